@@ -1,23 +1,31 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 
+	"toller-server/modules/audit"
 	"toller-server/modules/auth"
 	"toller-server/modules/channels"
 	"toller-server/modules/chat"
 	"toller-server/modules/dms"
 	"toller-server/modules/friends"
+	"toller-server/modules/permissions"
+	"toller-server/modules/presence"
+	"toller-server/modules/privacy"
 	"toller-server/modules/teams"
 	"toller-server/modules/users"
+	"toller-server/pkg/mailer"
+	"toller-server/pkg/migrations"
 )
 
 func main() {
@@ -34,13 +42,6 @@ func main() {
 		log.Fatal("DB_URL no está configurada.")
 	}
 
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		log.Fatal("JWT_SECRET no está configurada.")
-	}
-
-	log.Println("Variables de entorno cargadas correctamente")
-
 	db, err := sql.Open("postgres", dbURL)
 	if err != nil {
 		log.Fatal("Error al conectar a la DB:", err)
@@ -52,6 +53,52 @@ func main() {
 	}
 	log.Println("Conectado a la DB exitosamente")
 
+	// Subcomando: go run . migrate [up|down N|status]
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrateCommand(db, os.Args[2:]); err != nil {
+			log.Fatal("Error en migraciones:", err)
+		}
+		return
+	}
+
+	log.Println("Variables de entorno cargadas correctamente")
+
+	// Aplicar migraciones pendientes al arrancar (desactivable con AUTO_MIGRATE=false)
+	if os.Getenv("AUTO_MIGRATE") != "false" {
+		migrator, err := migrations.New(db)
+		if err != nil {
+			log.Fatal("Error al cargar migraciones:", err)
+		}
+		if _, err := migrator.Up(context.Background()); err != nil {
+			log.Fatal("Error al aplicar migraciones:", err)
+		}
+	}
+
+	// Claves de firma de los JWT, compartidas por todas las instancias a través de la DB
+	keyRing := &auth.KeyRing{
+		Repo:      &auth.SigningKeyRepository{DB: db},
+		Algorithm: os.Getenv("JWT_SIGNING_ALG"), // RS256 (por defecto) o EdDSA
+	}
+	if rotation := os.Getenv("JWT_KEY_ROTATION"); rotation != "" {
+		keyRing.RotationInterval, err = time.ParseDuration(rotation)
+		if err != nil {
+			log.Fatal("JWT_KEY_ROTATION inválida:", err)
+		}
+	}
+	if err := keyRing.Init(); err != nil {
+		log.Fatal("Error al inicializar las claves de firma:", err)
+	}
+	go keyRing.Run(context.Background())
+
+	// Única validación de tokens: la usan el middleware REST y el WebSocket
+	tokenVerifier := &auth.TokenVerifier{
+		Keys:           keyRing,
+		Sessions:       &auth.SessionRepository{DB: db},
+		PersonalTokens: &auth.PersonalTokenRepository{DB: db},
+		Issuer:         os.Getenv("JWT_ISSUER"),   // por defecto "toller"
+		Audience:       os.Getenv("JWT_AUDIENCE"), // por defecto "toller-api"
+	}
+
 	// Router principal
 	r := mux.NewRouter()
 
@@ -73,31 +120,150 @@ func main() {
 
 	// Módulo de Autenticación (público)
 	authRepo := &auth.UserRepository{DB: db}
-	authService := &auth.AuthService{Repo: authRepo}
-	authHandler := &auth.AuthHandler{Service: authService}
-	auth.RegisterRoutes(r, authHandler)
+	sessionRepo := tokenVerifier.Sessions
+	appURL := os.Getenv("APP_URL")
+	if appURL == "" {
+		appURL = "http://localhost:8080"
+	}
+	// IP del cliente: X-Forwarded-For solo cuenta si llega desde uno de estos proxies
+	proxies, err := auth.ParseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	// off (por defecto), restrict o required
+	verification, err := auth.ParseVerificationPolicy(os.Getenv("EMAIL_VERIFICATION"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	authService := &auth.AuthService{
+		Repo:          authRepo,
+		Tokens:        tokenVerifier,
+		Sessions:      sessionRepo,
+		Resets:        &auth.PasswordResetRepository{DB: db},
+		Verifications: &auth.EmailVerificationRepository{DB: db},
+		Mailer:        mailer.FromEnv(),
+		AppURL:        appURL,
+		Verification:  verification,
+		MFA:           &auth.MFARepository{DB: db},
+		// Exigir 2FA a los admins de teams
+		MFARequiredForAdmins: os.Getenv("MFA_REQUIRED_FOR_ADMINS") == "true",
+		OIDCProviders:        map[string]*auth.OIDCProvider{},
+		OIDC:                 &auth.OIDCRepository{DB: db},
+		// Demora progresiva y bloqueo temporal tras varios logins fallidos
+		Throttle: auth.NewLoginThrottle(&auth.LoginAttemptRepository{DB: db}),
+		// Tokens personales y cuentas de bot
+		PersonalTokens: tokenVerifier.PersonalTokens,
+		Bots:           &auth.BotRepository{DB: db},
+	}
+	// Login con un proveedor OpenID Connect (opcional, se activa con OIDC_ISSUER)
+	if provider := auth.OIDCProviderFromEnv(); provider != nil {
+		authService.OIDCProviders[provider.Config.Name] = provider
+		log.Printf("Login OIDC habilitado con %s (%s)", provider.Config.Name, provider.Config.Issuer)
+	}
+	// Contraseñas con argon2id; los hashes bcrypt existentes se actualizan en el próximo login
+	hasher, err := auth.Argon2idHasherFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	authService.Passwords = hasher
+	authService.PasswordPolicy = auth.NewPasswordPolicy()
+	if path := os.Getenv("PASSWORD_BLOCKLIST_FILE"); path != "" {
+		if err := authService.PasswordPolicy.LoadBlocklist(path); err != nil {
+			log.Fatal("Error al cargar la lista de contraseñas filtradas:", err)
+		}
+		log.Printf("Lista de contraseñas filtradas cargada (%d entradas)", len(authService.PasswordPolicy.Blocklist))
+	}
+	authHandler := &auth.AuthHandler{Service: authService, Proxies: proxies}
+	jwtMiddleware := auth.NewJWTMiddleware(tokenVerifier, proxies)
+	auth.RegisterRoutes(r, authHandler, jwtMiddleware)
+
+	// Registro de auditoría: teams, channels y permisos anotan cada cambio
+	auditLog := &audit.AuditLog{Repo: &audit.AuditRepository{DB: db}}
+
+	// Permisos: roles personalizados por team y overrides por canal. Teams,
+	// channels y el chat consultan el mismo authorizer
+	permissionsRepo := &permissions.PermissionRepository{DB: db}
+	authorizer := &permissions.Authorizer{Repo: permissionsRepo}
+	permissionsHandler := &permissions.PermissionHandler{
+		Service: &permissions.PermissionService{Repo: permissionsRepo, Authz: authorizer, Audit: auditLog},
+	}
+	permissions.RegisterRoutes(r, permissionsHandler, jwtMiddleware)
 
 	// Módulo de Teams (protegido)
 	teamsRepo := &teams.TeamRepository{DB: db}
-	teamsService := &teams.TeamService{Repo: teamsRepo}
+	teamsService := &teams.TeamService{
+		Repo:     teamsRepo,
+		Authz:    authorizer,
+		Audit:    auditLog,
+		Accounts: authService,
+		Mailer:   authService.Mailer,
+		AppURL:   appURL,
+	}
+	// Las invitaciones por email se reclaman al registrarse con esa dirección
+	authService.Invites = teamsService
+	// Los teams borrados se pueden restaurar durante TEAM_DELETION_GRACE (7 días por defecto)
+	if grace := os.Getenv("TEAM_DELETION_GRACE"); grace != "" {
+		teamsService.DeletionGrace, err = time.ParseDuration(grace)
+		if err != nil {
+			log.Fatal("TEAM_DELETION_GRACE inválida:", err)
+		}
+	}
+	go teamsService.RunPurge(context.Background())
 	teamsHandler := &teams.TeamHandler{Service: teamsService}
-	teams.RegisterRoutes(r, teamsHandler, auth.JWTMiddleware)
+	teams.RegisterRoutes(r, teamsHandler, jwtMiddleware)
 
 	// Módulo de Channels (protegido)
 	channelsRepo := &channels.ChannelRepository{DB: db}
-	channelsService := &channels.ChannelService{Repo: channelsRepo}
+	channelsService := &channels.ChannelService{Repo: channelsRepo, Authz: authorizer, Audit: auditLog}
 	channelsHandler := &channels.ChannelHandler{Service: channelsService}
-	channels.RegisterRoutes(r, channelsHandler, auth.JWTMiddleware)
+	channels.RegisterRoutes(r, channelsHandler, jwtMiddleware)
+	// Cada team nuevo arranca con #general y los miembros nuevos entran a los canales por defecto
+	teamsService.Channels = channelsService
 
 	// Módulo de Chat (WebSocket)
 	hub := chat.NewHub()
-	chatHandler := chat.NewHandler(db, jwtSecret, hub)
+	chatHandler := chat.NewHandler(db, tokenVerifier, hub)
+	chatHandler.Authz = authorizer
 	r.HandleFunc("/ws/channel/{channel_id}", chatHandler.ServeWS)
 
+	// Presencia (online/away/offline) derivada de las conexiones WebSocket
+	presenceService := &presence.PresenceService{
+		Repo:      &presence.PresenceRepository{DB: db},
+		Publisher: hub,
+	}
+	if awayAfter := os.Getenv("PRESENCE_AWAY_AFTER"); awayAfter != "" {
+		presenceService.AwayAfter, err = time.ParseDuration(awayAfter)
+		if err != nil {
+			log.Fatal("PRESENCE_AWAY_AFTER inválida:", err)
+		}
+	}
+	go presenceService.Run(context.Background())
+	chatHandler.Presence = presenceService
+	presence.RegisterRoutes(r, &presence.PresenceHandler{Service: presenceService}, jwtMiddleware)
+
 	// Otros Módulos (protegidos)
-	dms.RegisterDMSRoutes(r, db)
-	users.RegisterUserRoutes(r, db)
-	friends.RegisterFriendRoutes(r, db)
+	dms.RegisterDMSRoutes(r, db, jwtMiddleware)
+	usersHandler := users.NewUserHandler(db)
+	// Los cambios de estado personalizado se publican por los WebSockets del Hub
+	usersHandler.Service.Publisher = hub
+	go usersHandler.Service.RunStatusExpiry(context.Background())
+	users.RegisterUserRoutes(r, usersHandler, jwtMiddleware)
+	friends.RegisterFriendRoutes(r, db, jwtMiddleware)
+
+	// Privacidad: exportación de datos y baja de cuenta con período de gracia
+	exportDir := os.Getenv("EXPORT_DIR")
+	if exportDir == "" {
+		exportDir = "exports"
+	}
+	privacyService := privacy.NewPrivacyService(db, usersHandler.Service, authService, exportDir)
+	if grace := os.Getenv("ACCOUNT_DELETION_GRACE"); grace != "" {
+		privacyService.DeletionGrace, err = time.ParseDuration(grace)
+		if err != nil {
+			log.Fatal("ACCOUNT_DELETION_GRACE inválida:", err)
+		}
+	}
+	go privacyService.Run(context.Background())
+	privacy.RegisterRoutes(r, &privacy.PrivacyHandler{Service: privacyService}, jwtMiddleware)
 
 	// Servir archivos estáticos
 	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
@@ -0,0 +1,113 @@
+package audit
+
+import (
+	"encoding/base64"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"reflect"
+	"strconv"
+
+	"toller-server/modules/auth"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// AuditLog records what happens in teams and answers queries about it. The
+// services that change teams, channels or memberships call Record after each
+// successful change.
+type AuditLog struct {
+	Repo *AuditRepository
+}
+
+// Record appends an entry. A failure does not undo the action it describes:
+// if the entry can't be stored as is, it is stored again without the request
+// metadata, so that the action is still on record.
+func (a *AuditLog) Record(e Entry) {
+	if e.Changes == nil {
+		e.Changes = map[string]Change{}
+	}
+	err := a.Repo.Insert(&e)
+	if err != nil && e.Meta != (Meta{}) {
+		log.Printf("[AUDIT] Error recording %s on team %d, retrying without request metadata: %v", e.Action, e.TeamID, err)
+		e.Meta = Meta{}
+		err = a.Repo.Insert(&e)
+	}
+	if err != nil {
+		log.Printf("[AUDIT] Error recording %s on team %d: %v", e.Action, e.TeamID, err)
+	}
+}
+
+// List returns a page of the audit log of a team. The caller checks that the
+// user may see it.
+func (a *AuditLog) List(q Query) (*Page, error) {
+	if q.Limit <= 0 {
+		q.Limit = defaultPageSize
+	}
+	if q.Limit > maxPageSize {
+		q.Limit = maxPageSize
+	}
+
+	var beforeID int64
+	if q.Cursor != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		beforeID, err = strconv.ParseInt(string(raw), 10, 64)
+		if err != nil || beforeID <= 0 {
+			return nil, ErrInvalidCursor
+		}
+	}
+
+	entries, err := a.Repo.List(q, beforeID, q.Limit+1)
+	if err != nil {
+		return nil, err
+	}
+	page := &Page{Entries: entries}
+	if len(entries) > q.Limit {
+		page.Entries = entries[:q.Limit]
+		last := page.Entries[q.Limit-1].ID
+		page.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(last, 10)))
+	}
+	return page, nil
+}
+
+// Diff returns the fields whose value differs between before and after. Pass
+// nil as before for something created and nil as after for something deleted.
+func Diff(before, after map[string]interface{}) map[string]Change {
+	changes := map[string]Change{}
+	for field, value := range after {
+		if old, ok := before[field]; !ok || !reflect.DeepEqual(old, value) {
+			changes[field] = Change{Before: before[field], After: value}
+		}
+	}
+	for field, old := range before {
+		if _, ok := after[field]; !ok {
+			changes[field] = Change{Before: old}
+		}
+	}
+	return changes
+}
+
+// MetaFromRequest takes the client address, user agent and credentials that
+// the auth middleware left on an authenticated request. An address that
+// doesn't parse as an IP is left out.
+func MetaFromRequest(r *http.Request) Meta {
+	client, _ := auth.ClientInfoFromContext(r.Context())
+	meta := Meta{UserAgent: client.UserAgent}
+	if ip := net.ParseIP(client.IPAddress); ip != nil {
+		meta.IPAddress = ip.String()
+	}
+	if claims, ok := auth.ClaimsFromContext(r.Context()); ok {
+		meta.SessionID = claims.SessionID
+		meta.TokenID = claims.TokenID
+	}
+	return meta
+}
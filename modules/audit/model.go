@@ -0,0 +1,101 @@
+package audit
+
+import (
+	"time"
+
+	"toller-server/modules/users"
+)
+
+// Actions recorded in the audit log
+const (
+	TeamCreate   = "team.create"
+	TeamUpdate   = "team.update"
+	TeamDelete   = "team.delete"
+	TeamRestore  = "team.restore"
+	TeamTransfer = "team.transfer"
+
+	MemberAdd         = "member.add"
+	MemberRemove      = "member.remove"
+	MemberLeave       = "member.leave"
+	MemberJoin        = "member.join" // through an invite or an open team
+	MemberRoleUpdate  = "member.role_update"
+	MemberRolesUpdate = "member.roles_update" // custom roles
+
+	InviteCreate = "invite.create"
+	InviteRevoke = "invite.revoke"
+
+	JoinRequestApprove = "join_request.approve"
+	JoinRequestReject  = "join_request.reject"
+
+	ChannelCreate       = "channel.create"
+	ChannelUpdate       = "channel.update"
+	ChannelDelete       = "channel.delete"
+	ChannelMemberAdd    = "channel.member_add"
+	ChannelMemberRemove = "channel.member_remove"
+
+	RoleCreate = "role.create"
+	RoleUpdate = "role.update"
+	RoleDelete = "role.delete"
+
+	OverrideSet    = "override.set"
+	OverrideDelete = "override.delete"
+)
+
+// Target types
+const (
+	TargetTeam    = "team"
+	TargetUser    = "user"
+	TargetInvite  = "invite"
+	TargetChannel = "channel"
+	TargetRole    = "role"
+)
+
+// Meta is the request an action came from. It is empty for the actions the
+// server does on its own.
+type Meta struct {
+	IPAddress string `json:"ip_address,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+	SessionID int    `json:"session_id,omitempty"`
+	TokenID   int    `json:"token_id,omitempty"` // set when a personal access token was used
+}
+
+// Change is the value of a field before and after an action. Before is nil
+// for created things and After is nil for deleted ones.
+type Change struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Entry is one row of the audit log. ActorID is 0 for system actions and
+// TargetID is 0 when the target is the team itself.
+type Entry struct {
+	ID         int64              `json:"id"`
+	TeamID     int                `json:"team_id"`
+	ActorID    int                `json:"actor_id,omitempty"`
+	Actor      *users.UserSummary `json:"actor,omitempty"`
+	Action     string             `json:"action"`
+	TargetType string             `json:"target_type"`
+	TargetID   int                `json:"target_id,omitempty"`
+	Changes    map[string]Change  `json:"changes"`
+	Meta       Meta               `json:"meta"`
+	CreatedAt  time.Time          `json:"created_at"`
+}
+
+// Query filters a page of the audit log of a team. Zero values don't filter.
+type Query struct {
+	TeamID     int
+	Actions    []string
+	ActorID    int
+	TargetType string
+	TargetID   int
+	Since      *time.Time
+	Until      *time.Time
+	Cursor     string
+	Limit      int
+}
+
+// Page is one page of the audit log, newest first; NextCursor is empty on the last page.
+type Page struct {
+	Entries    []Entry `json:"entries"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
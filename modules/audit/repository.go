@@ -0,0 +1,102 @@
+package audit
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"toller-server/modules/users"
+
+	"github.com/lib/pq"
+)
+
+type AuditRepository struct {
+	DB *sql.DB
+}
+
+// Insert appends an entry to the audit log.
+func (r *AuditRepository) Insert(e *Entry) error {
+	changes, err := json.Marshal(e.Changes)
+	if err != nil {
+		return err
+	}
+	return r.DB.QueryRow(`
+		INSERT INTO audit_log (team_id, actor_id, action, target_type, target_id, changes,
+		                       ip_address, user_agent, session_id, token_id)
+		VALUES ($1, NULLIF($2, 0), $3, $4, NULLIF($5, 0), $6,
+		        NULLIF($7, ''), NULLIF($8, ''), NULLIF($9, 0), NULLIF($10, 0))
+		RETURNING id, created_at`,
+		e.TeamID, e.ActorID, e.Action, e.TargetType, e.TargetID, changes,
+		e.Meta.IPAddress, e.Meta.UserAgent, e.Meta.SessionID, e.Meta.TokenID,
+	).Scan(&e.ID, &e.CreatedAt)
+}
+
+// List returns up to limit entries of a team matching the query, newest
+// first, starting after the entry with ID beforeID (0 = from the newest).
+func (r *AuditRepository) List(q Query, beforeID int64, limit int) ([]Entry, error) {
+	conditions := []string{"a.team_id = $1"}
+	args := []interface{}{q.TeamID}
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if beforeID > 0 {
+		add("a.id < $%d", beforeID)
+	}
+	if len(q.Actions) > 0 {
+		add("a.action = ANY($%d)", pq.Array(q.Actions))
+	}
+	if q.ActorID > 0 {
+		add("a.actor_id = $%d", q.ActorID)
+	}
+	if q.TargetType != "" {
+		add("a.target_type = $%d", q.TargetType)
+	}
+	if q.TargetID > 0 {
+		add("a.target_id = $%d", q.TargetID)
+	}
+	if q.Since != nil {
+		add("a.created_at >= $%d", *q.Since)
+	}
+	if q.Until != nil {
+		add("a.created_at < $%d", *q.Until)
+	}
+	args = append(args, limit)
+
+	rows, err := r.DB.Query(`
+		SELECT a.id, a.team_id, COALESCE(a.actor_id, 0), a.action, a.target_type, COALESCE(a.target_id, 0),
+		       a.changes, COALESCE(a.ip_address, ''), COALESCE(a.user_agent, ''),
+		       COALESCE(a.session_id, 0), COALESCE(a.token_id, 0), a.created_at, `+users.SummaryColumns("u")+`
+		FROM audit_log a
+		LEFT JOIN users u ON u.id = a.actor_id
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY a.id DESC
+		LIMIT $`+fmt.Sprint(len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []Entry{}
+	for rows.Next() {
+		var e Entry
+		var changes []byte
+		var actor users.UserSummary
+		dest := append([]interface{}{
+			&e.ID, &e.TeamID, &e.ActorID, &e.Action, &e.TargetType, &e.TargetID,
+			&changes, &e.Meta.IPAddress, &e.Meta.UserAgent, &e.Meta.SessionID, &e.Meta.TokenID, &e.CreatedAt,
+		}, actor.ScanDest()...)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(changes, &e.Changes); err != nil {
+			return nil, err
+		}
+		if actor.ID != 0 {
+			e.Actor = &actor
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// TrustedProxies son las redes de los proxies cuyo X-Forwarded-For se acepta.
+// Vacía (por defecto), la IP del cliente es siempre la de la conexión.
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies arma la lista a partir de IPs o CIDRs separados por comas
+// (TRUSTED_PROXIES).
+func ParseTrustedProxies(list string) (TrustedProxies, error) {
+	var proxies TrustedProxies
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("TRUSTED_PROXIES inválido: %q", entry)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+// ClientInfo extrae user agent e IP del request
+func (p TrustedProxies) ClientInfo(r *http.Request) ClientInfo {
+	return ClientInfo{UserAgent: r.UserAgent(), IPAddress: p.clientIP(r)}
+}
+
+func (p TrustedProxies) contains(ip net.IP) bool {
+	for _, network := range p {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP devuelve la IP del cliente normalizada, o "" si no es una IP válida.
+// X-Forwarded-For solo se tiene en cuenta si el request llega desde un proxy de
+// confianza; se recorre de derecha a izquierda saltando los demás proxies, así
+// lo que agregue el cliente a la izquierda no cuenta.
+func (p TrustedProxies) clientIP(r *http.Request) string {
+	host := r.RemoteAddr
+	if h, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		host = h
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return ""
+	}
+
+	if p.contains(ip) {
+		hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+		for i := len(hops) - 1; i >= 0 && p.contains(ip); i-- {
+			hop := net.ParseIP(strings.TrimSpace(hops[i]))
+			if hop == nil {
+				break
+			}
+			ip = hop
+		}
+	}
+	return ip.String()
+}
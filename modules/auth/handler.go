@@ -2,13 +2,17 @@ package auth
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
 type AuthHandler struct {
 	Service *AuthService
+	Proxies TrustedProxies // de quiénes se acepta X-Forwarded-For para la IP del cliente
 }
 
 func (h *AuthHandler) RegisterHandler(w http.ResponseWriter, r *http.Request) {
@@ -25,7 +29,11 @@ func (h *AuthHandler) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 
 	user, err := h.Service.Register(req.Username, req.Email, req.Password)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		if IsPasswordPolicyError(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
 		return
 	}
 
@@ -44,27 +52,618 @@ func (h *AuthHandler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, user, err := h.Service.Login(req.Email, req.Password)
+	result, err := h.Service.Login(req.Email, req.Password, h.Proxies.ClientInfo(r))
+	if err != nil {
+		var locked *AccountLockedError
+		switch {
+		case errors.As(err, &locked):
+			writeLocked(w, locked)
+		case err == ErrEmailNotVerified:
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case err == ErrInvalidCredentials:
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeLoginResult(w, result)
+}
+
+// POST /auth/login/mfa - Segundo paso del login con 2FA activo
+func (h *AuthHandler) LoginMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ChallengeToken == "" || (req.Code == "" && req.RecoveryCode == "") {
+		http.Error(w, "request inválido", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.Service.CompleteMFALogin(req.ChallengeToken, req.Code, req.RecoveryCode, h.Proxies.ClientInfo(r))
+	if err != nil {
+		var locked *AccountLockedError
+		switch {
+		case errors.As(err, &locked):
+			writeLocked(w, locked)
+		case err == ErrInvalidMFAChallenge || err == ErrInvalidMFACode || err == ErrMFANotEnabled:
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeLoginResult(w, result)
+}
+
+// GET /auth/oidc/{provider}/login - Redirige al proveedor de identidad.
+// Con ?redirect=false devuelve la URL en JSON (para clientes que abren el navegador por su cuenta).
+func (h *AuthHandler) OIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	authURL, err := h.Service.StartOIDCLogin(mux.Vars(r)["provider"])
+	if err != nil {
+		if err == ErrUnknownOIDCProvider {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+		}
+		return
+	}
+
+	if r.URL.Query().Get("redirect") == "false" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"authorization_url": authURL})
+		return
+	}
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// GET /auth/oidc/{provider}/callback - El proveedor vuelve con code y state
+func (h *AuthHandler) OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if providerErr := query.Get("error"); providerErr != "" {
+		http.Error(w, "el proveedor rechazó el login: "+providerErr, http.StatusUnauthorized)
+		return
+	}
+	if query.Get("code") == "" || query.Get("state") == "" {
+		http.Error(w, "request inválido", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.Service.CompleteOIDCLogin(mux.Vars(r)["provider"], query.Get("state"), query.Get("code"), h.Proxies.ClientInfo(r))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		switch err {
+		case ErrUnknownOIDCProvider:
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case ErrInvalidOIDCState, ErrInvalidIDToken:
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		case ErrOIDCEmailConflict:
+			http.Error(w, err.Error(), http.StatusConflict)
+		case ErrEmailNotVerified, ErrOIDCEmailMissing:
+			http.Error(w, err.Error(), http.StatusForbidden)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeLoginResult(w, result)
+}
+
+func writeLoginResult(w http.ResponseWriter, result *LoginResult) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if result.MFAChallenge != "" {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"mfa_required":    true,
+			"challenge_token": result.MFAChallenge,
+			"expires_in":      int(mfaChallengeTTL.Seconds()),
+		})
 		return
 	}
 
 	resp := map[string]interface{}{
-		"token": token,
+		"token":         result.Tokens.AccessToken,
+		"refresh_token": result.Tokens.RefreshToken,
+		"expires_in":    result.Tokens.ExpiresIn,
 		"user": map[string]interface{}{
-			"id":       user.ID,
-			"username": user.Username,
-			"email":    user.Email,
+			"id":             result.User.ID,
+			"username":       result.User.Username,
+			"email":          result.User.Email,
+			"email_verified": result.User.EmailVerified,
 		},
 	}
+	if result.MFAEnrollmentRequired {
+		resp["mfa_enrollment_required"] = true
+	}
 	json.NewEncoder(w).Encode(resp)
 }
 
+func (h *AuthHandler) RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(w, "request inválido", http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := h.Service.Refresh(req.RefreshToken, h.Proxies.ClientInfo(r))
+	if err != nil {
+		if err == ErrInvalidRefreshToken || err == ErrSessionRevoked {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	json.NewEncoder(w).Encode(tokens)
+}
+
+func (h *AuthHandler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	sessionID, ok := SessionIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "sesión no encontrada", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.Service.Logout(sessionID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /auth/password/forgot - Pedir un enlace de recuperación
+func (h *AuthHandler) ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		http.Error(w, "request inválido", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Service.ForgotPassword(req.Email); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Misma respuesta exista o no la cuenta
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Si el email está registrado, te enviamos instrucciones para recuperar la contraseña",
+	})
+}
+
+// POST /auth/password/reset - Elegir una nueva contraseña con el token recibido por email
+func (h *AuthHandler) ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "request inválido", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Service.ResetPassword(req.Token, req.Password); err != nil {
+		if err == ErrInvalidResetToken || IsPasswordPolicyError(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /auth/verify (o GET /auth/verify?token=... desde el enlace del email)
+func (h *AuthHandler) VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if r.Method == http.MethodPost {
+		var req struct {
+			Token string `json:"token"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err == nil && req.Token != "" {
+			token = req.Token
+		}
+	}
+	if token == "" {
+		http.Error(w, "request inválido", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Service.VerifyEmail(token); err != nil {
+		if err == ErrInvalidVerification {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Email verificado"})
+}
+
+// POST /auth/verify/resend - Reenviar el email de verificación
+func (h *AuthHandler) ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		http.Error(w, "request inválido", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Service.ResendVerification(req.Email); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Si la cuenta existe y no está verificada, te reenviamos el email",
+	})
+}
+
+// POST /auth/mfa/enroll - Generar el secreto TOTP y el URI para el QR
+func (h *AuthHandler) EnrollMFAHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := UserIDFromContext(r.Context())
+
+	enrollment, err := h.Service.EnrollMFA(userID)
+	if err != nil {
+		if err == ErrMFAAlreadyEnabled {
+			http.Error(w, err.Error(), http.StatusConflict)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(enrollment)
+}
+
+// POST /auth/mfa/confirm - Activar el 2FA con el primer código de la app
+func (h *AuthHandler) ConfirmMFAHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := UserIDFromContext(r.Context())
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "request inválido", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := h.Service.ConfirmMFA(userID, req.Code)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes})
+}
+
+// POST /auth/mfa/recovery-codes - Regenerar los códigos de recuperación
+func (h *AuthHandler) RegenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := UserIDFromContext(r.Context())
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "request inválido", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := h.Service.RegenerateRecoveryCodes(userID, req.Code)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes})
+}
+
+// POST /auth/mfa/disable - Desactivar el 2FA
+func (h *AuthHandler) DisableMFAHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := UserIDFromContext(r.Context())
+
+	var req struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.Code == "" && req.RecoveryCode == "") {
+		http.Error(w, "request inválido", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Service.DisableMFA(userID, req.Code, req.RecoveryCode); err != nil {
+		writeMFAError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeMFAError(w http.ResponseWriter, err error) {
+	var locked *AccountLockedError
+	switch {
+	case errors.As(err, &locked):
+		writeLocked(w, locked)
+	case err == ErrInvalidMFACode:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case err == ErrMFANotEnabled, err == ErrMFAAlreadyEnabled:
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// writeLocked responde 429 con Retry-After hasta el fin del bloqueo
+func writeLocked(w http.ResponseWriter, locked *AccountLockedError) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(locked.Until).Seconds())+1))
+	http.Error(w, locked.Error(), http.StatusTooManyRequests)
+}
+
+// GET /auth/sessions - Sesiones activas del usuario, una por dispositivo
+func (h *AuthHandler) ListSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := UserIDFromContext(r.Context())
+	sessionID, _ := SessionIDFromContext(r.Context())
+
+	sessions, err := h.Service.ListSessions(userID, sessionID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if sessions == nil {
+		sessions = []Session{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// DELETE /auth/sessions/{id} - Cerrar la sesión de un dispositivo
+func (h *AuthHandler) RevokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := UserIDFromContext(r.Context())
+	sessionID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "id de sesión inválido", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Service.RevokeSession(userID, sessionID); err != nil {
+		if err == ErrSessionNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /auth/sessions/revoke-others - Cerrar sesión en todos los demás dispositivos
+func (h *AuthHandler) RevokeOtherSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := UserIDFromContext(r.Context())
+	sessionID, _ := SessionIDFromContext(r.Context())
+
+	revoked, err := h.Service.RevokeOtherSessions(userID, sessionID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int64{"revoked": revoked})
+}
+
+// botIDParam lee el ?bot_id= opcional de las rutas de tokens (0 = tokens propios)
+func botIDParam(r *http.Request) (int, error) {
+	raw := r.URL.Query().Get("bot_id")
+	if raw == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(raw)
+}
+
+func writeTokenError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrTokenNameRequired), errors.Is(err, ErrTokenNameTooLong),
+		errors.Is(err, ErrScopesRequired), errors.Is(err, ErrUnknownScope),
+		errors.Is(err, ErrInvalidTokenExpiry), errors.Is(err, ErrBotUsernameRequired):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrTokenNotFound), errors.Is(err, ErrBotNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrNotTeamAdmin), errors.Is(err, ErrMFARequired):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, ErrBotUsernameTaken):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// POST /auth/tokens - Crear un token personal (propio o, con bot_id, de un bot)
+func (h *AuthHandler) CreateTokenHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := UserIDFromContext(r.Context())
+	var req struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"` // 0 = no expira
+		BotID         int      `json:"bot_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Formato de solicitud inválido", http.StatusBadRequest)
+		return
+	}
+
+	token, err := h.Service.CreatePersonalToken(userID, req.BotID, req.Name, req.Scopes, req.ExpiresInDays)
+	if err != nil {
+		writeTokenError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(token)
+}
+
+// GET /auth/tokens - Tokens personales vigentes (sin el valor, solo el prefijo)
+func (h *AuthHandler) ListTokensHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := UserIDFromContext(r.Context())
+	botID, err := botIDParam(r)
+	if err != nil {
+		http.Error(w, "bot_id inválido", http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := h.Service.ListPersonalTokens(userID, botID)
+	if err != nil {
+		writeTokenError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// DELETE /auth/tokens/{id} - Revocar un token personal
+func (h *AuthHandler) RevokeTokenHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := UserIDFromContext(r.Context())
+	tokenID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "id de token inválido", http.StatusBadRequest)
+		return
+	}
+	botID, err := botIDParam(r)
+	if err != nil {
+		http.Error(w, "bot_id inválido", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Service.RevokePersonalToken(userID, botID, tokenID); err != nil {
+		writeTokenError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /auth/bots - Crear una cuenta de bot (propia o, con team_id, del team)
+func (h *AuthHandler) CreateBotHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := UserIDFromContext(r.Context())
+	var req struct {
+		Username string `json:"username"`
+		TeamID   int    `json:"team_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Formato de solicitud inválido", http.StatusBadRequest)
+		return
+	}
+
+	bot, err := h.Service.CreateBot(userID, req.Username, req.TeamID)
+	if err != nil {
+		writeTokenError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(bot)
+}
+
+// GET /auth/bots - Bots propios y de los teams que administra el usuario
+func (h *AuthHandler) ListBotsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := UserIDFromContext(r.Context())
+
+	bots, err := h.Service.ListBots(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bots)
+}
+
+// DELETE /auth/bots/{id} - Borrar un bot y todos sus tokens
+func (h *AuthHandler) DeleteBotHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := UserIDFromContext(r.Context())
+	botID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "id de bot inválido", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Service.DeleteBot(userID, botID); err != nil {
+		writeTokenError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /.well-known/jwks.json - Claves públicas para que otros servicios validen nuestros tokens
+func (h *AuthHandler) JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	// Las claves nuevas se publican antes de firmar, así que alcanza con un cache corto
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(h.Service.Tokens.Keys.JWKS())
+}
+
 // Registrar rutas
-func RegisterRoutes(r *mux.Router, handler *AuthHandler) {
+func RegisterRoutes(r *mux.Router, handler *AuthHandler, authMiddleware func(http.Handler) http.Handler) {
+	r.HandleFunc("/.well-known/jwks.json", handler.JWKSHandler).Methods("GET")
 
 	api := r.PathPrefix("/api/v1/auth").Subrouter()
 	api.HandleFunc("/register", handler.RegisterHandler).Methods("POST")
 	api.HandleFunc("/login", handler.LoginHandler).Methods("POST")
+	api.HandleFunc("/login/mfa", handler.LoginMFAHandler).Methods("POST")
+	api.HandleFunc("/refresh", handler.RefreshHandler).Methods("POST")
+	api.HandleFunc("/password/forgot", handler.ForgotPasswordHandler).Methods("POST")
+	api.HandleFunc("/password/reset", handler.ResetPasswordHandler).Methods("POST")
+	api.HandleFunc("/verify", handler.VerifyEmailHandler).Methods("GET", "POST")
+	api.HandleFunc("/verify/resend", handler.ResendVerificationHandler).Methods("POST")
+	api.HandleFunc("/oidc/{provider}/login", handler.OIDCLoginHandler).Methods("GET")
+	api.HandleFunc("/oidc/{provider}/callback", handler.OIDCCallbackHandler).Methods("GET")
+
+	// Rutas que requieren un access token válido. Son de gestión de la cuenta,
+	// así que no aceptan tokens personales.
+	protected := r.PathPrefix("/api/v1/auth").Subrouter()
+	protected.Use(authMiddleware)
+	protected.HandleFunc("/logout", SessionOnly(handler.LogoutHandler)).Methods("POST")
+	protected.HandleFunc("/sessions", SessionOnly(handler.ListSessionsHandler)).Methods("GET")
+	protected.HandleFunc("/sessions/revoke-others", SessionOnly(handler.RevokeOtherSessionsHandler)).Methods("POST")
+	protected.HandleFunc("/sessions/{id:[0-9]+}", SessionOnly(handler.RevokeSessionHandler)).Methods("DELETE")
+	protected.HandleFunc("/mfa/enroll", SessionOnly(handler.EnrollMFAHandler)).Methods("POST")
+	protected.HandleFunc("/mfa/confirm", SessionOnly(handler.ConfirmMFAHandler)).Methods("POST")
+	protected.HandleFunc("/mfa/recovery-codes", SessionOnly(handler.RegenerateRecoveryCodesHandler)).Methods("POST")
+	protected.HandleFunc("/mfa/disable", SessionOnly(handler.DisableMFAHandler)).Methods("POST")
+	protected.HandleFunc("/tokens", SessionOnly(handler.CreateTokenHandler)).Methods("POST")
+	protected.HandleFunc("/tokens", SessionOnly(handler.ListTokensHandler)).Methods("GET")
+	protected.HandleFunc("/tokens/{id:[0-9]+}", SessionOnly(handler.RevokeTokenHandler)).Methods("DELETE")
+	protected.HandleFunc("/bots", SessionOnly(handler.CreateBotHandler)).Methods("POST")
+	protected.HandleFunc("/bots", SessionOnly(handler.ListBotsHandler)).Methods("GET")
+	protected.HandleFunc("/bots/{id:[0-9]+}", SessionOnly(handler.DeleteBotHandler)).Methods("DELETE")
 }
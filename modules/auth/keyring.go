@@ -0,0 +1,312 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+
+	defaultKeyRotation = 30 * 24 * time.Hour
+	// Una clave nueva se publica en el JWKS antes de empezar a firmar,
+	// para que los servicios que cachean el JWKS ya la conozcan.
+	keyPrepublish = 10 * time.Minute
+	// Una clave reemplazada se sigue publicando (y aceptando) este tiempo
+	keyRetention = 24 * time.Hour
+	// Cada cuánto se recargan las claves de la DB y se revisa si toca rotar
+	keyRefreshInterval = time.Minute
+)
+
+var ErrUnknownSigningKey = errors.New("clave de firma desconocida")
+
+// KeyRing firma los JWT con claves asimétricas guardadas en signing_keys.
+// Todas las instancias comparten las claves a través de la DB: la que rota
+// inserta la nueva y las demás la levantan en la siguiente recarga.
+type KeyRing struct {
+	Repo *SigningKeyRepository
+	// Algoritmo de las claves nuevas: RS256 (por defecto) o EdDSA
+	Algorithm string
+	// Cada cuánto se genera una clave nueva (por defecto 30 días)
+	RotationInterval time.Duration
+
+	mu       sync.RWMutex
+	keys     []*SigningKey // ordenadas por ActivatesAt
+	byID     map[string]*SigningKey
+	loadedAt time.Time
+}
+
+// Init carga las claves y crea la primera si la tabla está vacía o la actual ya venció su período
+func (k *KeyRing) Init() error {
+	if k.Algorithm == "" {
+		k.Algorithm = AlgRS256
+	}
+	if k.Algorithm != AlgRS256 && k.Algorithm != AlgEdDSA {
+		return fmt.Errorf("algoritmo de firma no soportado: %s", k.Algorithm)
+	}
+	if k.RotationInterval <= 0 {
+		k.RotationInterval = defaultKeyRotation
+	}
+	if err := k.Reload(); err != nil {
+		return err
+	}
+	return k.RotateIfDue()
+}
+
+// Run recarga las claves y rota cuando corresponde, hasta que se cancele el contexto
+func (k *KeyRing) Run(ctx context.Context) {
+	ticker := time.NewTicker(keyRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := k.Reload(); err != nil {
+				log.Printf("[AUTH] Error recargando claves de firma: %v", err)
+				continue
+			}
+			if err := k.RotateIfDue(); err != nil {
+				log.Printf("[AUTH] Error rotando la clave de firma: %v", err)
+			}
+		}
+	}
+}
+
+// Reload lee de la DB las claves vigentes
+func (k *KeyRing) Reload() error {
+	stored, err := k.Repo.ListKeys()
+	if err != nil {
+		return err
+	}
+
+	keys := make([]*SigningKey, 0, len(stored))
+	byID := make(map[string]*SigningKey, len(stored))
+	for i := range stored {
+		key := &stored[i]
+		signer, err := parsePrivateKey(key.PrivateKeyPEM)
+		if err != nil {
+			return fmt.Errorf("clave %s: %w", key.ID, err)
+		}
+		key.signer = signer
+		keys = append(keys, key)
+		byID[key.ID] = key
+	}
+
+	k.mu.Lock()
+	k.keys, k.byID, k.loadedAt = keys, byID, time.Now()
+	k.mu.Unlock()
+	return nil
+}
+
+// RotateIfDue genera una clave nueva si la más reciente tiene más de RotationInterval
+func (k *KeyRing) RotateIfDue() error {
+	k.mu.RLock()
+	var latest *SigningKey
+	if len(k.keys) > 0 {
+		latest = k.keys[len(k.keys)-1]
+	}
+	k.mu.RUnlock()
+
+	if latest != nil && time.Since(latest.CreatedAt) < k.RotationInterval {
+		return nil
+	}
+	// Otra instancia puede haber rotado desde la última recarga
+	return k.rotate(time.Now().Add(-k.RotationInterval))
+}
+
+// Rotate genera una clave nueva sin esperar a que venza el intervalo. Si todavía no
+// hay ninguna clave, la nueva firma de inmediato; si no, primero se publica en el
+// JWKS y empieza a firmar después de keyPrepublish.
+func (k *KeyRing) Rotate() error {
+	return k.rotate(time.Now())
+}
+
+func (k *KeyRing) rotate(createdBefore time.Time) error {
+	k.mu.RLock()
+	empty := len(k.keys) == 0
+	k.mu.RUnlock()
+
+	key, err := generateSigningKey(k.Algorithm)
+	if err != nil {
+		return err
+	}
+	key.ActivatesAt = time.Now()
+	if !empty {
+		key.ActivatesAt = key.ActivatesAt.Add(keyPrepublish)
+	}
+
+	rotated, err := k.Repo.Rotate(key, createdBefore, key.ActivatesAt.Add(keyRetention))
+	if err != nil {
+		return err
+	}
+	if rotated {
+		log.Printf("[AUTH] Nueva clave de firma %s (%s), activa desde %s", key.ID, key.Algorithm, key.ActivatesAt.Format(time.RFC3339))
+	}
+	return k.Reload()
+}
+
+// Sign firma los claims con la clave activa e incluye su kid en el header
+func (k *KeyRing) Sign(claims jwt.Claims) (string, error) {
+	key := k.activeKey()
+	if key == nil {
+		return "", errors.New("no hay una clave de firma activa")
+	}
+
+	token := jwt.NewWithClaims(signingMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.signer)
+}
+
+// Keyfunc resuelve la clave de verificación para jwt.Parse a partir del kid
+func (k *KeyRing) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, ErrUnknownSigningKey
+	}
+
+	key := k.lookup(kid)
+	if key == nil {
+		return nil, ErrUnknownSigningKey
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, jwt.ErrSignatureInvalid
+	}
+	return key.signer.Public(), nil
+}
+
+// ValidMethods son los algoritmos aceptados al verificar
+func (k *KeyRing) ValidMethods() []string {
+	return []string{AlgRS256, AlgEdDSA}
+}
+
+// JWKS devuelve las claves públicas vigentes en formato JSON Web Key Set
+func (k *KeyRing) JWKS() jwkSet {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	set := jwkSet{Keys: []jwk{}}
+	for _, key := range k.keys {
+		set.Keys = append(set.Keys, publicJWK(key))
+	}
+	return set
+}
+
+// activeKey es la clave activada más recientemente
+func (k *KeyRing) activeKey() *SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	now := time.Now()
+	for i := len(k.keys) - 1; i >= 0; i-- {
+		if !k.keys[i].ActivatesAt.After(now) {
+			return k.keys[i]
+		}
+	}
+	return nil
+}
+
+// lookup busca por kid; si no la conoce recarga (como mucho cada 10 segundos)
+// por si otra instancia acaba de rotar.
+func (k *KeyRing) lookup(kid string) *SigningKey {
+	k.mu.RLock()
+	key, ok := k.byID[kid]
+	stale := time.Since(k.loadedAt) > 10*time.Second
+	k.mu.RUnlock()
+	if ok || !stale {
+		return key
+	}
+
+	if err := k.Reload(); err != nil {
+		log.Printf("[AUTH] Error recargando claves de firma: %v", err)
+		return nil
+	}
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.byID[kid]
+}
+
+func signingMethod(alg string) jwt.SigningMethod {
+	if alg == AlgEdDSA {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
+
+func generateSigningKey(alg string) (*SigningKey, error) {
+	var signer crypto.Signer
+	var err error
+	switch alg {
+	case AlgEdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	case AlgRS256:
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	default:
+		return nil, fmt.Errorf("algoritmo de firma no soportado: %s", alg)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(signer)
+	if err != nil {
+		return nil, err
+	}
+	kid := make([]byte, 12)
+	if _, err := rand.Read(kid); err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{
+		ID:            base64.RawURLEncoding.EncodeToString(kid),
+		Algorithm:     alg,
+		PrivateKeyPEM: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		signer:        signer,
+	}, nil
+}
+
+func parsePrivateKey(pemData string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(pemData))
+	if block == nil {
+		return nil, errors.New("PEM inválido")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("tipo de clave no soportado")
+	}
+	return signer, nil
+}
+
+func publicJWK(key *SigningKey) jwk {
+	out := jwk{Kid: key.ID, Use: "sig", Alg: key.Algorithm}
+	switch pub := key.signer.Public().(type) {
+	case *rsa.PublicKey:
+		out.Kty = "RSA"
+		out.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		out.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		out.Kty = "OKP"
+		out.Crv = "Ed25519"
+		out.X = base64.RawURLEncoding.EncodeToString(pub)
+	}
+	return out
+}
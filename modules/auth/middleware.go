@@ -2,62 +2,49 @@ package auth
 
 import (
 	"context"
+	"log"
 	"net/http"
-	"os"
 	"strings"
-
-	"github.com/golang-jwt/jwt/v5"
 )
 
-// Middleware para verificar JWT
-func JWTMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Obtener el token del header Authorization
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, `{"error": "unauthorized", "message": "Token no proporcionado"}`, http.StatusUnauthorized)
-			return
-		}
-
-		// Formato esperado: "Bearer <token>"
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			http.Error(w, `{"error": "unauthorized", "message": "Formato de token inválido"}`, http.StatusUnauthorized)
-			return
-		}
-
-		tokenString := parts[1]
-
-		// Verificar y parsear el token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// Verificar que el método de firma sea el esperado
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrSignatureInvalid
+// NewJWTMiddleware crea el middleware que verifica el access token y que su sesión siga activa.
+// También deja en el contexto el user agent y la IP del cliente, resuelta con proxies
+func NewJWTMiddleware(verifier *TokenVerifier, proxies TrustedProxies) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Obtener el token del header Authorization
+			authHeader := r.Header.Get("Authorization")
+			if authHeader == "" {
+				http.Error(w, `{"error": "unauthorized", "message": "Token no proporcionado"}`, http.StatusUnauthorized)
+				return
 			}
-			return []byte(os.Getenv("JWT_SECRET")), nil
-		})
 
-		if err != nil || !token.Valid {
-			http.Error(w, `{"error": "unauthorized", "message": "Token inválido o expirado"}`, http.StatusUnauthorized)
-			return
-		}
-
-		// Extraer los claims
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			http.Error(w, `{"error": "unauthorized", "message": "Claims inválidos"}`, http.StatusUnauthorized)
-			return
-		}
+			// Formato esperado: "Bearer <token>"
+			parts := strings.Split(authHeader, " ")
+			if len(parts) != 2 || parts[0] != "Bearer" {
+				http.Error(w, `{"error": "unauthorized", "message": "Formato de token inválido"}`, http.StatusUnauthorized)
+				return
+			}
 
-		// Obtener el user_id del token
-		userID, ok := claims["user_id"].(float64) // JWT parsea números como float64
-		if !ok {
-			http.Error(w, `{"error": "unauthorized", "message": "User ID no encontrado en el token"}`, http.StatusUnauthorized)
-			return
-		}
+			claims, err := verifier.VerifyAccessToken(parts[1])
+			switch err {
+			case nil:
+			case ErrInvalidToken:
+				http.Error(w, `{"error": "unauthorized", "message": "Token inválido o expirado"}`, http.StatusUnauthorized)
+				return
+			case ErrSessionClosed:
+				http.Error(w, `{"error": "unauthorized", "message": "Sesión revocada o expirada"}`, http.StatusUnauthorized)
+				return
+			default:
+				log.Printf("[AUTH] Error verificando el token: %v", err)
+				http.Error(w, `{"error": "internal_error", "message": "No se pudo verificar la sesión"}`, http.StatusInternalServerError)
+				return
+			}
 
-		// Agregar el user_id al contexto de la request
-		ctx := context.WithValue(r.Context(), "user_id", int(userID))
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+			// Agregar los claims (user_id y sesión) y el cliente al contexto de la request
+			ctx := ContextWithClaims(r.Context(), claims)
+			ctx = context.WithValue(ctx, clientInfoKey, proxies.ClientInfo(r))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
 }
@@ -1,8 +1,134 @@
 package auth
 
+import (
+	"crypto"
+	"fmt"
+	"time"
+)
+
 type User struct {
-	ID       int    `json:"id"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	Password string `json:"-"`
+	ID            int    `json:"id"`
+	Username      string `json:"username"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Password      string `json:"-"`
+}
+
+// VerificationPolicy define qué puede hacer una cuenta con el email sin verificar.
+type VerificationPolicy string
+
+const (
+	VerificationOff      VerificationPolicy = "off"      // sin restricciones (valor por defecto)
+	VerificationRestrict VerificationPolicy = "restrict" // puede loguearse pero no crear teams
+	VerificationRequired VerificationPolicy = "required" // no puede loguearse hasta verificar
+)
+
+// ParseVerificationPolicy valida el valor de EMAIL_VERIFICATION; vacío equivale a off.
+func ParseVerificationPolicy(v string) (VerificationPolicy, error) {
+	switch p := VerificationPolicy(v); p {
+	case "":
+		return VerificationOff, nil
+	case VerificationOff, VerificationRestrict, VerificationRequired:
+		return p, nil
+	}
+	return "", fmt.Errorf("EMAIL_VERIFICATION inválido (off, restrict o required): %q", v)
+}
+
+// Session representa un login activo; el refresh token solo se guarda hasheado.
+type Session struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	Current    bool       `json:"current"` // true si es la sesión del token que hace la consulta
+}
+
+// ClientInfo identifica el dispositivo desde el que se hace login o refresh.
+type ClientInfo struct {
+	UserAgent string
+	IPAddress string
+}
+
+// TokenPair es lo que recibe el cliente al hacer login o refresh.
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"` // segundos de vida del access token
+}
+
+// MFAConfig es el estado del segundo factor TOTP de un usuario.
+type MFAConfig struct {
+	UserID       int
+	Secret       string
+	Enabled      bool
+	LastUsedStep int64
+}
+
+// MFAEnrollment es lo que el cliente necesita para dar de alta la app de autenticación.
+type MFAEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+	QRPayload  string `json:"qr_payload"` // contenido a codificar en el QR
+}
+
+// LoginResult es el resultado de validar la contraseña: o bien los tokens,
+// o bien un challenge que hay que completar con el código TOTP.
+type LoginResult struct {
+	Tokens       *TokenPair
+	User         *User
+	MFAChallenge string
+	// El usuario administra algún team y la política exige 2FA, pero todavía no lo activó
+	MFAEnrollmentRequired bool
+}
+
+// SigningKey es una clave del key ring: firma access tokens desde ActivatesAt
+// y se publica en el JWKS hasta ExpiresAt.
+type SigningKey struct {
+	ID            string // kid
+	Algorithm     string // RS256 o EdDSA
+	PrivateKeyPEM string
+	CreatedAt     time.Time
+	ActivatesAt   time.Time
+	ExpiresAt     *time.Time
+
+	signer crypto.Signer
+}
+
+// Lockout es un bloqueo temporal del login, por cuenta (email), por IP o del
+// segundo factor de un usuario.
+type Lockout struct {
+	ID             int       `json:"id"`
+	Scope          string    `json:"scope"` // account / ip / mfa
+	Email          string    `json:"email,omitempty"`
+	UserID         *int      `json:"user_id,omitempty"`
+	IPAddress      string    `json:"ip_address,omitempty"`
+	FailedAttempts int       `json:"failed_attempts"`
+	LockedUntil    time.Time `json:"locked_until"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// PersonalAccessToken es un token de API de larga duración; solo se guarda su hash.
+type PersonalAccessToken struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // para reconocerlo sin conocer el token completo
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Token      string     `json:"token,omitempty"` // en claro, solo en la respuesta de creación
+}
+
+// Bot es una cuenta de usuario sin login propio, administrada por una persona o por un team.
+type Bot struct {
+	ID        int       `json:"id"`
+	Username  string    `json:"username"`
+	OwnerID   *int      `json:"owner_id,omitempty"`
+	TeamID    *int      `json:"team_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
 }
@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Parámetros argon2id por defecto (recomendación de OWASP: 64 MiB, 3 pasadas)
+const (
+	defaultArgon2Memory      = 64 * 1024 // KiB
+	defaultArgon2Iterations  = 3
+	defaultArgon2Parallelism = 2
+	argon2SaltLength         = 16
+	argon2KeyLength          = 32
+
+	defaultMinPasswordLength = 8
+	// argon2 no trunca como bcrypt, pero un límite evita hashear payloads enormes
+	defaultMaxPasswordLength = 128
+)
+
+var (
+	ErrPasswordTooShort = errors.New("la contraseña es demasiado corta")
+	ErrPasswordTooLong  = errors.New("la contraseña es demasiado larga")
+	ErrPasswordBreached = errors.New("esa contraseña aparece en filtraciones conocidas, elegí otra")
+)
+
+// PasswordHasher hashea y verifica contraseñas. El hash guardado lleva el
+// algoritmo y sus parámetros, así que se puede cambiar de política sin migrar.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(hash, password string) bool
+	// NeedsRehash indica si el hash es más débil que la política actual
+	NeedsRehash(hash string) bool
+}
+
+// Argon2idHasher genera hashes argon2id en formato PHC:
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+// Verifica también los hashes bcrypt anteriores, que se rehashean al loguearse.
+type Argon2idHasher struct {
+	Memory      uint32 // en KiB
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// NewArgon2idHasher devuelve un hasher con los parámetros por defecto
+func NewArgon2idHasher() *Argon2idHasher {
+	return &Argon2idHasher{
+		Memory:      defaultArgon2Memory,
+		Iterations:  defaultArgon2Iterations,
+		Parallelism: defaultArgon2Parallelism,
+	}
+}
+
+// Argon2idHasherFromEnv permite ajustar los parámetros con PASSWORD_ARGON2_MEMORY (KiB),
+// PASSWORD_ARGON2_ITERATIONS y PASSWORD_ARGON2_PARALLELISM
+func Argon2idHasherFromEnv() (*Argon2idHasher, error) {
+	h := NewArgon2idHasher()
+	if v := os.Getenv("PASSWORD_ARGON2_MEMORY"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil || n < 8*1024 {
+			return nil, fmt.Errorf("PASSWORD_ARGON2_MEMORY inválido (mínimo 8192 KiB): %q", v)
+		}
+		h.Memory = uint32(n)
+	}
+	if v := os.Getenv("PASSWORD_ARGON2_ITERATIONS"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("PASSWORD_ARGON2_ITERATIONS inválido: %q", v)
+		}
+		h.Iterations = uint32(n)
+	}
+	if v := os.Getenv("PASSWORD_ARGON2_PARALLELISM"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 8)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("PASSWORD_ARGON2_PARALLELISM inválido: %q", v)
+		}
+		h.Parallelism = uint8(n)
+	}
+	return h, nil
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, argon2KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, h.Memory, h.Iterations, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h *Argon2idHasher) Verify(hash, password string) bool {
+	if isBcryptHash(hash) {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		// Incluye las cuentas sin contraseña local (OIDC, bots)
+		return false
+	}
+	candidate := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	return subtle.ConstantTimeCompare(candidate, key) == 1
+}
+
+func (h *Argon2idHasher) NeedsRehash(hash string) bool {
+	if isBcryptHash(hash) {
+		return true
+	}
+	params, _, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return false
+	}
+	return params.Memory < h.Memory || params.Iterations < h.Iterations ||
+		params.Parallelism < h.Parallelism || len(key) < argon2KeyLength
+}
+
+func isBcryptHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func decodeArgon2id(hash string) (*Argon2idHasher, []byte, []byte, error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, hash
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, nil, nil, errors.New("no es un hash argon2id")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, nil, nil, errors.New("versión de argon2 no soportada")
+	}
+	params := &Argon2idHasher{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return nil, nil, nil, err
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return nil, nil, nil, errors.New("hash argon2id inválido")
+	}
+	return params, salt, key, nil
+}
+
+// PasswordPolicy define qué contraseñas se aceptan al registrarse y al restablecerla.
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	// Contraseñas filtradas conocidas, en minúsculas
+	Blocklist map[string]bool
+}
+
+// NewPasswordPolicy devuelve la política por defecto, sin lista de filtradas
+func NewPasswordPolicy() *PasswordPolicy {
+	return &PasswordPolicy{MinLength: defaultMinPasswordLength, MaxLength: defaultMaxPasswordLength}
+}
+
+// LoadBlocklist carga un archivo de contraseñas filtradas, una por línea
+// (por ejemplo un top de SecLists). Las líneas vacías y las que empiezan con # se ignoran.
+func (p *PasswordPolicy) LoadBlocklist(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if p.Blocklist == nil {
+		p.Blocklist = map[string]bool{}
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p.Blocklist[strings.ToLower(line)] = true
+	}
+	return scanner.Err()
+}
+
+// Validate devuelve un error legible si la contraseña no cumple la política
+func (p *PasswordPolicy) Validate(password string) error {
+	if password == "" {
+		return ErrPasswordRequired
+	}
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		return fmt.Errorf("%w: tiene que tener al menos %d caracteres", ErrPasswordTooShort, p.MinLength)
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		return fmt.Errorf("%w: puede tener hasta %d caracteres", ErrPasswordTooLong, p.MaxLength)
+	}
+	if p.Blocklist[strings.ToLower(password)] {
+		return ErrPasswordBreached
+	}
+	return nil
+}
+
+// IsPasswordPolicyError indica si el error es de validación (400) y no interno
+func IsPasswordPolicyError(err error) bool {
+	return errors.Is(err, ErrPasswordRequired) || errors.Is(err, ErrPasswordTooShort) ||
+		errors.Is(err, ErrPasswordTooLong) || errors.Is(err, ErrPasswordBreached)
+}
@@ -3,6 +3,9 @@ package auth
 import (
 	"database/sql"
 	"errors"
+	"time"
+
+	"github.com/lib/pq"
 )
 
 type UserRepository struct {
@@ -16,10 +19,893 @@ func (r *UserRepository) CreateUser(user *User) error {
 
 func (r *UserRepository) GetUserByEmail(email string) (*User, error) {
 	user := &User{}
-	query := `SELECT id, username, email, password FROM users WHERE email = $1`
-	err := r.DB.QueryRow(query, email).Scan(&user.ID, &user.Username, &user.Email, &user.Password)
+	query := `SELECT id, username, email, password, email_verified FROM users WHERE email = $1`
+	err := r.DB.QueryRow(query, email).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.EmailVerified)
 	if err != nil {
 		return nil, errors.New("usuario no encontrado")
 	}
 	return user, nil
 }
+
+func (r *UserRepository) GetUserByID(id int) (*User, error) {
+	user := &User{}
+	query := `SELECT id, username, email, password, email_verified FROM users WHERE id = $1`
+	err := r.DB.QueryRow(query, id).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.EmailVerified)
+	if err != nil {
+		return nil, errors.New("usuario no encontrado")
+	}
+	return user, nil
+}
+
+// Reemplazar el hash de la contraseña, solo si no cambió desde que se leyó
+func (r *UserRepository) UpdatePassword(userID int, oldHash, newHash string) error {
+	_, err := r.DB.Exec(`UPDATE users SET password = $3 WHERE id = $1 AND password = $2`, userID, oldHash, newHash)
+	return err
+}
+
+// Verificar si el username ya está en uso
+func (r *UserRepository) UsernameExists(username string) (bool, error) {
+	var exists bool
+	err := r.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE username = $1)`, username).Scan(&exists)
+	return exists, err
+}
+
+type SessionRepository struct {
+	DB *sql.DB
+}
+
+func (r *SessionRepository) CreateSession(userID int, refreshHash string, expiresAt time.Time, client ClientInfo) (*Session, error) {
+	session := &Session{UserID: userID, ExpiresAt: expiresAt, UserAgent: client.UserAgent, IPAddress: client.IPAddress}
+	query := `
+		INSERT INTO sessions (user_id, refresh_token_hash, expires_at, user_agent, ip_address)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, last_seen_at
+	`
+	err := r.DB.QueryRow(query, userID, refreshHash, expiresAt, client.UserAgent, client.IPAddress).
+		Scan(&session.ID, &session.CreatedAt, &session.LastSeenAt)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+const sessionColumns = `id, user_id, COALESCE(user_agent, ''), COALESCE(ip_address, ''), created_at, COALESCE(last_seen_at, created_at), expires_at, revoked_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSession(row rowScanner) (*Session, error) {
+	session := &Session{}
+	var revokedAt sql.NullTime
+	err := row.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IPAddress,
+		&session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+	if revokedAt.Valid {
+		session.RevokedAt = &revokedAt.Time
+	}
+	return session, nil
+}
+
+// Buscar la sesión a la que pertenece el refresh token vigente
+func (r *SessionRepository) GetSessionByRefreshHash(hash string) (*Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE refresh_token_hash = $1`
+	return scanSession(r.DB.QueryRow(query, hash))
+}
+
+// Buscar una sesión por un refresh token que ya fue rotado
+func (r *SessionRepository) GetSessionByPreviousHash(hash string) (*Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE previous_token_hash = $1`
+	return scanSession(r.DB.QueryRow(query, hash))
+}
+
+// Rotar el refresh token; solo tiene efecto si el hash actual sigue siendo oldHash
+func (r *SessionRepository) RotateRefreshToken(sessionID int, oldHash, newHash string, expiresAt time.Time, client ClientInfo) (bool, error) {
+	query := `
+		UPDATE sessions
+		SET refresh_token_hash = $1, previous_token_hash = $2, expires_at = $3,
+		    user_agent = $5, ip_address = $6, last_seen_at = NOW()
+		WHERE id = $4 AND refresh_token_hash = $2 AND revoked_at IS NULL
+	`
+	res, err := r.DB.Exec(query, newHash, oldHash, expiresAt, sessionID, client.UserAgent, client.IPAddress)
+	if err != nil {
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	return rows == 1, err
+}
+
+func (r *SessionRepository) RevokeSession(sessionID int) error {
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`
+	_, err := r.DB.Exec(query, sessionID)
+	return err
+}
+
+func (r *SessionRepository) RevokeUserSessions(userID int) error {
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+	_, err := r.DB.Exec(query, userID)
+	return err
+}
+
+// Una sesión está activa si no fue revocada ni expiró
+func (r *SessionRepository) IsSessionActive(sessionID int) (bool, error) {
+	var active bool
+	query := `
+		SELECT EXISTS(
+			SELECT 1 FROM sessions
+			WHERE id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		)
+	`
+	err := r.DB.QueryRow(query, sessionID).Scan(&active)
+	return active, err
+}
+
+// Sesiones no revocadas ni expiradas de un usuario, la más reciente primero
+func (r *SessionRepository) ListActiveSessions(userID int) ([]Session, error) {
+	query := `
+		SELECT ` + sessionColumns + `
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_seen_at DESC
+	`
+	rows, err := r.DB.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, rows.Err()
+}
+
+// Revocar una sesión solo si pertenece al usuario; devuelve false si no existe
+func (r *SessionRepository) RevokeUserSession(userID, sessionID int) (bool, error) {
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+	res, err := r.DB.Exec(query, sessionID, userID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	return rows == 1, err
+}
+
+// Revocar todas las sesiones del usuario menos la indicada
+func (r *SessionRepository) RevokeOtherSessions(userID, keepSessionID int) (int64, error) {
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL`
+	res, err := r.DB.Exec(query, userID, keepSessionID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Actualizar last_seen_at como mucho una vez por minuto para no escribir en cada request
+func (r *SessionRepository) TouchSession(sessionID int) error {
+	query := `
+		UPDATE sessions SET last_seen_at = NOW()
+		WHERE id = $1 AND (last_seen_at IS NULL OR last_seen_at < NOW() - INTERVAL '1 minute')
+	`
+	_, err := r.DB.Exec(query, sessionID)
+	return err
+}
+
+type PasswordResetRepository struct {
+	DB *sql.DB
+}
+
+// Crear un token de recuperación invalidando los anteriores que sigan pendientes
+func (r *PasswordResetRepository) CreateReset(userID int, tokenHash string, expiresAt time.Time) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`UPDATE password_resets SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL`, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO password_resets (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+	`, userID, tokenHash, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Consumir el token, cambiar la contraseña y revocar todas las sesiones en una transacción.
+// Devuelve sql.ErrNoRows si el token no existe, ya se usó o expiró.
+func (r *PasswordResetRepository) ResetPassword(tokenHash, passwordHash string) (int, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var userID int
+	err = tx.QueryRow(`
+		UPDATE password_resets SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id
+	`, tokenHash).Scan(&userID)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err = tx.Exec(`UPDATE users SET password = $1 WHERE id = $2`, passwordHash, userID); err != nil {
+		return 0, err
+	}
+
+	if _, err = tx.Exec(`UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`, userID); err != nil {
+		return 0, err
+	}
+
+	return userID, tx.Commit()
+}
+
+type EmailVerificationRepository struct {
+	DB *sql.DB
+}
+
+// Crear un token de verificación invalidando los anteriores que sigan pendientes
+func (r *EmailVerificationRepository) CreateVerification(userID int, tokenHash string, expiresAt time.Time) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`UPDATE email_verifications SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL`, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO email_verifications (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+	`, userID, tokenHash, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Consumir el token y marcar el email como verificado.
+// Devuelve sql.ErrNoRows si el token no existe, ya se usó o expiró.
+func (r *EmailVerificationRepository) VerifyEmail(tokenHash string) (int, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var userID int
+	err = tx.QueryRow(`
+		UPDATE email_verifications SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id
+	`, tokenHash).Scan(&userID)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE users SET email_verified = TRUE, email_verified_at = NOW()
+		WHERE id = $1 AND email_verified = FALSE
+	`, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, tx.Commit()
+}
+
+type MFARepository struct {
+	DB *sql.DB
+}
+
+// Devuelve sql.ErrNoRows si el usuario nunca inició el alta de 2FA
+func (r *MFARepository) GetMFA(userID int) (*MFAConfig, error) {
+	cfg := &MFAConfig{UserID: userID}
+	query := `SELECT secret, enabled, last_used_step FROM user_mfa WHERE user_id = $1`
+	err := r.DB.QueryRow(query, userID).Scan(&cfg.Secret, &cfg.Enabled, &cfg.LastUsedStep)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Guardar un secreto nuevo pendiente de confirmación (no pisa un 2FA ya activo)
+func (r *MFARepository) SavePendingSecret(userID int, secret string) (bool, error) {
+	query := `
+		INSERT INTO user_mfa (user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET secret = $2, last_used_step = 0, created_at = NOW()
+		WHERE user_mfa.enabled = FALSE
+	`
+	res, err := r.DB.Exec(query, userID, secret)
+	if err != nil {
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	return rows == 1, err
+}
+
+// Registrar el paso TOTP usado; falla si ya se usó ese paso o uno posterior
+func (r *MFARepository) UseStep(userID int, step int64) (bool, error) {
+	query := `UPDATE user_mfa SET last_used_step = $2 WHERE user_id = $1 AND last_used_step < $2`
+	res, err := r.DB.Exec(query, userID, step)
+	if err != nil {
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	return rows == 1, err
+}
+
+// Activar el 2FA y reemplazar los códigos de recuperación en una transacción
+func (r *MFARepository) Enable(userID int, codeHashes []string) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`UPDATE user_mfa SET enabled = TRUE, confirmed_at = NOW() WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *MFARepository) ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userID int, codeHashes []string) error {
+	if _, err := tx.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	for _, hash := range codeHashes {
+		_, err := tx.Exec(`INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, hash)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Consumir un código de recuperación; devuelve false si no existe o ya se usó
+func (r *MFARepository) UseRecoveryCode(userID int, codeHash string) (bool, error) {
+	query := `
+		UPDATE mfa_recovery_codes SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`
+	res, err := r.DB.Exec(query, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	return rows == 1, err
+}
+
+func (r *MFARepository) Disable(userID int) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM user_mfa WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Verificar si el usuario es admin de al menos un team
+func (r *MFARepository) IsTeamAdmin(userID int) (bool, error) {
+	var admin bool
+	query := `
+		SELECT EXISTS(
+			SELECT 1 FROM user_teams ut
+			JOIN teams t ON t.id = ut.team_id
+			WHERE ut.user_id = $1 AND ut.role = 'admin' AND t.deleted_at IS NULL
+		)
+	`
+	err := r.DB.QueryRow(query, userID).Scan(&admin)
+	return admin, err
+}
+
+type OIDCRepository struct {
+	DB *sql.DB
+}
+
+// Guardar el state del login en curso; de paso limpia los vencidos
+func (r *OIDCRepository) SaveLoginState(state, provider, codeVerifier, nonce string, expiresAt time.Time) error {
+	if _, err := r.DB.Exec(`DELETE FROM oidc_login_states WHERE expires_at < NOW()`); err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO oidc_login_states (state, provider, code_verifier, nonce, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	_, err := r.DB.Exec(query, state, provider, codeVerifier, nonce, expiresAt)
+	return err
+}
+
+// Consumir el state (un solo uso). Devuelve sql.ErrNoRows si no existe o expiró.
+func (r *OIDCRepository) ConsumeLoginState(state, provider string) (codeVerifier, nonce string, err error) {
+	query := `
+		DELETE FROM oidc_login_states
+		WHERE state = $1 AND provider = $2 AND expires_at > NOW()
+		RETURNING code_verifier, nonce
+	`
+	err = r.DB.QueryRow(query, state, provider).Scan(&codeVerifier, &nonce)
+	return codeVerifier, nonce, err
+}
+
+// Buscar el usuario vinculado a la identidad y registrar el login.
+// Devuelve sql.ErrNoRows si la identidad no está vinculada.
+func (r *OIDCRepository) GetUserIDByIdentity(provider, subject string) (int, error) {
+	var userID int
+	query := `
+		UPDATE user_identities SET last_login_at = NOW()
+		WHERE provider = $1 AND subject = $2
+		RETURNING user_id
+	`
+	err := r.DB.QueryRow(query, provider, subject).Scan(&userID)
+	return userID, err
+}
+
+// Vincular una identidad externa a un usuario existente
+func (r *OIDCRepository) LinkIdentity(userID int, provider, subject, email string) error {
+	query := `INSERT INTO user_identities (user_id, provider, subject, email) VALUES ($1, $2, $3, $4)`
+	_, err := r.DB.Exec(query, userID, provider, subject, email)
+	return err
+}
+
+// Crear el usuario y su identidad en una transacción (alta automática en el primer login)
+func (r *OIDCRepository) CreateUserWithIdentity(user *User, provider, subject string) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO users (username, email, password, email_verified, email_verified_at)
+		VALUES ($1, $2, $3, $4, CASE WHEN $4 THEN NOW() END)
+		RETURNING id
+	`
+	if err := tx.QueryRow(query, user.Username, user.Email, user.Password, user.EmailVerified).Scan(&user.ID); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO user_identities (user_id, provider, subject, email) VALUES ($1, $2, $3, $4)`,
+		user.ID, provider, subject, user.Email)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type SigningKeyRepository struct {
+	DB *sql.DB
+}
+
+// keyRotationLock serializa la rotación entre instancias del servidor
+const keyRotationLock int64 = 7_310_052_512
+
+// Claves que todavía sirven para verificar (incluye las que aún no empezaron a firmar)
+func (r *SigningKeyRepository) ListKeys() ([]SigningKey, error) {
+	query := `
+		SELECT kid, algorithm, private_key, created_at, activates_at, expires_at
+		FROM signing_keys
+		WHERE expires_at IS NULL OR expires_at > NOW()
+		ORDER BY activates_at
+	`
+	rows, err := r.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []SigningKey
+	for rows.Next() {
+		var key SigningKey
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&key.ID, &key.Algorithm, &key.PrivateKeyPEM, &key.CreatedAt, &key.ActivatesAt, &expiresAt); err != nil {
+			return nil, err
+		}
+		if expiresAt.Valid {
+			key.ExpiresAt = &expiresAt.Time
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// Rotate agrega la clave nueva si la más reciente es anterior a createdBefore.
+// Las claves vigentes pasan a vencer en retireAt. Devuelve false si otra instancia ya rotó.
+func (r *SigningKeyRepository) Rotate(key *SigningKey, createdBefore, retireAt time.Time) (bool, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, keyRotationLock); err != nil {
+		return false, err
+	}
+
+	var latest sql.NullTime
+	if err := tx.QueryRow(`SELECT MAX(created_at) FROM signing_keys`).Scan(&latest); err != nil {
+		return false, err
+	}
+	if latest.Valid && latest.Time.After(createdBefore) {
+		return false, nil
+	}
+
+	if _, err := tx.Exec(`UPDATE signing_keys SET expires_at = $1 WHERE expires_at IS NULL`, retireAt); err != nil {
+		return false, err
+	}
+	err = tx.QueryRow(`
+		INSERT INTO signing_keys (kid, algorithm, private_key, activates_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING created_at
+	`, key.ID, key.Algorithm, key.PrivateKeyPEM, key.ActivatesAt).Scan(&key.CreatedAt)
+	if err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(`DELETE FROM signing_keys WHERE expires_at < NOW()`); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+type LoginAttemptRepository struct {
+	DB *sql.DB
+}
+
+func (r *LoginAttemptRepository) RecordAttempt(email, ipAddress string, success bool) error {
+	query := `INSERT INTO login_attempts (email, ip_address, success) VALUES ($1, $2, $3)`
+	_, err := r.DB.Exec(query, email, ipAddress, success)
+	return err
+}
+
+// Fallos de la cuenta desde `since`, sin contar los anteriores al último login
+// exitoso ni al último bloqueo (que ya se "cobraron").
+func (r *LoginAttemptRepository) CountAccountFailures(email string, since time.Time) (int, error) {
+	var count int
+	query := `
+		SELECT COUNT(*) FROM login_attempts
+		WHERE email = $1 AND success = FALSE AND created_at > GREATEST($2,
+			COALESCE((SELECT MAX(created_at) FROM login_attempts WHERE email = $1 AND success), $2),
+			COALESCE((SELECT MAX(created_at) FROM account_lockouts WHERE scope = 'account' AND email = $1), $2))
+	`
+	err := r.DB.QueryRow(query, email, since).Scan(&count)
+	return count, err
+}
+
+// Fallos desde la IP (para cualquier cuenta) desde `since` o el último bloqueo de la IP
+func (r *LoginAttemptRepository) CountIPFailures(ipAddress string, since time.Time) (int, error) {
+	var count int
+	query := `
+		SELECT COUNT(*) FROM login_attempts
+		WHERE ip_address = $1 AND success = FALSE AND created_at > GREATEST($2,
+			COALESCE((SELECT MAX(created_at) FROM account_lockouts WHERE scope = 'ip' AND ip_address = $1), $2))
+	`
+	err := r.DB.QueryRow(query, ipAddress, since).Scan(&count)
+	return count, err
+}
+
+// Cantidad de bloqueos recientes, para que cada bloqueo dure más que el anterior
+func (r *LoginAttemptRepository) CountLockouts(scope, key string, since time.Time) (int, error) {
+	column := "email"
+	switch scope {
+	case "ip":
+		column = "ip_address"
+	case "mfa":
+		column = "user_id"
+	}
+	var count int
+	query := `SELECT COUNT(*) FROM account_lockouts WHERE scope = $1 AND ` + column + ` = $2 AND created_at > $3`
+	err := r.DB.QueryRow(query, scope, key, since).Scan(&count)
+	return count, err
+}
+
+// Registrar un bloqueo; si no trae usuario pero el email pertenece a uno, queda vinculado a él
+func (r *LoginAttemptRepository) CreateLockout(lockout *Lockout) error {
+	query := `
+		INSERT INTO account_lockouts (scope, email, user_id, ip_address, failed_attempts, locked_until)
+		VALUES ($1, NULLIF($2, ''),
+		        COALESCE($6, (SELECT id FROM users WHERE LOWER(email) = NULLIF($2, '') ORDER BY id LIMIT 1)),
+		        NULLIF($3, ''), $4, $5)
+		RETURNING id, user_id, created_at
+	`
+	var userID sql.NullInt64
+	err := r.DB.QueryRow(query, lockout.Scope, lockout.Email, lockout.IPAddress, lockout.FailedAttempts, lockout.LockedUntil, lockout.UserID).
+		Scan(&lockout.ID, &userID, &lockout.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if userID.Valid {
+		id := int(userID.Int64)
+		lockout.UserID = &id
+	}
+	return nil
+}
+
+// Hasta cuándo está bloqueado el login para ese email o esa IP (cero si no lo está)
+func (r *LoginAttemptRepository) LockedUntil(email, ipAddress string) (time.Time, error) {
+	var until sql.NullTime
+	query := `
+		SELECT MAX(locked_until) FROM account_lockouts
+		WHERE locked_until > NOW()
+		  AND ((scope = 'account' AND email = $1) OR (scope = 'ip' AND ip_address = $2))
+	`
+	if err := r.DB.QueryRow(query, email, ipAddress).Scan(&until); err != nil {
+		return time.Time{}, err
+	}
+	return until.Time, nil
+}
+
+// Borrar intentos viejos que ya no cuentan para ningún límite
+func (r *LoginAttemptRepository) PruneAttempts(before time.Time) error {
+	if _, err := r.DB.Exec(`DELETE FROM login_attempts WHERE created_at < $1`, before); err != nil {
+		return err
+	}
+	_, err := r.DB.Exec(`DELETE FROM mfa_attempts WHERE created_at < $1`, before)
+	return err
+}
+
+func (r *LoginAttemptRepository) RecordSecondFactorAttempt(userID int, success bool) error {
+	query := `INSERT INTO mfa_attempts (user_id, success) VALUES ($1, $2)`
+	_, err := r.DB.Exec(query, userID, success)
+	return err
+}
+
+// Códigos de 2FA inválidos del usuario desde `since`, sin contar los anteriores
+// al último código válido ni al último bloqueo del segundo factor.
+func (r *LoginAttemptRepository) CountSecondFactorFailures(userID int, since time.Time) (int, error) {
+	var count int
+	query := `
+		SELECT COUNT(*) FROM mfa_attempts
+		WHERE user_id = $1 AND success = FALSE AND created_at > GREATEST($2,
+			COALESCE((SELECT MAX(created_at) FROM mfa_attempts WHERE user_id = $1 AND success), $2),
+			COALESCE((SELECT MAX(created_at) FROM account_lockouts WHERE scope = 'mfa' AND user_id = $1), $2))
+	`
+	err := r.DB.QueryRow(query, userID, since).Scan(&count)
+	return count, err
+}
+
+// Hasta cuándo está bloqueado el segundo factor del usuario (cero si no lo está)
+func (r *LoginAttemptRepository) SecondFactorLockedUntil(userID int) (time.Time, error) {
+	var until sql.NullTime
+	query := `
+		SELECT MAX(locked_until) FROM account_lockouts
+		WHERE locked_until > NOW() AND scope = 'mfa' AND user_id = $1
+	`
+	if err := r.DB.QueryRow(query, userID).Scan(&until); err != nil {
+		return time.Time{}, err
+	}
+	return until.Time, nil
+}
+
+type PersonalTokenRepository struct {
+	DB *sql.DB
+}
+
+// Guardar un token nuevo; el token en claro nunca llega a la base
+func (r *PersonalTokenRepository) CreateToken(token *PersonalAccessToken, tokenHash string, createdBy int) error {
+	query := `
+		INSERT INTO personal_access_tokens (user_id, created_by, name, token_prefix, token_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`
+	return r.DB.QueryRow(query, token.UserID, createdBy, token.Name, token.Prefix, tokenHash,
+		pq.Array(token.Scopes), token.ExpiresAt).Scan(&token.ID, &token.CreatedAt)
+}
+
+func scanPersonalToken(row rowScanner) (*PersonalAccessToken, error) {
+	token := &PersonalAccessToken{}
+	var expiresAt, lastUsedAt sql.NullTime
+	err := row.Scan(&token.ID, &token.UserID, &token.Name, &token.Prefix, pq.Array(&token.Scopes),
+		&expiresAt, &lastUsedAt, &token.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		token.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		token.LastUsedAt = &lastUsedAt.Time
+	}
+	return token, nil
+}
+
+// Buscar un token vigente (ni revocado ni expirado) por su hash
+func (r *PersonalTokenRepository) GetActiveByHash(tokenHash string) (*PersonalAccessToken, error) {
+	query := `
+		SELECT id, user_id, name, token_prefix, scopes, expires_at, last_used_at, created_at
+		FROM personal_access_tokens
+		WHERE token_hash = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+	`
+	return scanPersonalToken(r.DB.QueryRow(query, tokenHash))
+}
+
+// Listar los tokens no revocados de un usuario (incluye los expirados, para que se vean)
+func (r *PersonalTokenRepository) ListTokens(userID int) ([]PersonalAccessToken, error) {
+	query := `
+		SELECT id, user_id, name, token_prefix, scopes, expires_at, last_used_at, created_at
+		FROM personal_access_tokens
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC
+	`
+	rows, err := r.DB.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []PersonalAccessToken{}
+	for rows.Next() {
+		token, err := scanPersonalToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *token)
+	}
+	return tokens, rows.Err()
+}
+
+// Revocar un token, solo si pertenece al usuario indicado
+func (r *PersonalTokenRepository) RevokeToken(userID, tokenID int) (bool, error) {
+	query := `UPDATE personal_access_tokens SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+	res, err := r.DB.Exec(query, tokenID, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// Actualizar last_used_at como mucho una vez por minuto, igual que las sesiones
+func (r *PersonalTokenRepository) TouchToken(tokenID int) error {
+	query := `
+		UPDATE personal_access_tokens SET last_used_at = NOW()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+	`
+	_, err := r.DB.Exec(query, tokenID)
+	return err
+}
+
+type BotRepository struct {
+	DB *sql.DB
+}
+
+// Crear la cuenta del bot. No tiene login propio: el email es un placeholder
+// y la contraseña no es un hash válido.
+func (r *BotRepository) CreateBot(bot *Bot, email, password string) error {
+	query := `
+		INSERT INTO users (username, email, password, email_verified, is_bot, bot_owner_id, bot_team_id)
+		VALUES ($1, $2, $3, TRUE, TRUE, $4, $5)
+		RETURNING id, created_at
+	`
+	return r.DB.QueryRow(query, bot.Username, email, password, bot.OwnerID, bot.TeamID).Scan(&bot.ID, &bot.CreatedAt)
+}
+
+func scanBot(row rowScanner) (*Bot, error) {
+	bot := &Bot{}
+	var ownerID, teamID sql.NullInt64
+	if err := row.Scan(&bot.ID, &bot.Username, &ownerID, &teamID, &bot.CreatedAt); err != nil {
+		return nil, err
+	}
+	if ownerID.Valid {
+		id := int(ownerID.Int64)
+		bot.OwnerID = &id
+	}
+	if teamID.Valid {
+		id := int(teamID.Int64)
+		bot.TeamID = &id
+	}
+	return bot, nil
+}
+
+// Bots que el usuario puede administrar: los propios y los de los teams donde es admin
+func (r *BotRepository) ListManagedBots(userID int) ([]Bot, error) {
+	query := `
+		SELECT u.id, u.username, u.bot_owner_id, u.bot_team_id, u.created_at
+		FROM users u
+		WHERE u.is_bot AND (
+			u.bot_owner_id = $1 OR
+			u.bot_team_id IN (
+				SELECT ut.team_id FROM user_teams ut
+				JOIN teams t ON t.id = ut.team_id
+				WHERE ut.user_id = $1 AND ut.role = 'admin' AND t.deleted_at IS NULL
+			)
+		)
+		ORDER BY u.created_at
+	`
+	rows, err := r.DB.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bots := []Bot{}
+	for rows.Next() {
+		bot, err := scanBot(rows)
+		if err != nil {
+			return nil, err
+		}
+		bots = append(bots, *bot)
+	}
+	return bots, rows.Err()
+}
+
+// Obtener un bot solo si el usuario puede administrarlo
+func (r *BotRepository) GetManagedBot(userID, botID int) (*Bot, error) {
+	query := `
+		SELECT u.id, u.username, u.bot_owner_id, u.bot_team_id, u.created_at
+		FROM users u
+		WHERE u.id = $2 AND u.is_bot AND (
+			u.bot_owner_id = $1 OR
+			u.bot_team_id IN (
+				SELECT ut.team_id FROM user_teams ut
+				JOIN teams t ON t.id = ut.team_id
+				WHERE ut.user_id = $1 AND ut.role = 'admin' AND t.deleted_at IS NULL
+			)
+		)
+	`
+	return scanBot(r.DB.QueryRow(query, userID, botID))
+}
+
+// Verificar si el usuario es admin del team
+func (r *BotRepository) IsTeamAdmin(userID, teamID int) (bool, error) {
+	var admin bool
+	query := `
+		SELECT EXISTS(
+			SELECT 1 FROM user_teams ut
+			JOIN teams t ON t.id = ut.team_id
+			WHERE ut.user_id = $1 AND ut.team_id = $2 AND ut.role = 'admin' AND t.deleted_at IS NULL
+		)
+	`
+	err := r.DB.QueryRow(query, userID, teamID).Scan(&admin)
+	return admin, err
+}
+
+// Borrar la cuenta del bot; sus tokens se borran en cascada
+func (r *BotRepository) DeleteBot(botID int) error {
+	_, err := r.DB.Exec(`DELETE FROM users WHERE id = $1 AND is_bot`, botID)
+	return err
+}
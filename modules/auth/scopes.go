@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Scopes que se pueden otorgar a un token personal. Los access tokens de sesión
+// no llevan scopes: tienen acceso completo.
+const (
+	ScopeMessagesRead  = "messages:read"
+	ScopeMessagesWrite = "messages:write"
+	ScopeChannelsRead  = "channels:read"
+	ScopeChannelsWrite = "channels:write"
+	ScopeTeamsRead     = "teams:read"
+	ScopeTeamsWrite    = "teams:write"
+	ScopeUsersRead     = "users:read"
+	ScopeUsersWrite    = "users:write"
+	ScopeFriendsRead   = "friends:read"
+	ScopeFriendsWrite  = "friends:write"
+)
+
+var knownScopes = map[string]bool{
+	ScopeMessagesRead:  true,
+	ScopeMessagesWrite: true,
+	ScopeChannelsRead:  true,
+	ScopeChannelsWrite: true,
+	ScopeTeamsRead:     true,
+	ScopeTeamsWrite:    true,
+	ScopeUsersRead:     true,
+	ScopeUsersWrite:    true,
+	ScopeFriendsRead:   true,
+	ScopeFriendsWrite:  true,
+}
+
+func validateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return ErrScopesRequired
+	}
+	for _, scope := range scopes {
+		if !knownScopes[scope] {
+			return fmt.Errorf("%w: %s", ErrUnknownScope, scope)
+		}
+	}
+	return nil
+}
+
+// IsPersonalToken indica si la request se autenticó con un token personal y no con una sesión
+func (c *Claims) IsPersonalToken() bool {
+	return c.TokenID != 0
+}
+
+// HasScope es siempre true para las sesiones; los tokens personales solo tienen los scopes otorgados
+func (c *Claims) HasScope(scope string) bool {
+	if !c.IsPersonalToken() {
+		return true
+	}
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireScope envuelve un handler protegido y rechaza los tokens personales sin el scope
+func RequireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := ClaimsFromContext(r.Context())
+		if !ok || !claims.HasScope(scope) {
+			http.Error(w, `{"error": "insufficient_scope", "message": "El token no tiene el scope `+scope+`"}`, http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// SessionOnly reserva un handler a las sesiones (gestión de la cuenta, 2FA, tokens):
+// un token personal nunca puede usarse para emitir otros tokens.
+func SessionOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := ClaimsFromContext(r.Context())
+		if !ok || claims.IsPersonalToken() {
+			http.Error(w, `{"error": "forbidden", "message": "Esta acción requiere iniciar sesión"}`, http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -1,21 +1,126 @@
 package auth
 
 import (
+	"database/sql"
 	"errors"
-	"os"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
+	"toller-server/pkg/mailer"
+)
+
+const (
+	accessTokenTTL   = 15 * time.Minute
+	refreshTokenTTL  = 30 * 24 * time.Hour
+	passwordResetTTL = time.Hour
+	verificationTTL  = 48 * time.Hour
+	mfaChallengeTTL  = 5 * time.Minute
+	mfaIssuer        = "Toller"
+	recoveryCodes    = 10
+	oidcStateTTL     = 10 * time.Minute
+	// Contraseña de las cuentas creadas por OIDC: no es un hash bcrypt válido,
+	// así que ningún login con contraseña puede coincidir.
+	unusablePassword = "!oidc"
+	// Los tokens personales se reconocen por el prefijo, así el verificador no intenta parsearlos como JWT
+	personalTokenPrefix = "tpat_"
+	tokenPrefixLength   = len(personalTokenPrefix) + 8
+	maxTokenNameLength  = 100
+	// Las cuentas de bot no reciben emails ni pueden loguearse con contraseña
+	botEmailDomain = "bots.toller.invalid"
+	botPassword    = "!bot"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("refresh token inválido o expirado")
+	ErrSessionRevoked      = errors.New("la sesión fue revocada")
+	ErrSessionNotFound     = errors.New("sesión no encontrada")
+	ErrInvalidResetToken   = errors.New("el enlace de recuperación es inválido o expiró")
+	ErrPasswordRequired    = errors.New("la contraseña es requerida")
+	ErrInvalidVerification = errors.New("el enlace de verificación es inválido o expiró")
+	ErrEmailNotVerified    = errors.New("tenés que verificar tu email antes de continuar")
+	ErrInvalidMFACode      = errors.New("código de verificación inválido")
+	ErrInvalidMFAChallenge = errors.New("el desafío de 2FA es inválido o expiró")
+	ErrMFAAlreadyEnabled   = errors.New("la verificación en dos pasos ya está activa")
+	ErrMFANotEnabled       = errors.New("la verificación en dos pasos no está activa")
+	ErrMFARequired         = errors.New("tenés que activar la verificación en dos pasos para administrar equipos")
+	ErrUnknownOIDCProvider = errors.New("proveedor de identidad desconocido")
+	ErrInvalidOIDCState    = errors.New("el login externo es inválido o expiró, volvé a intentarlo")
+	ErrOIDCEmailConflict   = errors.New("ya existe una cuenta con ese email; iniciá sesión con tu contraseña")
+	ErrOIDCEmailMissing    = errors.New("el proveedor de identidad no informó un email")
+	ErrInvalidCredentials  = errors.New("email o contraseña incorrectos")
+	ErrTokenNameRequired   = errors.New("el nombre del token es requerido")
+	ErrTokenNameTooLong    = errors.New("el nombre del token no puede superar los 100 caracteres")
+	ErrScopesRequired      = errors.New("tenés que indicar al menos un scope")
+	ErrUnknownScope        = errors.New("scope desconocido")
+	ErrInvalidTokenExpiry  = errors.New("la expiración del token tiene que ser de al menos un día")
+	ErrTokenNotFound       = errors.New("token no encontrado")
+	ErrBotUsernameRequired = errors.New("el nombre de usuario del bot es requerido")
+	ErrBotUsernameTaken    = errors.New("ese nombre de usuario ya está en uso")
+	ErrBotNotFound         = errors.New("bot no encontrado")
+	ErrNotTeamAdmin        = errors.New("solo los admins del equipo pueden crear bots del equipo")
 )
 
 type AuthService struct {
-	Repo *UserRepository
+	Repo          *UserRepository
+	Tokens        *TokenVerifier
+	Sessions      *SessionRepository
+	Resets        *PasswordResetRepository
+	Verifications *EmailVerificationRepository
+	Mailer        mailer.Mailer
+	AppURL        string // URL pública del cliente, usada en los enlaces de los emails
+	Verification  VerificationPolicy
+	MFA           *MFARepository
+	// Exigir 2FA a quienes administran algún team
+	MFARequiredForAdmins bool
+	// Proveedores OpenID Connect habilitados, por nombre
+	OIDCProviders map[string]*OIDCProvider
+	OIDC          *OIDCRepository
+	// Protección contra fuerza bruta en el login (opcional)
+	Throttle *LoginThrottle
+	// Tokens personales y cuentas de bot
+	PersonalTokens *PersonalTokenRepository
+	Bots           *BotRepository
+	// Hash de contraseñas (argon2id por defecto) y política de contraseñas nuevas
+	Passwords      PasswordHasher
+	PasswordPolicy *PasswordPolicy
+	// Invitaciones a teams por email, que se reclaman al crear la cuenta (opcional)
+	Invites InviteClaimer
+}
+
+// InviteClaimer suma a una cuenta a los teams que invitaron a su email. Lo implementa el módulo de teams.
+type InviteClaimer interface {
+	ClaimEmailInvites(userID int, email string) error
+}
+
+var (
+	defaultHasher = NewArgon2idHasher()
+	defaultPolicy = NewPasswordPolicy()
+)
+
+func (s *AuthService) passwords() PasswordHasher {
+	if s.Passwords == nil {
+		return defaultHasher
+	}
+	return s.Passwords
+}
+
+func (s *AuthService) passwordPolicy() *PasswordPolicy {
+	if s.PasswordPolicy == nil {
+		return defaultPolicy
+	}
+	return s.PasswordPolicy
 }
 
 func (s *AuthService) Register(username, email, password string) (*User, error) {
+	if err := s.passwordPolicy().Validate(password); err != nil {
+		return nil, err
+	}
+
 	// Hashear la contraseña
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hash, err := s.passwords().Hash(password)
 	if err != nil {
 		return nil, err
 	}
@@ -23,7 +128,7 @@ func (s *AuthService) Register(username, email, password string) (*User, error)
 	user := &User{
 		Username: username,
 		Email:    email,
-		Password: string(hash),
+		Password: hash,
 	}
 
 	err = s.Repo.CreateUser(user)
@@ -31,33 +136,887 @@ func (s *AuthService) Register(username, email, password string) (*User, error)
 		return nil, err
 	}
 
+	// Un fallo del mailer no impide el registro: se puede pedir el reenvío
+	if err := s.sendVerification(user); err != nil {
+		log.Printf("[AUTH] No se pudo enviar la verificación a %s: %v", user.Email, err)
+	}
+	s.claimInvites(user)
+
 	return user, nil
 }
 
-func (s *AuthService) Login(email, password string) (string, *User, error) {
+func (s *AuthService) Login(email, password string, client ClientInfo) (*LoginResult, error) {
+	if s.Throttle != nil {
+		if err := s.Throttle.Check(email, client.IPAddress); err != nil {
+			return nil, err
+		}
+	}
+
 	user, err := s.Repo.GetUserByEmail(email)
 	if err != nil {
-		return "", nil, err
+		// Comparar igual contra un hash de relleno para que el tiempo de respuesta
+		// no revele si la cuenta existe
+		s.passwords().Verify(s.dummyPasswordHash(), password)
+		return nil, s.loginFailed(email, client)
 	}
 
 	// Verificar contraseña
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return "", nil, errors.New("contraseña incorrecta")
+	if !s.passwords().Verify(user.Password, password) {
+		return nil, s.loginFailed(email, client)
+	}
+	s.rehashIfNeeded(user, password)
+
+	if s.Throttle != nil {
+		if err := s.Throttle.Success(email, client.IPAddress); err != nil {
+			log.Printf("[AUTH] Error registrando login de %d: %v", user.ID, err)
+		}
 	}
+	return s.finishLogin(user, client)
+}
+
+// ConfirmPassword vuelve a pedir la contraseña antes de una acción delicada (p. ej. borrar
+// la cuenta). Las cuentas sin contraseña local (OIDC) se confirman solo con la sesión.
+func (s *AuthService) ConfirmPassword(userID int, password string) (bool, error) {
+	user, err := s.Repo.GetUserByID(userID)
+	if err != nil {
+		return false, err
+	}
+	if strings.HasPrefix(user.Password, "!") {
+		return true, nil
+	}
+	return s.passwords().Verify(user.Password, password), nil
+}
 
-	// Crear JWT
-	secret := os.Getenv("JWT_SECRET")
-	claims := jwt.MapClaims{
-		"user_id": user.ID,
-		"exp":     time.Now().Add(time.Hour * 72).Unix(),
+// loginFailed registra el fallo y devuelve siempre el mismo error genérico,
+// sin distinguir entre email inexistente y contraseña incorrecta. Si el fallo no
+// se puede registrar, el login falla con ese error en lugar de quedar fuera del límite.
+func (s *AuthService) loginFailed(email string, client ClientInfo) error {
+	if s.Throttle != nil {
+		if err := s.Throttle.Failure(email, client.IPAddress); err != nil {
+			return fmt.Errorf("registrando login fallido: %w", err)
+		}
 	}
+	return ErrInvalidCredentials
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signed, err := token.SignedString([]byte(secret))
+func (s *AuthService) dummyPasswordHash() string {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = s.passwords().Hash("toller-dummy-password")
+	})
+	return dummyHash
+}
+
+// rehashIfNeeded actualiza el hash guardado cuando es más débil que la política
+// actual (bcrypt o parámetros argon2 viejos). Solo se puede hacer acá, que es
+// cuando tenemos la contraseña en claro.
+func (s *AuthService) rehashIfNeeded(user *User, password string) {
+	if !s.passwords().NeedsRehash(user.Password) {
+		return
+	}
+	hash, err := s.passwords().Hash(password)
+	if err == nil {
+		err = s.Repo.UpdatePassword(user.ID, user.Password, hash)
+	}
 	if err != nil {
-		return "", nil, err
+		log.Printf("[AUTH] No se pudo actualizar el hash de la contraseña de %d: %v", user.ID, err)
+	}
+}
+
+// finishLogin aplica la política de verificación y el 2FA a un usuario ya autenticado
+// (por contraseña o por un proveedor externo) y emite los tokens o el challenge.
+func (s *AuthService) finishLogin(user *User, client ClientInfo) (*LoginResult, error) {
+	if s.Verification == VerificationRequired && !user.EmailVerified {
+		return nil, ErrEmailNotVerified
 	}
 	// No enviar password en respuesta
 	user.Password = ""
-	return signed, user, nil
+
+	mfa, err := s.MFA.GetMFA(user.ID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	mfaEnabled := err == nil && mfa.Enabled
+
+	// Con 2FA activo la contraseña solo da un challenge de corta duración
+	if mfaEnabled {
+		challenge, err := s.signMFAChallenge(user.ID)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{User: user, MFAChallenge: challenge}, nil
+	}
+
+	tokens, err := s.startSession(user.ID, client)
+	if err != nil {
+		return nil, err
+	}
+	result := &LoginResult{Tokens: tokens, User: user}
+
+	if s.MFARequiredForAdmins {
+		admin, err := s.MFA.IsTeamAdmin(user.ID)
+		if err != nil {
+			return nil, err
+		}
+		result.MFAEnrollmentRequired = admin
+	}
+	return result, nil
+}
+
+// CompleteMFALogin canjea el challenge del login más un código TOTP (o de recuperación) por los tokens
+func (s *AuthService) CompleteMFALogin(challenge, code, recoveryCode string, client ClientInfo) (*LoginResult, error) {
+	userID, issuedAt, err := s.parseMFAChallenge(challenge)
+	if err != nil {
+		return nil, ErrInvalidMFAChallenge
+	}
+	// Tras unos pocos códigos inválidos el challenge deja de servir y hay que repetir la contraseña
+	if s.Throttle != nil {
+		exhausted, err := s.Throttle.ChallengeExhausted(userID, issuedAt)
+		if err != nil {
+			return nil, err
+		}
+		if exhausted {
+			return nil, ErrInvalidMFAChallenge
+		}
+	}
+
+	if err := s.checkSecondFactor(userID, code, recoveryCode); err != nil {
+		return nil, err
+	}
+
+	user, err := s.Repo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	user.Password = ""
+
+	tokens, err := s.startSession(user.ID, client)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{Tokens: tokens, User: user}, nil
+}
+
+// StartOIDCLogin guarda el state del flujo y devuelve la URL del proveedor a la que redirigir
+func (s *AuthService) StartOIDCLogin(providerName string) (string, error) {
+	provider, ok := s.OIDCProviders[providerName]
+	if !ok {
+		return "", ErrUnknownOIDCProvider
+	}
+
+	state, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+	verifier, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.OIDC.SaveLoginState(state, providerName, verifier, nonce, time.Now().Add(oidcStateTTL)); err != nil {
+		return "", err
+	}
+	return provider.AuthorizationURL(state, nonce, verifier)
+}
+
+// CompleteOIDCLogin canjea el code del callback, valida el id_token y loguea al usuario vinculado,
+// vinculando o creando la cuenta en el primer login.
+func (s *AuthService) CompleteOIDCLogin(providerName, state, code string, client ClientInfo) (*LoginResult, error) {
+	provider, ok := s.OIDCProviders[providerName]
+	if !ok {
+		return nil, ErrUnknownOIDCProvider
+	}
+
+	verifier, nonce, err := s.OIDC.ConsumeLoginState(state, providerName)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidOIDCState
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := provider.Exchange(code, verifier, nonce)
+	if err != nil {
+		log.Printf("[AUTH] Login OIDC con %s rechazado: %v", providerName, err)
+		return nil, ErrInvalidIDToken
+	}
+
+	user, err := s.resolveOIDCUser(providerName, claims)
+	if err != nil {
+		return nil, err
+	}
+	return s.finishLogin(user, client)
+}
+
+func (s *AuthService) resolveOIDCUser(provider string, claims *OIDCClaims) (*User, error) {
+	userID, err := s.OIDC.GetUserIDByIdentity(provider, claims.Subject)
+	if err == nil {
+		return s.Repo.GetUserByID(userID)
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	if claims.Email == "" {
+		return nil, ErrOIDCEmailMissing
+	}
+
+	// Solo se vincula a una cuenta existente si el proveedor garantiza el email;
+	// si no, cualquiera podría apropiarse de la cuenta registrando ese email en el IdP.
+	if existing, err := s.Repo.GetUserByEmail(claims.Email); err == nil {
+		if !claims.EmailVerified {
+			return nil, ErrOIDCEmailConflict
+		}
+		if err := s.OIDC.LinkIdentity(existing.ID, provider, claims.Subject, claims.Email); err != nil {
+			return nil, err
+		}
+		log.Printf("[AUTH] Identidad %s vinculada al usuario %d", provider, existing.ID)
+		return existing, nil
+	}
+
+	username, err := s.availableUsername(claims)
+	if err != nil {
+		return nil, err
+	}
+	user := &User{
+		Username:      username,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Password:      unusablePassword,
+	}
+	if err := s.OIDC.CreateUserWithIdentity(user, provider, claims.Subject); err != nil {
+		return nil, err
+	}
+	log.Printf("[AUTH] Usuario %d creado desde %s", user.ID, provider)
+
+	if !user.EmailVerified {
+		if err := s.sendVerification(user); err != nil {
+			log.Printf("[AUTH] No se pudo enviar la verificación a %s: %v", user.Email, err)
+		}
+	}
+	s.claimInvites(user)
+	return user, nil
+}
+
+// availableUsername deriva un username libre del preferred_username o del email
+func (s *AuthService) availableUsername(claims *OIDCClaims) (string, error) {
+	base := claims.PreferredUsername
+	if base == "" {
+		base = strings.SplitN(claims.Email, "@", 2)[0]
+	}
+	base = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '.' || r == '-' {
+			return r
+		}
+		return -1
+	}, base)
+	if len(base) > 40 {
+		base = base[:40]
+	}
+	if base == "" {
+		base = "user"
+	}
+
+	for i := 1; i <= 100; i++ {
+		candidate := base
+		if i > 1 {
+			candidate = fmt.Sprintf("%s%d", base, i)
+		}
+		taken, err := s.Repo.UsernameExists(candidate)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+	}
+	return "", errors.New("no se pudo generar un username disponible")
+}
+
+// EnrollMFA genera un secreto nuevo pendiente de confirmación
+func (s *AuthService) EnrollMFA(userID int) (*MFAEnrollment, error) {
+	user, err := s.Repo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	saved, err := s.MFA.SavePendingSecret(userID, secret)
+	if err != nil {
+		return nil, err
+	}
+	if !saved {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	uri := otpauthURI(mfaIssuer, user.Email, secret)
+	return &MFAEnrollment{Secret: secret, OTPAuthURI: uri, QRPayload: uri}, nil
+}
+
+// ConfirmMFA activa el 2FA con el primer código válido y devuelve los códigos de recuperación
+func (s *AuthService) ConfirmMFA(userID int, code string) ([]string, error) {
+	mfa, err := s.MFA.GetMFA(userID)
+	if err == sql.ErrNoRows {
+		return nil, ErrMFANotEnabled
+	}
+	if err != nil {
+		return nil, err
+	}
+	if mfa.Enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	if err := s.useTOTP(mfa, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.MFA.Enable(userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// RegenerateRecoveryCodes invalida los códigos anteriores y emite nuevos
+func (s *AuthService) RegenerateRecoveryCodes(userID int, code string) ([]string, error) {
+	if err := s.checkSecondFactor(userID, code, ""); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.MFA.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableMFA desactiva el 2FA; exige un código TOTP o de recuperación
+func (s *AuthService) DisableMFA(userID int, code, recoveryCode string) error {
+	if err := s.checkSecondFactor(userID, code, recoveryCode); err != nil {
+		return err
+	}
+	return s.MFA.Disable(userID)
+}
+
+// EnsureMFA devuelve ErrMFARequired si la política exige 2FA a los admins y el usuario no lo activó
+func (s *AuthService) EnsureMFA(userID int) error {
+	if !s.MFARequiredForAdmins {
+		return nil
+	}
+	mfa, err := s.MFA.GetMFA(userID)
+	if err == sql.ErrNoRows || (err == nil && !mfa.Enabled) {
+		return ErrMFARequired
+	}
+	return err
+}
+
+// checkSecondFactor valida un código TOTP o, si no viene, uno de recuperación.
+// Los códigos inválidos cuentan para el bloqueo del segundo factor del usuario.
+func (s *AuthService) checkSecondFactor(userID int, code, recoveryCode string) error {
+	mfa, err := s.MFA.GetMFA(userID)
+	if err == sql.ErrNoRows || (err == nil && !mfa.Enabled) {
+		return ErrMFANotEnabled
+	}
+	if err != nil {
+		return err
+	}
+	if s.Throttle != nil {
+		if err := s.Throttle.CheckSecondFactor(userID); err != nil {
+			return err
+		}
+	}
+
+	if code != "" {
+		err = s.useTOTP(mfa, code)
+	} else {
+		err = s.useRecoveryCode(userID, recoveryCode)
+	}
+	if err == ErrInvalidMFACode {
+		return s.secondFactorFailed(userID)
+	}
+	if err == nil && s.Throttle != nil {
+		if err := s.Throttle.SecondFactorSuccess(userID); err != nil {
+			log.Printf("[AUTH] Error registrando 2FA de %d: %v", userID, err)
+		}
+	}
+	return err
+}
+
+// secondFactorFailed registra el código inválido; si no se puede registrar, el
+// intento falla igual en lugar de quedar fuera del límite.
+func (s *AuthService) secondFactorFailed(userID int) error {
+	if s.Throttle != nil {
+		if err := s.Throttle.SecondFactorFailure(userID); err != nil {
+			return fmt.Errorf("registrando 2FA fallido: %w", err)
+		}
+	}
+	return ErrInvalidMFACode
+}
+
+// useRecoveryCode consume un código de recuperación; cada uno sirve una sola vez
+func (s *AuthService) useRecoveryCode(userID int, recoveryCode string) error {
+	used, err := s.MFA.UseRecoveryCode(userID, hashToken(normalizeRecoveryCode(recoveryCode)))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidMFACode
+	}
+	log.Printf("[AUTH] Usuario %d usó un código de recuperación de 2FA", userID)
+	return nil
+}
+
+// useTOTP valida el código y lo marca como usado para que no pueda repetirse
+func (s *AuthService) useTOTP(mfa *MFAConfig, code string) error {
+	step, ok := validateTOTP(mfa.Secret, strings.TrimSpace(code), time.Now())
+	if !ok {
+		return ErrInvalidMFACode
+	}
+	fresh, err := s.MFA.UseStep(mfa.UserID, step)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := generateRecoveryCodes(recoveryCodes)
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = hashToken(code)
+	}
+	return codes, hashes, nil
+}
+
+// Refresh rota el refresh token y emite un nuevo access token para la misma sesión
+func (s *AuthService) Refresh(refreshToken string, client ClientInfo) (*TokenPair, error) {
+	hash := hashToken(refreshToken)
+
+	session, err := s.Sessions.GetSessionByRefreshHash(hash)
+	if err == sql.ErrNoRows {
+		// Un refresh token ya rotado que vuelve a aparecer indica que fue robado:
+		// se revoca la sesión completa.
+		if stale, err := s.Sessions.GetSessionByPreviousHash(hash); err == nil {
+			log.Printf("[AUTH] Reutilización de refresh token en sesión %d, revocando", stale.ID)
+			if err := s.Sessions.RevokeSession(stale.ID); err != nil {
+				return nil, err
+			}
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if session.RevokedAt != nil {
+		return nil, ErrSessionRevoked
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	newRefresh, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+	rotated, err := s.Sessions.RotateRefreshToken(session.ID, hash, hashToken(newRefresh), time.Now().Add(refreshTokenTTL), client)
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		// Otro request rotó el token primero
+		return nil, ErrInvalidRefreshToken
+	}
+
+	access, err := s.signAccessToken(session.UserID, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		AccessToken:  access,
+		RefreshToken: newRefresh,
+		ExpiresIn:    int(accessTokenTTL.Seconds()),
+	}, nil
+}
+
+// Logout revoca la sesión del token actual
+func (s *AuthService) Logout(sessionID int) error {
+	return s.Sessions.RevokeSession(sessionID)
+}
+
+// ForgotPassword envía un enlace de recuperación. Si el email no existe no hace nada,
+// para no revelar qué cuentas están registradas.
+func (s *AuthService) ForgotPassword(email string) error {
+	user, err := s.Repo.GetUserByEmail(email)
+	if err != nil {
+		return nil
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return err
+	}
+	if err := s.Resets.CreateReset(user.ID, hashToken(token), time.Now().Add(passwordResetTTL)); err != nil {
+		return err
+	}
+
+	return s.Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Recuperar tu contraseña de Toller",
+		Body: fmt.Sprintf("Hola %s,\n\nPara elegir una nueva contraseña entrá a:\n%s/reset-password?token=%s\n\n"+
+			"El enlace vence en %d minutos y solo puede usarse una vez. Si no lo pediste, ignorá este email.\n",
+			user.Username, strings.TrimRight(s.AppURL, "/"), token, int(passwordResetTTL.Minutes())),
+	})
+}
+
+// ResetPassword cambia la contraseña con un token de recuperación y cierra todas las sesiones
+func (s *AuthService) ResetPassword(token, newPassword string) error {
+	if err := s.passwordPolicy().Validate(newPassword); err != nil {
+		return err
+	}
+
+	hash, err := s.passwords().Hash(newPassword)
+	if err != nil {
+		return err
+	}
+
+	userID, err := s.Resets.ResetPassword(hashToken(token), hash)
+	if err == sql.ErrNoRows {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[AUTH] Contraseña restablecida para el usuario %d, sesiones revocadas", userID)
+	return nil
+}
+
+// VerifyEmail marca el email como verificado con el token recibido al registrarse
+func (s *AuthService) VerifyEmail(token string) error {
+	userID, err := s.Verifications.VerifyEmail(hashToken(token))
+	if err == sql.ErrNoRows {
+		return ErrInvalidVerification
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[AUTH] Email verificado para el usuario %d", userID)
+	if user, err := s.Repo.GetUserByID(userID); err == nil {
+		s.claimInvites(user)
+	}
+	return nil
+}
+
+// claimInvites suma al usuario a los teams que invitaron a su email. Sea cual sea
+// la política, se espera a que el email esté verificado (VerifyEmail vuelve a
+// llamarla), así nadie entra a un team registrándose con una dirección ajena.
+func (s *AuthService) claimInvites(user *User) {
+	if s.Invites == nil || !user.EmailVerified {
+		return
+	}
+	if err := s.Invites.ClaimEmailInvites(user.ID, user.Email); err != nil {
+		log.Printf("[AUTH] No se pudieron reclamar las invitaciones de %d: %v", user.ID, err)
+	}
+}
+
+// ResendVerification reenvía el email de verificación. Igual que ForgotPassword,
+// no revela si la cuenta existe o ya estaba verificada.
+func (s *AuthService) ResendVerification(email string) error {
+	user, err := s.Repo.GetUserByEmail(email)
+	if err != nil || user.EmailVerified {
+		return nil
+	}
+	return s.sendVerification(user)
+}
+
+// EnsureVerified devuelve ErrEmailNotVerified si la política restringe
+// las cuentas sin verificar y el usuario todavía no verificó su email.
+func (s *AuthService) EnsureVerified(userID int) error {
+	if s.Verification != VerificationRestrict && s.Verification != VerificationRequired {
+		return nil
+	}
+	user, err := s.Repo.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if !user.EmailVerified {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
+
+// EnsureEmailVerified devuelve ErrEmailNotVerified si el usuario no verificó su
+// email, sin importar la política: lo exige todo lo que depende de ser dueño de
+// la dirección, como aceptar una invitación por email.
+func (s *AuthService) EnsureEmailVerified(userID int) error {
+	user, err := s.Repo.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if !user.EmailVerified {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
+
+func (s *AuthService) sendVerification(user *User) error {
+	token, err := generateToken()
+	if err != nil {
+		return err
+	}
+	if err := s.Verifications.CreateVerification(user.ID, hashToken(token), time.Now().Add(verificationTTL)); err != nil {
+		return err
+	}
+
+	return s.Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Confirmá tu email en Toller",
+		Body: fmt.Sprintf("Hola %s,\n\nPara confirmar tu email entrá a:\n%s/verify-email?token=%s\n\n"+
+			"El enlace vence en %d horas.\n",
+			user.Username, strings.TrimRight(s.AppURL, "/"), token, int(verificationTTL.Hours())),
+	})
+}
+
+// ListSessions devuelve las sesiones activas del usuario marcando la actual
+func (s *AuthService) ListSessions(userID, currentSessionID int) ([]Session, error) {
+	sessions, err := s.Sessions.ListActiveSessions(userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentSessionID
+	}
+	return sessions, nil
+}
+
+// RevokeSession cierra una sesión propia (por ejemplo la de otro dispositivo)
+func (s *AuthService) RevokeSession(userID, sessionID int) error {
+	revoked, err := s.Sessions.RevokeUserSession(userID, sessionID)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeOtherSessions implementa "cerrar sesión en todos los demás dispositivos"
+func (s *AuthService) RevokeOtherSessions(userID, currentSessionID int) (int64, error) {
+	return s.Sessions.RevokeOtherSessions(userID, currentSessionID)
+}
+
+// tokenOwner resuelve de quién son los tokens que se gestionan: del usuario o de un bot que administra
+func (s *AuthService) tokenOwner(userID, botID int) (int, error) {
+	if botID == 0 {
+		return userID, nil
+	}
+	bot, err := s.Bots.GetManagedBot(userID, botID)
+	if err == sql.ErrNoRows {
+		return 0, ErrBotNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	return bot.ID, nil
+}
+
+// CreatePersonalToken emite un token personal para el usuario o para uno de sus bots.
+// El valor en claro solo se devuelve acá; después solo se ve el prefijo.
+func (s *AuthService) CreatePersonalToken(userID, botID int, name string, scopes []string, expiresInDays int) (*PersonalAccessToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, ErrTokenNameRequired
+	}
+	if len(name) > maxTokenNameLength {
+		return nil, ErrTokenNameTooLong
+	}
+	if err := validateScopes(scopes); err != nil {
+		return nil, err
+	}
+	if expiresInDays < 0 {
+		return nil, ErrInvalidTokenExpiry
+	}
+
+	ownerID, err := s.tokenOwner(userID, botID)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+	value := personalTokenPrefix + secret
+
+	token := &PersonalAccessToken{
+		UserID: ownerID,
+		Name:   name,
+		Prefix: value[:tokenPrefixLength],
+		Scopes: scopes,
+	}
+	if expiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, expiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+	if err := s.PersonalTokens.CreateToken(token, hashToken(value), userID); err != nil {
+		return nil, err
+	}
+	token.Token = value
+	return token, nil
+}
+
+// ListPersonalTokens lista los tokens vigentes del usuario o de uno de sus bots
+func (s *AuthService) ListPersonalTokens(userID, botID int) ([]PersonalAccessToken, error) {
+	ownerID, err := s.tokenOwner(userID, botID)
+	if err != nil {
+		return nil, err
+	}
+	return s.PersonalTokens.ListTokens(ownerID)
+}
+
+// RevokePersonalToken revoca un token del usuario o de uno de sus bots; deja de valer en la próxima request
+func (s *AuthService) RevokePersonalToken(userID, botID, tokenID int) error {
+	ownerID, err := s.tokenOwner(userID, botID)
+	if err != nil {
+		return err
+	}
+	revoked, err := s.PersonalTokens.RevokeToken(ownerID, tokenID)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return ErrTokenNotFound
+	}
+	return nil
+}
+
+// CreateBot crea una cuenta de bot propia o, con teamID, del team (solo admins)
+func (s *AuthService) CreateBot(userID int, username string, teamID int) (*Bot, error) {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return nil, ErrBotUsernameRequired
+	}
+
+	bot := &Bot{Username: username}
+	if teamID != 0 {
+		admin, err := s.Bots.IsTeamAdmin(userID, teamID)
+		if err != nil {
+			return nil, err
+		}
+		if !admin {
+			return nil, ErrNotTeamAdmin
+		}
+		if err := s.EnsureMFA(userID); err != nil {
+			return nil, err
+		}
+		bot.TeamID = &teamID
+	} else {
+		bot.OwnerID = &userID
+	}
+
+	taken, err := s.Repo.UsernameExists(username)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, ErrBotUsernameTaken
+	}
+
+	id, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+	email := fmt.Sprintf("bot-%s@%s", strings.ToLower(id[:16]), botEmailDomain)
+	if err := s.Bots.CreateBot(bot, email, botPassword); err != nil {
+		return nil, err
+	}
+	return bot, nil
+}
+
+// ListBots devuelve los bots propios y los de los teams que administra el usuario
+func (s *AuthService) ListBots(userID int) ([]Bot, error) {
+	return s.Bots.ListManagedBots(userID)
+}
+
+// DeleteBot borra la cuenta del bot junto con sus tokens
+func (s *AuthService) DeleteBot(userID, botID int) error {
+	bot, err := s.Bots.GetManagedBot(userID, botID)
+	if err == sql.ErrNoRows {
+		return ErrBotNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return s.Bots.DeleteBot(bot.ID)
+}
+
+// startSession crea la sesión en la DB y emite el par de tokens
+func (s *AuthService) startSession(userID int, client ClientInfo) (*TokenPair, error) {
+	refresh, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := s.Sessions.CreateSession(userID, hashToken(refresh), time.Now().Add(refreshTokenTTL), client)
+	if err != nil {
+		return nil, err
+	}
+
+	access, err := s.signAccessToken(userID, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		ExpiresIn:    int(accessTokenTTL.Seconds()),
+	}, nil
+}
+
+// Crear JWT de corta duración atado a la sesión (claim "sid")
+func (s *AuthService) signAccessToken(userID, sessionID int) (string, error) {
+	claims := s.Tokens.NewClaims(userID, accessTokenTTL)
+	claims.SessionID = sessionID
+	return s.Tokens.Sign(claims)
+}
+
+// El challenge de 2FA no lleva "sid", así que el middleware nunca lo acepta como access token
+func (s *AuthService) signMFAChallenge(userID int) (string, error) {
+	claims := s.Tokens.NewClaims(userID, mfaChallengeTTL)
+	claims.Purpose = "mfa_challenge"
+	return s.Tokens.Sign(claims)
+}
+
+func (s *AuthService) parseMFAChallenge(challenge string) (int, time.Time, error) {
+	claims, err := s.Tokens.Parse(challenge)
+	if err != nil || claims.Purpose != "mfa_challenge" || claims.IssuedAt == nil {
+		return 0, time.Time{}, ErrInvalidMFAChallenge
+	}
+	return claims.UserID, claims.IssuedAt.Time, nil
 }
@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AccountLockedError se devuelve mientras el login está bloqueado para la cuenta, la IP o el 2FA del usuario.
+type AccountLockedError struct {
+	Until time.Time
+}
+
+func (e *AccountLockedError) Error() string {
+	return "demasiados intentos fallidos, probá de nuevo más tarde"
+}
+
+// LoginThrottle limita la fuerza bruta sobre el login: cuenta los fallos por
+// email y por IP (y los del segundo factor por usuario), demora cada respuesta
+// fallida un poco más que la anterior y bloquea temporalmente al pasar el límite.
+type LoginThrottle struct {
+	Attempts *LoginAttemptRepository
+
+	MaxAccountFailures int           // fallos seguidos de una cuenta antes de bloquearla
+	MaxIPFailures      int           // fallos desde una IP (cualquier cuenta) antes de bloquearla
+	MaxMFAFailures     int           // códigos de 2FA inválidos seguidos antes de bloquear el segundo factor
+	MaxChallengeTries  int           // códigos inválidos que admite un mismo challenge de login
+	Window             time.Duration // período en el que se cuentan los fallos
+	LockoutDuration    time.Duration // primer bloqueo; se duplica con cada bloqueo en 24 horas
+	MaxLockout         time.Duration
+	BaseDelay          time.Duration // demora desde el segundo fallo; se duplica con cada fallo
+	MaxDelay           time.Duration
+}
+
+// NewLoginThrottle crea el limitador con los valores por defecto
+func NewLoginThrottle(attempts *LoginAttemptRepository) *LoginThrottle {
+	return &LoginThrottle{
+		Attempts:           attempts,
+		MaxAccountFailures: 5,
+		MaxIPFailures:      20,
+		MaxMFAFailures:     5,
+		MaxChallengeTries:  3,
+		Window:             15 * time.Minute,
+		LockoutDuration:    15 * time.Minute,
+		MaxLockout:         24 * time.Hour,
+		BaseDelay:          500 * time.Millisecond,
+		MaxDelay:           5 * time.Second,
+	}
+}
+
+// Check devuelve *AccountLockedError si el email o la IP están bloqueados
+func (t *LoginThrottle) Check(email, ipAddress string) error {
+	until, err := t.Attempts.LockedUntil(normalizeEmail(email), ipAddress)
+	if err != nil {
+		return err
+	}
+	if !until.IsZero() {
+		return &AccountLockedError{Until: until}
+	}
+	return nil
+}
+
+// Success registra un login correcto; los fallos anteriores de la cuenta dejan de contar
+func (t *LoginThrottle) Success(email, ipAddress string) error {
+	return t.Attempts.RecordAttempt(normalizeEmail(email), ipAddress, true)
+}
+
+// Failure registra el fallo, bloquea si se pasó algún límite y aplica la demora progresiva
+func (t *LoginThrottle) Failure(email, ipAddress string) error {
+	email = normalizeEmail(email)
+	if err := t.Attempts.RecordAttempt(email, ipAddress, false); err != nil {
+		return err
+	}
+	since := time.Now().Add(-t.Window)
+
+	accountFailures, err := t.Attempts.CountAccountFailures(email, since)
+	if err != nil {
+		return err
+	}
+	if accountFailures >= t.MaxAccountFailures {
+		if err := t.lock(&Lockout{Scope: "account", Email: email, FailedAttempts: accountFailures}); err != nil {
+			return err
+		}
+	}
+
+	if ipAddress != "" {
+		ipFailures, err := t.Attempts.CountIPFailures(ipAddress, since)
+		if err != nil {
+			return err
+		}
+		if ipFailures >= t.MaxIPFailures {
+			if err := t.lock(&Lockout{Scope: "ip", IPAddress: ipAddress, FailedAttempts: ipFailures}); err != nil {
+				return err
+			}
+		}
+	}
+
+	if delay := t.delay(accountFailures); delay > 0 {
+		time.Sleep(delay)
+	}
+	return nil
+}
+
+// CheckSecondFactor devuelve *AccountLockedError si el 2FA del usuario está bloqueado
+func (t *LoginThrottle) CheckSecondFactor(userID int) error {
+	until, err := t.Attempts.SecondFactorLockedUntil(userID)
+	if err != nil {
+		return err
+	}
+	if !until.IsZero() {
+		return &AccountLockedError{Until: until}
+	}
+	return nil
+}
+
+// ChallengeExhausted indica si desde que se emitió el challenge ya se probaron
+// MaxChallengeTries códigos inválidos; en ese caso hay que volver a loguearse.
+func (t *LoginThrottle) ChallengeExhausted(userID int, issuedAt time.Time) (bool, error) {
+	failures, err := t.Attempts.CountSecondFactorFailures(userID, issuedAt)
+	if err != nil {
+		return false, err
+	}
+	return failures >= t.MaxChallengeTries, nil
+}
+
+// SecondFactorSuccess registra un código válido; los fallos anteriores dejan de contar
+func (t *LoginThrottle) SecondFactorSuccess(userID int) error {
+	return t.Attempts.RecordSecondFactorAttempt(userID, true)
+}
+
+// SecondFactorFailure registra un código inválido con la misma demora y bloqueo que el login
+func (t *LoginThrottle) SecondFactorFailure(userID int) error {
+	if err := t.Attempts.RecordSecondFactorAttempt(userID, false); err != nil {
+		return err
+	}
+	failures, err := t.Attempts.CountSecondFactorFailures(userID, time.Now().Add(-t.Window))
+	if err != nil {
+		return err
+	}
+	if failures >= t.MaxMFAFailures {
+		if err := t.lock(&Lockout{Scope: "mfa", UserID: &userID, FailedAttempts: failures}); err != nil {
+			return err
+		}
+	}
+
+	if delay := t.delay(failures); delay > 0 {
+		time.Sleep(delay)
+	}
+	return nil
+}
+
+// lock completa LockedUntil según los bloqueos previos de la misma cuenta, IP o usuario y lo guarda
+func (t *LoginThrottle) lock(lockout *Lockout) error {
+	key := lockout.Email
+	switch lockout.Scope {
+	case "ip":
+		key = lockout.IPAddress
+	case "mfa":
+		key = strconv.Itoa(*lockout.UserID)
+	}
+	previous, err := t.Attempts.CountLockouts(lockout.Scope, key, time.Now().Add(-24*time.Hour))
+	if err != nil {
+		return err
+	}
+
+	duration := t.LockoutDuration
+	for i := 0; i < previous && duration < t.MaxLockout; i++ {
+		duration *= 2
+	}
+	if duration > t.MaxLockout {
+		duration = t.MaxLockout
+	}
+
+	lockout.LockedUntil = time.Now().Add(duration)
+	if err := t.Attempts.CreateLockout(lockout); err != nil {
+		return err
+	}
+	log.Printf("[AUTH] Login bloqueado (%s %s) hasta %s tras %d fallos", lockout.Scope, key, lockout.LockedUntil.Format(time.RFC3339), lockout.FailedAttempts)
+
+	// Los intentos de más de un día ya no cuentan para ningún límite
+	if err := t.Attempts.PruneAttempts(time.Now().Add(-24 * time.Hour)); err != nil {
+		return fmt.Errorf("limpiando intentos viejos: %w", err)
+	}
+	return nil
+}
+
+// delay es cero en el primer fallo y después se duplica hasta MaxDelay
+func (t *LoginThrottle) delay(failures int) time.Duration {
+	if failures < 2 || t.BaseDelay <= 0 {
+		return 0
+	}
+	delay := t.BaseDelay
+	for i := 2; i < failures && delay < t.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > t.MaxDelay {
+		delay = t.MaxDelay
+	}
+	return delay
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	defaultIssuer   = "toller"
+	defaultAudience = "toller-api"
+	// Tolerancia de reloj entre servicios al validar exp / nbf
+	clockSkew = 30 * time.Second
+)
+
+var (
+	ErrInvalidToken  = errors.New("token inválido o expirado")
+	ErrSessionClosed = errors.New("sesión revocada o expirada")
+)
+
+// Claims son los claims de los tokens que emite Toller.
+type Claims struct {
+	UserID    int    `json:"user_id"`
+	SessionID int    `json:"sid,omitempty"`
+	Purpose   string `json:"purpose,omitempty"` // vacío en los access tokens; "mfa_challenge" en el challenge de 2FA
+	jwt.RegisteredClaims
+
+	// Solo para tokens personales: nunca viajan en un JWT
+	TokenID int      `json:"-"`
+	Scopes  []string `json:"-"`
+}
+
+// TokenVerifier es el único lugar donde se decide qué token se acepta:
+// lo usan el middleware REST, el WebSocket y el challenge de 2FA.
+type TokenVerifier struct {
+	Keys           *KeyRing
+	Sessions       *SessionRepository
+	PersonalTokens *PersonalTokenRepository // opcional: sin él no se aceptan tokens personales
+	Issuer         string                   // claim "iss" (por defecto "toller")
+	Audience       string                   // claim "aud" (por defecto "toller-api")
+}
+
+func (v *TokenVerifier) issuer() string {
+	if v.Issuer == "" {
+		return defaultIssuer
+	}
+	return v.Issuer
+}
+
+func (v *TokenVerifier) audience() string {
+	if v.Audience == "" {
+		return defaultAudience
+	}
+	return v.Audience
+}
+
+// NewClaims arma los claims estándar (iss, aud, iat, nbf, exp) de un token nuevo
+func (v *TokenVerifier) NewClaims(userID int, ttl time.Duration) Claims {
+	now := time.Now()
+	return Claims{
+		UserID: userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    v.issuer(),
+			Audience:  jwt.ClaimStrings{v.audience()},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+}
+
+// Sign firma los claims con la clave activa del key ring
+func (v *TokenVerifier) Sign(claims Claims) (string, error) {
+	return v.Keys.Sign(claims)
+}
+
+// Parse valida firma, algoritmo, iss, aud, exp y nbf. No mira la sesión.
+func (v *TokenVerifier) Parse(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, v.Keys.Keyfunc,
+		jwt.WithValidMethods(v.Keys.ValidMethods()),
+		jwt.WithIssuer(v.issuer()),
+		jwt.WithAudience(v.audience()),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(clockSkew),
+	)
+	if err != nil || !token.Valid || claims.UserID <= 0 {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// VerifyAccessToken valida un access token: además de Parse exige que sea un
+// access token (con sesión y sin purpose) y que la sesión siga activa.
+// Los tokens personales (prefijo tpat_) se validan contra la base.
+func (v *TokenVerifier) VerifyAccessToken(tokenString string) (*Claims, error) {
+	if strings.HasPrefix(tokenString, personalTokenPrefix) {
+		return v.verifyPersonalToken(tokenString)
+	}
+
+	claims, err := v.Parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != "" || claims.SessionID <= 0 {
+		return nil, ErrInvalidToken
+	}
+
+	active, err := v.Sessions.IsSessionActive(claims.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		return nil, ErrSessionClosed
+	}
+	if err := v.Sessions.TouchSession(claims.SessionID); err != nil {
+		log.Printf("[AUTH] Error actualizando last_seen de la sesión %d: %v", claims.SessionID, err)
+	}
+	return claims, nil
+}
+
+func (v *TokenVerifier) verifyPersonalToken(tokenString string) (*Claims, error) {
+	if v.PersonalTokens == nil {
+		return nil, ErrInvalidToken
+	}
+	token, err := v.PersonalTokens.GetActiveByHash(hashToken(tokenString))
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := v.PersonalTokens.TouchToken(token.ID); err != nil {
+		log.Printf("[AUTH] Error actualizando last_used_at del token %d: %v", token.ID, err)
+	}
+	return &Claims{UserID: token.UserID, TokenID: token.ID, Scopes: token.Scopes}, nil
+}
+
+type contextKey int
+
+const (
+	claimsKey contextKey = iota
+	clientInfoKey
+)
+
+// ContextWithClaims guarda los claims del token verificado en el contexto
+func ContextWithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey, claims)
+}
+
+// ClaimsFromContext devuelve los claims que dejó el middleware
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey).(*Claims)
+	return claims, ok
+}
+
+// ClientInfoFromContext devuelve el user agent y la IP del cliente que dejó el middleware
+func ClientInfoFromContext(ctx context.Context) (ClientInfo, bool) {
+	client, ok := ctx.Value(clientInfoKey).(ClientInfo)
+	return client, ok
+}
+
+// UserIDFromContext devuelve el usuario autenticado de la request
+func UserIDFromContext(ctx context.Context) (int, bool) {
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok {
+		return 0, false
+	}
+	return claims.UserID, true
+}
+
+// SessionIDFromContext devuelve la sesión del access token de la request
+func SessionIDFromContext(ctx context.Context) (int, bool) {
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok {
+		return 0, false
+	}
+	return claims.SessionID, true
+}
@@ -3,9 +3,13 @@ package channels
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
+	"toller-server/modules/audit"
+	"toller-server/modules/auth"
+
 	"github.com/gorilla/mux"
 )
 
@@ -14,7 +18,8 @@ type ChannelHandler struct {
 }
 
 type CreateChannelRequest struct {
-	Name string `json:"name"`
+	Name      string `json:"name"`
+	IsDefault bool   `json:"is_default"`
 }
 
 type AddMemberRequest struct {
@@ -23,7 +28,8 @@ type AddMemberRequest struct {
 }
 
 type UpdateChannelRequest struct {
-	Name string `json:"name"`
+	Name      string `json:"name"`
+	IsDefault *bool  `json:"is_default"` // nil = sem mudança
 }
 
 // CreateChannel cria um novo canal
@@ -35,7 +41,7 @@ func (h *ChannelHandler) CreateChannel(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID, ok := r.Context().Value("user_id").(int)
+	userID, ok := auth.UserIDFromContext(r.Context())
 	if !ok {
 		http.Error(w, "Usuário não autenticado", http.StatusUnauthorized)
 		return
@@ -47,7 +53,11 @@ func (h *ChannelHandler) CreateChannel(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	channel, err := h.Service.CreateChannel(req.Name, teamID, userID)
+	channel, err := h.Service.CreateChannel(req.Name, teamID, userID, req.IsDefault, audit.MetaFromRequest(r))
+	if errors.Is(err, ErrSemPermissao) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -67,7 +77,7 @@ func (h *ChannelHandler) GetChannelsByTeam(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	userID, ok := r.Context().Value("user_id").(int)
+	userID, ok := auth.UserIDFromContext(r.Context())
 	if !ok {
 		http.Error(w, "Usuário não autenticado", http.StatusUnauthorized)
 		return
@@ -92,7 +102,7 @@ func (h *ChannelHandler) GetChannelByID(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	userID, ok := r.Context().Value("user_id").(int)
+	userID, ok := auth.UserIDFromContext(r.Context())
 	if !ok {
 		http.Error(w, "Usuário não autenticado", http.StatusUnauthorized)
 		return
@@ -117,7 +127,7 @@ func (h *ChannelHandler) AddMember(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	requestingUserID, ok := r.Context().Value("user_id").(int)
+	requestingUserID, ok := auth.UserIDFromContext(r.Context())
 	if !ok {
 		http.Error(w, "Usuário não autenticado", http.StatusUnauthorized)
 		return
@@ -129,7 +139,7 @@ func (h *ChannelHandler) AddMember(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.Service.AddMemberToChannel(channelID, req.UserID, requestingUserID, req.Role)
+	err = h.Service.AddMemberToChannel(channelID, req.UserID, requestingUserID, req.Role, audit.MetaFromRequest(r))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusForbidden)
 		return
@@ -154,13 +164,13 @@ func (h *ChannelHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	requestingUserID, ok := r.Context().Value("user_id").(int)
+	requestingUserID, ok := auth.UserIDFromContext(r.Context())
 	if !ok {
 		http.Error(w, "Usuário não autenticado", http.StatusUnauthorized)
 		return
 	}
 
-	err = h.Service.RemoveMemberFromChannel(channelID, userID, requestingUserID)
+	err = h.Service.RemoveMemberFromChannel(channelID, userID, requestingUserID, audit.MetaFromRequest(r))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusForbidden)
 		return
@@ -179,7 +189,7 @@ func (h *ChannelHandler) GetChannelMembers(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	requestingUserID, ok := r.Context().Value("user_id").(int)
+	requestingUserID, ok := auth.UserIDFromContext(r.Context())
 	if !ok {
 		http.Error(w, "Usuário não autenticado", http.StatusUnauthorized)
 		return
@@ -204,13 +214,13 @@ func (h *ChannelHandler) DeleteChannel(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID, ok := r.Context().Value("user_id").(int)
+	userID, ok := auth.UserIDFromContext(r.Context())
 	if !ok {
 		http.Error(w, "Usuário não autenticado", http.StatusUnauthorized)
 		return
 	}
 
-	err = h.Service.DeleteChannel(channelID, userID)
+	err = h.Service.DeleteChannel(channelID, userID, audit.MetaFromRequest(r))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusForbidden)
 		return
@@ -229,7 +239,7 @@ func (h *ChannelHandler) UpdateChannel(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID, ok := r.Context().Value("user_id").(int)
+	userID, ok := auth.UserIDFromContext(r.Context())
 	if !ok {
 		http.Error(w, "Usuário não autenticado", http.StatusUnauthorized)
 		return
@@ -241,10 +251,20 @@ func (h *ChannelHandler) UpdateChannel(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.Service.UpdateChannelName(channelID, req.Name, userID)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusForbidden)
-		return
+	// O nome é obrigatório, a não ser que só se mude is_default
+	if req.Name != "" || req.IsDefault == nil {
+		err = h.Service.UpdateChannelName(channelID, req.Name, userID, audit.MetaFromRequest(r))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+	if req.IsDefault != nil {
+		err = h.Service.SetChannelDefault(channelID, *req.IsDefault, userID, audit.MetaFromRequest(r))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
 	}
 
 	w.WriteHeader(http.StatusOK)
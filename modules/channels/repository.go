@@ -5,19 +5,23 @@ import (
 	"database/sql"
 	"errors"
 	"time"
+
+	"toller-server/modules/users"
 )
 
 type Channel struct {
 	ID        int       `json:"id"`
 	Name      string    `json:"name"`
 	TeamID    int       `json:"team_id"`
+	IsDefault bool      `json:"is_default"` // os novos membros do time entram automaticamente
 	CreatedAt time.Time `json:"created_at"`
 }
 
 type ChannelMember struct {
-	UserID    int    `json:"user_id"`
-	ChannelID int    `json:"channel_id"`
-	Role      string `json:"role"` // admin, user
+	UserID    int               `json:"user_id"`
+	ChannelID int               `json:"channel_id"`
+	Role      string            `json:"role"` // admin, user
+	User      users.UserSummary `json:"user"`
 }
 
 type ChannelWithRole struct {
@@ -29,8 +33,9 @@ type ChannelRepository struct {
 	DB *sql.DB
 }
 
-// CreateChannel cria um novo canal e adiciona o criador como admin
-func (r *ChannelRepository) CreateChannel(name string, teamID, creatorID int) (*Channel, error) {
+// CreateChannel cria um novo canal e adiciona o criador como admin. Um canal
+// padrão recebe também todos os membros do time
+func (r *ChannelRepository) CreateChannel(name string, teamID, creatorID int, isDefault bool) (*Channel, error) {
 	tx, err := r.DB.Begin()
 	if err != nil {
 		return nil, err
@@ -40,14 +45,15 @@ func (r *ChannelRepository) CreateChannel(name string, teamID, creatorID int) (*
 	// Criar o canal
 	var channel Channel
 	query := `
-		INSERT INTO channels (name, team_id, created_at)
-		VALUES ($1, $2, CURRENT_TIMESTAMP)
-		RETURNING id, name, team_id, created_at
+		INSERT INTO channels (name, team_id, is_default, created_at)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
+		RETURNING id, name, team_id, is_default, created_at
 	`
-	err = tx.QueryRow(query, name, teamID).Scan(
+	err = tx.QueryRow(query, name, teamID, isDefault).Scan(
 		&channel.ID,
 		&channel.Name,
 		&channel.TeamID,
+		&channel.IsDefault,
 		&channel.CreatedAt,
 	)
 	if err != nil {
@@ -63,6 +69,12 @@ func (r *ChannelRepository) CreateChannel(name string, teamID, creatorID int) (*
 		return nil, err
 	}
 
+	if isDefault {
+		if _, err = addTeamMembers(tx, channel.ID, teamID); err != nil {
+			return nil, err
+		}
+	}
+
 	if err = tx.Commit(); err != nil {
 		return nil, err
 	}
@@ -73,7 +85,7 @@ func (r *ChannelRepository) CreateChannel(name string, teamID, creatorID int) (*
 // GetChannelsByTeam retorna todos os canais de um time aos quais o usuário pertence
 func (r *ChannelRepository) GetChannelsByTeam(teamID, userID int) ([]ChannelWithRole, error) {
 	query := `
-		SELECT c.id, c.name, c.team_id, c.created_at, cu.role
+		SELECT c.id, c.name, c.team_id, c.is_default, c.created_at, cu.role
 		FROM channels c
 		INNER JOIN channel_users cu ON c.id = cu.channel_id
 		WHERE c.team_id = $1 AND cu.user_id = $2
@@ -93,6 +105,7 @@ func (r *ChannelRepository) GetChannelsByTeam(teamID, userID int) ([]ChannelWith
 			&ch.ID,
 			&ch.Name,
 			&ch.TeamID,
+			&ch.IsDefault,
 			&ch.CreatedAt,
 			&ch.UserRole,
 		)
@@ -109,7 +122,7 @@ func (r *ChannelRepository) GetChannelsByTeam(teamID, userID int) ([]ChannelWith
 func (r *ChannelRepository) GetChannelByID(channelID int) (*Channel, error) {
 	var channel Channel
 	query := `
-		SELECT id, name, team_id, created_at
+		SELECT id, name, team_id, is_default, created_at
 		FROM channels
 		WHERE id = $1
 	`
@@ -117,6 +130,7 @@ func (r *ChannelRepository) GetChannelByID(channelID int) (*Channel, error) {
 		&channel.ID,
 		&channel.Name,
 		&channel.TeamID,
+		&channel.IsDefault,
 		&channel.CreatedAt,
 	)
 	if err == sql.ErrNoRows {
@@ -142,24 +156,6 @@ func (r *ChannelRepository) IsUserInChannel(userID, channelID int) (bool, error)
 	return exists, err
 }
 
-// IsUserChannelAdmin verifica se um usuário é admin de um canal
-func (r *ChannelRepository) IsUserChannelAdmin(userID, channelID int) (bool, error) {
-	var role string
-	query := `
-		SELECT role FROM channel_users
-		WHERE user_id = $1 AND channel_id = $2
-	`
-	err := r.DB.QueryRow(query, userID, channelID).Scan(&role)
-	if err == sql.ErrNoRows {
-		return false, nil
-	}
-	if err != nil {
-		return false, err
-	}
-
-	return role == "admin", nil
-}
-
 // AddUserToChannel adiciona um usuário a um canal
 func (r *ChannelRepository) AddUserToChannel(userID, channelID int, role string) error {
 	query := `
@@ -197,9 +193,10 @@ func (r *ChannelRepository) RemoveUserFromChannel(userID, channelID int) error {
 // GetChannelMembers retorna todos os membros de um canal
 func (r *ChannelRepository) GetChannelMembers(channelID int) ([]ChannelMember, error) {
 	query := `
-		SELECT user_id, channel_id, role
-		FROM channel_users
-		WHERE channel_id = $1
+		SELECT cu.user_id, cu.channel_id, cu.role, ` + users.SummaryColumns("u") + `
+		FROM channel_users cu
+		JOIN users u ON u.id = cu.user_id
+		WHERE cu.channel_id = $1
 	`
 
 	rows, err := r.DB.Query(query, channelID)
@@ -211,7 +208,8 @@ func (r *ChannelRepository) GetChannelMembers(channelID int) ([]ChannelMember, e
 	var members []ChannelMember
 	for rows.Next() {
 		var member ChannelMember
-		err := rows.Scan(&member.UserID, &member.ChannelID, &member.Role)
+		dest := append([]interface{}{&member.UserID, &member.ChannelID, &member.Role}, member.User.ScanDest()...)
+		err := rows.Scan(dest...)
 		if err != nil {
 			return nil, err
 		}
@@ -241,15 +239,66 @@ func (r *ChannelRepository) DeleteChannel(channelID int) error {
 	return nil
 }
 
-// IsUserInTeam verifica se um usuário pertence a um time
+// IsUserInTeam verifica se um usuário pertence a um time (um time excluído não tem membros)
 func (r *ChannelRepository) IsUserInTeam(userID, teamID int) (bool, error) {
 	var exists bool
 	query := `
 		SELECT EXISTS(
-			SELECT 1 FROM user_teams
-			WHERE user_id = $1 AND team_id = $2
+			SELECT 1 FROM user_teams ut
+			INNER JOIN teams t ON t.id = ut.team_id
+			WHERE ut.user_id = $1 AND ut.team_id = $2 AND t.deleted_at IS NULL
 		)
 	`
 	err := r.DB.QueryRow(query, userID, teamID).Scan(&exists)
 	return exists, err
 }
+
+// SetDefault marca ou desmarca o canal como padrão. Ao marcá-lo, todos os
+// membros atuais do time entram no canal; retorna quantos foram adicionados
+func (r *ChannelRepository) SetDefault(channelID, teamID int, isDefault bool) (int64, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE channels SET is_default = $1 WHERE id = $2`, isDefault, channelID); err != nil {
+		return 0, err
+	}
+
+	var added int64
+	if isDefault {
+		if added, err = addTeamMembers(tx, channelID, teamID); err != nil {
+			return 0, err
+		}
+	}
+
+	return added, tx.Commit()
+}
+
+// JoinDefaultChannels adiciona o usuário a todos os canais padrão do time
+func (r *ChannelRepository) JoinDefaultChannels(teamID, userID int) error {
+	query := `
+		INSERT INTO channel_users (user_id, channel_id, role)
+		SELECT $2, id, 'user' FROM channels
+		WHERE team_id = $1 AND is_default
+		ON CONFLICT (user_id, channel_id) DO NOTHING
+	`
+	_, err := r.DB.Exec(query, teamID, userID)
+	return err
+}
+
+// addTeamMembers adiciona ao canal os membros do time que ainda não estão nele
+func addTeamMembers(tx *sql.Tx, channelID, teamID int) (int64, error) {
+	result, err := tx.Exec(`
+		INSERT INTO channel_users (user_id, channel_id, role)
+		SELECT ut.user_id, $1, 'user' FROM user_teams ut
+		JOIN teams t ON t.id = ut.team_id
+		WHERE ut.team_id = $2 AND t.deleted_at IS NULL
+		ON CONFLICT (user_id, channel_id) DO NOTHING
+	`, channelID, teamID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -4,6 +4,8 @@ package channels
 import (
 	"net/http"
 
+	"toller-server/modules/auth"
+
 	"github.com/gorilla/mux"
 )
 
@@ -14,16 +16,16 @@ func RegisterRoutes(r *mux.Router, handler *ChannelHandler, authMiddleware func(
 	api.Use(authMiddleware)
 
 	// Rotas de canais por time
-	api.HandleFunc("/teams/{team_id}/channels", handler.CreateChannel).Methods("POST")
-	api.HandleFunc("/teams/{team_id}/channels", handler.GetChannelsByTeam).Methods("GET")
+	api.HandleFunc("/teams/{team_id}/channels", auth.RequireScope(auth.ScopeChannelsWrite, handler.CreateChannel)).Methods("POST")
+	api.HandleFunc("/teams/{team_id}/channels", auth.RequireScope(auth.ScopeChannelsRead, handler.GetChannelsByTeam)).Methods("GET")
 
 	// Rotas de canal específico
-	api.HandleFunc("/channels/{channel_id}", handler.GetChannelByID).Methods("GET")
-	api.HandleFunc("/channels/{channel_id}", handler.UpdateChannel).Methods("PUT", "PATCH")
-	api.HandleFunc("/channels/{channel_id}", handler.DeleteChannel).Methods("DELETE")
+	api.HandleFunc("/channels/{channel_id}", auth.RequireScope(auth.ScopeChannelsRead, handler.GetChannelByID)).Methods("GET")
+	api.HandleFunc("/channels/{channel_id}", auth.RequireScope(auth.ScopeChannelsWrite, handler.UpdateChannel)).Methods("PUT", "PATCH")
+	api.HandleFunc("/channels/{channel_id}", auth.RequireScope(auth.ScopeChannelsWrite, handler.DeleteChannel)).Methods("DELETE")
 
 	// Rotas de membros do canal
-	api.HandleFunc("/channels/{channel_id}/members", handler.GetChannelMembers).Methods("GET")
-	api.HandleFunc("/channels/{channel_id}/members", handler.AddMember).Methods("POST")
-	api.HandleFunc("/channels/{channel_id}/members/{user_id}", handler.RemoveMember).Methods("DELETE")
+	api.HandleFunc("/channels/{channel_id}/members", auth.RequireScope(auth.ScopeChannelsRead, handler.GetChannelMembers)).Methods("GET")
+	api.HandleFunc("/channels/{channel_id}/members", auth.RequireScope(auth.ScopeChannelsWrite, handler.AddMember)).Methods("POST")
+	api.HandleFunc("/channels/{channel_id}/members/{user_id}", auth.RequireScope(auth.ScopeChannelsWrite, handler.RemoveMember)).Methods("DELETE")
 }
@@ -3,14 +3,27 @@ package channels
 
 import (
 	"errors"
+	"fmt"
+
+	"toller-server/modules/audit"
+	"toller-server/modules/permissions"
 )
 
+// ErrSemPermissao indica que falta ao usuário uma permissão no time ou no canal
+var ErrSemPermissao = errors.New("sem permissão para esta ação")
+
+// DefaultChannelName é o canal padrão criado junto com cada time
+const DefaultChannelName = "general"
+
 type ChannelService struct {
-	Repo *ChannelRepository
+	Repo  *ChannelRepository
+	Authz *permissions.Authorizer
+	Audit *audit.AuditLog // opcional, registra as mudanças no log de auditoria do time
 }
 
-// CreateChannel cria um novo canal
-func (s *ChannelService) CreateChannel(name string, teamID, creatorID int) (*Channel, error) {
+// CreateChannel cria um novo canal. Criar um canal padrão, que recebe todos os
+// membros do time, exige manage_channels no time
+func (s *ChannelService) CreateChannel(name string, teamID, creatorID int, isDefault bool, meta audit.Meta) (*Channel, error) {
 	if name == "" {
 		return nil, errors.New("nome do canal é obrigatório")
 	}
@@ -23,8 +36,67 @@ func (s *ChannelService) CreateChannel(name string, teamID, creatorID int) (*Cha
 	if !inTeam {
 		return nil, errors.New("usuário não pertence ao time")
 	}
+	if err := s.requireTeam(creatorID, teamID, permissions.CreateChannels); err != nil {
+		return nil, err
+	}
+	if isDefault {
+		if err := s.requireTeam(creatorID, teamID, permissions.ManageChannels); err != nil {
+			return nil, err
+		}
+	}
+
+	channel, err := s.Repo.CreateChannel(name, teamID, creatorID, isDefault)
+	if err != nil {
+		return nil, err
+	}
+	s.recordCreate(channel, creatorID, meta)
+	return channel, nil
+}
+
+// CreateDefaultChannels cria o #general de um time novo, com o criador como admin.
+// O módulo de times chama ao criar o time
+func (s *ChannelService) CreateDefaultChannels(teamID, creatorID int) error {
+	channel, err := s.Repo.CreateChannel(DefaultChannelName, teamID, creatorID, true)
+	if err != nil {
+		return err
+	}
+	s.recordCreate(channel, creatorID, audit.Meta{})
+	return nil
+}
 
-	return s.Repo.CreateChannel(name, teamID, creatorID)
+// JoinDefaultChannels adiciona um novo membro do time aos canais padrão.
+// O módulo de times chama sempre que alguém entra no time
+func (s *ChannelService) JoinDefaultChannels(teamID, userID int) error {
+	return s.Repo.JoinDefaultChannels(teamID, userID)
+}
+
+// SetChannelDefault marca ou desmarca o canal como padrão (requer manage_channels
+// no time). Ao marcá-lo, os membros atuais do time também entram no canal
+func (s *ChannelService) SetChannelDefault(channelID int, isDefault bool, userID int, meta audit.Meta) error {
+	channel, err := s.Repo.GetChannelByID(channelID)
+	if err != nil {
+		return err
+	}
+	if err := s.requireTeam(userID, channel.TeamID, permissions.ManageChannels); err != nil {
+		return err
+	}
+	if channel.IsDefault == isDefault {
+		return nil
+	}
+
+	added, err := s.Repo.SetDefault(channelID, channel.TeamID, isDefault)
+	if err != nil {
+		return err
+	}
+	s.record(audit.Entry{
+		TeamID: channel.TeamID, ActorID: userID, Action: audit.ChannelUpdate, TargetType: audit.TargetChannel, TargetID: channelID,
+		Changes: audit.Diff(
+			map[string]interface{}{"is_default": channel.IsDefault},
+			map[string]interface{}{"is_default": isDefault, "members_added": added},
+		),
+		Meta: meta,
+	})
+	return nil
 }
 
 // GetChannelsByTeam retorna os canais de um time para o usuário
@@ -56,15 +128,11 @@ func (s *ChannelService) GetChannelByID(channelID, userID int) (*Channel, error)
 }
 
 // AddMemberToChannel adiciona um membro ao canal
-func (s *ChannelService) AddMemberToChannel(channelID, userID, requestingUserID int, role string) error {
-	// Verificar se o usuário que está fazendo a requisição é admin do canal
-	isAdmin, err := s.Repo.IsUserChannelAdmin(requestingUserID, channelID)
-	if err != nil {
+func (s *ChannelService) AddMemberToChannel(channelID, userID, requestingUserID int, role string, meta audit.Meta) error {
+	// Verificar se o usuário tem manage_channels no canal
+	if err := s.requireManage(requestingUserID, channelID); err != nil {
 		return err
 	}
-	if !isAdmin {
-		return errors.New("apenas administradores podem adicionar membros")
-	}
 
 	// Verificar se o canal existe
 	channel, err := s.Repo.GetChannelByID(channelID)
@@ -86,19 +154,33 @@ func (s *ChannelService) AddMemberToChannel(channelID, userID, requestingUserID
 		role = "user"
 	}
 
-	return s.Repo.AddUserToChannel(userID, channelID, role)
+	// Tornar alguém admin do canal dá as permissões de admin: só quem já as tem pode fazer isso
+	if role == "admin" {
+		perms, err := s.Authz.ChannelPermissions(requestingUserID, channelID)
+		if err != nil {
+			return err
+		}
+		if !perms.HasAll(permissions.ChannelAdminGrants) {
+			return fmt.Errorf("%w: %s", ErrSemPermissao, "admin do canal")
+		}
+	}
+
+	if err := s.Repo.AddUserToChannel(userID, channelID, role); err != nil {
+		return err
+	}
+	s.record(audit.Entry{
+		TeamID: channel.TeamID, ActorID: requestingUserID, Action: audit.ChannelMemberAdd, TargetType: audit.TargetChannel, TargetID: channelID,
+		Changes: audit.Diff(nil, map[string]interface{}{"user_id": userID, "role": role}), Meta: meta,
+	})
+	return nil
 }
 
 // RemoveMemberFromChannel remove um membro do canal
-func (s *ChannelService) RemoveMemberFromChannel(channelID, userID, requestingUserID int) error {
-	// Verificar se o usuário que está fazendo a requisição é admin do canal
-	isAdmin, err := s.Repo.IsUserChannelAdmin(requestingUserID, channelID)
-	if err != nil {
+func (s *ChannelService) RemoveMemberFromChannel(channelID, userID, requestingUserID int, meta audit.Meta) error {
+	// Verificar se o usuário tem manage_channels no canal
+	if err := s.requireManage(requestingUserID, channelID); err != nil {
 		return err
 	}
-	if !isAdmin {
-		return errors.New("apenas administradores podem remover membros")
-	}
 
 	// Não permitir que o último admin se remova
 	members, err := s.Repo.GetChannelMembers(channelID)
@@ -117,7 +199,18 @@ func (s *ChannelService) RemoveMemberFromChannel(channelID, userID, requestingUs
 		return errors.New("não é possível remover o último administrador do canal")
 	}
 
-	return s.Repo.RemoveUserFromChannel(userID, channelID)
+	channel, err := s.Repo.GetChannelByID(channelID)
+	if err != nil {
+		return err
+	}
+	if err := s.Repo.RemoveUserFromChannel(userID, channelID); err != nil {
+		return err
+	}
+	s.record(audit.Entry{
+		TeamID: channel.TeamID, ActorID: requestingUserID, Action: audit.ChannelMemberRemove, TargetType: audit.TargetChannel, TargetID: channelID,
+		Changes: audit.Diff(map[string]interface{}{"user_id": userID}, nil), Meta: meta,
+	})
+	return nil
 }
 
 // GetChannelMembers retorna os membros de um canal
@@ -135,35 +228,90 @@ func (s *ChannelService) GetChannelMembers(channelID, requestingUserID int) ([]C
 }
 
 // DeleteChannel remove um canal
-func (s *ChannelService) DeleteChannel(channelID, userID int) error {
-	// Verificar se o usuário é admin do canal
-	isAdmin, err := s.Repo.IsUserChannelAdmin(userID, channelID)
+func (s *ChannelService) DeleteChannel(channelID, userID int, meta audit.Meta) error {
+	// Verificar se o usuário tem manage_channels no canal
+	if err := s.requireManage(userID, channelID); err != nil {
+		return err
+	}
+
+	channel, err := s.Repo.GetChannelByID(channelID)
 	if err != nil {
 		return err
 	}
-	if !isAdmin {
-		return errors.New("apenas administradores podem deletar o canal")
+	if err := s.Repo.DeleteChannel(channelID); err != nil {
+		return err
 	}
-
-	return s.Repo.DeleteChannel(channelID)
+	s.record(audit.Entry{
+		TeamID: channel.TeamID, ActorID: userID, Action: audit.ChannelDelete, TargetType: audit.TargetChannel, TargetID: channelID,
+		Changes: audit.Diff(map[string]interface{}{"name": channel.Name}, nil), Meta: meta,
+	})
+	return nil
 }
 
 // UpdateChannelName atualiza o nome do canal
-func (s *ChannelService) UpdateChannelName(channelID int, newName string, userID int) error {
+func (s *ChannelService) UpdateChannelName(channelID int, newName string, userID int, meta audit.Meta) error {
 	if newName == "" {
 		return errors.New("nome do canal não pode ser vazio")
 	}
 
-	// Verificar se o usuário é admin do canal
-	isAdmin, err := s.Repo.IsUserChannelAdmin(userID, channelID)
-	if err != nil {
+	// Verificar se o usuário tem manage_channels no canal
+	if err := s.requireManage(userID, channelID); err != nil {
 		return err
 	}
-	if !isAdmin {
-		return errors.New("apenas administradores podem renomear o canal")
+
+	channel, err := s.Repo.GetChannelByID(channelID)
+	if err != nil {
+		return err
 	}
 
 	query := `UPDATE channels SET name = $1 WHERE id = $2`
-	_, err = s.Repo.DB.Exec(query, newName, channelID)
-	return err
+	if _, err := s.Repo.DB.Exec(query, newName, channelID); err != nil {
+		return err
+	}
+	if channel.Name != newName {
+		s.record(audit.Entry{
+			TeamID: channel.TeamID, ActorID: userID, Action: audit.ChannelUpdate, TargetType: audit.TargetChannel, TargetID: channelID,
+			Changes: audit.Diff(map[string]interface{}{"name": channel.Name}, map[string]interface{}{"name": newName}), Meta: meta,
+		})
+	}
+	return nil
+}
+
+// requireTeam verifica com o authorizer se o usuário tem a permissão no time
+func (s *ChannelService) requireTeam(userID, teamID int, perm string) error {
+	allowed, err := s.Authz.Can(userID, teamID, perm)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return fmt.Errorf("%w: %s", ErrSemPermissao, perm)
+	}
+	return nil
+}
+
+// requireManage verifica com o authorizer se o usuário pode administrar o canal
+// (admins do time, o admin do canal ou quem tiver manage_channels)
+func (s *ChannelService) requireManage(userID, channelID int) error {
+	allowed, err := s.Authz.CanInChannel(userID, channelID, permissions.ManageChannels)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return fmt.Errorf("%w: %s", ErrSemPermissao, permissions.ManageChannels)
+	}
+	return nil
+}
+
+func (s *ChannelService) recordCreate(channel *Channel, creatorID int, meta audit.Meta) {
+	s.record(audit.Entry{
+		TeamID: channel.TeamID, ActorID: creatorID, Action: audit.ChannelCreate, TargetType: audit.TargetChannel, TargetID: channel.ID,
+		Changes: audit.Diff(nil, map[string]interface{}{"name": channel.Name, "is_default": channel.IsDefault}), Meta: meta,
+	})
+}
+
+// record registra a ação no log de auditoria do time do canal
+func (s *ChannelService) record(e audit.Entry) {
+	if s.Audit != nil {
+		s.Audit.Record(e)
+	}
 }
@@ -4,6 +4,9 @@ import (
 	"log"
 	"time"
 
+	"toller-server/modules/presence"
+	"toller-server/modules/users"
+
 	"github.com/gorilla/websocket"
 )
 
@@ -21,10 +24,13 @@ type Client struct {
 	channelID int64
 	hub       *Hub
 	repo      *Repository
+	presence  *presence.PresenceService // opcional
+	canWrite  bool                      // false para tokens pessoais sem messages:write
+	readOnly  bool                      // sem send_messages no canal, calculado ao conectar
 }
 
 type IncomingMessage struct {
-	Type    string `json:"type"`    // "message", "typing", etc
+	Type    string `json:"type"`    // "message", "typing", "heartbeat"
 	Content string `json:"content"` // text
 }
 
@@ -35,11 +41,21 @@ type OutgoingMessage struct {
 	ChannelID int64  `json:"channel_id"`
 	MessageID int64  `json:"message_id,omitempty"`
 	CreatedAt string `json:"created_at,omitempty"`
+	// Perfil do autor, para o cliente não precisar buscar cada usuário
+	Author *users.UserSummary `json:"author,omitempty"`
+	// Eventos "presence": status visível (e modo, só para o próprio usuário)
+	Status string `json:"status,omitempty"`
+	Mode   string `json:"mode,omitempty"`
+	// Eventos "custom_status": o status personalizado do usuário (vazio se foi limpo)
+	CustomStatus *users.CustomStatus `json:"custom_status,omitempty"`
 }
 
 func (c *Client) readPump() {
 	defer func() {
 		c.hub.Unregister(c, c.channelID)
+		if c.presence != nil {
+			c.presence.Disconnect(int(c.userID))
+		}
 		_ = c.conn.Close()
 	}()
 	c.conn.SetReadLimit(maxMessageSize)
@@ -57,11 +73,34 @@ func (c *Client) readPump() {
 		// LOG CRÍTICO 1: Confirma que a mensagem foi lida do WebSocket.
 		log.Printf("CLIENT %d: Mensagem lida do WebSocket. Tipo=%s.", c.userID, im.Type)
 
+		// qualquer mensagem do cliente conta como atividade (online e não away)
+		if c.presence != nil {
+			c.presence.Touch(int(c.userID))
+		}
+
 		// process message types
 		switch im.Type {
 		case "message":
+			if !c.canWrite {
+				c.hub.reply(c, OutgoingMessage{
+					Type:      "error",
+					Content:   "o token não tem permissão para enviar mensagens",
+					UserID:    c.userID,
+					ChannelID: c.channelID,
+				})
+				continue
+			}
+			if c.readOnly {
+				c.hub.reply(c, OutgoingMessage{
+					Type:      "error",
+					Content:   "sem permissão para enviar mensagens neste canal",
+					UserID:    c.userID,
+					ChannelID: c.channelID,
+				})
+				continue
+			}
 			// persistir
-			msgID, createdAt, err := c.repo.SaveMessage(c.channelID, c.userID, im.Content)
+			msgID, createdAt, author, err := c.repo.SaveMessage(c.channelID, c.userID, im.Content)
 			if err != nil {
 				log.Println("SaveMessage error:", err)
 				continue
@@ -73,6 +112,7 @@ func (c *Client) readPump() {
 				ChannelID: c.channelID,
 				MessageID: msgID,
 				CreatedAt: createdAt.Format("2006-01-02 15:04:05"),
+				Author:    author,
 			}
 
 			// LOG CRÍTICO 2: Confirma que a mensagem foi salva e será enviada ao Hub.
@@ -80,6 +120,9 @@ func (c *Client) readPump() {
 
 			c.hub.Broadcast(c, c.channelID, out)
 		case "typing":
+			if !c.canWrite {
+				continue
+			}
 			// opcional: retransmitir estado "typing"
 			out := OutgoingMessage{
 				Type:      "typing",
@@ -88,6 +131,8 @@ func (c *Client) readPump() {
 				ChannelID: c.channelID,
 			}
 			c.hub.Broadcast(c, c.channelID, out)
+		case "heartbeat":
+			// só atualiza a presença (já feito acima)
 		default:
 			// ignorar
 		}
@@ -7,23 +7,28 @@ import (
 	"net/http"
 	"strconv"
 
-	"github.com/golang-jwt/jwt/v5"
+	"toller-server/modules/auth"
+	"toller-server/modules/permissions"
+	"toller-server/modules/presence"
+
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 )
 
 type ChatHandler struct {
-	Hub       *Hub
-	Repo      *Repository
-	JWTSecret []byte
-	Upgrader  websocket.Upgrader
+	Hub      *Hub
+	Repo     *Repository
+	Tokens   *auth.TokenVerifier
+	Presence *presence.PresenceService // opcional
+	Authz    *permissions.Authorizer   // opcional, aplica send_messages e os overrides do canal
+	Upgrader websocket.Upgrader
 }
 
-func NewHandler(db *sql.DB, jwtSecret string, hub *Hub) *ChatHandler {
+func NewHandler(db *sql.DB, tokens *auth.TokenVerifier, hub *Hub) *ChatHandler {
 	return &ChatHandler{
-		Hub:       hub,
-		Repo:      NewRepository(db),
-		JWTSecret: []byte(jwtSecret),
+		Hub:    hub,
+		Repo:   NewRepository(db),
+		Tokens: tokens,
 		Upgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool { return true }, // ajustar em prod
 		},
@@ -31,7 +36,8 @@ func NewHandler(db *sql.DB, jwtSecret string, hub *Hub) *ChatHandler {
 }
 
 // parse token (aceita token no query param "token" ou header Authorization: Bearer ...)
-func (h *ChatHandler) parseTokenGetUserID(r *http.Request) (int64, error) {
+// a validação é a mesma do middleware REST (auth.TokenVerifier)
+func (h *ChatHandler) parseToken(r *http.Request) (*auth.Claims, error) {
 	tokenStr := r.URL.Query().Get("token")
 	if tokenStr == "" {
 		auth := r.Header.Get("Authorization")
@@ -40,31 +46,10 @@ func (h *ChatHandler) parseTokenGetUserID(r *http.Request) (int64, error) {
 		}
 	}
 	if tokenStr == "" {
-		return 0, errors.New("token não fornecido")
+		return nil, errors.New("token não fornecido")
 	}
 
-	token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
-		// opcional: checar método de assinatura
-		return h.JWTSecret, nil
-	})
-	if err != nil || !token.Valid {
-		return 0, errors.New("token inválido")
-	}
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return 0, errors.New("claims inválidos")
-	}
-	uidFloat, ok := claims["user_id"].(float64)
-	if !ok {
-		// tentar por "sub"
-		if sub, ok2 := claims["sub"].(string); ok2 {
-			if id, err := strconv.ParseInt(sub, 10, 64); err == nil {
-				return id, nil
-			}
-		}
-		return 0, errors.New("user_id não encontrado no token")
-	}
-	return int64(uidFloat), nil
+	return h.Tokens.VerifyAccessToken(tokenStr)
 }
 
 func (h *ChatHandler) ServeWS(w http.ResponseWriter, r *http.Request) {
@@ -80,11 +65,34 @@ func (h *ChatHandler) ServeWS(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID, err := h.parseTokenGetUserID(r)
+	claims, err := h.parseToken(r)
 	if err != nil {
 		http.Error(w, "autenticação falhou: "+err.Error(), http.StatusUnauthorized)
 		return
 	}
+	// tokens pessoais precisam de messages:read para conectar e de messages:write para enviar
+	if !claims.HasScope(auth.ScopeMessagesRead) {
+		http.Error(w, "o token não tem o scope "+auth.ScopeMessagesRead, http.StatusForbidden)
+		return
+	}
+	userID := int64(claims.UserID)
+
+	// só conecta quem está no canal (membro adicionado ou participante do DM), antes
+	// do upgrade; send_messages pode ter sido negado no canal com um override
+	readOnly := false
+	if h.Authz != nil {
+		perms, err := h.Authz.ChannelMemberPermissions(claims.UserID, int(channelID))
+		switch {
+		case errors.Is(err, permissions.ErrNotMember), errors.Is(err, permissions.ErrChannelNotFound):
+			http.Error(w, "sem acesso ao canal", http.StatusForbidden)
+			return
+		case err != nil:
+			log.Println("ChannelPermissions error:", err)
+			http.Error(w, "erro ao verificar o acesso ao canal", http.StatusInternalServerError)
+			return
+		}
+		readOnly = !perms.Has(permissions.SendMessages)
+	}
 
 	conn, err := h.Upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -99,10 +107,16 @@ func (h *ChatHandler) ServeWS(w http.ResponseWriter, r *http.Request) {
 		channelID: channelID,
 		hub:       h.Hub,
 		repo:      h.Repo,
+		presence:  h.Presence,
+		canWrite:  claims.HasScope(auth.ScopeMessagesWrite),
+		readOnly:  readOnly,
 	}
 
 	// registrar
 	h.Hub.Register(client, channelID)
+	if h.Presence != nil {
+		h.Presence.Connect(int(userID))
+	}
 
 	// enviar últimas mensagens (ex.: 50)
 	if msgs, err := h.Repo.LoadLastMessages(channelID, 50); err == nil {
@@ -3,17 +3,23 @@ package chat
 import (
 	"log"
 	"sync"
+
+	"toller-server/modules/presence"
+	"toller-server/modules/users"
 )
 
 type Hub struct {
 	// map channelID -> set of clients
 	rooms map[int64]map[*Client]bool
+	// map userID -> set of clients, para eventos dirigidos a usuarios (presença)
+	users map[int64]map[*Client]bool
 	mu    sync.RWMutex
 }
 
 func NewHub() *Hub {
 	return &Hub{
 		rooms: make(map[int64]map[*Client]bool),
+		users: make(map[int64]map[*Client]bool),
 	}
 }
 
@@ -24,6 +30,10 @@ func (h *Hub) Register(c *Client, channelID int64) {
 		h.rooms[channelID] = make(map[*Client]bool)
 	}
 	h.rooms[channelID][c] = true
+	if _, ok := h.users[c.userID]; !ok {
+		h.users[c.userID] = make(map[*Client]bool)
+	}
+	h.users[c.userID][c] = true
 	log.Printf("HUB: Cliente %d registrado no Canal %d. Total: %d", c.userID, channelID, len(h.rooms[channelID]))
 }
 
@@ -36,6 +46,12 @@ func (h *Hub) Unregister(c *Client, channelID int64) {
 			delete(h.rooms, channelID)
 		}
 	}
+	if clients, ok := h.users[c.userID]; ok {
+		delete(clients, c)
+		if len(clients) == 0 {
+			delete(h.users, c.userID)
+		}
+	}
 	log.Printf("HUB: Cliente %d desregistrado do Canal %d", c.userID, channelID)
 }
 
@@ -74,3 +90,48 @@ func (h *Hub) Broadcast(sender *Client, channelID int64, msg OutgoingMessage) {
 		}
 	}
 }
+
+// PublishPresence envia uma mudança de presença a todos os sockets dos usuários.
+// Implementa presence.Publisher.
+func (h *Hub) PublishPresence(userIDs []int, p presence.Presence) {
+	h.sendToUsers(userIDs, OutgoingMessage{Type: "presence", UserID: int64(p.UserID), Status: p.Status, Mode: p.Mode})
+}
+
+// PublishCustomStatus envia o status personalizado (vazio quando foi limpo) de um usuário.
+// Implementa users.StatusPublisher.
+func (h *Hub) PublishCustomStatus(userIDs []int, userID int, status users.CustomStatus) {
+	h.sendToUsers(userIDs, OutgoingMessage{Type: "custom_status", UserID: int64(userID), CustomStatus: &status})
+}
+
+// sendToUsers entrega msg a todos os sockets dos usuários, sem bloquear.
+func (h *Hub) sendToUsers(userIDs []int, msg OutgoingMessage) {
+	// O envio acontece com o lock de leitura: Unregister (e o close de send) espera
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, id := range userIDs {
+		for c := range h.users[int64(id)] {
+			select {
+			case c.send <- msg:
+			default:
+				// buffer cheio: eventos de usuário não são críticos, descarta
+				log.Printf("HUB: Buffer de envio do Cliente %d cheio. Evento %s descartado.", c.userID, msg.Type)
+			}
+		}
+	}
+}
+
+// reply envia msg só para o socket c, sem bloquear (ex.: um erro para quem mandou
+// a mensagem). Como em sendToUsers, o lock de leitura garante que send não foi
+// fechado: o Broadcast desregistra o cliente antes de fechar.
+func (h *Hub) reply(c *Client, msg OutgoingMessage) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if !h.users[c.userID][c] {
+		return
+	}
+	select {
+	case c.send <- msg:
+	default:
+		log.Printf("HUB: Buffer de envio do Cliente %d cheio. Resposta %s descartada.", c.userID, msg.Type)
+	}
+}
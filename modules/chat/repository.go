@@ -3,6 +3,8 @@ package chat
 import (
 	"database/sql"
 	"time"
+
+	"toller-server/modules/users"
 )
 
 type Repository struct {
@@ -13,20 +15,35 @@ func NewRepository(db *sql.DB) *Repository {
 	return &Repository{DB: db}
 }
 
-// SaveMessage salva e retorna id e created_at
-func (r *Repository) SaveMessage(channelID int64, userID int64, content string) (int64, time.Time, error) {
+// SaveMessage salva e retorna id, created_at e o perfil atual do autor
+func (r *Repository) SaveMessage(channelID int64, userID int64, content string) (int64, time.Time, *users.UserSummary, error) {
 	var id int64
 	var createdAt time.Time
-	query := `INSERT INTO messages (channel_id, user_id, content) VALUES ($1, $2, $3) RETURNING id, created_at`
-	err := r.DB.QueryRow(query, channelID, userID, content).Scan(&id, &createdAt)
+	author := &users.UserSummary{}
+	query := `
+		WITH m AS (
+			INSERT INTO messages (channel_id, user_id, content) VALUES ($1, $2, $3)
+			RETURNING id, user_id, created_at
+		)
+		SELECT m.id, m.created_at, ` + users.SummaryColumns("u") + `
+		FROM m JOIN users u ON u.id = m.user_id
+	`
+	err := r.DB.QueryRow(query, channelID, userID, content).Scan(append([]interface{}{&id, &createdAt}, author.ScanDest()...)...)
 	if err != nil {
-		return 0, time.Time{}, err
+		return 0, time.Time{}, nil, err
 	}
-	return id, createdAt, nil
+	return id, createdAt, author, nil
 }
 
 func (r *Repository) LoadLastMessages(channelID int64, limit int) ([]OutgoingMessage, error) {
-	query := `SELECT id, user_id, content, created_at FROM messages WHERE channel_id=$1 ORDER BY created_at DESC LIMIT $2`
+	query := `
+		SELECT m.id, COALESCE(m.user_id, 0), m.content, m.created_at, ` + users.SummaryColumns("u") + `
+		FROM messages m
+		LEFT JOIN users u ON u.id = m.user_id
+		WHERE m.channel_id = $1
+		ORDER BY m.created_at DESC
+		LIMIT $2
+	`
 	rows, err := r.DB.Query(query, channelID, limit)
 	if err != nil {
 		return nil, err
@@ -38,7 +55,8 @@ func (r *Repository) LoadLastMessages(channelID int64, limit int) ([]OutgoingMes
 		var userID int64
 		var content string
 		var createdAt time.Time
-		if err := rows.Scan(&id, &userID, &content, &createdAt); err != nil {
+		author := &users.UserSummary{}
+		if err := rows.Scan(append([]interface{}{&id, &userID, &content, &createdAt}, author.ScanDest()...)...); err != nil {
 			return nil, err
 		}
 		out = append(out, OutgoingMessage{
@@ -48,6 +66,7 @@ func (r *Repository) LoadLastMessages(channelID int64, limit int) ([]OutgoingMes
 			ChannelID: channelID,
 			MessageID: id,
 			CreatedAt: createdAt.Format("2006-01-02 15:04:05"),
+			Author:    author,
 		})
 	}
 	// return in chronological order
@@ -7,6 +7,8 @@ import (
 	"net/http"
 	"strconv"
 
+	"toller-server/modules/auth"
+
 	"github.com/gorilla/mux"
 )
 
@@ -22,7 +24,7 @@ func NewDMHandler(db *sql.DB) *DMHandler {
 
 func (h *DMHandler) CreateDMHandler(w http.ResponseWriter, r *http.Request) {
 
-	userID, ok := r.Context().Value("user_id").(int)
+	userID, ok := auth.UserIDFromContext(r.Context())
 	if !ok {
 		log.Println("[DM] User not authenticated")
 		http.Error(w, "User not authenticated", http.StatusUnauthorized)
@@ -56,7 +58,7 @@ func (h *DMHandler) CreateDMHandler(w http.ResponseWriter, r *http.Request) {
 
 // ListDMsHandler maneja la petición para listar los DMs de un usuario.
 func (h *DMHandler) ListDMsHandler(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value("user_id").(int)
+	userID, ok := auth.UserIDFromContext(r.Context())
 	if !ok {
 		http.Error(w, "Usuario no autenticado", http.StatusUnauthorized)
 		return
@@ -78,7 +80,7 @@ func (h *DMHandler) ListDMsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *DMHandler) GetMessagesHandler(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value("user_id").(int)
+	userID, ok := auth.UserIDFromContext(r.Context())
 	if !ok {
 		http.Error(w, "User not authenticated", http.StatusUnauthorized)
 		return
@@ -102,7 +104,7 @@ func (h *DMHandler) GetMessagesHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *DMHandler) MarkAsReadHandler(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value("user_id").(int)
+	userID, ok := auth.UserIDFromContext(r.Context())
 	if !ok {
 		http.Error(w, "User not authenticated", http.StatusUnauthorized)
 		return
@@ -1,23 +1,29 @@
 package dms
 
-import "time"
+import (
+	"time"
+
+	"toller-server/modules/users"
+)
 
 // DMChannelInfo representa la información de un canal de DM para la API.
 // Incluye el ID del canal y los datos del otro usuario en la conversación.
 type DMChannelInfo struct {
-	ChannelID     int    `json:"channel_id"`
-	OtherUserID   int    `json:"other_user_id"`
-	OtherUsername string `json:"other_username"`
+	ChannelID     int               `json:"channel_id"`
+	OtherUserID   int               `json:"other_user_id"`
+	OtherUsername string            `json:"other_username"`
+	OtherUser     users.UserSummary `json:"other_user"`
 }
 
 // Message representa un mensaje en un canal de DM.
 
 type Message struct {
-	ID        int       `json:"id"`
-	ChannelID int       `json:"channel_id"`
-	UserID    int       `json:"user_id"`
-	Content   string    `json:"content"`
-	CreatedAt time.Time `json:"created_at"`
+	ID        int               `json:"id"`
+	ChannelID int               `json:"channel_id"`
+	UserID    int               `json:"user_id"`
+	Content   string            `json:"content"`
+	CreatedAt time.Time         `json:"created_at"`
+	Author    users.UserSummary `json:"author"`
 }
 
 // LastRead representa el último mensaje leído por un usuario en un canal.
@@ -1,6 +1,10 @@
 package dms
 
-import "database/sql"
+import (
+	"database/sql"
+
+	"toller-server/modules/users"
+)
 
 type DMRepository struct {
 	DB *sql.DB
@@ -55,7 +59,7 @@ func (r *DMRepository) CreateDMChannel(user1ID, user2ID int) (int, error) {
 // ListDMChannels devuelve una lista de todos los canales de DM de un usuario.
 func (r *DMRepository) ListDMChannels(userID int) ([]DMChannelInfo, error) {
 	query := `
-		SELECT c.id, u.id, u.username
+		SELECT c.id, ` + users.SummaryColumns("u") + `
 		FROM channels c
 		JOIN channel_users cu_self ON c.id = cu_self.channel_id
 		JOIN channel_users cu_other ON c.id = cu_other.channel_id
@@ -73,9 +77,11 @@ func (r *DMRepository) ListDMChannels(userID int) ([]DMChannelInfo, error) {
 	var dms []DMChannelInfo
 	for rows.Next() {
 		var dm DMChannelInfo
-		if err := rows.Scan(&dm.ChannelID, &dm.OtherUserID, &dm.OtherUsername); err != nil {
+		if err := rows.Scan(append([]interface{}{&dm.ChannelID}, dm.OtherUser.ScanDest()...)...); err != nil {
 			return nil, err
 		}
+		dm.OtherUserID = dm.OtherUser.ID
+		dm.OtherUsername = dm.OtherUser.Username
 		dms = append(dms, dm)
 	}
 
@@ -83,7 +89,14 @@ func (r *DMRepository) ListDMChannels(userID int) ([]DMChannelInfo, error) {
 }
 
 func (r *DMRepository) GetMessagesByChannelID(channelID int) ([]Message, error) {
-	rows, err := r.DB.Query("SELECT id, channel_id, user_id, content, created_at FROM messages WHERE channel_id = $1 ORDER BY created_at ASC", channelID)
+	query := `
+		SELECT m.id, m.channel_id, COALESCE(m.user_id, 0), m.content, m.created_at, ` + users.SummaryColumns("u") + `
+		FROM messages m
+		LEFT JOIN users u ON u.id = m.user_id
+		WHERE m.channel_id = $1
+		ORDER BY m.created_at ASC
+	`
+	rows, err := r.DB.Query(query, channelID)
 	if err != nil {
 		return nil, err
 	}
@@ -92,7 +105,8 @@ func (r *DMRepository) GetMessagesByChannelID(channelID int) ([]Message, error)
 	var messages []Message
 	for rows.Next() {
 		var msg Message
-		if err := rows.Scan(&msg.ID, &msg.ChannelID, &msg.UserID, &msg.Content, &msg.CreatedAt); err != nil {
+		dest := append([]interface{}{&msg.ID, &msg.ChannelID, &msg.UserID, &msg.Content, &msg.CreatedAt}, msg.Author.ScanDest()...)
+		if err := rows.Scan(dest...); err != nil {
 			return nil, err
 		}
 		messages = append(messages, msg)
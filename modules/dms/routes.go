@@ -2,19 +2,21 @@ package dms
 
 import (
 	"database/sql"
+	"net/http"
 
-	"github.com/gorilla/mux"
 	"toller-server/modules/auth"
+
+	"github.com/gorilla/mux"
 )
 
-func RegisterDMSRoutes(router *mux.Router, db *sql.DB) {
+func RegisterDMSRoutes(router *mux.Router, db *sql.DB, authMiddleware func(http.Handler) http.Handler) {
 	h := NewDMHandler(db)
 
 	s := router.PathPrefix("/api/v1").Subrouter()
-	s.Use(auth.JWTMiddleware)
+	s.Use(authMiddleware)
 
-	s.HandleFunc("/dms", h.CreateDMHandler).Methods("POST")
-	s.HandleFunc("/dms", h.ListDMsHandler).Methods("GET")
-	s.HandleFunc("/dms/{channelID:[0-9]+}/messages", h.GetMessagesHandler).Methods("GET")
-	s.HandleFunc("/dms/{channelID:[0-9]+}/read", h.MarkAsReadHandler).Methods("POST")
+	s.HandleFunc("/dms", auth.RequireScope(auth.ScopeMessagesWrite, h.CreateDMHandler)).Methods("POST")
+	s.HandleFunc("/dms", auth.RequireScope(auth.ScopeMessagesRead, h.ListDMsHandler)).Methods("GET")
+	s.HandleFunc("/dms/{channelID:[0-9]+}/messages", auth.RequireScope(auth.ScopeMessagesRead, h.GetMessagesHandler)).Methods("GET")
+	s.HandleFunc("/dms/{channelID:[0-9]+}/read", auth.RequireScope(auth.ScopeMessagesWrite, h.MarkAsReadHandler)).Methods("POST")
 }
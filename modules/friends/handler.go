@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"strconv"
 
+	"toller-server/modules/auth"
+
 	"github.com/gorilla/mux"
 )
 
@@ -20,7 +22,7 @@ func NewFriendHandler(db *sql.DB) *FriendHandler {
 }
 
 func (h *FriendHandler) SendFriendRequestHandler(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value("user_id").(int)
+	userID, ok := auth.UserIDFromContext(r.Context())
 	if !ok {
 		http.Error(w, "User not authenticated", http.StatusUnauthorized)
 		return
@@ -44,7 +46,7 @@ func (h *FriendHandler) SendFriendRequestHandler(w http.ResponseWriter, r *http.
 }
 
 func (h *FriendHandler) UpdateFriendRequestHandler(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value("user_id").(int)
+	userID, ok := auth.UserIDFromContext(r.Context())
 	if !ok {
 		http.Error(w, "User not authenticated", http.StatusUnauthorized)
 		return
@@ -75,7 +77,7 @@ func (h *FriendHandler) UpdateFriendRequestHandler(w http.ResponseWriter, r *htt
 }
 
 func (h *FriendHandler) ListFriendsHandler(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value("user_id").(int)
+	userID, ok := auth.UserIDFromContext(r.Context())
 	if !ok {
 		http.Error(w, "User not authenticated", http.StatusUnauthorized)
 		return
@@ -92,7 +94,7 @@ func (h *FriendHandler) ListFriendsHandler(w http.ResponseWriter, r *http.Reques
 }
 
 func (h *FriendHandler) ListPendingRequestsHandler(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value("user_id").(int)
+	userID, ok := auth.UserIDFromContext(r.Context())
 	if !ok {
 		http.Error(w, "User not authenticated", http.StatusUnauthorized)
 		return
@@ -2,20 +2,21 @@ package friends
 
 import (
 	"database/sql"
+	"net/http"
 
 	"toller-server/modules/auth"
 
 	"github.com/gorilla/mux"
 )
 
-func RegisterFriendRoutes(router *mux.Router, db *sql.DB) {
+func RegisterFriendRoutes(router *mux.Router, db *sql.DB, authMiddleware func(http.Handler) http.Handler) {
 	h := NewFriendHandler(db)
 
 	s := router.PathPrefix("/api/v1").Subrouter()
-	s.Use(auth.JWTMiddleware)
+	s.Use(authMiddleware)
 
-	s.HandleFunc("/friends/requests", h.SendFriendRequestHandler).Methods("POST")
-	s.HandleFunc("/friends/requests/{friendID:[0-9]+}", h.UpdateFriendRequestHandler).Methods("PUT")
-	s.HandleFunc("/friends", h.ListFriendsHandler).Methods("GET")
-	s.HandleFunc("/friends/requests/pending", h.ListPendingRequestsHandler).Methods("GET")
+	s.HandleFunc("/friends/requests", auth.RequireScope(auth.ScopeFriendsWrite, h.SendFriendRequestHandler)).Methods("POST")
+	s.HandleFunc("/friends/requests/{friendID:[0-9]+}", auth.RequireScope(auth.ScopeFriendsWrite, h.UpdateFriendRequestHandler)).Methods("PUT")
+	s.HandleFunc("/friends", auth.RequireScope(auth.ScopeFriendsRead, h.ListFriendsHandler)).Methods("GET")
+	s.HandleFunc("/friends/requests/pending", auth.RequireScope(auth.ScopeFriendsRead, h.ListPendingRequestsHandler)).Methods("GET")
 }
@@ -0,0 +1,129 @@
+package permissions
+
+import (
+	"errors"
+)
+
+var (
+	ErrNotMember       = errors.New("not a member of this team")
+	ErrForbidden       = errors.New("missing permission")
+	ErrChannelNotFound = errors.New("channel not found")
+)
+
+// Authorizer answers every "can this user do X" question for teams and
+// channels. Services ask it instead of checking roles themselves.
+type Authorizer struct {
+	Repo *PermissionRepository
+}
+
+// TeamPermissions returns what a member can do in a team: everything for
+// admins and the owner, MemberDefaults plus custom roles for everyone else.
+func (a *Authorizer) TeamPermissions(userID, teamID int) (Set, error) {
+	m, err := a.Repo.GetMembership(userID, teamID)
+	if err != nil {
+		return nil, err
+	}
+	return m.permissions(), nil
+}
+
+// Can reports whether a user has a permission in a team. Non-members have none.
+func (a *Authorizer) Can(userID, teamID int, perm string) (bool, error) {
+	perms, err := a.TeamPermissions(userID, teamID)
+	if errors.Is(err, ErrNotMember) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return perms.Has(perm), nil
+}
+
+// ChannelPermissions returns what a user can do in a channel. It starts from
+// the team permissions, adds what the channel admin role grants and then
+// applies the channel overrides. Admins and the owner are not affected by
+// overrides. In direct messages the participants can only send messages.
+func (a *Authorizer) ChannelPermissions(userID, channelID int) (Set, error) {
+	return a.channelPermissions(userID, channelID, false)
+}
+
+// ChannelMemberPermissions is ChannelPermissions for someone who has to be in
+// the channel itself and not only in its team, like a connection that reads
+// its messages. Team members who were not added to the channel get ErrNotMember.
+func (a *Authorizer) ChannelMemberPermissions(userID, channelID int) (Set, error) {
+	return a.channelPermissions(userID, channelID, true)
+}
+
+func (a *Authorizer) channelPermissions(userID, channelID int, inChannel bool) (Set, error) {
+	access, err := a.Repo.GetChannelAccess(userID, channelID)
+	if err != nil {
+		return nil, err
+	}
+	if access.Role == "" && (inChannel || access.TeamID == nil) {
+		return nil, ErrNotMember
+	}
+	if access.TeamID == nil {
+		return NewSet(SendMessages), nil
+	}
+
+	m, err := a.Repo.GetMembership(userID, *access.TeamID)
+	if err != nil {
+		return nil, err
+	}
+	perms := m.permissions()
+	if m.isAdmin() {
+		return perms, nil
+	}
+	if access.Role == RoleAdmin {
+		perms.add(ChannelAdminGrants...)
+	}
+
+	overrides, err := a.Repo.GetApplicableOverrides(channelID, userID, m.RoleIDs)
+	if err != nil {
+		return nil, err
+	}
+	applyOverrides(perms, overrides)
+	return perms, nil
+}
+
+// CanInChannel reports whether a user has a permission in a channel.
+// Users outside the channel's team have none.
+func (a *Authorizer) CanInChannel(userID, channelID int, perm string) (bool, error) {
+	perms, err := a.ChannelPermissions(userID, channelID)
+	if errors.Is(err, ErrNotMember) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return perms.Has(perm), nil
+}
+
+// applyOverrides applies the overrides from the least to the most specific:
+// everyone, then the member's roles together, then the user.
+func applyOverrides(perms Set, overrides []Override) {
+	var everyone, user *Override
+	roleAllow, roleDeny := []string{}, []string{}
+	for i := range overrides {
+		o := &overrides[i]
+		switch {
+		case o.UserID != nil:
+			user = o
+		case o.RoleID != nil:
+			roleAllow = append(roleAllow, o.Allow...)
+			roleDeny = append(roleDeny, o.Deny...)
+		default:
+			everyone = o
+		}
+	}
+
+	if everyone != nil {
+		perms.remove(everyone.Deny...)
+		perms.add(everyone.Allow...)
+	}
+	perms.remove(roleDeny...)
+	perms.add(roleAllow...)
+	if user != nil {
+		perms.remove(user.Deny...)
+		perms.add(user.Allow...)
+	}
+}
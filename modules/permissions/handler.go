@@ -0,0 +1,263 @@
+package permissions
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"toller-server/modules/audit"
+	"toller-server/modules/auth"
+
+	"github.com/gorilla/mux"
+)
+
+type PermissionHandler struct {
+	Service *PermissionService
+}
+
+func respondJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func permissionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidRoleName), errors.Is(err, ErrReservedRoleName),
+		errors.Is(err, ErrUnknownPermission), errors.Is(err, ErrNotChannelPermission),
+		errors.Is(err, ErrOverrideConflict), errors.Is(err, ErrInvalidTarget),
+		errors.Is(err, ErrDirectChannel):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrForbidden), errors.Is(err, ErrNotMember):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, ErrRoleNotFound), errors.Is(err, ErrChannelNotFound),
+		errors.Is(err, ErrOverrideNotFound), errors.Is(err, ErrMemberNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrRoleExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// pathIDs parses the numeric route variables with the given names.
+func pathIDs(r *http.Request, names ...string) ([]int, error) {
+	vars := mux.Vars(r)
+	ids := make([]int, len(names))
+	for i, name := range names {
+		id, err := strconv.Atoi(vars[name])
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// MyTeamPermissionsHandler handles GET /teams/{id}/permissions
+func (h *PermissionHandler) MyTeamPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	ids, err := pathIDs(r, "id")
+	if err != nil {
+		http.Error(w, "invalid team id", http.StatusBadRequest)
+		return
+	}
+
+	perms, err := h.Service.MyTeamPermissions(ids[0], userID)
+	if err != nil {
+		permissionError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"permissions": perms})
+}
+
+// ListRolesHandler handles GET /teams/{id}/roles
+func (h *PermissionHandler) ListRolesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	ids, err := pathIDs(r, "id")
+	if err != nil {
+		http.Error(w, "invalid team id", http.StatusBadRequest)
+		return
+	}
+
+	roles, err := h.Service.ListRoles(ids[0], userID)
+	if err != nil {
+		permissionError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"roles": roles, "permissions": All})
+}
+
+// CreateRoleHandler handles POST /teams/{id}/roles
+func (h *PermissionHandler) CreateRoleHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	ids, err := pathIDs(r, "id")
+	if err != nil {
+		http.Error(w, "invalid team id", http.StatusBadRequest)
+		return
+	}
+	var req RoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	role, err := h.Service.CreateRole(ids[0], userID, req, audit.MetaFromRequest(r))
+	if err != nil {
+		permissionError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, role)
+}
+
+// UpdateRoleHandler handles PUT/PATCH /teams/{id}/roles/{role_id}
+func (h *PermissionHandler) UpdateRoleHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	ids, err := pathIDs(r, "id", "role_id")
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	var req RoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	role, err := h.Service.UpdateRole(ids[0], ids[1], userID, req, audit.MetaFromRequest(r))
+	if err != nil {
+		permissionError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, role)
+}
+
+// DeleteRoleHandler handles DELETE /teams/{id}/roles/{role_id}
+func (h *PermissionHandler) DeleteRoleHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	ids, err := pathIDs(r, "id", "role_id")
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Service.DeleteRole(ids[0], ids[1], userID, audit.MetaFromRequest(r)); err != nil {
+		permissionError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetMemberRolesHandler handles GET /teams/{id}/members/{user_id}/roles
+func (h *PermissionHandler) GetMemberRolesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	ids, err := pathIDs(r, "id", "user_id")
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	roles, err := h.Service.GetMemberRoles(ids[0], ids[1], userID)
+	if err != nil {
+		permissionError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"roles": roles})
+}
+
+// SetMemberRolesHandler handles PUT /teams/{id}/members/{user_id}/roles
+func (h *PermissionHandler) SetMemberRolesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	ids, err := pathIDs(r, "id", "user_id")
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		RoleIDs []int `json:"role_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	roles, err := h.Service.SetMemberRoles(ids[0], ids[1], userID, req.RoleIDs, audit.MetaFromRequest(r))
+	if err != nil {
+		permissionError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"roles": roles})
+}
+
+// MyChannelPermissionsHandler handles GET /channels/{channel_id}/permissions
+func (h *PermissionHandler) MyChannelPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	ids, err := pathIDs(r, "channel_id")
+	if err != nil {
+		http.Error(w, "invalid channel id", http.StatusBadRequest)
+		return
+	}
+
+	perms, err := h.Service.MyChannelPermissions(ids[0], userID)
+	if err != nil {
+		permissionError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"permissions": perms})
+}
+
+// ListOverridesHandler handles GET /channels/{channel_id}/overrides
+func (h *PermissionHandler) ListOverridesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	ids, err := pathIDs(r, "channel_id")
+	if err != nil {
+		http.Error(w, "invalid channel id", http.StatusBadRequest)
+		return
+	}
+
+	overrides, err := h.Service.ListOverrides(ids[0], userID)
+	if err != nil {
+		permissionError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"overrides": overrides})
+}
+
+// SetOverrideHandler handles PUT /channels/{channel_id}/overrides
+func (h *PermissionHandler) SetOverrideHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	ids, err := pathIDs(r, "channel_id")
+	if err != nil {
+		http.Error(w, "invalid channel id", http.StatusBadRequest)
+		return
+	}
+	var req OverrideRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	o, err := h.Service.SetOverride(ids[0], userID, req, audit.MetaFromRequest(r))
+	if err != nil {
+		permissionError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, o)
+}
+
+// DeleteOverrideHandler handles DELETE /channels/{channel_id}/overrides/{override_id}
+func (h *PermissionHandler) DeleteOverrideHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	ids, err := pathIDs(r, "channel_id", "override_id")
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Service.DeleteOverride(ids[0], ids[1], userID, audit.MetaFromRequest(r)); err != nil {
+		permissionError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,162 @@
+package permissions
+
+import "time"
+
+// Named permissions. Admins and the team owner have all of them; members get
+// MemberDefaults plus whatever their custom roles grant.
+const (
+	ManageTeam     = "manage_team"     // edit the team name and description
+	ManageMembers  = "manage_members"  // add and remove members, see login lockouts
+	ManageRoles    = "manage_roles"    // create, edit and assign custom roles
+	InviteMembers  = "invite_members"  // create and revoke invites
+	CreateChannels = "create_channels" // create channels in the team
+	ManageChannels = "manage_channels" // rename and delete channels, manage their members and overrides
+	SendMessages   = "send_messages"   // post in channels
+	DeleteMessages = "delete_messages" // delete other people's messages
+	PinMessages    = "pin_messages"    // pin and unpin messages
+	ViewAuditLog   = "view_audit_log"  // read the team audit log
+)
+
+// Built-in team roles, stored in user_teams.role
+const (
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+// All lists every permission in display order.
+var All = []string{
+	ManageTeam, ManageMembers, ManageRoles, InviteMembers,
+	CreateChannels, ManageChannels, SendMessages, DeleteMessages, PinMessages, ViewAuditLog,
+}
+
+// MemberDefaults is what every member of a team can do.
+var MemberDefaults = []string{CreateChannels, SendMessages}
+
+// ChannelScoped are the permissions that channel overrides can allow or deny.
+var ChannelScoped = []string{ManageChannels, SendMessages, DeleteMessages, PinMessages}
+
+// ChannelAdminGrants is what the channel_users 'admin' role (the channel creator) gets in its channel.
+var ChannelAdminGrants = []string{ManageChannels, DeleteMessages, PinMessages}
+
+// Set is a set of permissions. It is encoded in JSON as a sorted list.
+type Set map[string]bool
+
+func NewSet(perms ...string) Set {
+	s := Set{}
+	s.add(perms...)
+	return s
+}
+
+func (s Set) Has(perm string) bool {
+	return s[perm]
+}
+
+// HasAll reports whether every permission in perms is in the set.
+func (s Set) HasAll(perms []string) bool {
+	for _, p := range perms {
+		if !s[p] {
+			return false
+		}
+	}
+	return true
+}
+
+// List returns the permissions in the set in the order of All.
+func (s Set) List() []string {
+	list := []string{}
+	for _, p := range All {
+		if s[p] {
+			list = append(list, p)
+		}
+	}
+	return list
+}
+
+func (s Set) add(perms ...string) {
+	for _, p := range perms {
+		s[p] = true
+	}
+}
+
+func (s Set) remove(perms ...string) {
+	for _, p := range perms {
+		delete(s, p)
+	}
+}
+
+// Role is a team role. The built-in roles (admin and member) have no ID and
+// cannot be edited.
+type Role struct {
+	ID          int        `json:"id,omitempty"`
+	TeamID      int        `json:"team_id"`
+	Name        string     `json:"name"`
+	Permissions []string   `json:"permissions"`
+	BuiltIn     bool       `json:"built_in"`
+	Members     int        `json:"members"`
+	CreatedAt   *time.Time `json:"created_at,omitempty"`
+}
+
+// RoleRequest is the body to create or edit a custom role.
+type RoleRequest struct {
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+}
+
+// Override changes the permissions of a channel for everyone in the team
+// (no RoleID nor UserID), for the members with a role, or for one user.
+// Denies are applied before allows at each level, and the levels go from
+// everyone to roles to user, so the most specific one wins.
+type Override struct {
+	ID        int      `json:"id"`
+	ChannelID int      `json:"channel_id"`
+	RoleID    *int     `json:"role_id"`
+	UserID    *int     `json:"user_id"`
+	Allow     []string `json:"allow"`
+	Deny      []string `json:"deny"`
+}
+
+// OverrideRequest is the body to set an override. Target is "everyone",
+// "role" (with RoleID) or "user" (with UserID).
+type OverrideRequest struct {
+	Target string   `json:"target"`
+	RoleID int      `json:"role_id"`
+	UserID int      `json:"user_id"`
+	Allow  []string `json:"allow"`
+	Deny   []string `json:"deny"`
+}
+
+// membership is what the authorizer needs to know about a team member.
+type membership struct {
+	Role    string
+	IsOwner bool
+	Granted []string // union of the permissions of the member's custom roles
+	RoleIDs []int
+}
+
+func (m *membership) isAdmin() bool {
+	return m.IsOwner || m.Role == RoleAdmin
+}
+
+func (m *membership) permissions() Set {
+	if m.isAdmin() {
+		return NewSet(All...)
+	}
+	s := NewSet(MemberDefaults...)
+	s.add(m.Granted...)
+	return s
+}
+
+// channelAccess is the team and the channel_users role of a user in a channel.
+type channelAccess struct {
+	TeamID *int   // nil for direct messages
+	Role   string // "" when the user is not in the channel
+}
+
+func contains(list []string, perm string) bool {
+	for _, p := range list {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,289 @@
+package permissions
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+type PermissionRepository struct {
+	DB *sql.DB
+}
+
+// GetMembership returns the base role, ownership and custom roles of a member.
+// Deleted teams have no members.
+func (r *PermissionRepository) GetMembership(userID, teamID int) (*membership, error) {
+	var m membership
+	var roleIDs []int64
+	err := r.DB.QueryRow(`
+		SELECT COALESCE(ut.role, 'member'), COALESCE(t.owner_id = ut.user_id, FALSE),
+		       ARRAY(SELECT mr.role_id FROM team_member_roles mr
+		             WHERE mr.user_id = ut.user_id AND mr.team_id = ut.team_id),
+		       ARRAY(SELECT DISTINCT p FROM team_member_roles mr
+		             JOIN team_roles tr ON tr.id = mr.role_id, unnest(tr.permissions) p
+		             WHERE mr.user_id = ut.user_id AND mr.team_id = ut.team_id)
+		FROM user_teams ut
+		JOIN teams t ON t.id = ut.team_id
+		WHERE ut.user_id = $1 AND ut.team_id = $2 AND t.deleted_at IS NULL`,
+		userID, teamID).Scan(&m.Role, &m.IsOwner, pq.Array(&roleIDs), pq.Array(&m.Granted))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotMember
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range roleIDs {
+		m.RoleIDs = append(m.RoleIDs, int(id))
+	}
+	return &m, nil
+}
+
+// GetChannelAccess returns the team of a channel and the channel_users role of the user in it.
+func (r *PermissionRepository) GetChannelAccess(userID, channelID int) (*channelAccess, error) {
+	var teamID sql.NullInt64
+	var access channelAccess
+	err := r.DB.QueryRow(`
+		SELECT c.team_id, COALESCE(cu.role, '')
+		FROM channels c
+		LEFT JOIN channel_users cu ON cu.channel_id = c.id AND cu.user_id = $1
+		WHERE c.id = $2`, userID, channelID).Scan(&teamID, &access.Role)
+	if err == sql.ErrNoRows {
+		return nil, ErrChannelNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if teamID.Valid {
+		id := int(teamID.Int64)
+		access.TeamID = &id
+	}
+	return &access, nil
+}
+
+const overrideColumns = `id, channel_id, role_id, user_id, allow, deny`
+
+func scanOverrides(rows *sql.Rows) ([]Override, error) {
+	defer rows.Close()
+	overrides := []Override{}
+	for rows.Next() {
+		var o Override
+		if err := rows.Scan(&o.ID, &o.ChannelID, &o.RoleID, &o.UserID, pq.Array(&o.Allow), pq.Array(&o.Deny)); err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, o)
+	}
+	return overrides, rows.Err()
+}
+
+// GetApplicableOverrides returns the overrides of a channel that apply to a
+// user: the one for everyone, the ones for the given roles and the user's own.
+func (r *PermissionRepository) GetApplicableOverrides(channelID, userID int, roleIDs []int) ([]Override, error) {
+	rows, err := r.DB.Query(`
+		SELECT `+overrideColumns+` FROM channel_permission_overrides
+		WHERE channel_id = $1
+		  AND ((role_id IS NULL AND user_id IS NULL) OR user_id = $2 OR role_id = ANY($3))`,
+		channelID, userID, pq.Array(int64s(roleIDs)))
+	if err != nil {
+		return nil, err
+	}
+	return scanOverrides(rows)
+}
+
+// ListOverrides returns all the overrides of a channel.
+func (r *PermissionRepository) ListOverrides(channelID int) ([]Override, error) {
+	rows, err := r.DB.Query(`
+		SELECT `+overrideColumns+` FROM channel_permission_overrides
+		WHERE channel_id = $1
+		ORDER BY role_id NULLS FIRST, user_id NULLS FIRST`, channelID)
+	if err != nil {
+		return nil, err
+	}
+	return scanOverrides(rows)
+}
+
+// SetOverride creates or replaces the override of a channel for its target.
+func (r *PermissionRepository) SetOverride(o *Override) error {
+	return r.DB.QueryRow(`
+		INSERT INTO channel_permission_overrides (channel_id, role_id, user_id, allow, deny)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (channel_id, COALESCE(role_id, 0), COALESCE(user_id, 0))
+		DO UPDATE SET allow = EXCLUDED.allow, deny = EXCLUDED.deny
+		RETURNING id`,
+		o.ChannelID, o.RoleID, o.UserID, pq.Array(o.Allow), pq.Array(o.Deny)).Scan(&o.ID)
+}
+
+// DeleteOverride removes an override of a channel. It returns false if it did not exist.
+func (r *PermissionRepository) DeleteOverride(channelID, overrideID int) (bool, error) {
+	res, err := r.DB.Exec(`DELETE FROM channel_permission_overrides WHERE id = $1 AND channel_id = $2`,
+		overrideID, channelID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// CountByBaseRole returns how many members of a team have each built-in role.
+func (r *PermissionRepository) CountByBaseRole(teamID int) (map[string]int, error) {
+	rows, err := r.DB.Query(`
+		SELECT COALESCE(role, 'member'), COUNT(*) FROM user_teams
+		WHERE team_id = $1
+		GROUP BY 1`, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := map[string]int{}
+	for rows.Next() {
+		var role string
+		var n int
+		if err := rows.Scan(&role, &n); err != nil {
+			return nil, err
+		}
+		counts[role] = n
+	}
+	return counts, rows.Err()
+}
+
+const roleColumns = `r.id, r.team_id, r.name, r.permissions, r.created_at,
+	(SELECT COUNT(*) FROM team_member_roles mr WHERE mr.role_id = r.id)`
+
+func scanRole(row interface{ Scan(...interface{}) error }) (*Role, error) {
+	var role Role
+	err := row.Scan(&role.ID, &role.TeamID, &role.Name, pq.Array(&role.Permissions), &role.CreatedAt, &role.Members)
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// ListRoles returns the custom roles of a team.
+func (r *PermissionRepository) ListRoles(teamID int) ([]Role, error) {
+	return r.queryRoles(`
+		SELECT `+roleColumns+` FROM team_roles r
+		WHERE r.team_id = $1
+		ORDER BY LOWER(r.name)`, teamID)
+}
+
+// GetRole returns a custom role of a team.
+func (r *PermissionRepository) GetRole(teamID, roleID int) (*Role, error) {
+	role, err := scanRole(r.DB.QueryRow(`
+		SELECT `+roleColumns+` FROM team_roles r
+		WHERE r.id = $1 AND r.team_id = $2`, roleID, teamID))
+	if err == sql.ErrNoRows {
+		return nil, ErrRoleNotFound
+	}
+	return role, err
+}
+
+// GetRoles returns the custom roles of a team with the given IDs; unknown IDs are skipped.
+func (r *PermissionRepository) GetRoles(teamID int, roleIDs []int) ([]Role, error) {
+	return r.queryRoles(`
+		SELECT `+roleColumns+` FROM team_roles r
+		WHERE r.team_id = $1 AND r.id = ANY($2)
+		ORDER BY LOWER(r.name)`, teamID, pq.Array(int64s(roleIDs)))
+}
+
+func (r *PermissionRepository) queryRoles(query string, args ...interface{}) ([]Role, error) {
+	rows, err := r.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	roles := []Role{}
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, *role)
+	}
+	return roles, rows.Err()
+}
+
+// RoleNameTaken reports whether another role of the team already uses the name (case insensitive).
+func (r *PermissionRepository) RoleNameTaken(teamID int, name string, exceptID int) (bool, error) {
+	var taken bool
+	err := r.DB.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM team_roles WHERE team_id = $1 AND LOWER(name) = $2 AND id <> $3)`,
+		teamID, strings.ToLower(name), exceptID).Scan(&taken)
+	return taken, err
+}
+
+// CreateRole inserts a custom role. It returns ErrRoleExists if the name is taken.
+func (r *PermissionRepository) CreateRole(role *Role) error {
+	err := r.DB.QueryRow(`
+		INSERT INTO team_roles (team_id, name, permissions)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING
+		RETURNING id, created_at`,
+		role.TeamID, role.Name, pq.Array(role.Permissions)).Scan(&role.ID, &role.CreatedAt)
+	if err == sql.ErrNoRows {
+		return ErrRoleExists
+	}
+	return err
+}
+
+// UpdateRole changes the name and permissions of a custom role.
+func (r *PermissionRepository) UpdateRole(role *Role) error {
+	res, err := r.DB.Exec(`
+		UPDATE team_roles SET name = $1, permissions = $2
+		WHERE id = $3 AND team_id = $4`,
+		role.Name, pq.Array(role.Permissions), role.ID, role.TeamID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrRoleNotFound
+	}
+	return nil
+}
+
+// DeleteRole removes a custom role; its assignments and overrides go with it.
+func (r *PermissionRepository) DeleteRole(teamID, roleID int) error {
+	res, err := r.DB.Exec(`DELETE FROM team_roles WHERE id = $1 AND team_id = $2`, roleID, teamID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrRoleNotFound
+	}
+	return nil
+}
+
+// SetMemberRoles replaces the custom roles of a member with the given ones.
+func (r *PermissionRepository) SetMemberRoles(teamID, userID int, roleIDs []int) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM team_member_roles WHERE team_id = $1 AND user_id = $2`, teamID, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO team_member_roles (user_id, team_id, role_id)
+		SELECT $1, $2, id FROM team_roles WHERE team_id = $2 AND id = ANY($3)`,
+		userID, teamID, pq.Array(int64s(roleIDs))); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func int64s(ids []int) []int64 {
+	out := make([]int64, len(ids))
+	for i, id := range ids {
+		out[i] = int64(id)
+	}
+	return out
+}
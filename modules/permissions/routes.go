@@ -0,0 +1,30 @@
+package permissions
+
+import (
+	"net/http"
+
+	"toller-server/modules/auth"
+
+	"github.com/gorilla/mux"
+)
+
+// RegisterRoutes registers the role and channel override routes under /api/v1.
+func RegisterRoutes(router *mux.Router, handler *PermissionHandler, authMiddleware func(http.Handler) http.Handler) {
+	s := router.PathPrefix("/api/v1").Subrouter()
+	s.Use(authMiddleware)
+
+	// Team roles
+	s.HandleFunc("/teams/{id:[0-9]+}/permissions", auth.RequireScope(auth.ScopeTeamsRead, handler.MyTeamPermissionsHandler)).Methods("GET")
+	s.HandleFunc("/teams/{id:[0-9]+}/roles", auth.RequireScope(auth.ScopeTeamsRead, handler.ListRolesHandler)).Methods("GET")
+	s.HandleFunc("/teams/{id:[0-9]+}/roles", auth.RequireScope(auth.ScopeTeamsWrite, handler.CreateRoleHandler)).Methods("POST")
+	s.HandleFunc("/teams/{id:[0-9]+}/roles/{role_id:[0-9]+}", auth.RequireScope(auth.ScopeTeamsWrite, handler.UpdateRoleHandler)).Methods("PUT", "PATCH")
+	s.HandleFunc("/teams/{id:[0-9]+}/roles/{role_id:[0-9]+}", auth.RequireScope(auth.ScopeTeamsWrite, handler.DeleteRoleHandler)).Methods("DELETE")
+	s.HandleFunc("/teams/{id:[0-9]+}/members/{user_id:[0-9]+}/roles", auth.RequireScope(auth.ScopeTeamsRead, handler.GetMemberRolesHandler)).Methods("GET")
+	s.HandleFunc("/teams/{id:[0-9]+}/members/{user_id:[0-9]+}/roles", auth.RequireScope(auth.ScopeTeamsWrite, handler.SetMemberRolesHandler)).Methods("PUT")
+
+	// Channel overrides
+	s.HandleFunc("/channels/{channel_id:[0-9]+}/permissions", auth.RequireScope(auth.ScopeChannelsRead, handler.MyChannelPermissionsHandler)).Methods("GET")
+	s.HandleFunc("/channels/{channel_id:[0-9]+}/overrides", auth.RequireScope(auth.ScopeChannelsRead, handler.ListOverridesHandler)).Methods("GET")
+	s.HandleFunc("/channels/{channel_id:[0-9]+}/overrides", auth.RequireScope(auth.ScopeChannelsWrite, handler.SetOverrideHandler)).Methods("PUT")
+	s.HandleFunc("/channels/{channel_id:[0-9]+}/overrides/{override_id:[0-9]+}", auth.RequireScope(auth.ScopeChannelsWrite, handler.DeleteOverrideHandler)).Methods("DELETE")
+}
@@ -0,0 +1,471 @@
+package permissions
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"toller-server/modules/audit"
+)
+
+const maxRoleNameLength = 50
+
+var (
+	ErrRoleNotFound         = errors.New("role not found")
+	ErrRoleExists           = errors.New("a role with that name already exists")
+	ErrInvalidRoleName      = errors.New("role name must be between 1 and 50 characters")
+	ErrReservedRoleName     = errors.New("admin, member and owner are reserved role names")
+	ErrUnknownPermission    = errors.New("unknown permission")
+	ErrNotChannelPermission = errors.New("permission cannot be overridden per channel")
+	ErrOverrideConflict     = errors.New("a permission cannot be both allowed and denied")
+	ErrInvalidTarget        = errors.New("target must be everyone, role or user")
+	ErrOverrideNotFound     = errors.New("override not found")
+	ErrDirectChannel        = errors.New("direct message channels have no permission overrides")
+	ErrMemberNotFound       = errors.New("user is not a member of this team")
+)
+
+// PermissionService manages custom roles and channel overrides. Nobody can
+// grant (or take away) a permission they don't have themselves.
+type PermissionService struct {
+	Repo  *PermissionRepository
+	Authz *Authorizer
+	Audit *audit.AuditLog // optional, records every change in the team audit log
+}
+
+// MyTeamPermissions returns the effective permissions of the user in a team.
+func (s *PermissionService) MyTeamPermissions(teamID, userID int) ([]string, error) {
+	perms, err := s.Authz.TeamPermissions(userID, teamID)
+	if err != nil {
+		return nil, err
+	}
+	return perms.List(), nil
+}
+
+// MyChannelPermissions returns the effective permissions of the user in a channel.
+func (s *PermissionService) MyChannelPermissions(channelID, userID int) ([]string, error) {
+	perms, err := s.Authz.ChannelPermissions(userID, channelID)
+	if err != nil {
+		return nil, err
+	}
+	return perms.List(), nil
+}
+
+// ListRoles returns the built-in roles followed by the custom roles of the team.
+func (s *PermissionService) ListRoles(teamID, userID int) ([]Role, error) {
+	if _, err := s.Authz.TeamPermissions(userID, teamID); err != nil {
+		return nil, err
+	}
+
+	counts, err := s.Repo.CountByBaseRole(teamID)
+	if err != nil {
+		return nil, err
+	}
+	roles := []Role{
+		{TeamID: teamID, Name: RoleAdmin, Permissions: All, BuiltIn: true, Members: counts[RoleAdmin]},
+		{TeamID: teamID, Name: RoleMember, Permissions: MemberDefaults, BuiltIn: true, Members: counts[RoleMember]},
+	}
+	custom, err := s.Repo.ListRoles(teamID)
+	if err != nil {
+		return nil, err
+	}
+	return append(roles, custom...), nil
+}
+
+// CreateRole creates a custom role in the team.
+func (s *PermissionService) CreateRole(teamID, userID int, req RoleRequest, meta audit.Meta) (*Role, error) {
+	perms, err := s.requireTeam(userID, teamID, ManageRoles)
+	if err != nil {
+		return nil, err
+	}
+	role := &Role{TeamID: teamID}
+	if err := s.fillRole(role, req, perms); err != nil {
+		return nil, err
+	}
+	if err := s.Repo.CreateRole(role); err != nil {
+		return nil, err
+	}
+	s.record(audit.Entry{
+		TeamID: teamID, ActorID: userID, Action: audit.RoleCreate, TargetType: audit.TargetRole, TargetID: role.ID,
+		Changes: audit.Diff(nil, roleFields(role)), Meta: meta,
+	})
+	return role, nil
+}
+
+// UpdateRole renames a custom role and replaces its permissions.
+func (s *PermissionService) UpdateRole(teamID, roleID, userID int, req RoleRequest, meta audit.Meta) (*Role, error) {
+	perms, err := s.requireTeam(userID, teamID, ManageRoles)
+	if err != nil {
+		return nil, err
+	}
+	role, err := s.Repo.GetRole(teamID, roleID)
+	if err != nil {
+		return nil, err
+	}
+	// Editing a role also takes away what it granted
+	if err := requireAll(perms, role.Permissions); err != nil {
+		return nil, err
+	}
+	before := roleFields(role)
+	if err := s.fillRole(role, req, perms); err != nil {
+		return nil, err
+	}
+	if err := s.Repo.UpdateRole(role); err != nil {
+		return nil, err
+	}
+	if changes := audit.Diff(before, roleFields(role)); len(changes) > 0 {
+		s.record(audit.Entry{
+			TeamID: teamID, ActorID: userID, Action: audit.RoleUpdate, TargetType: audit.TargetRole, TargetID: roleID,
+			Changes: changes, Meta: meta,
+		})
+	}
+	return role, nil
+}
+
+// DeleteRole deletes a custom role; members that had it lose its permissions.
+func (s *PermissionService) DeleteRole(teamID, roleID, userID int, meta audit.Meta) error {
+	perms, err := s.requireTeam(userID, teamID, ManageRoles)
+	if err != nil {
+		return err
+	}
+	role, err := s.Repo.GetRole(teamID, roleID)
+	if err != nil {
+		return err
+	}
+	if err := requireAll(perms, role.Permissions); err != nil {
+		return err
+	}
+	if err := s.Repo.DeleteRole(teamID, roleID); err != nil {
+		return err
+	}
+	s.record(audit.Entry{
+		TeamID: teamID, ActorID: userID, Action: audit.RoleDelete, TargetType: audit.TargetRole, TargetID: roleID,
+		Changes: audit.Diff(roleFields(role), nil), Meta: meta,
+	})
+	return nil
+}
+
+// GetMemberRoles returns the custom roles of a member.
+func (s *PermissionService) GetMemberRoles(teamID, memberID, userID int) ([]Role, error) {
+	if _, err := s.Authz.TeamPermissions(userID, teamID); err != nil {
+		return nil, err
+	}
+	m, err := s.targetMembership(memberID, teamID)
+	if err != nil {
+		return nil, err
+	}
+	return s.Repo.GetRoles(teamID, m.RoleIDs)
+}
+
+// SetMemberRoles replaces the custom roles of a member. The roles being added
+// and the ones being removed must only contain permissions the requester has.
+func (s *PermissionService) SetMemberRoles(teamID, memberID, userID int, roleIDs []int, meta audit.Meta) ([]Role, error) {
+	perms, err := s.requireTeam(userID, teamID, ManageRoles)
+	if err != nil {
+		return nil, err
+	}
+	m, err := s.targetMembership(memberID, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := s.Repo.GetRoles(teamID, m.RoleIDs)
+	if err != nil {
+		return nil, err
+	}
+	wanted, err := s.Repo.GetRoles(teamID, roleIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(wanted) != len(uniqueInts(roleIDs)) {
+		return nil, ErrRoleNotFound
+	}
+	for _, role := range append(current, wanted...) {
+		if err := requireAll(perms, role.Permissions); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.Repo.SetMemberRoles(teamID, memberID, roleIDs); err != nil {
+		return nil, err
+	}
+	if changes := audit.Diff(
+		map[string]interface{}{"roles": roleNames(current)},
+		map[string]interface{}{"roles": roleNames(wanted)},
+	); len(changes) > 0 {
+		s.record(audit.Entry{
+			TeamID: teamID, ActorID: userID, Action: audit.MemberRolesUpdate, TargetType: audit.TargetUser, TargetID: memberID,
+			Changes: changes, Meta: meta,
+		})
+	}
+	return s.Repo.GetRoles(teamID, roleIDs)
+}
+
+// ListOverrides returns the overrides of a channel to the members of its team.
+func (s *PermissionService) ListOverrides(channelID, userID int) ([]Override, error) {
+	if _, err := s.Authz.ChannelPermissions(userID, channelID); err != nil {
+		return nil, err
+	}
+	return s.Repo.ListOverrides(channelID)
+}
+
+// SetOverride creates or replaces the override of a channel for a target.
+// It needs manage_channels in the channel, and every permission in allow and
+// deny must be one the requester has there.
+func (s *PermissionService) SetOverride(channelID, userID int, req OverrideRequest, meta audit.Meta) (*Override, error) {
+	access, err := s.Repo.GetChannelAccess(userID, channelID)
+	if err != nil {
+		return nil, err
+	}
+	if access.TeamID == nil {
+		return nil, ErrDirectChannel
+	}
+	perms, err := s.requireChannel(userID, channelID, ManageChannels)
+	if err != nil {
+		return nil, err
+	}
+
+	o := &Override{ChannelID: channelID}
+	switch req.Target {
+	case "everyone":
+	case "role":
+		if _, err := s.Repo.GetRole(*access.TeamID, req.RoleID); err != nil {
+			return nil, err
+		}
+		o.RoleID = &req.RoleID
+	case "user":
+		if _, err := s.targetMembership(req.UserID, *access.TeamID); err != nil {
+			return nil, err
+		}
+		o.UserID = &req.UserID
+	default:
+		return nil, ErrInvalidTarget
+	}
+
+	if o.Allow, err = normalizeChannelPermissions(req.Allow); err != nil {
+		return nil, err
+	}
+	if o.Deny, err = normalizeChannelPermissions(req.Deny); err != nil {
+		return nil, err
+	}
+	for _, p := range o.Allow {
+		if contains(o.Deny, p) {
+			return nil, fmt.Errorf("%w: %s", ErrOverrideConflict, p)
+		}
+	}
+	if err := requireAll(perms, o.Allow); err != nil {
+		return nil, err
+	}
+	if err := requireAll(perms, o.Deny); err != nil {
+		return nil, err
+	}
+
+	before, err := s.findOverride(channelID, o.RoleID, o.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Repo.SetOverride(o); err != nil {
+		return nil, err
+	}
+	s.record(audit.Entry{
+		TeamID: *access.TeamID, ActorID: userID, Action: audit.OverrideSet, TargetType: audit.TargetChannel, TargetID: channelID,
+		Changes: audit.Diff(overrideFields(before), overrideFields(o)), Meta: meta,
+	})
+	return o, nil
+}
+
+// DeleteOverride removes an override of a channel.
+func (s *PermissionService) DeleteOverride(channelID, overrideID, userID int, meta audit.Meta) error {
+	if _, err := s.requireChannel(userID, channelID, ManageChannels); err != nil {
+		return err
+	}
+	access, err := s.Repo.GetChannelAccess(userID, channelID)
+	if err != nil {
+		return err
+	}
+	overrides, err := s.Repo.ListOverrides(channelID)
+	if err != nil {
+		return err
+	}
+	var before *Override
+	for i := range overrides {
+		if overrides[i].ID == overrideID {
+			before = &overrides[i]
+		}
+	}
+
+	deleted, err := s.Repo.DeleteOverride(channelID, overrideID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrOverrideNotFound
+	}
+	if access.TeamID != nil {
+		s.record(audit.Entry{
+			TeamID: *access.TeamID, ActorID: userID, Action: audit.OverrideDelete, TargetType: audit.TargetChannel, TargetID: channelID,
+			Changes: audit.Diff(overrideFields(before), nil), Meta: meta,
+		})
+	}
+	return nil
+}
+
+func (s *PermissionService) requireTeam(userID, teamID int, perm string) (Set, error) {
+	perms, err := s.Authz.TeamPermissions(userID, teamID)
+	if err != nil {
+		return nil, err
+	}
+	if !perms.Has(perm) {
+		return nil, fmt.Errorf("%w: %s", ErrForbidden, perm)
+	}
+	return perms, nil
+}
+
+func (s *PermissionService) requireChannel(userID, channelID int, perm string) (Set, error) {
+	perms, err := s.Authz.ChannelPermissions(userID, channelID)
+	if err != nil {
+		return nil, err
+	}
+	if !perms.Has(perm) {
+		return nil, fmt.Errorf("%w: %s", ErrForbidden, perm)
+	}
+	return perms, nil
+}
+
+// findOverride returns the override of a channel for a target, or nil if there is none.
+func (s *PermissionService) findOverride(channelID int, roleID, userID *int) (*Override, error) {
+	overrides, err := s.Repo.ListOverrides(channelID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range overrides {
+		o := &overrides[i]
+		if equalIDs(o.RoleID, roleID) && equalIDs(o.UserID, userID) {
+			return o, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *PermissionService) record(e audit.Entry) {
+	if s.Audit != nil {
+		s.Audit.Record(e)
+	}
+}
+
+func roleFields(role *Role) map[string]interface{} {
+	return map[string]interface{}{"name": role.Name, "permissions": role.Permissions}
+}
+
+func roleNames(roles []Role) []string {
+	names := []string{}
+	for _, role := range roles {
+		names = append(names, role.Name)
+	}
+	return names
+}
+
+// overrideFields describes an override for the audit log; nil gives nil.
+func overrideFields(o *Override) map[string]interface{} {
+	if o == nil {
+		return nil
+	}
+	fields := map[string]interface{}{"target": "everyone", "allow": o.Allow, "deny": o.Deny}
+	if o.RoleID != nil {
+		fields["target"] = "role"
+		fields["role_id"] = *o.RoleID
+	}
+	if o.UserID != nil {
+		fields["target"] = "user"
+		fields["user_id"] = *o.UserID
+	}
+	return fields
+}
+
+func equalIDs(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// targetMembership is GetMembership for the user an action is about, so that
+// "not a member" is reported as not found rather than as forbidden.
+func (s *PermissionService) targetMembership(userID, teamID int) (*membership, error) {
+	m, err := s.Repo.GetMembership(userID, teamID)
+	if errors.Is(err, ErrNotMember) {
+		return nil, ErrMemberNotFound
+	}
+	return m, err
+}
+
+// fillRole validates the request and sets the name and permissions of the role.
+func (s *PermissionService) fillRole(role *Role, req RoleRequest, granter Set) error {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxRoleNameLength {
+		return ErrInvalidRoleName
+	}
+	switch strings.ToLower(name) {
+	case RoleAdmin, RoleMember, "owner":
+		return ErrReservedRoleName
+	}
+	taken, err := s.Repo.RoleNameTaken(role.TeamID, name, role.ID)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrRoleExists
+	}
+
+	perms, err := normalizePermissions(req.Permissions)
+	if err != nil {
+		return err
+	}
+	if err := requireAll(granter, perms); err != nil {
+		return err
+	}
+	role.Name = name
+	role.Permissions = perms
+	return nil
+}
+
+func requireAll(granter Set, perms []string) error {
+	for _, p := range perms {
+		if !granter.Has(p) {
+			return fmt.Errorf("%w: %s", ErrForbidden, p)
+		}
+	}
+	return nil
+}
+
+// normalizePermissions rejects unknown permissions and returns the rest
+// without duplicates, in the order of All.
+func normalizePermissions(perms []string) ([]string, error) {
+	for _, p := range perms {
+		if !contains(All, p) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownPermission, p)
+		}
+	}
+	return NewSet(perms...).List(), nil
+}
+
+func normalizeChannelPermissions(perms []string) ([]string, error) {
+	perms, err := normalizePermissions(perms)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range perms {
+		if !contains(ChannelScoped, p) {
+			return nil, fmt.Errorf("%w: %s", ErrNotChannelPermission, p)
+		}
+	}
+	return perms, nil
+}
+
+func uniqueInts(ids []int) map[int]bool {
+	seen := map[int]bool{}
+	for _, id := range ids {
+		seen[id] = true
+	}
+	return seen
+}
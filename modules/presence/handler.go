@@ -0,0 +1,71 @@
+package presence
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"toller-server/modules/auth"
+)
+
+type PresenceHandler struct {
+	Service *PresenceService
+}
+
+// LookupHandler handles GET /presence?user_ids=1,2,3
+func (h *PresenceHandler) LookupHandler(w http.ResponseWriter, r *http.Request) {
+	viewerID, _ := auth.UserIDFromContext(r.Context())
+
+	var userIDs []int
+	if raw := r.URL.Query().Get("user_ids"); raw != "" {
+		for _, part := range strings.Split(raw, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil || id <= 0 {
+				http.Error(w, ErrInvalidUserID.Error(), http.StatusBadRequest)
+				return
+			}
+			userIDs = append(userIDs, id)
+		}
+	}
+
+	presences, err := h.Service.Lookup(viewerID, userIDs)
+	if err != nil {
+		if errors.Is(err, ErrNoUsers) || errors.Is(err, ErrTooManyUsers) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(presences)
+}
+
+// SetModeHandler handles PUT /presence/me with {"mode": "auto" | "dnd" | "invisible"}
+func (h *PresenceHandler) SetModeHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	var req struct {
+		Mode string `json:"mode"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	p, err := h.Service.SetMode(userID, req.Mode)
+	if err != nil {
+		if errors.Is(err, ErrInvalidMode) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
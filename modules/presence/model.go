@@ -0,0 +1,31 @@
+package presence
+
+// Statuses seen by other users.
+const (
+	StatusOnline  = "online"
+	StatusAway    = "away"
+	StatusDND     = "dnd"
+	StatusOffline = "offline"
+	// StatusInvisible is only ever shown to the user themselves; others see offline.
+	StatusInvisible = "invisible"
+)
+
+// Modes chosen by the user. auto derives online/away from the connections.
+const (
+	ModeAuto      = "auto"
+	ModeDND       = "dnd"
+	ModeInvisible = "invisible"
+)
+
+// Presence is the status of a user. Mode is only set for the user themselves.
+type Presence struct {
+	UserID int    `json:"user_id"`
+	Status string `json:"status"`
+	Mode   string `json:"mode,omitempty"`
+}
+
+// Publisher delivers presence changes to the connected sockets of the given users.
+// The chat Hub implements it.
+type Publisher interface {
+	PublishPresence(userIDs []int, p Presence)
+}
@@ -0,0 +1,78 @@
+package presence
+
+import (
+	"database/sql"
+
+	"toller-server/modules/users"
+
+	"github.com/lib/pq"
+)
+
+type PresenceRepository struct {
+	DB *sql.DB
+}
+
+// related is true for the people who can see each other's presence.
+var related = users.Related("$1", "u")
+
+// GetMode returns the presence mode chosen by the user.
+func (r *PresenceRepository) GetMode(userID int) (string, error) {
+	var mode string
+	err := r.DB.QueryRow(`SELECT presence_mode FROM users WHERE id = $1`, userID).Scan(&mode)
+	return mode, err
+}
+
+// SetMode saves the presence mode of the user.
+func (r *PresenceRepository) SetMode(userID int, mode string) error {
+	res, err := r.DB.Exec(`UPDATE users SET presence_mode = $2 WHERE id = $1`, userID, mode)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Audience returns the other users who can see the user's presence.
+func (r *PresenceRepository) Audience(userID int) ([]int, error) {
+	rows, err := r.DB.Query(users.RelatedIDs("$1"), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// FilterVisible returns the subset of userIDs whose presence the viewer can see.
+func (r *PresenceRepository) FilterVisible(viewerID int, userIDs []int) ([]int, error) {
+	ids := make([]int64, len(userIDs))
+	for i, id := range userIDs {
+		ids[i] = int64(id)
+	}
+	rows, err := r.DB.Query(`SELECT u.id FROM users u WHERE u.id = ANY($2) AND `+related+` ORDER BY u.id`,
+		viewerID, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var visible []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		visible = append(visible, id)
+	}
+	return visible, rows.Err()
+}
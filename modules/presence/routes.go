@@ -0,0 +1,18 @@
+package presence
+
+import (
+	"net/http"
+
+	"toller-server/modules/auth"
+
+	"github.com/gorilla/mux"
+)
+
+// RegisterRoutes registers the presence routes under /api/v1/presence
+func RegisterRoutes(router *mux.Router, handler *PresenceHandler, authMiddleware func(http.Handler) http.Handler) {
+	s := router.PathPrefix("/api/v1").Subrouter()
+	s.Use(authMiddleware)
+
+	s.HandleFunc("/presence", auth.RequireScope(auth.ScopeUsersRead, handler.LookupHandler)).Methods("GET")
+	s.HandleFunc("/presence/me", auth.RequireScope(auth.ScopeUsersWrite, handler.SetModeHandler)).Methods("PUT")
+}
@@ -0,0 +1,262 @@
+package presence
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAwayAfter = 5 * time.Minute
+	maxLookupUsers   = 100
+)
+
+var (
+	ErrInvalidMode   = errors.New("mode must be auto, dnd or invisible")
+	ErrNoUsers       = errors.New("user_ids is required")
+	ErrTooManyUsers  = errors.New("at most 100 user_ids per request")
+	ErrInvalidUserID = errors.New("user_ids must be a comma-separated list of ids")
+)
+
+// userState is what this instance knows about a connected user.
+type userState struct {
+	conns      int // open WebSockets; one per channel or tab
+	lastActive time.Time
+	mode       string
+	status     string // last status published to others
+}
+
+// PresenceService derives online/away/offline from the WebSocket connections of
+// this instance and pushes the changes to friends and teammates.
+type PresenceService struct {
+	Repo      *PresenceRepository
+	Publisher Publisher     // optional
+	AwayAfter time.Duration // without activity for this long the user is away; 5 minutes by default
+
+	mu    sync.Mutex
+	users map[int]*userState
+}
+
+func (s *PresenceService) awayAfter() time.Duration {
+	if s.AwayAfter > 0 {
+		return s.AwayAfter
+	}
+	return defaultAwayAfter
+}
+
+// Connect registers a new WebSocket of the user.
+func (s *PresenceService) Connect(userID int) {
+	s.mu.Lock()
+	_, known := s.users[userID]
+	s.mu.Unlock()
+
+	mode := ModeAuto
+	if !known {
+		m, err := s.Repo.GetMode(userID)
+		if err != nil {
+			log.Printf("presence: could not load the mode of user %d: %v", userID, err)
+		} else {
+			mode = m
+		}
+	}
+
+	s.mu.Lock()
+	if s.users == nil {
+		s.users = make(map[int]*userState)
+	}
+	st, ok := s.users[userID]
+	if !ok {
+		st = &userState{mode: mode, status: StatusOffline}
+		s.users[userID] = st
+	}
+	st.conns++
+	st.lastActive = time.Now()
+	changed := s.refresh(userID, st)
+	s.mu.Unlock()
+
+	s.publish(changed)
+}
+
+// Disconnect unregisters a WebSocket of the user; with the last one they go offline.
+func (s *PresenceService) Disconnect(userID int) {
+	s.mu.Lock()
+	st, ok := s.users[userID]
+	if !ok {
+		s.mu.Unlock()
+		return
+	}
+	st.conns--
+	changed := s.refresh(userID, st)
+	if st.conns <= 0 {
+		delete(s.users, userID)
+	}
+	s.mu.Unlock()
+
+	s.publish(changed)
+}
+
+// Touch records activity (a message, typing or a heartbeat from the client).
+func (s *PresenceService) Touch(userID int) {
+	s.mu.Lock()
+	st, ok := s.users[userID]
+	if !ok {
+		s.mu.Unlock()
+		return
+	}
+	st.lastActive = time.Now()
+	changed := s.refresh(userID, st)
+	s.mu.Unlock()
+
+	s.publish(changed)
+}
+
+// SetMode saves the manual mode (auto, dnd or invisible) and returns the user's own presence.
+func (s *PresenceService) SetMode(userID int, mode string) (*Presence, error) {
+	if mode != ModeAuto && mode != ModeDND && mode != ModeInvisible {
+		return nil, ErrInvalidMode
+	}
+	if err := s.Repo.SetMode(userID, mode); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	var changed *Presence
+	self := Presence{UserID: userID, Status: StatusOffline, Mode: mode}
+	if st, ok := s.users[userID]; ok {
+		st.mode = mode
+		changed = s.refresh(userID, st)
+		self = s.selfView(userID, st)
+	}
+	s.mu.Unlock()
+
+	s.publish(changed)
+	// The user's other tabs learn about the new mode too
+	if s.Publisher != nil {
+		s.Publisher.PublishPresence([]int{userID}, self)
+	}
+	return &self, nil
+}
+
+// Lookup returns the presence of the given users that the viewer can see
+// (themselves, teammates and friends). Other ids are left out.
+func (s *PresenceService) Lookup(viewerID int, userIDs []int) ([]Presence, error) {
+	if len(userIDs) == 0 {
+		return nil, ErrNoUsers
+	}
+	if len(userIDs) > maxLookupUsers {
+		return nil, ErrTooManyUsers
+	}
+
+	visible, err := s.Repo.FilterVisible(viewerID, userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Without connections here the viewer's own mode comes from the database
+	selfMode := ""
+	s.mu.Lock()
+	_, viewerConnected := s.users[viewerID]
+	s.mu.Unlock()
+	if !viewerConnected {
+		if selfMode, err = s.Repo.GetMode(viewerID); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]Presence, 0, len(visible))
+	for _, id := range visible {
+		st, ok := s.users[id]
+		switch {
+		case id == viewerID && ok:
+			result = append(result, s.selfView(id, st))
+		case id == viewerID:
+			result = append(result, Presence{UserID: id, Status: StatusOffline, Mode: selfMode})
+		case ok:
+			result = append(result, Presence{UserID: id, Status: s.publicStatus(st)})
+		default:
+			result = append(result, Presence{UserID: id, Status: StatusOffline})
+		}
+	}
+	return result, nil
+}
+
+// Run marks as away the users without activity, until ctx is cancelled.
+func (s *PresenceService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.awayAfter() / 5)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.sweep()
+		}
+	}
+}
+
+func (s *PresenceService) sweep() {
+	s.mu.Lock()
+	var changes []*Presence
+	for userID, st := range s.users {
+		if changed := s.refresh(userID, st); changed != nil {
+			changes = append(changes, changed)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, changed := range changes {
+		s.publish(changed)
+	}
+}
+
+// publicStatus is the status other users see. Must be called with s.mu held.
+func (s *PresenceService) publicStatus(st *userState) string {
+	switch {
+	case st.conns <= 0 || st.mode == ModeInvisible:
+		return StatusOffline
+	case st.mode == ModeDND:
+		return StatusDND
+	case time.Since(st.lastActive) >= s.awayAfter():
+		return StatusAway
+	default:
+		return StatusOnline
+	}
+}
+
+// selfView is the presence the user sees of themselves. Must be called with s.mu held.
+func (s *PresenceService) selfView(userID int, st *userState) Presence {
+	status := s.publicStatus(st)
+	if st.conns > 0 && st.mode == ModeInvisible {
+		status = StatusInvisible
+	}
+	return Presence{UserID: userID, Status: status, Mode: st.mode}
+}
+
+// refresh recalculates the public status and returns it if it changed.
+// Must be called with s.mu held.
+func (s *PresenceService) refresh(userID int, st *userState) *Presence {
+	status := s.publicStatus(st)
+	if status == st.status {
+		return nil
+	}
+	st.status = status
+	return &Presence{UserID: userID, Status: status}
+}
+
+// publish sends a change to the user's audience. Called without s.mu held,
+// since it queries the database.
+func (s *PresenceService) publish(p *Presence) {
+	if p == nil || s.Publisher == nil {
+		return
+	}
+	audience, err := s.Repo.Audience(p.UserID)
+	if err != nil {
+		log.Printf("presence: could not load the audience of user %d: %v", p.UserID, err)
+		return
+	}
+	s.Publisher.PublishPresence(audience, *p)
+}
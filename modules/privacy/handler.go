@@ -0,0 +1,155 @@
+package privacy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"toller-server/modules/auth"
+
+	"github.com/gorilla/mux"
+)
+
+type PrivacyHandler struct {
+	Service *PrivacyService
+}
+
+func respondJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func exportError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrExportNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrExportInProgress), errors.Is(err, ErrExportNotReady):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, ErrExportExpired):
+		http.Error(w, err.Error(), http.StatusGone)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func exportID(r *http.Request) (int, error) {
+	return strconv.Atoi(mux.Vars(r)["id"])
+}
+
+// RequestExportHandler handles POST /privacy/exports
+func (h *PrivacyHandler) RequestExportHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	e, err := h.Service.RequestExport(userID)
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusAccepted, e)
+}
+
+// ListExportsHandler handles GET /privacy/exports
+func (h *PrivacyHandler) ListExportsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	exports, err := h.Service.ListExports(userID)
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, exports)
+}
+
+// GetExportHandler handles GET /privacy/exports/{id}
+func (h *PrivacyHandler) GetExportHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	id, err := exportID(r)
+	if err != nil {
+		http.Error(w, "Invalid export ID", http.StatusBadRequest)
+		return
+	}
+
+	e, err := h.Service.GetExport(userID, id)
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, e)
+}
+
+// DownloadExportHandler handles GET /privacy/exports/{id}/download
+func (h *PrivacyHandler) DownloadExportHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	id, err := exportID(r)
+	if err != nil {
+		http.Error(w, "Invalid export ID", http.StatusBadRequest)
+		return
+	}
+
+	f, e, err := h.Service.OpenExport(userID, id)
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="toller-export-%d.zip"`, e.ID))
+	w.Header().Set("Content-Length", strconv.FormatInt(e.SizeBytes, 10))
+	io.Copy(w, f)
+}
+
+// RequestDeletionHandler handles POST /privacy/deletion with {"password": "..."}
+func (h *PrivacyHandler) RequestDeletionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	d, err := h.Service.RequestDeletion(userID, req.Password)
+	if err != nil {
+		if errors.Is(err, ErrWrongPassword) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	respondJSON(w, http.StatusAccepted, d)
+}
+
+// GetDeletionHandler handles GET /privacy/deletion
+func (h *PrivacyHandler) GetDeletionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	d, err := h.Service.GetDeletion(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, http.StatusOK, d)
+}
+
+// CancelDeletionHandler handles DELETE /privacy/deletion
+func (h *PrivacyHandler) CancelDeletionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	if err := h.Service.CancelDeletion(userID); err != nil {
+		if errors.Is(err, ErrNoDeletionScheduled) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
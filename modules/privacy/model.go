@@ -0,0 +1,57 @@
+package privacy
+
+import "time"
+
+// Export statuses
+const (
+	ExportPending = "pending"
+	ExportRunning = "running"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+	ExportExpired = "expired" // the file was removed after ExpiresAt
+)
+
+// Export is a personal data export job. The archive can be downloaded while
+// the status is ready and until ExpiresAt.
+type Export struct {
+	ID          int        `json:"id"`
+	Status      string     `json:"status"`
+	SizeBytes   int64      `json:"size_bytes"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+
+	userID   int
+	fileName string
+}
+
+// Deletion is the state of an account deletion request.
+type Deletion struct {
+	ScheduledAt *time.Time `json:"scheduled_at"` // nil when no deletion is pending
+}
+
+// ExportedFriend is a friendship as it appears in the archive.
+type ExportedFriend struct {
+	UserID    int    `json:"user_id"`
+	Username  string `json:"username"`
+	Status    string `json:"status"`
+	Direction string `json:"direction"` // sent / received
+}
+
+// ExportedMessage is a message authored by the user as it appears in the archive.
+type ExportedMessage struct {
+	ID          int       `json:"id"`
+	ChannelID   int       `json:"channel_id"`
+	ChannelName string    `json:"channel_name"`
+	TeamID      *int      `json:"team_id"`
+	IsDM        bool      `json:"is_dm"`
+	Content     string    `json:"content"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// IdentityConfirmer re-checks the user's password before a destructive action.
+// The auth module implements it.
+type IdentityConfirmer interface {
+	ConfirmPassword(userID int, password string) (bool, error)
+}
@@ -0,0 +1,300 @@
+package privacy
+
+import (
+	"database/sql"
+	"time"
+)
+
+type PrivacyRepository struct {
+	DB *sql.DB
+}
+
+const exportColumns = `id, user_id, status, COALESCE(file_name, ''), size_bytes, COALESCE(error, ''), created_at, completed_at, expires_at`
+
+func scanExport(row interface{ Scan(...interface{}) error }) (*Export, error) {
+	var e Export
+	err := row.Scan(&e.ID, &e.userID, &e.Status, &e.fileName, &e.SizeBytes, &e.Error, &e.CreatedAt, &e.CompletedAt, &e.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// CreateExport queues an export, unless the user already has one pending or
+// running; in that case it returns sql.ErrNoRows.
+func (r *PrivacyRepository) CreateExport(userID int) (*Export, error) {
+	return scanExport(r.DB.QueryRow(`
+		INSERT INTO data_exports (user_id)
+		SELECT $1
+		WHERE NOT EXISTS (
+			SELECT 1 FROM data_exports WHERE user_id = $1 AND status IN ('pending', 'running')
+		)
+		RETURNING `+exportColumns, userID))
+}
+
+// ListExports returns the exports of the user, newest first.
+func (r *PrivacyRepository) ListExports(userID int) ([]Export, error) {
+	rows, err := r.DB.Query(`SELECT `+exportColumns+` FROM data_exports WHERE user_id = $1 ORDER BY id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exports := []Export{}
+	for rows.Next() {
+		e, err := scanExport(rows)
+		if err != nil {
+			return nil, err
+		}
+		exports = append(exports, *e)
+	}
+	return exports, rows.Err()
+}
+
+// GetExport returns an export of the user.
+func (r *PrivacyRepository) GetExport(userID, exportID int) (*Export, error) {
+	return scanExport(r.DB.QueryRow(`SELECT `+exportColumns+` FROM data_exports WHERE id = $1 AND user_id = $2`, exportID, userID))
+}
+
+// ClaimExport marks the oldest pending export as running and returns it, or
+// sql.ErrNoRows if there is none. SKIP LOCKED lets several instances share the queue.
+func (r *PrivacyRepository) ClaimExport() (*Export, error) {
+	return scanExport(r.DB.QueryRow(`
+		UPDATE data_exports SET status = 'running'
+		WHERE id = (
+			SELECT id FROM data_exports WHERE status = 'pending'
+			ORDER BY id LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + exportColumns))
+}
+
+// RequeueStaleExports returns to the queue the exports left running (e.g. by a
+// restart) for longer than maxAge.
+func (r *PrivacyRepository) RequeueStaleExports(maxAge time.Duration) error {
+	_, err := r.DB.Exec(`
+		UPDATE data_exports SET status = 'pending'
+		WHERE status = 'running' AND created_at < NOW() - make_interval(secs => $1)`, int64(maxAge/time.Second))
+	return err
+}
+
+// CompleteExport marks the export as ready to download for ttl.
+func (r *PrivacyRepository) CompleteExport(exportID int, fileName string, size int64, ttl time.Duration) error {
+	_, err := r.DB.Exec(`
+		UPDATE data_exports
+		SET status = 'ready', file_name = $2, size_bytes = $3, completed_at = NOW(),
+			expires_at = NOW() + make_interval(secs => $4)
+		WHERE id = $1`, exportID, fileName, size, int64(ttl/time.Second))
+	return err
+}
+
+// FailExport records why the export could not be built.
+func (r *PrivacyRepository) FailExport(exportID int, reason string) error {
+	_, err := r.DB.Exec(`UPDATE data_exports SET status = 'failed', error = $2, completed_at = NOW() WHERE id = $1`, exportID, reason)
+	return err
+}
+
+// ExpireExports marks the ready exports past their expiry as expired and
+// returns their file names so the files can be removed.
+func (r *PrivacyRepository) ExpireExports() ([]string, error) {
+	rows, err := r.DB.Query(`
+		UPDATE data_exports SET status = 'expired'
+		WHERE status = 'ready' AND expires_at <= NOW()
+		RETURNING COALESCE(file_name, '')`)
+	if err != nil {
+		return nil, err
+	}
+	return scanStrings(rows)
+}
+
+// ListFriends returns every friendship of the user, in both directions.
+func (r *PrivacyRepository) ListFriends(userID int) ([]ExportedFriend, error) {
+	rows, err := r.DB.Query(`
+		SELECT u.id, u.username, f.status, CASE WHEN f.user_id = $1 THEN 'sent' ELSE 'received' END
+		FROM friends f
+		JOIN users u ON u.id = CASE WHEN f.user_id = $1 THEN f.friend_id ELSE f.user_id END
+		WHERE f.user_id = $1 OR f.friend_id = $1
+		ORDER BY u.id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	friends := []ExportedFriend{}
+	for rows.Next() {
+		var f ExportedFriend
+		if err := rows.Scan(&f.UserID, &f.Username, &f.Status, &f.Direction); err != nil {
+			return nil, err
+		}
+		friends = append(friends, f)
+	}
+	return friends, rows.Err()
+}
+
+// EachMessage calls fn for every message authored by the user, oldest first,
+// without loading them all in memory.
+func (r *PrivacyRepository) EachMessage(userID int, fn func(ExportedMessage) error) error {
+	rows, err := r.DB.Query(`
+		SELECT m.id, m.channel_id, c.name, c.team_id, c.is_dm, m.content, m.created_at
+		FROM messages m
+		JOIN channels c ON c.id = m.channel_id
+		WHERE m.user_id = $1
+		ORDER BY m.id`, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m ExportedMessage
+		if err := rows.Scan(&m.ID, &m.ChannelID, &m.ChannelName, &m.TeamID, &m.IsDM, &m.Content, &m.CreatedAt); err != nil {
+			return err
+		}
+		if err := fn(m); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ScheduleDeletion schedules the account for deletion after grace and returns
+// when. If it was already scheduled the original date is kept.
+func (r *PrivacyRepository) ScheduleDeletion(userID int, grace time.Duration) (time.Time, error) {
+	var at time.Time
+	err := r.DB.QueryRow(`
+		UPDATE users
+		SET deletion_scheduled_at = COALESCE(deletion_scheduled_at, NOW() + make_interval(secs => $2))
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING deletion_scheduled_at`, userID, int64(grace/time.Second)).Scan(&at)
+	return at, err
+}
+
+// GetDeletion returns when the account is scheduled for deletion, if it is.
+func (r *PrivacyRepository) GetDeletion(userID int) (*time.Time, error) {
+	var at *time.Time
+	err := r.DB.QueryRow(`SELECT deletion_scheduled_at FROM users WHERE id = $1`, userID).Scan(&at)
+	return at, err
+}
+
+// CancelDeletion cancels a scheduled deletion; false if there was none.
+func (r *PrivacyRepository) CancelDeletion(userID int) (bool, error) {
+	res, err := r.DB.Exec(`
+		UPDATE users SET deletion_scheduled_at = NULL
+		WHERE id = $1 AND deletion_scheduled_at IS NOT NULL AND deleted_at IS NULL`, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// DueDeletions returns the accounts whose grace period is over.
+func (r *PrivacyRepository) DueDeletions() ([]int, error) {
+	rows, err := r.DB.Query(`
+		SELECT id FROM users
+		WHERE deletion_scheduled_at <= NOW() AND deleted_at IS NULL
+		ORDER BY deletion_scheduled_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// AnonymizeUser erases the personal data of the account in a transaction. The
+// users row stays, scrubbed, so the messages it authored keep their author for
+// everyone else. Returns the export files to remove.
+func (r *PrivacyRepository) AnonymizeUser(userID int) ([]string, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`DELETE FROM data_exports WHERE user_id = $1 RETURNING COALESCE(file_name, '')`, userID)
+	if err != nil {
+		return nil, err
+	}
+	files, err := scanStrings(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	statements := []string{
+		// Credentials and sessions
+		`DELETE FROM sessions WHERE user_id = $1`,
+		`DELETE FROM personal_access_tokens WHERE user_id = $1`,
+		`DELETE FROM mfa_recovery_codes WHERE user_id = $1`,
+		`DELETE FROM user_mfa WHERE user_id = $1`,
+		`DELETE FROM user_identities WHERE user_id = $1`,
+		`DELETE FROM email_verifications WHERE user_id = $1`,
+		`DELETE FROM password_resets WHERE user_id = $1`,
+		`DELETE FROM login_attempts WHERE email = (SELECT email FROM users WHERE id = $1)`,
+		`DELETE FROM mfa_attempts WHERE user_id = $1`,
+		`DELETE FROM account_lockouts WHERE user_id = $1 OR email = (SELECT email FROM users WHERE id = $1)`,
+		// Relationships and preferences. DM memberships stay so the other
+		// participant keeps the conversation
+		`DELETE FROM user_settings WHERE user_id = $1`,
+		`DELETE FROM friends WHERE user_id = $1 OR friend_id = $1`,
+		// Owned teams with nobody else go away; the rest pass to another person,
+		// preferring admins, who becomes admin if they were not
+		`DELETE FROM teams t WHERE t.owner_id = $1 AND NOT EXISTS (
+			SELECT 1 FROM user_teams ut JOIN users u ON u.id = ut.user_id
+			WHERE ut.team_id = t.id AND ut.user_id <> $1 AND NOT u.is_bot
+		)`,
+		`UPDATE teams t SET owner_id = (
+			SELECT ut.user_id FROM user_teams ut JOIN users u ON u.id = ut.user_id
+			WHERE ut.team_id = t.id AND ut.user_id <> $1 AND NOT u.is_bot
+			ORDER BY ut.role = 'admin' DESC, ut.user_id
+			LIMIT 1
+		) WHERE t.owner_id = $1`,
+		`UPDATE user_teams ut SET role = 'admin' FROM teams t
+		WHERE t.id = ut.team_id AND t.owner_id = ut.user_id AND ut.role <> 'admin'`,
+		`DELETE FROM user_teams WHERE user_id = $1`,
+		`DELETE FROM team_join_requests WHERE user_id = $1`,
+		`DELETE FROM channel_users WHERE user_id = $1 AND channel_id IN (SELECT id FROM channels WHERE NOT is_dm)`,
+		`DELETE FROM channel_permission_overrides WHERE user_id = $1`,
+		`DELETE FROM last_read WHERE user_id = $1`,
+		// Personal bots go away (their messages lose the author); team bots stay with the team
+		`DELETE FROM users WHERE is_bot AND bot_owner_id = $1 AND bot_team_id IS NULL`,
+		`UPDATE users SET bot_owner_id = NULL WHERE bot_owner_id = $1`,
+		// The row stays as an anonymous author; the random username cannot clash with a real one
+		`UPDATE users SET
+			username = 'deleted-' || substr(md5(random()::text || id::text), 1, 12),
+			email = 'deleted-' || id || '@deleted.invalid',
+			password = '!deleted',
+			email_verified = FALSE, email_verified_at = NULL,
+			display_name = 'Deleted user', avatar_url = '', bio = '', pronouns = '', timezone = '', locale = '',
+			status_emoji = '', status_text = '', status_expires_at = NULL,
+			presence_mode = 'auto', deletion_scheduled_at = NULL, deleted_at = NOW()
+		WHERE id = $1`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt, userID); err != nil {
+			return nil, err
+		}
+	}
+	return files, tx.Commit()
+}
+
+func scanStrings(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+	var values []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
@@ -0,0 +1,25 @@
+package privacy
+
+import (
+	"net/http"
+
+	"toller-server/modules/auth"
+
+	"github.com/gorilla/mux"
+)
+
+// RegisterRoutes registers the privacy routes under /api/v1/privacy. They
+// require an interactive session: API tokens can neither export the account
+// nor delete it.
+func RegisterRoutes(router *mux.Router, handler *PrivacyHandler, authMiddleware func(http.Handler) http.Handler) {
+	s := router.PathPrefix("/api/v1/privacy").Subrouter()
+	s.Use(authMiddleware)
+
+	s.HandleFunc("/exports", auth.SessionOnly(handler.RequestExportHandler)).Methods("POST")
+	s.HandleFunc("/exports", auth.SessionOnly(handler.ListExportsHandler)).Methods("GET")
+	s.HandleFunc("/exports/{id:[0-9]+}", auth.SessionOnly(handler.GetExportHandler)).Methods("GET")
+	s.HandleFunc("/exports/{id:[0-9]+}/download", auth.SessionOnly(handler.DownloadExportHandler)).Methods("GET")
+	s.HandleFunc("/deletion", auth.SessionOnly(handler.RequestDeletionHandler)).Methods("POST")
+	s.HandleFunc("/deletion", auth.SessionOnly(handler.GetDeletionHandler)).Methods("GET")
+	s.HandleFunc("/deletion", auth.SessionOnly(handler.CancelDeletionHandler)).Methods("DELETE")
+}
@@ -0,0 +1,349 @@
+package privacy
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"toller-server/modules/users"
+)
+
+var (
+	ErrExportInProgress    = errors.New("an export is already in progress")
+	ErrExportNotFound      = errors.New("export not found")
+	ErrExportNotReady      = errors.New("export is not ready")
+	ErrExportExpired       = errors.New("export has expired")
+	ErrWrongPassword       = errors.New("wrong password")
+	ErrNoDeletionScheduled = errors.New("no deletion is scheduled")
+)
+
+const (
+	DefaultExportTTL     = 7 * 24 * time.Hour
+	DefaultDeletionGrace = 30 * 24 * time.Hour
+
+	pollInterval   = 10 * time.Second
+	staleExportAge = time.Hour
+	archiveVersion = 1
+)
+
+type PrivacyService struct {
+	Repo          *PrivacyRepository
+	Users         *users.UserService
+	Identity      IdentityConfirmer
+	ExportDir     string
+	ExportTTL     time.Duration // how long a ready archive can be downloaded
+	DeletionGrace time.Duration // time between the request and the anonymization
+}
+
+func NewPrivacyService(db *sql.DB, usersService *users.UserService, identity IdentityConfirmer, exportDir string) *PrivacyService {
+	return &PrivacyService{
+		Repo:          &PrivacyRepository{DB: db},
+		Users:         usersService,
+		Identity:      identity,
+		ExportDir:     exportDir,
+		ExportTTL:     DefaultExportTTL,
+		DeletionGrace: DefaultDeletionGrace,
+	}
+}
+
+// RequestExport queues a new export; only one can be pending at a time.
+func (s *PrivacyService) RequestExport(userID int) (*Export, error) {
+	e, err := s.Repo.CreateExport(userID)
+	if err == sql.ErrNoRows {
+		return nil, ErrExportInProgress
+	}
+	return e, err
+}
+
+func (s *PrivacyService) ListExports(userID int) ([]Export, error) {
+	return s.Repo.ListExports(userID)
+}
+
+func (s *PrivacyService) GetExport(userID, exportID int) (*Export, error) {
+	e, err := s.Repo.GetExport(userID, exportID)
+	if err == sql.ErrNoRows {
+		return nil, ErrExportNotFound
+	}
+	return e, err
+}
+
+// OpenExport opens the archive of a ready export. The caller closes the file.
+func (s *PrivacyService) OpenExport(userID, exportID int) (*os.File, *Export, error) {
+	e, err := s.GetExport(userID, exportID)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch {
+	case e.Status == ExportExpired, e.Status == ExportReady && e.ExpiresAt != nil && !e.ExpiresAt.After(time.Now()):
+		return nil, nil, ErrExportExpired
+	case e.Status != ExportReady:
+		return nil, nil, ErrExportNotReady
+	}
+	f, err := os.Open(filepath.Join(s.ExportDir, e.fileName))
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, e, nil
+}
+
+// Run processes the export queue, expires old archives and anonymizes the
+// accounts whose grace period ended, until ctx is cancelled.
+func (s *PrivacyService) Run(ctx context.Context) {
+	if err := s.Repo.RequeueStaleExports(staleExportAge); err != nil {
+		log.Println("could not requeue stale exports:", err)
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		s.ProcessExports()
+		s.ExpireExports()
+		s.ProcessDeletions()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessExports builds every pending export.
+func (s *PrivacyService) ProcessExports() {
+	for {
+		e, err := s.Repo.ClaimExport()
+		if err == sql.ErrNoRows {
+			return
+		}
+		if err != nil {
+			log.Println("could not claim an export:", err)
+			return
+		}
+
+		fileName, size, err := s.buildArchive(e.userID)
+		if err != nil {
+			log.Printf("export %d of user %d failed: %v", e.ID, e.userID, err)
+			if err := s.Repo.FailExport(e.ID, "the archive could not be built"); err != nil {
+				log.Printf("could not mark export %d as failed: %v", e.ID, err)
+			}
+			continue
+		}
+		if err := s.Repo.CompleteExport(e.ID, fileName, size, s.ExportTTL); err != nil {
+			log.Printf("could not complete export %d: %v", e.ID, err)
+			s.removeFile(fileName)
+		}
+	}
+}
+
+// ExpireExports removes the archives past their expiry.
+func (s *PrivacyService) ExpireExports() {
+	files, err := s.Repo.ExpireExports()
+	if err != nil {
+		log.Println("could not expire exports:", err)
+		return
+	}
+	for _, name := range files {
+		s.removeFile(name)
+	}
+}
+
+// buildArchive writes the zip with every piece of data held about the user
+// and returns its file name and size.
+func (s *PrivacyService) buildArchive(userID int) (string, int64, error) {
+	if err := os.MkdirAll(s.ExportDir, 0o700); err != nil {
+		return "", 0, err
+	}
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", 0, err
+	}
+	fileName := fmt.Sprintf("export-%d-%s.zip", userID, hex.EncodeToString(token))
+
+	// Written under a temporary name so a crash never leaves a half archive behind
+	tmp, err := os.CreateTemp(s.ExportDir, "export-*.tmp")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if err := s.writeArchive(tmp, userID); err != nil {
+		return "", 0, err
+	}
+	info, err := tmp.Stat()
+	if err != nil {
+		return "", 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", 0, err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(s.ExportDir, fileName)); err != nil {
+		return "", 0, err
+	}
+	return fileName, info.Size(), nil
+}
+
+func (s *PrivacyService) writeArchive(w io.Writer, userID int) error {
+	profile, err := s.Users.GetUserByID(userID, userID)
+	if err != nil {
+		return err
+	}
+	settings, err := s.Users.GetSettings(userID)
+	if err != nil {
+		return err
+	}
+	teams, err := s.Users.Repo.ListTeamMemberships(userID)
+	if err != nil {
+		return err
+	}
+	friends, err := s.Repo.ListFriends(userID)
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"manifest.json", map[string]interface{}{
+			"version":      archiveVersion,
+			"user_id":      userID,
+			"generated_at": time.Now().UTC(),
+			// Messages carry no attachments yet; when they do, the files go under
+			// attachments/<message_id>/ and are listed here.
+			"attachments": []string{},
+		}},
+		{"profile.json", profile},
+		{"settings.json", settings},
+		{"teams.json", teams},
+		{"friends.json", friends},
+	}
+	for _, f := range files {
+		if err := addJSON(zw, f.name, f.data); err != nil {
+			return err
+		}
+	}
+	if err := s.writeMessages(zw, userID); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// writeMessages streams the messages as a JSON array, one row at a time, so
+// long histories do not have to fit in memory.
+func (s *PrivacyService) writeMessages(zw *zip.Writer, userID int) error {
+	out, err := zw.Create("messages.json")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(out, "["); err != nil {
+		return err
+	}
+	first := true
+	err = s.Repo.EachMessage(userID, func(m ExportedMessage) error {
+		if !first {
+			if _, err := io.WriteString(out, ","); err != nil {
+				return err
+			}
+		}
+		first = false
+		data, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(out, "]")
+	return err
+}
+
+func addJSON(zw *zip.Writer, name string, v interface{}) error {
+	out, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func (s *PrivacyService) removeFile(name string) {
+	if name == "" {
+		return
+	}
+	if err := os.Remove(filepath.Join(s.ExportDir, name)); err != nil && !os.IsNotExist(err) {
+		log.Printf("could not remove export file %s: %v", name, err)
+	}
+}
+
+// RequestDeletion schedules the account for deletion after the grace period,
+// once the password is confirmed. Asking again keeps the original date.
+func (s *PrivacyService) RequestDeletion(userID int, password string) (*Deletion, error) {
+	ok, err := s.Identity.ConfirmPassword(userID, password)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrWrongPassword
+	}
+	at, err := s.Repo.ScheduleDeletion(userID, s.DeletionGrace)
+	if err != nil {
+		return nil, err
+	}
+	return &Deletion{ScheduledAt: &at}, nil
+}
+
+func (s *PrivacyService) GetDeletion(userID int) (*Deletion, error) {
+	at, err := s.Repo.GetDeletion(userID)
+	if err != nil {
+		return nil, err
+	}
+	return &Deletion{ScheduledAt: at}, nil
+}
+
+// CancelDeletion keeps the account; any time during the grace period.
+func (s *PrivacyService) CancelDeletion(userID int) error {
+	ok, err := s.Repo.CancelDeletion(userID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNoDeletionScheduled
+	}
+	return nil
+}
+
+// ProcessDeletions anonymizes every account whose grace period is over.
+func (s *PrivacyService) ProcessDeletions() {
+	ids, err := s.Repo.DueDeletions()
+	if err != nil {
+		log.Println("could not load due deletions:", err)
+		return
+	}
+	for _, id := range ids {
+		files, err := s.Repo.AnonymizeUser(id)
+		if err != nil {
+			log.Printf("could not delete account %d: %v", id, err)
+			continue
+		}
+		for _, name := range files {
+			s.removeFile(name)
+		}
+		log.Printf("account %d deleted", id)
+	}
+}
@@ -0,0 +1,182 @@
+package teams
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"toller-server/modules/audit"
+	"toller-server/modules/permissions"
+)
+
+// Visibilidad de un team
+const (
+	VisibilityPrivate      = "private"      // solo se entra por invitación
+	VisibilityDiscoverable = "discoverable" // aparece en el directorio y se pide unirse
+	VisibilityOpen         = "open"         // aparece en el directorio y cualquiera entra
+)
+
+const (
+	defaultDirectoryLimit = 20
+	maxDirectoryLimit     = 100
+	maxDirectoryQuery     = 100
+	maxJoinMessage        = 500
+)
+
+var (
+	ErrInvalidVisibility   = errors.New("visibilidad inválida, debe ser 'private', 'discoverable' u 'open'")
+	ErrInvalidCursor       = errors.New("cursor inválido")
+	ErrQueryTooLong        = errors.New("la búsqueda es demasiado larga")
+	ErrJoinMessageTooLong  = errors.New("el mensaje puede tener como máximo 500 caracteres")
+	ErrTeamNotJoinable     = errors.New("el equipo no existe o solo admite miembros por invitación")
+	ErrJoinRequestPending  = errors.New("ya tienes una solicitud pendiente para este equipo")
+	ErrJoinRequestNotFound = errors.New("la solicitud no existe o ya fue respondida")
+)
+
+func validVisibility(v string) bool {
+	return v == VisibilityPrivate || v == VisibilityDiscoverable || v == VisibilityOpen
+}
+
+// Buscar en el directorio de teams (los discoverable y open), por relevancia si hay búsqueda
+func (s *TeamService) Directory(userID int, q DirectoryQuery) (*DirectoryPage, error) {
+	q.Query = strings.TrimSpace(q.Query)
+	if utf8.RuneCountInString(q.Query) > maxDirectoryQuery {
+		return nil, ErrQueryTooLong
+	}
+	if q.Limit <= 0 {
+		q.Limit = defaultDirectoryLimit
+	}
+	if q.Limit > maxDirectoryLimit {
+		q.Limit = maxDirectoryLimit
+	}
+
+	var after *directoryKey
+	if q.Cursor != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		after = &directoryKey{}
+		if err := json.Unmarshal(raw, after); err != nil {
+			return nil, ErrInvalidCursor
+		}
+	}
+
+	teams, keys, err := s.Repo.Directory(userID, q, after)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &DirectoryPage{Teams: teams}
+	if len(teams) > q.Limit {
+		page.Teams = teams[:q.Limit]
+		raw, _ := json.Marshal(keys[q.Limit-1])
+		page.NextCursor = base64.RawURLEncoding.EncodeToString(raw)
+	}
+	return page, nil
+}
+
+// Unirse a un team del directorio. En un team open se entra en el momento como
+// member (joined = true); en uno discoverable queda una solicitud pendiente
+// para que la apruebe quien gestiona los miembros
+func (s *TeamService) JoinTeam(teamID, userID int, message string, meta audit.Meta) (joined bool, request *JoinRequest, err error) {
+	team, err := s.Repo.GetTeamByID(teamID)
+	if err != nil || team.Visibility == VisibilityPrivate {
+		// Un team privado no se distingue de uno que no existe
+		return false, nil, ErrTeamNotJoinable
+	}
+	message = strings.TrimSpace(message)
+	if utf8.RuneCountInString(message) > maxJoinMessage {
+		return false, nil, ErrJoinMessageTooLong
+	}
+	if s.Accounts != nil {
+		if err := s.Accounts.EnsureVerified(userID); err != nil {
+			return false, nil, err
+		}
+	}
+
+	isMember, _, err := s.Repo.IsUserInTeam(userID, teamID)
+	if err != nil {
+		return false, nil, err
+	}
+	if isMember {
+		return false, nil, ErrAlreadyMember
+	}
+
+	if team.Visibility == VisibilityOpen {
+		added, err := s.Repo.JoinTeam(userID, teamID)
+		if err != nil {
+			return false, nil, err
+		}
+		if !added {
+			return false, nil, ErrAlreadyMember
+		}
+		s.joinDefaultChannels(teamID, userID)
+		s.record(audit.Entry{
+			TeamID: teamID, ActorID: userID, Action: audit.MemberJoin, TargetType: audit.TargetUser, TargetID: userID,
+			Changes: audit.Diff(nil, map[string]interface{}{"role": "member"}), Meta: meta,
+		})
+		return true, nil, nil
+	}
+
+	request = &JoinRequest{TeamID: teamID, UserID: userID, Message: message}
+	if err := s.Repo.CreateJoinRequest(request); err != nil {
+		return false, nil, err
+	}
+	return false, request, nil
+}
+
+// Cancelar la solicitud pendiente del usuario para unirse al team
+func (s *TeamService) CancelJoinRequest(teamID, userID int) error {
+	cancelled, err := s.Repo.CancelJoinRequest(teamID, userID)
+	if err != nil {
+		return err
+	}
+	if !cancelled {
+		return ErrJoinRequestNotFound
+	}
+	return nil
+}
+
+// Obtener las solicitudes pendientes del team (requiere manage_members)
+func (s *TeamService) GetJoinRequests(teamID, requestingUserID int) ([]JoinRequest, error) {
+	if err := s.authorize(teamID, requestingUserID, permissions.ManageMembers); err != nil {
+		return nil, err
+	}
+	return s.Repo.GetPendingJoinRequests(teamID)
+}
+
+// Aprobar una solicitud (requiere manage_members): el usuario entra como member
+func (s *TeamService) ApproveJoinRequest(teamID, requestID, requestingUserID int, meta audit.Meta) (*JoinRequest, error) {
+	if err := s.authorize(teamID, requestingUserID, permissions.ManageMembers); err != nil {
+		return nil, err
+	}
+	request, err := s.Repo.ApproveJoinRequest(teamID, requestID, requestingUserID)
+	if err != nil {
+		return nil, err
+	}
+	s.joinDefaultChannels(teamID, request.UserID)
+	s.record(audit.Entry{
+		TeamID: teamID, ActorID: requestingUserID, Action: audit.JoinRequestApprove, TargetType: audit.TargetUser, TargetID: request.UserID,
+		Changes: audit.Diff(nil, map[string]interface{}{"role": "member", "request_id": request.ID}), Meta: meta,
+	})
+	return request, nil
+}
+
+// Rechazar una solicitud (requiere manage_members)
+func (s *TeamService) RejectJoinRequest(teamID, requestID, requestingUserID int, meta audit.Meta) (*JoinRequest, error) {
+	if err := s.authorize(teamID, requestingUserID, permissions.ManageMembers); err != nil {
+		return nil, err
+	}
+	request, err := s.Repo.RejectJoinRequest(teamID, requestID, requestingUserID)
+	if err != nil {
+		return nil, err
+	}
+	s.record(audit.Entry{
+		TeamID: teamID, ActorID: requestingUserID, Action: audit.JoinRequestReject, TargetType: audit.TargetUser, TargetID: request.UserID,
+		Changes: audit.Diff(nil, map[string]interface{}{"request_id": request.ID}), Meta: meta,
+	})
+	return request, nil
+}
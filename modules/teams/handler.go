@@ -2,8 +2,15 @@ package teams
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
+
+	"toller-server/modules/audit"
+	"toller-server/modules/auth"
 
 	"github.com/gorilla/mux"
 )
@@ -19,11 +26,12 @@ type ErrorResponse struct {
 
 // POST /teams - Crear un nuevo team
 func (h *TeamHandler) CreateTeam(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value("user_id").(int)
+	userID, _ := auth.UserIDFromContext(r.Context())
 
 	var req struct {
 		Name        string `json:"name"`
 		Description string `json:"description"`
+		Visibility  string `json:"visibility"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -36,7 +44,7 @@ func (h *TeamHandler) CreateTeam(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	team, err := h.Service.CreateTeam(req.Name, req.Description, userID)
+	team, err := h.Service.CreateTeam(req.Name, req.Description, req.Visibility, userID, audit.MetaFromRequest(r))
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
@@ -57,7 +65,7 @@ func (h *TeamHandler) CreateTeam(w http.ResponseWriter, r *http.Request) {
 
 // GET /teams - Obtener todos los teams del usuario
 func (h *TeamHandler) GetUserTeams(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value("user_id").(int)
+	userID, _ := auth.UserIDFromContext(r.Context())
 
 	teams, err := h.Service.GetUserTeams(userID)
 	if err != nil {
@@ -81,7 +89,7 @@ func (h *TeamHandler) GetUserTeams(w http.ResponseWriter, r *http.Request) {
 
 // GET /teams/{id} - Obtener un team específico
 func (h *TeamHandler) GetTeam(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value("user_id").(int)
+	userID, _ := auth.UserIDFromContext(r.Context())
 	vars := mux.Vars(r)
 	teamID, err := strconv.Atoi(vars["id"])
 	if err != nil {
@@ -111,7 +119,7 @@ func (h *TeamHandler) GetTeam(w http.ResponseWriter, r *http.Request) {
 
 // GET /teams/{id}/members - Obtener miembros del team
 func (h *TeamHandler) GetTeamMembers(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value("user_id").(int)
+	userID, _ := auth.UserIDFromContext(r.Context())
 	vars := mux.Vars(r)
 	teamID, err := strconv.Atoi(vars["id"])
 	if err != nil {
@@ -139,9 +147,39 @@ func (h *TeamHandler) GetTeamMembers(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(members)
 }
 
+// GET /teams/{id}/lockouts - Bloqueos de login de los miembros (requiere manage_members)
+func (h *TeamHandler) GetMemberLockouts(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	vars := mux.Vars(r)
+	teamID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{
+			Error:   "invalid_id",
+			Message: "ID de equipo inválido",
+		})
+		return
+	}
+
+	lockouts, err := h.Service.GetMemberLockouts(teamID, userID)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(ErrorResponse{
+			Error:   "access_denied",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lockouts)
+}
+
 // POST /teams/{id}/members - Agregar miembro al team
 func (h *TeamHandler) AddMember(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value("user_id").(int)
+	userID, _ := auth.UserIDFromContext(r.Context())
 	vars := mux.Vars(r)
 	teamID, err := strconv.Atoi(vars["team_id"])
 	if err != nil {
@@ -168,7 +206,7 @@ func (h *TeamHandler) AddMember(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.Service.AddMember(teamID, req.UserID, userID)
+	err = h.Service.AddMember(teamID, req.UserID, userID, audit.MetaFromRequest(r))
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusForbidden)
@@ -185,14 +223,14 @@ func (h *TeamHandler) AddMember(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// DELETE /teams/{id}/members/{user_id} - Remover miembro
+// DELETE /teams/{team_id}/members/{user_id} - Remover miembro
 func (h *TeamHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value("user_id").(int)
+	userID, _ := auth.UserIDFromContext(r.Context())
 	vars := mux.Vars(r)
-	teamID, _ := strconv.Atoi(vars["id"])
+	teamID, _ := strconv.Atoi(vars["team_id"])
 	memberID, _ := strconv.Atoi(vars["user_id"])
 
-	err := h.Service.RemoveMember(teamID, memberID, userID)
+	err := h.Service.RemoveMember(teamID, memberID, userID, audit.MetaFromRequest(r))
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusForbidden)
@@ -211,13 +249,14 @@ func (h *TeamHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
 
 // PUT /teams/{id} - Actualizar team
 func (h *TeamHandler) UpdateTeam(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value("user_id").(int)
+	userID, _ := auth.UserIDFromContext(r.Context())
 	vars := mux.Vars(r)
 	teamID, _ := strconv.Atoi(vars["id"])
 
 	var req struct {
 		Name        string `json:"name"`
 		Description string `json:"description"`
+		Visibility  string `json:"visibility"` // vacío = sin cambios
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -230,7 +269,11 @@ func (h *TeamHandler) UpdateTeam(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.Service.UpdateTeam(teamID, userID, req.Name, req.Description)
+	err := h.Service.UpdateTeam(teamID, userID, req.Name, req.Description, req.Visibility, audit.MetaFromRequest(r))
+	if errors.Is(err, ErrInvalidVisibility) || errors.Is(err, ErrInvalidTeamName) {
+		writeTeamError(w, "update_failed", err)
+		return
+	}
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusForbidden)
@@ -249,23 +292,439 @@ func (h *TeamHandler) UpdateTeam(w http.ResponseWriter, r *http.Request) {
 
 // POST /teams/{id}/leave - Salir del team
 func (h *TeamHandler) LeaveTeam(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value("user_id").(int)
+	userID, _ := auth.UserIDFromContext(r.Context())
 	vars := mux.Vars(r)
 	teamID, _ := strconv.Atoi(vars["id"])
 
-	err := h.Service.LeaveTeam(teamID, userID)
+	err := h.Service.LeaveTeam(teamID, userID, audit.MetaFromRequest(r))
 	if err != nil {
+		writeTeamError(w, "leave_failed", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Has salido del equipo exitosamente",
+	})
+}
+
+// PUT /teams/{team_id}/members/{user_id} - Cambiar el rol de un miembro
+func (h *TeamHandler) UpdateMemberRole(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	vars := mux.Vars(r)
+	teamID, _ := strconv.Atoi(vars["team_id"])
+	memberID, _ := strconv.Atoi(vars["user_id"])
+
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(ErrorResponse{
-			Error:   "leave_failed",
-			Message: err.Error(),
+			Error:   "invalid_request",
+			Message: "Formato de solicitud inválido",
 		})
 		return
 	}
 
+	if err := h.Service.UpdateMemberRole(teamID, memberID, userID, req.Role, audit.MetaFromRequest(r)); err != nil {
+		writeTeamError(w, "update_role_failed", err)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Has salido del equipo exitosamente",
+		"message": "Rol actualizado exitosamente",
+	})
+}
+
+// POST /teams/{id}/transfer - Transferir el team a otro miembro (solo el dueño)
+func (h *TeamHandler) TransferOwnership(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	teamID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	var req struct {
+		UserID int `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{
+			Error:   "invalid_request",
+			Message: "Formato de solicitud inválido",
+		})
+		return
+	}
+
+	if err := h.Service.TransferOwnership(teamID, req.UserID, userID, audit.MetaFromRequest(r)); err != nil {
+		writeTeamError(w, "transfer_failed", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Propiedad del equipo transferida exitosamente",
+	})
+}
+
+// DELETE /teams/{id} - Borrar el team (solo el dueño, con período de gracia)
+func (h *TeamHandler) DeleteTeam(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	teamID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	team, err := h.Service.DeleteTeam(teamID, userID, audit.MetaFromRequest(r))
+	if err != nil {
+		writeTeamError(w, "delete_failed", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Equipo borrado; se puede restaurar hasta purge_at",
+		"team":    team,
+	})
+}
+
+// POST /teams/{id}/restore - Restaurar un team borrado (solo el dueño)
+func (h *TeamHandler) RestoreTeam(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	teamID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	team, err := h.Service.RestoreTeam(teamID, userID, audit.MetaFromRequest(r))
+	if err != nil {
+		writeTeamError(w, "restore_failed", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Equipo restaurado exitosamente",
+		"team":    team,
+	})
+}
+
+// GET /teams/deleted - Teams borrados del usuario que todavía se pueden restaurar
+func (h *TeamHandler) GetDeletedTeams(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	teams, err := h.Service.GetDeletedTeams(userID)
+	if err != nil {
+		writeTeamError(w, "fetch_failed", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(teams)
+}
+
+// GET /teams/{id}/audit - Registro de auditoría del team, del más nuevo al más viejo
+// Filtros: action (separadas por coma), actor_id, target_type, target_id, since y until (RFC 3339)
+func (h *TeamHandler) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	teamID, _ := strconv.Atoi(mux.Vars(r)["id"])
+	params := r.URL.Query()
+
+	q := audit.Query{TargetType: params.Get("target_type"), Cursor: params.Get("cursor")}
+	if actions := params.Get("action"); actions != "" {
+		q.Actions = strings.Split(actions, ",")
+	}
+	for name, dest := range map[string]*int{"actor_id": &q.ActorID, "target_id": &q.TargetID, "limit": &q.Limit} {
+		if raw := params.Get(name); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 0 {
+				writeTeamError(w, "invalid_request", fmt.Errorf("%w: %s", ErrInvalidAuditFilter, name))
+				return
+			}
+			*dest = n
+		}
+	}
+	for name, dest := range map[string]**time.Time{"since": &q.Since, "until": &q.Until} {
+		if raw := params.Get(name); raw != "" {
+			t, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				writeTeamError(w, "invalid_request", fmt.Errorf("%w: %s", ErrInvalidAuditFilter, name))
+				return
+			}
+			*dest = &t
+		}
+	}
+
+	page, err := h.Service.GetAuditLog(teamID, userID, q)
+	if err != nil {
+		writeTeamError(w, "fetch_failed", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// Responde el error del servicio con el status que corresponde
+func writeTeamError(w http.ResponseWriter, code string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrInvalidRole), errors.Is(err, ErrInvalidMaxUses),
+		errors.Is(err, ErrInvalidInviteTTL), errors.Is(err, ErrInvalidEmail), errors.Is(err, ErrBotOwner),
+		errors.Is(err, ErrInvalidAuditFilter), errors.Is(err, audit.ErrInvalidCursor), errors.Is(err, ErrInvalidVisibility), errors.Is(err, ErrInvalidTeamName),
+		errors.Is(err, ErrInvalidCursor), errors.Is(err, ErrQueryTooLong), errors.Is(err, ErrJoinMessageTooLong):
+		status = http.StatusBadRequest
+	case errors.Is(err, ErrNotTeamAdmin), errors.Is(err, ErrNotTeamOwner), errors.Is(err, ErrMissingPermission),
+		errors.Is(err, ErrInviteWrongEmail), errors.Is(err, auth.ErrMFARequired), errors.Is(err, auth.ErrEmailNotVerified):
+		status = http.StatusForbidden
+	case errors.Is(err, ErrInviteNotFound), errors.Is(err, ErrNotMember), errors.Is(err, ErrTeamNotRestorable),
+		errors.Is(err, ErrTeamNotJoinable), errors.Is(err, ErrJoinRequestNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrInvitePending), errors.Is(err, ErrEmailAlreadyMember), errors.Is(err, ErrAlreadyMember),
+		errors.Is(err, ErrOwnerRole), errors.Is(err, ErrOwnerCannotLeave), errors.Is(err, ErrLastAdmin),
+		errors.Is(err, ErrAlreadyOwner), errors.Is(err, ErrJoinRequestPending):
+		status = http.StatusConflict
+	case errors.Is(err, ErrInviteExpired):
+		status = http.StatusGone
+	}
+
+	message := err.Error()
+	if status == http.StatusInternalServerError {
+		message = "Error al procesar la solicitud"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Error:   code,
+		Message: message,
+	})
+}
+
+// POST /teams/{id}/invites - Crear una invitación (link o por email)
+func (h *TeamHandler) CreateInvite(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	teamID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	var req InviteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{
+			Error:   "invalid_request",
+			Message: "Formato de solicitud inválido",
+		})
+		return
+	}
+
+	invite, err := h.Service.CreateInvite(teamID, userID, req, audit.MetaFromRequest(r))
+	if err != nil {
+		writeTeamError(w, "invite_failed", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(invite)
+}
+
+// GET /teams/{id}/invites - Invitaciones vigentes del team (requiere invite_members)
+func (h *TeamHandler) GetInvites(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	teamID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	invites, err := h.Service.GetInvites(teamID, userID)
+	if err != nil {
+		writeTeamError(w, "fetch_failed", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(invites)
+}
+
+// DELETE /teams/{id}/invites/{invite_id} - Revocar una invitación
+func (h *TeamHandler) RevokeInvite(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	vars := mux.Vars(r)
+	teamID, _ := strconv.Atoi(vars["id"])
+	inviteID, _ := strconv.Atoi(vars["invite_id"])
+
+	if err := h.Service.RevokeInvite(teamID, inviteID, userID, audit.MetaFromRequest(r)); err != nil {
+		writeTeamError(w, "revoke_failed", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Invitación revocada exitosamente",
+	})
+}
+
+// GET /invites/{code} - Ver a qué team lleva una invitación
+func (h *TeamHandler) PreviewInvite(w http.ResponseWriter, r *http.Request) {
+	preview, err := h.Service.PreviewInvite(mux.Vars(r)["code"])
+	if err != nil {
+		writeTeamError(w, "invite_not_found", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(preview)
+}
+
+// POST /invites/{code}/accept - Aceptar una invitación y entrar al team
+func (h *TeamHandler) AcceptInvite(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	invite, err := h.Service.AcceptInvite(mux.Vars(r)["code"], userID, audit.MetaFromRequest(r))
+	if err != nil {
+		writeTeamError(w, "accept_failed", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Te uniste al equipo exitosamente",
+		"team_id": invite.TeamID,
+		"role":    invite.Role,
+	})
+}
+
+// GET /teams/directory?q=&limit=&cursor= - Directorio de teams discoverable y open
+func (h *TeamHandler) GetDirectory(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	params := r.URL.Query()
+
+	q := DirectoryQuery{Query: params.Get("q"), Cursor: params.Get("cursor")}
+	if raw := params.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResponse{
+				Error:   "invalid_request",
+				Message: "limit inválido",
+			})
+			return
+		}
+		q.Limit = n
+	}
+
+	page, err := h.Service.Directory(userID, q)
+	if err != nil {
+		writeTeamError(w, "fetch_failed", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// POST /teams/{id}/join - Entrar a un team open o pedir unirse a uno discoverable
+func (h *TeamHandler) JoinTeam(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	teamID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	// El cuerpo es opcional: solo lleva el mensaje para los admins
+	var req struct {
+		Message string `json:"message"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResponse{
+				Error:   "invalid_request",
+				Message: "Formato de solicitud inválido",
+			})
+			return
+		}
+	}
+
+	joined, request, err := h.Service.JoinTeam(teamID, userID, req.Message, audit.MetaFromRequest(r))
+	if err != nil {
+		writeTeamError(w, "join_failed", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if joined {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Te uniste al equipo exitosamente",
+			"team_id": teamID,
+			"role":    "member",
+		})
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Solicitud enviada; un admin del equipo tiene que aprobarla",
+		"request": request,
+	})
+}
+
+// DELETE /teams/{id}/join - Cancelar mi solicitud pendiente
+func (h *TeamHandler) CancelJoinRequest(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	teamID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := h.Service.CancelJoinRequest(teamID, userID); err != nil {
+		writeTeamError(w, "cancel_failed", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Solicitud cancelada exitosamente",
+	})
+}
+
+// GET /teams/{id}/join-requests - Solicitudes pendientes (requiere manage_members)
+func (h *TeamHandler) GetJoinRequests(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	teamID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	requests, err := h.Service.GetJoinRequests(teamID, userID)
+	if err != nil {
+		writeTeamError(w, "fetch_failed", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(requests)
+}
+
+// POST /teams/{id}/join-requests/{request_id}/approve - Aprobar una solicitud
+func (h *TeamHandler) ApproveJoinRequest(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	vars := mux.Vars(r)
+	teamID, _ := strconv.Atoi(vars["id"])
+	requestID, _ := strconv.Atoi(vars["request_id"])
+
+	request, err := h.Service.ApproveJoinRequest(teamID, requestID, userID, audit.MetaFromRequest(r))
+	if err != nil {
+		writeTeamError(w, "approve_failed", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Solicitud aprobada exitosamente",
+		"request": request,
+	})
+}
+
+// POST /teams/{id}/join-requests/{request_id}/reject - Rechazar una solicitud
+func (h *TeamHandler) RejectJoinRequest(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	vars := mux.Vars(r)
+	teamID, _ := strconv.Atoi(vars["id"])
+	requestID, _ := strconv.Atoi(vars["request_id"])
+
+	request, err := h.Service.RejectJoinRequest(teamID, requestID, userID, audit.MetaFromRequest(r))
+	if err != nil {
+		writeTeamError(w, "reject_failed", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Solicitud rechazada",
+		"request": request,
 	})
 }
@@ -0,0 +1,231 @@
+package teams
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"strings"
+	"time"
+
+	"toller-server/modules/audit"
+	"toller-server/modules/permissions"
+	"toller-server/pkg/mailer"
+)
+
+const (
+	defaultInviteTTL = 7 * 24 * time.Hour
+	maxInviteTTL     = 30 * 24 * time.Hour
+	maxInviteUses    = 1000
+	inviteCodeBytes  = 12 // 16 caracteres en base64url
+)
+
+var (
+	ErrInvalidMaxUses     = errors.New("max_uses debe estar entre 0 (sin límite) y 1000")
+	ErrInvalidInviteTTL   = errors.New("la invitación puede durar como máximo 720 horas")
+	ErrInvalidEmail       = errors.New("email inválido")
+	ErrEmailAlreadyMember = errors.New("ese email ya pertenece a un miembro del equipo")
+	ErrInvitePending      = errors.New("ya hay una invitación pendiente para ese email")
+	ErrInviteNotFound     = errors.New("la invitación no existe o fue revocada")
+	ErrInviteExpired      = errors.New("la invitación venció o ya no tiene usos disponibles")
+	ErrInviteWrongEmail   = errors.New("esta invitación es para otra dirección de email")
+	ErrAlreadyMember      = errors.New("ya eres miembro de este equipo")
+)
+
+// Datos para crear una invitación. Con Email es personal (un solo uso); sin
+// Email es un link que puede usar cualquiera hasta MaxUses veces
+type InviteRequest struct {
+	Email          string `json:"email"`
+	Role           string `json:"role"`             // member por defecto
+	MaxUses        int    `json:"max_uses"`         // 0 = sin límite
+	ExpiresInHours int    `json:"expires_in_hours"` // 168 (7 días) por defecto
+}
+
+// Crear una invitación (requiere invite_members). Las invitaciones por email se mandan por correo
+func (s *TeamService) CreateInvite(teamID, requestingUserID int, req InviteRequest, meta audit.Meta) (*TeamInvite, error) {
+	if err := s.authorize(teamID, requestingUserID, permissions.InviteMembers); err != nil {
+		return nil, err
+	}
+
+	if req.Role == "" {
+		req.Role = "member"
+	}
+	if req.Role != "admin" && req.Role != "member" {
+		return nil, ErrInvalidRole
+	}
+	// Invitar como admin es dar todos los permisos: solo lo puede hacer otro admin
+	if req.Role == "admin" {
+		if err := s.ensureAdmin(teamID, requestingUserID); err != nil {
+			return nil, err
+		}
+	}
+	if req.MaxUses < 0 || req.MaxUses > maxInviteUses {
+		return nil, ErrInvalidMaxUses
+	}
+	ttl := defaultInviteTTL
+	if req.ExpiresInHours != 0 {
+		ttl = time.Duration(req.ExpiresInHours) * time.Hour
+		if ttl < 0 || ttl > maxInviteTTL {
+			return nil, ErrInvalidInviteTTL
+		}
+	}
+
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if email != "" {
+		if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+			return nil, ErrInvalidEmail
+		}
+		isMember, err := s.Repo.IsEmailInTeam(teamID, email)
+		if err != nil {
+			return nil, err
+		}
+		if isMember {
+			return nil, ErrEmailAlreadyMember
+		}
+		pending, err := s.Repo.HasPendingEmailInvite(teamID, email)
+		if err != nil {
+			return nil, err
+		}
+		if pending {
+			return nil, ErrInvitePending
+		}
+		req.MaxUses = 1
+	}
+
+	code, err := generateInviteCode()
+	if err != nil {
+		return nil, err
+	}
+	invite := &TeamInvite{
+		TeamID:    teamID,
+		Code:      code,
+		Email:     email,
+		Role:      req.Role,
+		MaxUses:   req.MaxUses,
+		CreatedBy: &requestingUserID,
+	}
+	if err := s.Repo.CreateInvite(invite, ttl); err != nil {
+		return nil, err
+	}
+	// El código no se registra: con él cualquiera podría entrar al team
+	s.record(audit.Entry{
+		TeamID: teamID, ActorID: requestingUserID, Action: audit.InviteCreate, TargetType: audit.TargetInvite, TargetID: invite.ID,
+		Changes: audit.Diff(nil, map[string]interface{}{
+			"email": email, "role": invite.Role, "max_uses": invite.MaxUses, "expires_at": invite.ExpiresAt,
+		}),
+		Meta: meta,
+	})
+
+	// Un fallo del mailer no invalida la invitación: el admin puede compartir el código
+	if email != "" {
+		if err := s.sendInvite(invite); err != nil {
+			log.Printf("[TEAMS] No se pudo enviar la invitación %d a %s: %v", invite.ID, email, err)
+		}
+	}
+	return invite, nil
+}
+
+// Obtener las invitaciones vigentes del team (requiere invite_members)
+func (s *TeamService) GetInvites(teamID, requestingUserID int) ([]TeamInvite, error) {
+	if err := s.authorize(teamID, requestingUserID, permissions.InviteMembers); err != nil {
+		return nil, err
+	}
+	return s.Repo.GetActiveInvites(teamID)
+}
+
+// Revocar una invitación (requiere invite_members)
+func (s *TeamService) RevokeInvite(teamID, inviteID, requestingUserID int, meta audit.Meta) error {
+	if err := s.authorize(teamID, requestingUserID, permissions.InviteMembers); err != nil {
+		return err
+	}
+	revoked, err := s.Repo.RevokeInvite(teamID, inviteID)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return ErrInviteNotFound
+	}
+	s.record(audit.Entry{
+		TeamID: teamID, ActorID: requestingUserID, Action: audit.InviteRevoke, TargetType: audit.TargetInvite, TargetID: inviteID,
+		Meta: meta,
+	})
+	return nil
+}
+
+// Ver a qué team lleva una invitación antes de aceptarla
+func (s *TeamService) PreviewInvite(code string) (*InvitePreview, error) {
+	return s.Repo.GetInvitePreview(code)
+}
+
+// Aceptar una invitación y entrar al team con su rol. Las invitaciones por email
+// solo las puede aceptar esa cuenta, y siempre con el email verificado
+func (s *TeamService) AcceptInvite(code string, userID int, meta audit.Meta) (*TeamInvite, error) {
+	preview, err := s.Repo.GetInvitePreview(code)
+	if err != nil && !errors.Is(err, ErrInviteNotFound) {
+		return nil, err
+	}
+	if preview != nil && preview.ForEmail && s.Accounts != nil {
+		if err := s.Accounts.EnsureEmailVerified(userID); err != nil {
+			return nil, err
+		}
+	}
+	invite, err := s.Repo.AcceptInvite(code, userID)
+	if err != nil {
+		return nil, err
+	}
+	s.afterInviteJoin(invite, userID, meta)
+	return invite, nil
+}
+
+// ClaimEmailInvites suma a una cuenta a los teams que invitaron a su email.
+// La llama el módulo de auth cuando el email queda verificado (al verificarlo o
+// al crear la cuenta con un email ya verificado por el proveedor)
+func (s *TeamService) ClaimEmailInvites(userID int, email string) error {
+	invites, err := s.Repo.ClaimEmailInvites(userID, email)
+	if err != nil {
+		return err
+	}
+	for i := range invites {
+		log.Printf("[TEAMS] Usuario %d se unió al equipo %d por la invitación %d", userID, invites[i].TeamID, invites[i].ID)
+		s.afterInviteJoin(&invites[i], userID, audit.Meta{})
+	}
+	return nil
+}
+
+// Completa la entrada por invitación: canales por defecto y registro de auditoría
+func (s *TeamService) afterInviteJoin(invite *TeamInvite, userID int, meta audit.Meta) {
+	s.joinDefaultChannels(invite.TeamID, userID)
+	s.record(audit.Entry{
+		TeamID: invite.TeamID, ActorID: userID, Action: audit.MemberJoin, TargetType: audit.TargetUser, TargetID: userID,
+		Changes: audit.Diff(nil, map[string]interface{}{"role": invite.Role, "invite_id": invite.ID}), Meta: meta,
+	})
+}
+
+func (s *TeamService) sendInvite(invite *TeamInvite) error {
+	if s.Mailer == nil {
+		return nil
+	}
+	team, err := s.Repo.GetTeamByID(invite.TeamID)
+	if err != nil {
+		return err
+	}
+	return s.Mailer.Send(mailer.Message{
+		To:      invite.Email,
+		Subject: fmt.Sprintf("Te invitaron a %s en Toller", team.Name),
+		Body: fmt.Sprintf("Hola,\n\nTe invitaron a unirte al equipo %s en Toller.\n\n"+
+			"Si ya tienes cuenta, entra a:\n%s/invite?code=%s\n\n"+
+			"Si no, regístrate con este email: en cuanto lo verifiques entrarás al equipo automáticamente.\n\n"+
+			"La invitación vence el %s.\n",
+			team.Name, strings.TrimRight(s.AppURL, "/"), invite.Code, invite.ExpiresAt.Format("02/01/2006")),
+	})
+}
+
+func generateInviteCode() (string, error) {
+	b := make([]byte, inviteCodeBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
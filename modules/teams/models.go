@@ -1,12 +1,20 @@
 package teams
 
-import "time"
+import (
+	"time"
+
+	"toller-server/modules/users"
+)
 
 type Team struct {
-	ID          int       `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description,omitempty"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID          int        `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	OwnerID     *int       `json:"owner_id"`
+	Visibility  string     `json:"visibility"` // private, discoverable u open
+	CreatedAt   time.Time  `json:"created_at"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+	PurgeAt     *time.Time `json:"purge_at,omitempty"` // hasta cuándo se puede restaurar
 }
 
 type UserTeam struct {
@@ -20,6 +28,8 @@ type TeamWithRole struct {
 	ID          int       `json:"id"`
 	Name        string    `json:"name"`
 	Description string    `json:"description,omitempty"`
+	OwnerID     *int      `json:"owner_id"`
+	Visibility  string    `json:"visibility"`
 	CreatedAt   time.Time `json:"created_at"`
 	UserRole    string    `json:"user_role"` // rol del usuario actual
 }
@@ -27,6 +37,81 @@ type TeamWithRole struct {
 type TeamMember struct {
 	UserID   int    `json:"user_id"`
 	Username string `json:"username"`
-	Email    string `json:"email"`
+	Email    string `json:"email,omitempty"` // solo para admins del team y usuarios relacionados
 	Role     string `json:"role"`
+	IsOwner  bool   `json:"is_owner"`
+	IsBot    bool   `json:"is_bot"`
+	users.Profile
+}
+
+// Bloqueo de login de un miembro, visible para los admins del team
+type MemberLockout struct {
+	ID             int       `json:"id"`
+	UserID         int       `json:"user_id"`
+	Username       string    `json:"username"`
+	IPAddress      string    `json:"ip_address,omitempty"`
+	FailedAttempts int       `json:"failed_attempts"`
+	LockedUntil    time.Time `json:"locked_until"`
+	Active         bool      `json:"active"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// Invitación a un team: un link compartible o dirigida a un email
+type TeamInvite struct {
+	ID        int        `json:"id"`
+	TeamID    int        `json:"team_id"`
+	Code      string     `json:"code"`
+	Email     string     `json:"email,omitempty"` // vacío en los links compartibles
+	Role      string     `json:"role"`
+	MaxUses   int        `json:"max_uses"` // 0 = sin límite
+	Uses      int        `json:"uses"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	CreatedBy *int       `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Lo que ve quien recibe el link antes de aceptarlo
+type InvitePreview struct {
+	TeamID    int        `json:"team_id"`
+	TeamName  string     `json:"team_name"`
+	Role      string     `json:"role"`
+	ForEmail  bool       `json:"for_email"` // solo la puede aceptar el dueño del email invitado
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// Un team del directorio, visto por quien lo busca
+type DirectoryTeam struct {
+	ID            int    `json:"id"`
+	Name          string `json:"name"`
+	Description   string `json:"description,omitempty"`
+	Visibility    string `json:"visibility"` // discoverable u open
+	MemberCount   int    `json:"member_count"`
+	IsMember      bool   `json:"is_member"`
+	RequestedJoin bool   `json:"requested_join"` // tiene una solicitud pendiente
+}
+
+// Filtros de una página del directorio de teams
+type DirectoryQuery struct {
+	Query  string
+	Limit  int
+	Cursor string
+}
+
+// Una página del directorio; NextCursor queda vacío en la última
+type DirectoryPage struct {
+	Teams      []DirectoryTeam `json:"teams"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// Solicitud para unirse a un team discoverable
+type JoinRequest struct {
+	ID         int                `json:"id"`
+	TeamID     int                `json:"team_id"`
+	UserID     int                `json:"user_id"`
+	User       *users.UserSummary `json:"user,omitempty"`
+	Message    string             `json:"message,omitempty"`
+	Status     string             `json:"status"` // pending, approved, rejected o cancelled
+	ReviewedBy *int               `json:"reviewed_by,omitempty"`
+	ReviewedAt *time.Time         `json:"reviewed_at,omitempty"`
+	CreatedAt  time.Time          `json:"created_at"`
 }
@@ -3,6 +3,11 @@ package teams
 import (
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"toller-server/modules/users"
 )
 
 type TeamRepository struct {
@@ -12,11 +17,11 @@ type TeamRepository struct {
 // Crear un team
 func (r *TeamRepository) CreateTeam(team *Team) error {
 	query := `
-		INSERT INTO teams (name, description)
-		VALUES ($1, $2)
+		INSERT INTO teams (name, description, owner_id, visibility)
+		VALUES ($1, $2, $3, $4)
 		RETURNING id, created_at
 	`
-	return r.DB.QueryRow(query, team.Name, team.Description).
+	return r.DB.QueryRow(query, team.Name, team.Description, team.OwnerID, team.Visibility).
 		Scan(&team.ID, &team.CreatedAt)
 }
 
@@ -33,10 +38,10 @@ func (r *TeamRepository) AddUserToTeam(userID, teamID int, role string) error {
 // Obtener teams de un usuario
 func (r *TeamRepository) GetUserTeams(userID int) ([]TeamWithRole, error) {
 	query := `
-		SELECT t.id, t.name, t.description, t.created_at, ut.role
+		SELECT t.id, t.name, t.description, t.owner_id, t.visibility, t.created_at, ut.role
 		FROM teams t
 		INNER JOIN user_teams ut ON t.id = ut.team_id
-		WHERE ut.user_id = $1
+		WHERE ut.user_id = $1 AND t.deleted_at IS NULL
 		ORDER BY t.created_at DESC
 	`
 	rows, err := r.DB.Query(query, userID)
@@ -49,7 +54,7 @@ func (r *TeamRepository) GetUserTeams(userID int) ([]TeamWithRole, error) {
 	for rows.Next() {
 		var t TeamWithRole
 		var desc sql.NullString
-		err := rows.Scan(&t.ID, &t.Name, &desc, &t.CreatedAt, &t.UserRole)
+		err := rows.Scan(&t.ID, &t.Name, &desc, &t.OwnerID, &t.Visibility, &t.CreatedAt, &t.UserRole)
 		if err != nil {
 			return nil, err
 		}
@@ -61,17 +66,17 @@ func (r *TeamRepository) GetUserTeams(userID int) ([]TeamWithRole, error) {
 	return teams, nil
 }
 
-// Obtener un team por ID
+// Obtener un team por ID (los borrados no se ven)
 func (r *TeamRepository) GetTeamByID(teamID int) (*Team, error) {
 	team := &Team{}
 	var desc sql.NullString
 	query := `
-		SELECT id, name, description, created_at
+		SELECT id, name, description, owner_id, visibility, created_at
 		FROM teams
-		WHERE id = $1
+		WHERE id = $1 AND deleted_at IS NULL
 	`
 	err := r.DB.QueryRow(query, teamID).Scan(
-		&team.ID, &team.Name, &desc, &team.CreatedAt,
+		&team.ID, &team.Name, &desc, &team.OwnerID, &team.Visibility, &team.CreatedAt,
 	)
 	if err == sql.ErrNoRows {
 		return nil, errors.New("equipo no encontrado")
@@ -82,12 +87,13 @@ func (r *TeamRepository) GetTeamByID(teamID int) (*Team, error) {
 	return team, err
 }
 
-// Verificar si un usuario es miembro del team
+// Verificar si un usuario es miembro del team (un team borrado no tiene miembros)
 func (r *TeamRepository) IsUserInTeam(userID, teamID int) (bool, string, error) {
 	var role string
 	query := `
-		SELECT role FROM user_teams
-		WHERE user_id = $1 AND team_id = $2
+		SELECT ut.role FROM user_teams ut
+		INNER JOIN teams t ON t.id = ut.team_id
+		WHERE ut.user_id = $1 AND ut.team_id = $2 AND t.deleted_at IS NULL
 	`
 	err := r.DB.QueryRow(query, userID, teamID).Scan(&role)
 	if err == sql.ErrNoRows {
@@ -99,16 +105,20 @@ func (r *TeamRepository) IsUserInTeam(userID, teamID int) (bool, string, error)
 	return true, role, nil
 }
 
-// Obtener miembros de un team
-func (r *TeamRepository) GetTeamMembers(teamID int) ([]TeamMember, error) {
+// Obtener miembros de un team tal como los ve viewerID: con email si allEmails
+// (admins del team) o si está relacionado con el miembro (ver users.Related)
+func (r *TeamRepository) GetTeamMembers(teamID, viewerID int, allEmails bool) ([]TeamMember, error) {
 	query := `
-		SELECT u.id, u.username, u.email, ut.role
+		SELECT u.id, u.username,
+		       CASE WHEN NOT u.is_bot AND ($3 OR ` + users.Related("$2", "u") + `) THEN u.email ELSE '' END,
+		       ut.role, COALESCE(u.id = t.owner_id, FALSE), u.is_bot, ` + users.ProfileColumns("u") + `
 		FROM users u
 		INNER JOIN user_teams ut ON u.id = ut.user_id
+		INNER JOIN teams t ON t.id = ut.team_id
 		WHERE ut.team_id = $1
 		ORDER BY ut.role DESC, u.username ASC
 	`
-	rows, err := r.DB.Query(query, teamID)
+	rows, err := r.DB.Query(query, teamID, viewerID, allEmails)
 	if err != nil {
 		return nil, err
 	}
@@ -117,7 +127,8 @@ func (r *TeamRepository) GetTeamMembers(teamID int) ([]TeamMember, error) {
 	var members []TeamMember
 	for rows.Next() {
 		var m TeamMember
-		err := rows.Scan(&m.UserID, &m.Username, &m.Email, &m.Role)
+		dest := append([]interface{}{&m.UserID, &m.Username, &m.Email, &m.Role, &m.IsOwner, &m.IsBot}, m.Profile.ScanDest()...)
+		err := rows.Scan(dest...)
 		if err != nil {
 			return nil, err
 		}
@@ -126,6 +137,37 @@ func (r *TeamRepository) GetTeamMembers(teamID int) ([]TeamMember, error) {
 	return members, nil
 }
 
+// Obtener los bloqueos de login de los miembros del team (los más recientes primero)
+func (r *TeamRepository) GetMemberLockouts(teamID int) ([]MemberLockout, error) {
+	query := `
+		SELECT l.id, u.id, u.username, COALESCE(l.ip_address, ''), l.failed_attempts,
+		       l.locked_until, l.locked_until > NOW(), l.created_at
+		FROM account_lockouts l
+		INNER JOIN users u ON u.id = l.user_id
+		INNER JOIN user_teams ut ON ut.user_id = u.id
+		INNER JOIN teams t ON t.id = ut.team_id
+		WHERE ut.team_id = $1 AND t.deleted_at IS NULL
+		ORDER BY l.created_at DESC
+		LIMIT 100
+	`
+	rows, err := r.DB.Query(query, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lockouts := []MemberLockout{}
+	for rows.Next() {
+		var l MemberLockout
+		err := rows.Scan(&l.ID, &l.UserID, &l.Username, &l.IPAddress, &l.FailedAttempts, &l.LockedUntil, &l.Active, &l.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		lockouts = append(lockouts, l)
+	}
+	return lockouts, rows.Err()
+}
+
 // Remover usuario de un team
 func (r *TeamRepository) RemoveUserFromTeam(userID, teamID int) error {
 	query := `DELETE FROM user_teams WHERE user_id = $1 AND team_id = $2`
@@ -148,10 +190,10 @@ func (r *TeamRepository) UpdateUserRole(userID, teamID int, role string) error {
 func (r *TeamRepository) UpdateTeam(team *Team) error {
 	query := `
 		UPDATE teams
-		SET name = $1, description = $2
-		WHERE id = $3
+		SET name = $1, description = $2, visibility = $3
+		WHERE id = $4
 	`
-	_, err := r.DB.Exec(query, team.Name, team.Description, team.ID)
+	_, err := r.DB.Exec(query, team.Name, team.Description, team.Visibility, team.ID)
 	return err
 }
 
@@ -161,3 +203,512 @@ func (r *TeamRepository) DeleteTeam(teamID int) error {
 	_, err := r.DB.Exec(query, teamID)
 	return err
 }
+
+// Contar los admins del team
+func (r *TeamRepository) CountAdmins(teamID int) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM user_teams WHERE team_id = $1 AND role = 'admin'`
+	err := r.DB.QueryRow(query, teamID).Scan(&count)
+	return count, err
+}
+
+// Contar los miembros del team
+func (r *TeamRepository) CountMembers(teamID int) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM user_teams WHERE team_id = $1`
+	err := r.DB.QueryRow(query, teamID).Scan(&count)
+	return count, err
+}
+
+// Verificar si el usuario es una cuenta de bot
+func (r *TeamRepository) IsBot(userID int) (bool, error) {
+	var isBot bool
+	err := r.DB.QueryRow(`SELECT is_bot FROM users WHERE id = $1`, userID).Scan(&isBot)
+	return isBot, err
+}
+
+// Pasar el team a otro miembro, que además queda como admin
+func (r *TeamRepository) TransferOwnership(teamID, newOwnerID int) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE user_teams SET role = 'admin' WHERE user_id = $1 AND team_id = $2`, newOwnerID, teamID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE teams SET owner_id = $1 WHERE id = $2`, newOwnerID, teamID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Marcar el team como borrado; se purga definitivamente después de grace
+func (r *TeamRepository) SoftDeleteTeam(teamID int, grace time.Duration) (time.Time, error) {
+	var purgeAt time.Time
+	query := `
+		UPDATE teams
+		SET deleted_at = NOW(), purge_at = NOW() + make_interval(secs => $2)
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING purge_at
+	`
+	err := r.DB.QueryRow(query, teamID, int64(grace/time.Second)).Scan(&purgeAt)
+	return purgeAt, err
+}
+
+// Restaurar un team borrado del dueño, si todavía no se purgó; false si no había
+func (r *TeamRepository) RestoreTeam(teamID, ownerID int) (bool, error) {
+	query := `
+		UPDATE teams SET deleted_at = NULL, purge_at = NULL
+		WHERE id = $1 AND owner_id = $2 AND deleted_at IS NOT NULL AND purge_at > NOW()
+	`
+	res, err := r.DB.Exec(query, teamID, ownerID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Obtener los teams borrados del dueño que todavía se pueden restaurar
+func (r *TeamRepository) GetDeletedTeams(ownerID int) ([]Team, error) {
+	query := `
+		SELECT id, name, COALESCE(description, ''), owner_id, visibility, created_at, deleted_at, purge_at
+		FROM teams
+		WHERE owner_id = $1 AND deleted_at IS NOT NULL AND purge_at > NOW()
+		ORDER BY purge_at
+	`
+	rows, err := r.DB.Query(query, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	teams := []Team{}
+	for rows.Next() {
+		var t Team
+		if err := rows.Scan(&t.ID, &t.Name, &t.Description, &t.OwnerID, &t.Visibility, &t.CreatedAt, &t.DeletedAt, &t.PurgeAt); err != nil {
+			return nil, err
+		}
+		teams = append(teams, t)
+	}
+	return teams, rows.Err()
+}
+
+// Purgar los teams cuyo período de gracia venció (cascadea a canales, mensajes y membresías)
+func (r *TeamRepository) PurgeDeletedTeams() (int64, error) {
+	res, err := r.DB.Exec(`DELETE FROM teams WHERE purge_at <= NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+const inviteColumns = `id, team_id, code, COALESCE(email, ''), role, max_uses, uses, expires_at, created_by, created_at`
+
+// Invitación no revocada, sin vencer y con usos disponibles
+const activeInvite = `revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW()) AND (max_uses = 0 OR uses < max_uses)`
+
+func scanInvite(row interface{ Scan(...interface{}) error }) (*TeamInvite, error) {
+	var inv TeamInvite
+	err := row.Scan(&inv.ID, &inv.TeamID, &inv.Code, &inv.Email, &inv.Role, &inv.MaxUses, &inv.Uses, &inv.ExpiresAt, &inv.CreatedBy, &inv.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// Crear una invitación que vence en ttl
+func (r *TeamRepository) CreateInvite(inv *TeamInvite, ttl time.Duration) error {
+	query := `
+		INSERT INTO team_invites (team_id, code, email, role, max_uses, expires_at, created_by)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, NOW() + make_interval(secs => $6), $7)
+		RETURNING id, uses, expires_at, created_at
+	`
+	return r.DB.QueryRow(query, inv.TeamID, inv.Code, inv.Email, inv.Role, inv.MaxUses, int64(ttl/time.Second), inv.CreatedBy).
+		Scan(&inv.ID, &inv.Uses, &inv.ExpiresAt, &inv.CreatedAt)
+}
+
+// Verificar si hay una invitación vigente para el email en el team
+func (r *TeamRepository) HasPendingEmailInvite(teamID int, email string) (bool, error) {
+	var exists bool
+	query := `SELECT EXISTS(SELECT 1 FROM team_invites WHERE team_id = $1 AND email = $2 AND ` + activeInvite + `)`
+	err := r.DB.QueryRow(query, teamID, email).Scan(&exists)
+	return exists, err
+}
+
+// Verificar si la cuenta con ese email ya es miembro del team
+func (r *TeamRepository) IsEmailInTeam(teamID int, email string) (bool, error) {
+	var exists bool
+	query := `
+		SELECT EXISTS(
+			SELECT 1 FROM user_teams ut
+			INNER JOIN users u ON u.id = ut.user_id
+			INNER JOIN teams t ON t.id = ut.team_id
+			WHERE ut.team_id = $1 AND LOWER(u.email) = $2 AND t.deleted_at IS NULL
+		)
+	`
+	err := r.DB.QueryRow(query, teamID, email).Scan(&exists)
+	return exists, err
+}
+
+// Obtener las invitaciones vigentes del team (las más recientes primero)
+func (r *TeamRepository) GetActiveInvites(teamID int) ([]TeamInvite, error) {
+	query := `SELECT ` + inviteColumns + ` FROM team_invites WHERE team_id = $1 AND ` + activeInvite + ` ORDER BY id DESC`
+	rows, err := r.DB.Query(query, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invites := []TeamInvite{}
+	for rows.Next() {
+		inv, err := scanInvite(rows)
+		if err != nil {
+			return nil, err
+		}
+		invites = append(invites, *inv)
+	}
+	return invites, rows.Err()
+}
+
+// Revocar una invitación del team; false si no existía o ya estaba revocada
+func (r *TeamRepository) RevokeInvite(teamID, inviteID int) (bool, error) {
+	query := `UPDATE team_invites SET revoked_at = NOW() WHERE id = $1 AND team_id = $2 AND revoked_at IS NULL`
+	res, err := r.DB.Exec(query, inviteID, teamID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Obtener una invitación vigente por código junto con el nombre del team
+func (r *TeamRepository) GetInvitePreview(code string) (*InvitePreview, error) {
+	p := &InvitePreview{}
+	query := `
+		SELECT t.id, t.name, i.role, i.email IS NOT NULL, i.expires_at
+		FROM team_invites i
+		INNER JOIN teams t ON t.id = i.team_id
+		WHERE i.code = $1 AND t.deleted_at IS NULL AND ` + activeInvite
+	err := r.DB.QueryRow(query, code).Scan(&p.TeamID, &p.TeamName, &p.Role, &p.ForEmail, &p.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrInviteNotFound
+	}
+	return p, err
+}
+
+// Aceptar una invitación: suma al usuario al team con el rol de la invitación y
+// consume un uso, todo en una transacción para no pasarse de max_uses
+func (r *TeamRepository) AcceptInvite(code string, userID int) (*TeamInvite, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var expired bool
+	inv := &TeamInvite{}
+	query := `
+		SELECT ` + inviteColumns + `,
+		       (expires_at IS NOT NULL AND expires_at <= NOW()) OR (max_uses > 0 AND uses >= max_uses)
+		FROM team_invites
+		WHERE code = $1 AND revoked_at IS NULL
+		  AND team_id IN (SELECT id FROM teams WHERE deleted_at IS NULL)
+		FOR UPDATE
+	`
+	err = tx.QueryRow(query, code).Scan(&inv.ID, &inv.TeamID, &inv.Code, &inv.Email, &inv.Role, &inv.MaxUses, &inv.Uses,
+		&inv.ExpiresAt, &inv.CreatedBy, &inv.CreatedAt, &expired)
+	if err == sql.ErrNoRows {
+		return nil, ErrInviteNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if expired {
+		return nil, ErrInviteExpired
+	}
+
+	if inv.Email != "" {
+		var email string
+		if err := tx.QueryRow(`SELECT LOWER(email) FROM users WHERE id = $1`, userID).Scan(&email); err != nil {
+			return nil, err
+		}
+		if email != inv.Email {
+			return nil, ErrInviteWrongEmail
+		}
+	}
+
+	res, err := tx.Exec(`INSERT INTO user_teams (user_id, team_id, role) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`,
+		userID, inv.TeamID, inv.Role)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrAlreadyMember
+	}
+	if _, err := tx.Exec(`UPDATE team_invites SET uses = uses + 1 WHERE id = $1`, inv.ID); err != nil {
+		return nil, err
+	}
+	inv.Uses++
+	return inv, tx.Commit()
+}
+
+// Reclamar las invitaciones vigentes dirigidas al email: el usuario entra a cada
+// team con el rol de la invitación. Devuelve solo las invitaciones usadas
+func (r *TeamRepository) ClaimEmailInvites(userID int, email string) ([]TeamInvite, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT ` + inviteColumns + ` FROM team_invites
+		WHERE email = LOWER($1) AND ` + activeInvite + `
+		  AND team_id IN (SELECT id FROM teams WHERE deleted_at IS NULL)
+		ORDER BY id
+		FOR UPDATE
+	`
+	rows, err := tx.Query(query, email)
+	if err != nil {
+		return nil, err
+	}
+	var invites []TeamInvite
+	for rows.Next() {
+		inv, err := scanInvite(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		invites = append(invites, *inv)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Si ya era miembro del team la invitación no se usa
+	var joined []TeamInvite
+	for _, inv := range invites {
+		res, err := tx.Exec(`INSERT INTO user_teams (user_id, team_id, role) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`,
+			userID, inv.TeamID, inv.Role)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue
+		}
+		if _, err := tx.Exec(`UPDATE team_invites SET uses = uses + 1 WHERE id = $1`, inv.ID); err != nil {
+			return nil, err
+		}
+		inv.Uses++
+		joined = append(joined, inv)
+	}
+	return joined, tx.Commit()
+}
+
+// Posición de un team en el orden del directorio, usada como cursor
+type directoryKey struct {
+	Rank  int     `json:"r"`
+	Score float64 `json:"s"`
+	Name  string  `json:"n"`
+	ID    int     `json:"i"`
+}
+
+// Directorio de teams visibles (discoverable u open), hasta limit+1. Con búsqueda
+// se ordena por relevancia: nombre exacto, prefijo, contiene y similitud; sin
+// búsqueda, alfabético. after es la clave de la última fila de la página anterior
+func (r *TeamRepository) Directory(viewerID int, q DirectoryQuery, after *directoryKey) ([]DirectoryTeam, []directoryKey, error) {
+	args := []interface{}{viewerID}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	rank, score := "0", "0::float8"
+	filters := []string{"t.visibility <> 'private'", "t.deleted_at IS NULL"}
+	if q.Query != "" {
+		term := strings.ToLower(q.Query)
+		exact, prefix, substring := arg(term), arg(escapeLike(term)+"%"), arg("%"+escapeLike(term)+"%")
+		rank = fmt.Sprintf(`CASE
+				WHEN LOWER(t.name) = %s THEN 0
+				WHEN LOWER(t.name) LIKE %s THEN 1
+				WHEN LOWER(t.name) LIKE %s THEN 2
+				ELSE 3
+			END`, exact, prefix, substring)
+		score = fmt.Sprintf("similarity(LOWER(t.name), %s)::float8", exact)
+		filters = append(filters, fmt.Sprintf("(LOWER(t.name) LIKE %s OR LOWER(t.name) %% %s)", substring, exact))
+	}
+	where := strings.Join(filters, " AND ")
+
+	page := "TRUE"
+	if after != nil {
+		// Orden: rank ASC, score DESC, nombre ASC, id ASC
+		page = fmt.Sprintf("(c.rank, -c.score, c.sort_name, c.id) > (%s, %s, %s, %s)",
+			arg(after.Rank), arg(-after.Score), arg(after.Name), arg(after.ID))
+	}
+
+	query := `
+		WITH c AS (
+			SELECT t.id, ` + rank + ` AS rank, ` + score + ` AS score, LOWER(t.name) AS sort_name
+			FROM teams t
+			WHERE ` + where + `
+		)
+		SELECT t.id, t.name, COALESCE(t.description, ''), t.visibility,
+		       (SELECT COUNT(*) FROM user_teams WHERE team_id = t.id),
+		       EXISTS(SELECT 1 FROM user_teams WHERE team_id = t.id AND user_id = $1),
+		       EXISTS(SELECT 1 FROM team_join_requests WHERE team_id = t.id AND user_id = $1 AND status = 'pending'),
+		       c.rank, c.score, c.sort_name
+		FROM c
+		JOIN teams t ON t.id = c.id
+		WHERE ` + page + `
+		ORDER BY c.rank, c.score DESC, c.sort_name, c.id
+		LIMIT ` + arg(q.Limit+1)
+
+	rows, err := r.DB.Query(query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	teams := []DirectoryTeam{}
+	var keys []directoryKey
+	for rows.Next() {
+		var t DirectoryTeam
+		var key directoryKey
+		err := rows.Scan(&t.ID, &t.Name, &t.Description, &t.Visibility, &t.MemberCount, &t.IsMember, &t.RequestedJoin,
+			&key.Rank, &key.Score, &key.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		key.ID = t.ID
+		teams = append(teams, t)
+		keys = append(keys, key)
+	}
+	return teams, keys, rows.Err()
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// Sumar al usuario como member; false si ya era miembro
+func (r *TeamRepository) JoinTeam(userID, teamID int) (bool, error) {
+	res, err := r.DB.Exec(`INSERT INTO user_teams (user_id, team_id, role) VALUES ($1, $2, 'member') ON CONFLICT DO NOTHING`,
+		userID, teamID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+const joinRequestColumns = `jr.id, jr.team_id, jr.user_id, COALESCE(jr.message, ''), jr.status, jr.reviewed_by, jr.reviewed_at, jr.created_at`
+
+func scanJoinRequest(row interface{ Scan(...interface{}) error }, extra ...interface{}) (*JoinRequest, error) {
+	var req JoinRequest
+	dest := append([]interface{}{&req.ID, &req.TeamID, &req.UserID, &req.Message, &req.Status, &req.ReviewedBy, &req.ReviewedAt, &req.CreatedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// Crear una solicitud pendiente; ErrJoinRequestPending si ya había una
+func (r *TeamRepository) CreateJoinRequest(req *JoinRequest) error {
+	query := `
+		INSERT INTO team_join_requests (team_id, user_id, message)
+		VALUES ($1, $2, NULLIF($3, ''))
+		ON CONFLICT (team_id, user_id) WHERE status = 'pending' DO NOTHING
+		RETURNING id, status, created_at
+	`
+	err := r.DB.QueryRow(query, req.TeamID, req.UserID, req.Message).Scan(&req.ID, &req.Status, &req.CreatedAt)
+	if err == sql.ErrNoRows {
+		return ErrJoinRequestPending
+	}
+	return err
+}
+
+// Obtener las solicitudes pendientes del team (las más viejas primero)
+func (r *TeamRepository) GetPendingJoinRequests(teamID int) ([]JoinRequest, error) {
+	query := `
+		SELECT ` + joinRequestColumns + `, ` + users.SummaryColumns("u") + `
+		FROM team_join_requests jr
+		LEFT JOIN users u ON u.id = jr.user_id
+		WHERE jr.team_id = $1 AND jr.status = 'pending'
+		ORDER BY jr.id
+	`
+	rows, err := r.DB.Query(query, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []JoinRequest{}
+	for rows.Next() {
+		var user users.UserSummary
+		req, err := scanJoinRequest(rows, user.ScanDest()...)
+		if err != nil {
+			return nil, err
+		}
+		req.User = &user
+		requests = append(requests, *req)
+	}
+	return requests, rows.Err()
+}
+
+// Aprobar una solicitud pendiente: el usuario entra como member y la solicitud
+// queda cerrada, en una transacción para no aprobarla dos veces
+func (r *TeamRepository) ApproveJoinRequest(teamID, requestID, reviewerID int) (*JoinRequest, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE team_join_requests jr
+		SET status = 'approved', reviewed_by = $3, reviewed_at = NOW()
+		WHERE jr.id = $1 AND jr.team_id = $2 AND jr.status = 'pending'
+		RETURNING ` + joinRequestColumns
+	req, err := scanJoinRequest(tx.QueryRow(query, requestID, teamID, reviewerID))
+	if err == sql.ErrNoRows {
+		return nil, ErrJoinRequestNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`INSERT INTO user_teams (user_id, team_id, role) VALUES ($1, $2, 'member') ON CONFLICT DO NOTHING`,
+		req.UserID, teamID)
+	if err != nil {
+		return nil, err
+	}
+	return req, tx.Commit()
+}
+
+// Rechazar una solicitud pendiente
+func (r *TeamRepository) RejectJoinRequest(teamID, requestID, reviewerID int) (*JoinRequest, error) {
+	query := `
+		UPDATE team_join_requests jr
+		SET status = 'rejected', reviewed_by = $3, reviewed_at = NOW()
+		WHERE jr.id = $1 AND jr.team_id = $2 AND jr.status = 'pending'
+		RETURNING ` + joinRequestColumns
+	req, err := scanJoinRequest(r.DB.QueryRow(query, requestID, teamID, reviewerID))
+	if err == sql.ErrNoRows {
+		return nil, ErrJoinRequestNotFound
+	}
+	return req, err
+}
+
+// Cancelar la solicitud pendiente del usuario; false si no tenía
+func (r *TeamRepository) CancelJoinRequest(teamID, userID int) (bool, error) {
+	query := `UPDATE team_join_requests SET status = 'cancelled' WHERE team_id = $1 AND user_id = $2 AND status = 'pending'`
+	res, err := r.DB.Exec(query, teamID, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
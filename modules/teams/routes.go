@@ -3,6 +3,8 @@ package teams
 import (
 	"net/http"
 
+	"toller-server/modules/auth"
+
 	"github.com/gorilla/mux"
 )
 
@@ -11,11 +13,38 @@ func RegisterRoutes(router *mux.Router, handler *TeamHandler, authMiddleware fun
 	s := router.PathPrefix("/api/v1").Subrouter()
 	s.Use(authMiddleware)
 
-	s.HandleFunc("/teams", handler.GetUserTeams).Methods("GET")
-	s.HandleFunc("/teams", handler.CreateTeam).Methods("POST")
-	s.HandleFunc("/teams/{id:[0-9]+}", handler.GetTeam).Methods("GET")
-	s.HandleFunc("/teams/{id:[0-9]+}/members", handler.GetTeamMembers).Methods("GET")
-	s.HandleFunc("/teams/{id:[0-9]+}", handler.UpdateTeam).Methods("PUT", "PATCH")
-	s.HandleFunc("/teams/{team_id:[0-9]+}/members", handler.AddMember).Methods("POST")
-	s.HandleFunc("/teams/{team_id:[0-9]+}/members/{user_id:[0-9]+}", handler.RemoveMember).Methods("DELETE")
+	s.HandleFunc("/teams", auth.RequireScope(auth.ScopeTeamsRead, handler.GetUserTeams)).Methods("GET")
+	s.HandleFunc("/teams", auth.RequireScope(auth.ScopeTeamsWrite, handler.CreateTeam)).Methods("POST")
+	s.HandleFunc("/teams/{id:[0-9]+}", auth.RequireScope(auth.ScopeTeamsRead, handler.GetTeam)).Methods("GET")
+	s.HandleFunc("/teams/{id:[0-9]+}/members", auth.RequireScope(auth.ScopeTeamsRead, handler.GetTeamMembers)).Methods("GET")
+	s.HandleFunc("/teams/{id:[0-9]+}/lockouts", auth.RequireScope(auth.ScopeTeamsRead, handler.GetMemberLockouts)).Methods("GET")
+	s.HandleFunc("/teams/{id:[0-9]+}", auth.RequireScope(auth.ScopeTeamsWrite, handler.UpdateTeam)).Methods("PUT", "PATCH")
+	s.HandleFunc("/teams/{team_id:[0-9]+}/members", auth.RequireScope(auth.ScopeTeamsWrite, handler.AddMember)).Methods("POST")
+	s.HandleFunc("/teams/{team_id:[0-9]+}/members/{user_id:[0-9]+}", auth.RequireScope(auth.ScopeTeamsWrite, handler.RemoveMember)).Methods("DELETE")
+	s.HandleFunc("/teams/{team_id:[0-9]+}/members/{user_id:[0-9]+}", auth.RequireScope(auth.ScopeTeamsWrite, handler.UpdateMemberRole)).Methods("PUT", "PATCH")
+	s.HandleFunc("/teams/{id:[0-9]+}/leave", auth.RequireScope(auth.ScopeTeamsWrite, handler.LeaveTeam)).Methods("POST")
+
+	// Propiedad y borrado (solo el dueño); borrar y transferir exigen una sesión interactiva
+	s.HandleFunc("/teams/deleted", auth.RequireScope(auth.ScopeTeamsRead, handler.GetDeletedTeams)).Methods("GET")
+	s.HandleFunc("/teams/{id:[0-9]+}", auth.SessionOnly(handler.DeleteTeam)).Methods("DELETE")
+	s.HandleFunc("/teams/{id:[0-9]+}/restore", auth.SessionOnly(handler.RestoreTeam)).Methods("POST")
+	s.HandleFunc("/teams/{id:[0-9]+}/transfer", auth.SessionOnly(handler.TransferOwnership)).Methods("POST")
+
+	// Registro de auditoría (requiere view_audit_log)
+	s.HandleFunc("/teams/{id:[0-9]+}/audit", auth.RequireScope(auth.ScopeTeamsRead, handler.GetAuditLog)).Methods("GET")
+
+	// Directorio y solicitudes para unirse
+	s.HandleFunc("/teams/directory", auth.RequireScope(auth.ScopeTeamsRead, handler.GetDirectory)).Methods("GET")
+	s.HandleFunc("/teams/{id:[0-9]+}/join", auth.RequireScope(auth.ScopeTeamsWrite, handler.JoinTeam)).Methods("POST")
+	s.HandleFunc("/teams/{id:[0-9]+}/join", auth.RequireScope(auth.ScopeTeamsWrite, handler.CancelJoinRequest)).Methods("DELETE")
+	s.HandleFunc("/teams/{id:[0-9]+}/join-requests", auth.RequireScope(auth.ScopeTeamsRead, handler.GetJoinRequests)).Methods("GET")
+	s.HandleFunc("/teams/{id:[0-9]+}/join-requests/{request_id:[0-9]+}/approve", auth.RequireScope(auth.ScopeTeamsWrite, handler.ApproveJoinRequest)).Methods("POST")
+	s.HandleFunc("/teams/{id:[0-9]+}/join-requests/{request_id:[0-9]+}/reject", auth.RequireScope(auth.ScopeTeamsWrite, handler.RejectJoinRequest)).Methods("POST")
+
+	// Invitaciones
+	s.HandleFunc("/teams/{id:[0-9]+}/invites", auth.RequireScope(auth.ScopeTeamsWrite, handler.CreateInvite)).Methods("POST")
+	s.HandleFunc("/teams/{id:[0-9]+}/invites", auth.RequireScope(auth.ScopeTeamsRead, handler.GetInvites)).Methods("GET")
+	s.HandleFunc("/teams/{id:[0-9]+}/invites/{invite_id:[0-9]+}", auth.RequireScope(auth.ScopeTeamsWrite, handler.RevokeInvite)).Methods("DELETE")
+	s.HandleFunc("/invites/{code:[A-Za-z0-9_-]+}", auth.RequireScope(auth.ScopeTeamsRead, handler.PreviewInvite)).Methods("GET")
+	s.HandleFunc("/invites/{code:[A-Za-z0-9_-]+}/accept", auth.RequireScope(auth.ScopeTeamsWrite, handler.AcceptInvite)).Methods("POST")
 }
@@ -1,20 +1,93 @@
 package teams
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+
+	"toller-server/modules/audit"
+	"toller-server/modules/permissions"
+	"toller-server/pkg/mailer"
+)
+
+const (
+	DefaultDeletionGrace = 7 * 24 * time.Hour
+	purgeInterval        = time.Hour
+)
+
+var (
+	ErrNotTeamAdmin       = errors.New("esta acción es solo para admins del equipo")
+	ErrMissingPermission  = errors.New("no tienes permiso para esta acción")
+	ErrNotTeamOwner       = errors.New("esta acción es solo para el dueño del equipo")
+	ErrNotMember          = errors.New("el usuario no es miembro del equipo")
+	ErrInvalidRole        = errors.New("rol inválido, debe ser 'admin' o 'member'")
+	ErrOwnerRole          = errors.New("el dueño siempre es admin; transfiere la propiedad antes de cambiar su rol")
+	ErrOwnerCannotLeave   = errors.New("el dueño no puede salir ni ser removido del equipo; transfiere la propiedad primero")
+	ErrLastAdmin          = errors.New("el equipo tiene que quedar con al menos un admin")
+	ErrBotOwner           = errors.New("un bot no puede ser dueño de un equipo")
+	ErrTeamNotRestorable  = errors.New("el equipo no está borrado o ya no se puede restaurar")
+	ErrAlreadyOwner       = errors.New("el usuario ya es el dueño del equipo")
+	ErrInvalidAuditFilter = errors.New("filtro de auditoría inválido")
+	ErrInvalidTeamName    = errors.New("el nombre del equipo no puede tener caracteres de control")
+)
+
+// AccountPolicy permite que el módulo de auth restrinja acciones según el estado de la cuenta
+type AccountPolicy interface {
+	EnsureVerified(userID int) error
+	EnsureEmailVerified(userID int) error
+	EnsureMFA(userID int) error
+}
+
+// DefaultChannels permite que el módulo de canales cree el #general de cada team
+// nuevo y sume a los miembros nuevos a los canales por defecto
+type DefaultChannels interface {
+	CreateDefaultChannels(teamID, creatorID int) error
+	JoinDefaultChannels(teamID, userID int) error
+}
 
 type TeamService struct {
-	Repo *TeamRepository
+	Repo     *TeamRepository
+	Authz    *permissions.Authorizer
+	Audit    *audit.AuditLog // opcional, registra cada cambio en el team
+	Accounts AccountPolicy   // opcional
+	Channels DefaultChannels // opcional
+	Mailer   mailer.Mailer   // opcional, para las invitaciones por email
+	AppURL   string          // URL pública del cliente, usada en los enlaces de invitación
+	// Tiempo durante el que un team borrado se puede restaurar (7 días por defecto)
+	DeletionGrace time.Duration
 }
 
-// Crear un team (el creador se convierte en admin automáticamente)
-func (s *TeamService) CreateTeam(name, description string, creatorID int) (*Team, error) {
+// Crear un team (el creador queda como dueño y admin). Sin visibilidad es privado
+func (s *TeamService) CreateTeam(name, description, visibility string, creatorID int, meta audit.Meta) (*Team, error) {
 	if name == "" {
 		return nil, errors.New("el nombre del equipo es requerido")
 	}
+	if !validTeamName(name) {
+		return nil, ErrInvalidTeamName
+	}
+	if visibility == "" {
+		visibility = VisibilityPrivate
+	}
+	if !validVisibility(visibility) {
+		return nil, ErrInvalidVisibility
+	}
+
+	// Crear teams puede requerir el email verificado
+	if s.Accounts != nil {
+		if err := s.Accounts.EnsureVerified(creatorID); err != nil {
+			return nil, err
+		}
+	}
 
 	team := &Team{
 		Name:        name,
 		Description: description,
+		OwnerID:     &creatorID,
+		Visibility:  visibility,
 	}
 
 	// Crear el team
@@ -29,6 +102,17 @@ func (s *TeamService) CreateTeam(name, description string, creatorID int) (*Team
 		return nil, err
 	}
 
+	s.record(audit.Entry{
+		TeamID: team.ID, ActorID: creatorID, Action: audit.TeamCreate, TargetType: audit.TargetTeam,
+		Changes: audit.Diff(nil, teamFields(team)), Meta: meta,
+	})
+
+	// Sin #general el team sigue sirviendo: el error queda en el log
+	if s.Channels != nil {
+		if err := s.Channels.CreateDefaultChannels(team.ID, creatorID); err != nil {
+			log.Printf("[TEAMS] No se pudieron crear los canales por defecto del equipo %d: %v", team.ID, err)
+		}
+	}
 	return team, nil
 }
 
@@ -51,16 +135,11 @@ func (s *TeamService) GetTeam(teamID, userID int) (*Team, error) {
 	return s.Repo.GetTeamByID(teamID)
 }
 
-// Agregar miembro al team (solo admins pueden hacerlo)
-func (s *TeamService) AddMember(teamID, newUserID, requestingUserID int) error {
-	// Verificar que quien lo solicita sea admin
-	isMember, role, err := s.Repo.IsUserInTeam(requestingUserID, teamID)
-	if err != nil {
+// Agregar miembro al team (requiere manage_members)
+func (s *TeamService) AddMember(teamID, newUserID, requestingUserID int, meta audit.Meta) error {
+	if err := s.authorize(teamID, requestingUserID, permissions.ManageMembers); err != nil {
 		return err
 	}
-	if !isMember || role != "admin" {
-		return errors.New("solo los admins pueden agregar miembros")
-	}
 
 	// Verificar que el nuevo usuario no esté ya en el team
 	alreadyMember, _, err := s.Repo.IsUserInTeam(newUserID, teamID)
@@ -71,13 +150,22 @@ func (s *TeamService) AddMember(teamID, newUserID, requestingUserID int) error {
 		return errors.New("el usuario ya es miembro del equipo")
 	}
 
-	return s.Repo.AddUserToTeam(newUserID, teamID, "member")
+	if err := s.Repo.AddUserToTeam(newUserID, teamID, "member"); err != nil {
+		return err
+	}
+	s.joinDefaultChannels(teamID, newUserID)
+	s.record(audit.Entry{
+		TeamID: teamID, ActorID: requestingUserID, Action: audit.MemberAdd, TargetType: audit.TargetUser, TargetID: newUserID,
+		Changes: audit.Diff(nil, map[string]interface{}{"role": "member"}), Meta: meta,
+	})
+	return nil
 }
 
-// Obtener miembros del team
+// Obtener miembros del team. El email de cada uno solo lo ven los admins y
+// quienes ya lo verían por su perfil: en un team open entra cualquiera
 func (s *TeamService) GetTeamMembers(teamID, userID int) ([]TeamMember, error) {
 	// Verificar que el usuario sea miembro
-	isMember, _, err := s.Repo.IsUserInTeam(userID, teamID)
+	isMember, role, err := s.Repo.IsUserInTeam(userID, teamID)
 	if err != nil {
 		return nil, err
 	}
@@ -85,81 +173,405 @@ func (s *TeamService) GetTeamMembers(teamID, userID int) ([]TeamMember, error) {
 		return nil, errors.New("no tienes acceso a este equipo")
 	}
 
-	return s.Repo.GetTeamMembers(teamID)
+	return s.Repo.GetTeamMembers(teamID, userID, role == "admin")
 }
 
-// Remover miembro del team (solo admins)
-func (s *TeamService) RemoveMember(teamID, userToRemove, requestingUserID int) error {
-	// Verificar que quien lo solicita sea admin
-	isMember, role, err := s.Repo.IsUserInTeam(requestingUserID, teamID)
-	if err != nil {
+// Remover miembro del team (requiere manage_members; a un admin solo lo saca otro admin)
+func (s *TeamService) RemoveMember(teamID, userToRemove, requestingUserID int, meta audit.Meta) error {
+	if err := s.authorize(teamID, requestingUserID, permissions.ManageMembers); err != nil {
 		return err
 	}
-	if !isMember || role != "admin" {
-		return errors.New("solo los admins pueden remover miembros")
-	}
 
 	// No puede removerse a sí mismo si es admin
 	if userToRemove == requestingUserID {
 		return errors.New("no puedes removerte a ti mismo del equipo")
 	}
 
-	return s.Repo.RemoveUserFromTeam(userToRemove, teamID)
-}
+	// Verificar que el usuario a remover esté en el team
+	isMember, targetRole, err := s.Repo.IsUserInTeam(userToRemove, teamID)
+	if err != nil {
+		return err
+	}
+	if !isMember {
+		return ErrNotMember
+	}
 
-// Actualizar rol de un miembro (solo admins)
-func (s *TeamService) UpdateMemberRole(teamID, targetUserID, requestingUserID int, newRole string) error {
-	// Verificar que quien lo solicita sea admin
-	isMember, role, err := s.Repo.IsUserInTeam(requestingUserID, teamID)
+	// Al dueño no lo puede sacar nadie
+	team, err := s.Repo.GetTeamByID(teamID)
 	if err != nil {
 		return err
 	}
-	if !isMember || role != "admin" {
-		return errors.New("solo los admins pueden cambiar roles")
+	if isOwner(team, userToRemove) {
+		return ErrOwnerCannotLeave
+	}
+	// Y a un admin solo lo puede sacar otro admin
+	if targetRole == "admin" {
+		if err := s.ensureAdmin(teamID, requestingUserID); err != nil {
+			return err
+		}
+	}
+
+	if err := s.Repo.RemoveUserFromTeam(userToRemove, teamID); err != nil {
+		return err
+	}
+	s.record(audit.Entry{
+		TeamID: teamID, ActorID: requestingUserID, Action: audit.MemberRemove, TargetType: audit.TargetUser, TargetID: userToRemove,
+		Changes: audit.Diff(map[string]interface{}{"role": targetRole}, nil), Meta: meta,
+	})
+	return nil
+}
+
+// Actualizar el rol base de un miembro (solo admins: un admin tiene todos los permisos)
+func (s *TeamService) UpdateMemberRole(teamID, targetUserID, requestingUserID int, newRole string, meta audit.Meta) error {
+	// Verificar que quien lo solicita sea admin
+	if err := s.ensureAdmin(teamID, requestingUserID); err != nil {
+		return err
 	}
 
 	// Validar el nuevo rol
 	if newRole != "admin" && newRole != "member" {
-		return errors.New("rol inválido, debe ser 'admin' o 'member'")
+		return ErrInvalidRole
 	}
 
-	return s.Repo.UpdateUserRole(targetUserID, teamID, newRole)
-}
-
-// Actualizar team (solo admins)
-func (s *TeamService) UpdateTeam(teamID, userID int, name, description string) error {
-	// Verificar que el usuario sea admin
-	isMember, role, err := s.Repo.IsUserInTeam(userID, teamID)
+	isMember, currentRole, err := s.Repo.IsUserInTeam(targetUserID, teamID)
 	if err != nil {
 		return err
 	}
-	if !isMember || role != "admin" {
-		return errors.New("solo los admins pueden actualizar el equipo")
+	if !isMember {
+		return ErrNotMember
+	}
+
+	// El dueño no se degrada, y el último admin tampoco
+	if newRole != "admin" && currentRole == "admin" {
+		team, err := s.Repo.GetTeamByID(teamID)
+		if err != nil {
+			return err
+		}
+		if isOwner(team, targetUserID) {
+			return ErrOwnerRole
+		}
+		if err := s.ensureNotLastAdmin(teamID); err != nil {
+			return err
+		}
+	}
+
+	if err := s.Repo.UpdateUserRole(targetUserID, teamID, newRole); err != nil {
+		return err
+	}
+	if newRole != currentRole {
+		s.record(audit.Entry{
+			TeamID: teamID, ActorID: requestingUserID, Action: audit.MemberRoleUpdate, TargetType: audit.TargetUser, TargetID: targetUserID,
+			Changes: audit.Diff(map[string]interface{}{"role": currentRole}, map[string]interface{}{"role": newRole}), Meta: meta,
+		})
+	}
+	return nil
+}
+
+// Actualizar team (requiere manage_team). Sin visibilidad se mantiene la actual
+func (s *TeamService) UpdateTeam(teamID, requestingUserID int, name, description, visibility string, meta audit.Meta) error {
+	if err := s.authorize(teamID, requestingUserID, permissions.ManageTeam); err != nil {
+		return err
 	}
 
 	if name == "" {
 		return errors.New("el nombre del equipo es requerido")
 	}
+	if !validTeamName(name) {
+		return ErrInvalidTeamName
+	}
+	if visibility != "" && !validVisibility(visibility) {
+		return ErrInvalidVisibility
+	}
 
+	before, err := s.Repo.GetTeamByID(teamID)
+	if err != nil {
+		return err
+	}
+	if visibility == "" {
+		visibility = before.Visibility
+	}
 	team := &Team{
 		ID:          teamID,
 		Name:        name,
 		Description: description,
+		Visibility:  visibility,
 	}
 
-	return s.Repo.UpdateTeam(team)
+	if err := s.Repo.UpdateTeam(team); err != nil {
+		return err
+	}
+	if changes := audit.Diff(teamFields(before), teamFields(team)); len(changes) > 0 {
+		s.record(audit.Entry{
+			TeamID: teamID, ActorID: requestingUserID, Action: audit.TeamUpdate, TargetType: audit.TargetTeam,
+			Changes: changes, Meta: meta,
+		})
+	}
+	return nil
+}
+
+// Obtener los bloqueos de login de los miembros (requiere manage_members)
+func (s *TeamService) GetMemberLockouts(teamID, requestingUserID int) ([]MemberLockout, error) {
+	if err := s.authorize(teamID, requestingUserID, permissions.ManageMembers); err != nil {
+		return nil, err
+	}
+
+	return s.Repo.GetMemberLockouts(teamID)
 }
 
 // Salir del team (dejar el equipo)
-func (s *TeamService) LeaveTeam(teamID, userID int) error {
+func (s *TeamService) LeaveTeam(teamID, userID int, meta audit.Meta) error {
 	// Verificar que el usuario sea miembro
-	isMember, _, err := s.Repo.IsUserInTeam(userID, teamID)
+	isMember, role, err := s.Repo.IsUserInTeam(userID, teamID)
+	if err != nil {
+		return err
+	}
+	if !isMember {
+		return ErrNotMember
+	}
+
+	// El dueño tiene que transferir el team antes de irse
+	team, err := s.Repo.GetTeamByID(teamID)
+	if err != nil {
+		return err
+	}
+	if isOwner(team, userID) {
+		return ErrOwnerCannotLeave
+	}
+	// Y el último admin no puede dejar al resto sin nadie que administre
+	if role == "admin" {
+		members, err := s.Repo.CountMembers(teamID)
+		if err != nil {
+			return err
+		}
+		if members > 1 {
+			if err := s.ensureNotLastAdmin(teamID); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := s.Repo.RemoveUserFromTeam(userID, teamID); err != nil {
+		return err
+	}
+	s.record(audit.Entry{
+		TeamID: teamID, ActorID: userID, Action: audit.MemberLeave, TargetType: audit.TargetUser, TargetID: userID,
+		Changes: audit.Diff(map[string]interface{}{"role": role}, nil), Meta: meta,
+	})
+	return nil
+}
+
+// Transferir el team a otro miembro (solo el dueño). El nuevo dueño queda como
+// admin y el anterior sigue como admin
+func (s *TeamService) TransferOwnership(teamID, newOwnerID, requestingUserID int, meta audit.Meta) error {
+	team, err := s.ensureOwner(teamID, requestingUserID)
+	if err != nil {
+		return err
+	}
+	if isOwner(team, newOwnerID) {
+		return ErrAlreadyOwner
+	}
+
+	isMember, _, err := s.Repo.IsUserInTeam(newOwnerID, teamID)
 	if err != nil {
 		return err
 	}
 	if !isMember {
-		return errors.New("no eres miembro de este equipo")
+		return ErrNotMember
+	}
+	isBot, err := s.Repo.IsBot(newOwnerID)
+	if err != nil {
+		return err
+	}
+	if isBot {
+		return ErrBotOwner
+	}
+
+	if err := s.Repo.TransferOwnership(teamID, newOwnerID); err != nil {
+		return err
+	}
+	s.record(audit.Entry{
+		TeamID: teamID, ActorID: requestingUserID, Action: audit.TeamTransfer, TargetType: audit.TargetUser, TargetID: newOwnerID,
+		Changes: audit.Diff(map[string]interface{}{"owner_id": requestingUserID}, map[string]interface{}{"owner_id": newOwnerID}),
+		Meta:    meta,
+	})
+	return nil
+}
+
+// Borrar el team (solo el dueño). Queda oculto para todos y se purga al terminar
+// el período de gracia; hasta entonces el dueño lo puede restaurar
+func (s *TeamService) DeleteTeam(teamID, requestingUserID int, meta audit.Meta) (*Team, error) {
+	team, err := s.ensureOwner(teamID, requestingUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	grace := s.DeletionGrace
+	if grace <= 0 {
+		grace = DefaultDeletionGrace
+	}
+	purgeAt, err := s.Repo.SoftDeleteTeam(teamID, grace)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	team.DeletedAt = &now
+	team.PurgeAt = &purgeAt
+	s.record(audit.Entry{
+		TeamID: teamID, ActorID: requestingUserID, Action: audit.TeamDelete, TargetType: audit.TargetTeam,
+		Changes: audit.Diff(nil, map[string]interface{}{"purge_at": purgeAt}), Meta: meta,
+	})
+	return team, nil
+}
+
+// Restaurar un team borrado (solo el dueño, dentro del período de gracia)
+func (s *TeamService) RestoreTeam(teamID, requestingUserID int, meta audit.Meta) (*Team, error) {
+	restored, err := s.Repo.RestoreTeam(teamID, requestingUserID)
+	if err != nil {
+		return nil, err
+	}
+	if !restored {
+		return nil, ErrTeamNotRestorable
+	}
+	s.record(audit.Entry{
+		TeamID: teamID, ActorID: requestingUserID, Action: audit.TeamRestore, TargetType: audit.TargetTeam, Meta: meta,
+	})
+	return s.Repo.GetTeamByID(teamID)
+}
+
+// Obtener los teams borrados del usuario que todavía se pueden restaurar
+func (s *TeamService) GetDeletedTeams(userID int) ([]Team, error) {
+	return s.Repo.GetDeletedTeams(userID)
+}
+
+// RunPurge purga cada hora los teams con el período de gracia vencido, hasta que se cancele ctx
+func (s *TeamService) RunPurge(ctx context.Context) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+	for {
+		s.PurgeDeletedTeams()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 	}
+}
+
+// Purgar los teams borrados cuyo período de gracia venció
+func (s *TeamService) PurgeDeletedTeams() {
+	n, err := s.Repo.PurgeDeletedTeams()
+	if err != nil {
+		log.Printf("[TEAMS] Error purgando equipos borrados: %v", err)
+		return
+	}
+	if n > 0 {
+		log.Printf("[TEAMS] %d equipos borrados purgados", n)
+	}
+}
+
+// Obtener el registro de auditoría del team (requiere view_audit_log)
+func (s *TeamService) GetAuditLog(teamID, requestingUserID int, q audit.Query) (*audit.Page, error) {
+	if err := s.authorize(teamID, requestingUserID, permissions.ViewAuditLog); err != nil {
+		return nil, err
+	}
+	if s.Audit == nil {
+		return &audit.Page{Entries: []audit.Entry{}}, nil
+	}
+	q.TeamID = teamID
+	return s.Audit.List(q)
+}
+
+// Suma a un miembro nuevo a los canales por defecto. Si falla, el error queda en
+// el log y la membresía sigue en pie
+func (s *TeamService) joinDefaultChannels(teamID, userID int) {
+	if s.Channels == nil {
+		return
+	}
+	if err := s.Channels.JoinDefaultChannels(teamID, userID); err != nil {
+		log.Printf("[TEAMS] No se pudo sumar al usuario %d a los canales por defecto del equipo %d: %v", userID, teamID, err)
+	}
+}
+
+// Deja constancia de una acción en el registro de auditoría
+func (s *TeamService) record(e audit.Entry) {
+	if s.Audit != nil {
+		s.Audit.Record(e)
+	}
+}
+
+// Los campos del team que se auditan al crearlo o editarlo
+func teamFields(team *Team) map[string]interface{} {
+	return map[string]interface{}{"name": team.Name, "description": team.Description, "visibility": team.Visibility}
+}
+
+// Permiso del team según el authorizer (con 2FA si la política lo exige)
+func (s *TeamService) authorize(teamID, userID int, perm string) error {
+	ok, err := s.Authz.Can(userID, teamID, perm)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrMissingPermission, perm)
+	}
+	return s.ensureAdminMFA(userID)
+}
+
+// Solo los admins del team (con 2FA si la política lo exige)
+func (s *TeamService) ensureAdmin(teamID, userID int) error {
+	isMember, role, err := s.Repo.IsUserInTeam(userID, teamID)
+	if err != nil {
+		return err
+	}
+	if !isMember || role != "admin" {
+		return ErrNotTeamAdmin
+	}
+	return s.ensureAdminMFA(userID)
+}
+
+// Solo el dueño del team (con 2FA si la política lo exige)
+func (s *TeamService) ensureOwner(teamID, userID int) (*Team, error) {
+	isMember, _, err := s.Repo.IsUserInTeam(userID, teamID)
+	if err != nil {
+		return nil, err
+	}
+	if !isMember {
+		return nil, ErrNotTeamOwner
+	}
+	team, err := s.Repo.GetTeamByID(teamID)
+	if err != nil {
+		return nil, err
+	}
+	if !isOwner(team, userID) {
+		return nil, ErrNotTeamOwner
+	}
+	return team, s.ensureAdminMFA(userID)
+}
+
+func (s *TeamService) ensureNotLastAdmin(teamID int) error {
+	admins, err := s.Repo.CountAdmins(teamID)
+	if err != nil {
+		return err
+	}
+	if admins <= 1 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+func isOwner(team *Team, userID int) bool {
+	return team.OwnerID != nil && *team.OwnerID == userID
+}
+
+// Las acciones de admin pueden requerir 2FA activo según la política de auth
+func (s *TeamService) ensureAdminMFA(userID int) error {
+	if s.Accounts == nil {
+		return nil
+	}
+	return s.Accounts.EnsureMFA(userID)
+}
 
-	return s.Repo.RemoveUserFromTeam(userID, teamID)
+// El nombre del equipo va en el asunto de las invitaciones y en notificaciones:
+// sin saltos de línea ni otros caracteres de control
+func validTeamName(name string) bool {
+	return strings.IndexFunc(name, unicode.IsControl) < 0
 }
@@ -3,9 +3,12 @@ package users
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
+	"toller-server/modules/auth"
+
 	"github.com/gorilla/mux"
 )
 
@@ -19,15 +22,38 @@ func NewUserHandler(db *sql.DB) *UserHandler {
 	return &UserHandler{Service: service}
 }
 
-func (h *UserHandler) GetAllUsersHandler(w http.ResponseWriter, r *http.Request) {
-	users, err := h.Service.GetAllUsers()
+// DirectoryHandler handles GET /users?q=&team_id=&limit=&cursor=
+func (h *UserHandler) DirectoryHandler(w http.ResponseWriter, r *http.Request) {
+	viewerID, _ := auth.UserIDFromContext(r.Context())
+	params := r.URL.Query()
+
+	q := DirectoryQuery{Query: params.Get("q"), Cursor: params.Get("cursor")}
+	for name, dest := range map[string]*int{"team_id": &q.TeamID, "limit": &q.Limit} {
+		if raw := params.Get(name); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 0 {
+				http.Error(w, "Invalid "+name, http.StatusBadRequest)
+				return
+			}
+			*dest = n
+		}
+	}
+
+	page, err := h.Service.Directory(viewerID, q)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		switch {
+		case errors.Is(err, ErrInvalidCursor), errors.Is(err, ErrQueryTooLong):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrNotTeamMember):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(users)
+	json.NewEncoder(w).Encode(page)
 }
 
 func (h *UserHandler) GetUserByIDHandler(w http.ResponseWriter, r *http.Request) {
@@ -38,7 +64,8 @@ func (h *UserHandler) GetUserByIDHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	user, err := h.Service.GetUserByID(id)
+	viewerID, _ := auth.UserIDFromContext(r.Context())
+	user, err := h.Service.GetUserByID(viewerID, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, "User not found", http.StatusNotFound)
@@ -52,20 +79,15 @@ func (h *UserHandler) GetUserByIDHandler(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(user)
 }
 
+// GetUserMeHandler handles GET /users/me: the authenticated user's bootstrap payload.
 func (h *UserHandler) GetUserMeHandler(w http.ResponseWriter, r *http.Request) {
-	// id viene por query param de la url
-	userID, ok := r.URL.Query()["id"]
-	if !ok || len(userID) == 0 {
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
-	userIDInt, err := strconv.Atoi(userID[0])
-	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
-		return
-	}
 
-	user, err := h.Service.GetUserByID(userIDInt)
+	me, err := h.Service.GetMe(userID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, "User not found", http.StatusNotFound)
@@ -76,22 +98,114 @@ func (h *UserHandler) GetUserMeHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(user)
+	json.NewEncoder(w).Encode(me)
 }
 
+// SearchUsersHandler handles GET /users/search?q=, the directory with a required query.
 func (h *UserHandler) SearchUsersHandler(w http.ResponseWriter, r *http.Request) {
-	query := r.URL.Query().Get("q")
-	if query == "" {
+	if r.URL.Query().Get("q") == "" {
 		http.Error(w, "Missing search query", http.StatusBadRequest)
 		return
 	}
+	h.DirectoryHandler(w, r)
+}
+
+// UpdateMeHandler handles PATCH /users/me: only the fields present in the body are changed.
+func (h *UserHandler) UpdateMeHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	var update ProfileUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
 
-	users, err := h.Service.SearchUsers(query)
+	user, err := h.Service.UpdateProfile(userID, update)
+	if err != nil {
+		if errors.Is(err, ErrInvalidProfile) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// SetStatusHandler handles PUT /users/me/status.
+func (h *UserHandler) SetStatusHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	var update StatusUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.Service.SetStatus(userID, update)
+	if err != nil {
+		if errors.Is(err, ErrInvalidStatus) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// ClearStatusHandler handles DELETE /users/me/status.
+func (h *UserHandler) ClearStatusHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	user, err := h.Service.ClearStatus(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// GetSettingsHandler handles GET /users/me/settings.
+func (h *UserHandler) GetSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	settings, err := h.Service.GetSettings(userID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(users)
+	json.NewEncoder(w).Encode(settings)
+}
+
+// UpdateSettingsHandler handles PATCH /users/me/settings with a JSON merge patch.
+func (h *UserHandler) UpdateSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	var patch map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil || patch == nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	settings, err := h.Service.UpdateSettings(userID, patch)
+	if err != nil {
+		if errors.Is(err, ErrInvalidSettings) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
 }
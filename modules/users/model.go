@@ -1,11 +1,152 @@
 package users
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
-// User represents a user in the database.
+// User represents a user in the database. Email is only filled in when the
+// viewer may see it (themselves, a teammate or a friend).
 type User struct {
 	ID        int       `json:"id"`
 	Username  string    `json:"username"`
-	Email     string    `json:"email"`
+	Email     string    `json:"email,omitempty"`
+	IsBot     bool      `json:"is_bot"`
 	CreatedAt time.Time `json:"created_at"`
+	Profile
+}
+
+// Profile holds the public, user-editable profile fields. Empty means "not set".
+type Profile struct {
+	DisplayName string       `json:"display_name"`
+	AvatarURL   string       `json:"avatar_url"`
+	Bio         string       `json:"bio"`
+	Pronouns    string       `json:"pronouns"`
+	Timezone    string       `json:"timezone"`
+	Locale      string       `json:"locale"`
+	Status      CustomStatus `json:"status"`
+}
+
+// CustomStatus is a Slack-style status. ExpiresAt nil means it stays until cleared.
+type CustomStatus struct {
+	Emoji     string     `json:"emoji"`
+	Text      string     `json:"text"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// UserSummary is the compact user embedded in other resources (members, DMs,
+// messages), so clients don't need an extra request per user.
+type UserSummary struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	IsBot    bool   `json:"is_bot"`
+	Profile
+}
+
+// ProfileColumns returns the profile columns of the users table aliased as alias,
+// in the order expected by Profile.ScanDest.
+func ProfileColumns(alias string) string {
+	return fmt.Sprintf("%[1]s.display_name, %[1]s.avatar_url, %[1]s.bio, %[1]s.pronouns, %[1]s.timezone, %[1]s.locale, "+
+		"%[1]s.status_emoji, %[1]s.status_text, %[1]s.status_expires_at", alias)
+}
+
+// ScanDest returns the scan destinations matching ProfileColumns.
+func (p *Profile) ScanDest() []interface{} {
+	return []interface{}{&p.DisplayName, &p.AvatarURL, &p.Bio, &p.Pronouns, &p.Timezone, &p.Locale,
+		&p.Status.Emoji, &p.Status.Text, &p.Status.ExpiresAt}
+}
+
+// SummaryColumns returns the columns of a UserSummary for the users table aliased
+// as alias, so other modules can join users and scan the summary in the same query.
+// They are null-safe: with a LEFT JOIN on a removed user (e.g. the author of a
+// message from a deleted bot) the summary comes back empty with ID 0.
+func SummaryColumns(alias string) string {
+	return fmt.Sprintf("COALESCE(%[1]s.id, 0), COALESCE(%[1]s.username, ''), COALESCE(%[1]s.is_bot, FALSE), "+
+		"COALESCE(%[1]s.display_name, ''), COALESCE(%[1]s.avatar_url, ''), COALESCE(%[1]s.bio, ''), "+
+		"COALESCE(%[1]s.pronouns, ''), COALESCE(%[1]s.timezone, ''), COALESCE(%[1]s.locale, ''), "+
+		"COALESCE(%[1]s.status_emoji, ''), COALESCE(%[1]s.status_text, ''), %[1]s.status_expires_at", alias)
+}
+
+// ScanDest returns the scan destinations matching SummaryColumns.
+func (s *UserSummary) ScanDest() []interface{} {
+	return append([]interface{}{&s.ID, &s.Username, &s.IsBot}, s.Profile.ScanDest()...)
+}
+
+// ProfileUpdate is the body of PATCH /users/me; nil fields are left unchanged.
+type ProfileUpdate struct {
+	DisplayName *string `json:"display_name"`
+	AvatarURL   *string `json:"avatar_url"`
+	Bio         *string `json:"bio"`
+	Pronouns    *string `json:"pronouns"`
+	Timezone    *string `json:"timezone"`
+	Locale      *string `json:"locale"`
+}
+
+// StatusUpdate is the body of PUT /users/me/status. The status is cleared after
+// ClearAfter (a duration such as "30m" or "4h") or at ExpiresAt; at most one of them.
+type StatusUpdate struct {
+	Emoji      string     `json:"emoji"`
+	Text       string     `json:"text"`
+	ClearAfter string     `json:"clear_after"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+}
+
+// StatusPublisher delivers custom status changes to the connected sockets of the
+// given users. The chat Hub implements it.
+type StatusPublisher interface {
+	PublishCustomStatus(userIDs []int, userID int, status CustomStatus)
+}
+
+// DirectoryQuery filters a page of the user directory.
+type DirectoryQuery struct {
+	Query  string // matched against username and display name
+	TeamID int    // 0 = every user
+	Cursor string
+	Limit  int
+}
+
+// DirectoryPage is one page of directory results; NextCursor is empty on the last page.
+type DirectoryPage struct {
+	Users      []User `json:"users"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Me is the private view of the authenticated user returned by GET /users/me:
+// everything the client needs on startup in a single request.
+type Me struct {
+	User
+	Account               AccountSettings  `json:"account"`
+	Settings              Settings         `json:"settings"`
+	Teams                 []TeamMembership `json:"teams"`
+	Unread                []ChannelUnread  `json:"unread"`
+	PendingFriendRequests []FriendRequest  `json:"pending_friend_requests"`
+}
+
+// AccountSettings is the account state only the user can see.
+type AccountSettings struct {
+	EmailVerified bool `json:"email_verified"`
+	MFAEnabled    bool `json:"mfa_enabled"`
+	// Set while the account is scheduled for deletion (see the privacy module)
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at"`
+}
+
+// TeamMembership is a team the user belongs to, with their role in it.
+type TeamMembership struct {
+	TeamID int    `json:"team_id"`
+	Name   string `json:"name"`
+	Role   string `json:"role"`
+}
+
+// ChannelUnread counts the messages from others after the user's last read
+// message in a channel. Only channels with unread messages are listed.
+type ChannelUnread struct {
+	ChannelID int  `json:"channel_id"`
+	TeamID    *int `json:"team_id"` // nil for DMs
+	IsDM      bool `json:"is_dm"`
+	Count     int  `json:"count"`
+}
+
+// FriendRequest is a pending friend request received by the user.
+type FriendRequest struct {
+	From UserSummary `json:"from"`
 }
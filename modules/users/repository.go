@@ -1,6 +1,10 @@
 package users
 
-import "database/sql"
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
 
 type UserRepository struct {
 	DB *sql.DB
@@ -10,49 +14,366 @@ func NewUserRepository(db *sql.DB) *UserRepository {
 	return &UserRepository{DB: db}
 }
 
-func (r *UserRepository) GetAllUsers() ([]User, error) {
-	rows, err := r.DB.Query("SELECT id, username, email, created_at FROM users")
+var userColumns = "u.id, u.username, u.email, u.is_bot, u.created_at, " + ProfileColumns("u")
+
+// Related returns a condition that is true when the viewer (a SQL expression
+// such as "$1") is the user aliased as alias, shares a private team with them
+// or is an accepted friend. Deleted teams don't count, and neither do open or
+// discoverable ones, since anyone can get into those. It decides who sees a
+// user's email and presence.
+func Related(viewer, alias string) string {
+	return fmt.Sprintf(`
+	(%[2]s.id = %[1]s
+	OR EXISTS (
+		SELECT 1 FROM user_teams mine
+		JOIN user_teams theirs ON theirs.team_id = mine.team_id
+		JOIN teams t ON t.id = mine.team_id
+		WHERE mine.user_id = %[1]s AND theirs.user_id = %[2]s.id
+		  AND t.deleted_at IS NULL AND t.visibility = 'private'
+	)
+	OR EXISTS (
+		SELECT 1 FROM friends f
+		WHERE f.status = 'accepted'
+		  AND ((f.user_id = %[1]s AND f.friend_id = %[2]s.id) OR (f.friend_id = %[1]s AND f.user_id = %[2]s.id))
+	))`, viewer, alias)
+}
+
+// RelatedIDs returns a query listing the other users related to the viewer, by
+// the same rule as Related. It starts from the viewer's teams and friends instead
+// of checking every user, for when the whole audience is needed.
+func RelatedIDs(viewer string) string {
+	return fmt.Sprintf(`
+	SELECT theirs.user_id FROM user_teams mine
+	JOIN user_teams theirs ON theirs.team_id = mine.team_id
+	JOIN teams t ON t.id = mine.team_id
+	WHERE mine.user_id = %[1]s AND theirs.user_id <> %[1]s
+	  AND t.deleted_at IS NULL AND t.visibility = 'private'
+	UNION
+	SELECT CASE WHEN f.user_id = %[1]s THEN f.friend_id ELSE f.user_id END FROM friends f
+	WHERE f.status = 'accepted' AND (f.user_id = %[1]s OR f.friend_id = %[1]s)`, viewer)
+}
+
+var related = Related("$1", "u")
+
+// emailVisible is true when the viewer is related to the user. Bot emails are
+// placeholders and are never shown.
+var emailVisible = "(NOT u.is_bot AND " + related + ")"
+
+func scanUser(row interface{ Scan(...interface{}) error }, extra ...interface{}) (*User, error) {
+	var user User
+	var showEmail bool
+	dest := append([]interface{}{&user.ID, &user.Username, &user.Email, &user.IsBot, &user.CreatedAt}, user.Profile.ScanDest()...)
+	dest = append(dest, &showEmail)
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	if !showEmail {
+		user.Email = ""
+	}
+	return &user, nil
+}
+
+// GetUserByID returns the user as seen by viewerID.
+func (r *UserRepository) GetUserByID(viewerID, id int) (*User, error) {
+	query := "SELECT " + userColumns + ", " + emailVisible + " FROM users u WHERE u.id = $2"
+	return scanUser(r.DB.QueryRow(query, viewerID, id))
+}
+
+// directoryKey is the position of a row in the directory order, used as cursor.
+type directoryKey struct {
+	Rank     int     `json:"r"`
+	Score    float64 `json:"s"`
+	Username string  `json:"u"`
+	ID       int     `json:"i"`
+}
+
+// Directory returns up to limit+1 users ordered by relevance: exact match, then
+// prefix, then substring and finally trigram similarity. Without a query the
+// order is alphabetical. after is the key of the last row of the previous page.
+func (r *UserRepository) Directory(viewerID int, q DirectoryQuery, after *directoryKey) ([]User, []directoryKey, error) {
+	args := []interface{}{viewerID}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	rank, score := "0", "0::float8"
+	// Deleted accounts stay as message authors but are not listed
+	filters := []string{"u.deleted_at IS NULL"}
+	if q.Query != "" {
+		term := strings.ToLower(q.Query)
+		exact, prefix, substring := arg(term), arg(escapeLike(term)+"%"), arg("%"+escapeLike(term)+"%")
+		rank = fmt.Sprintf(`CASE
+				WHEN LOWER(u.username) = %[1]s OR LOWER(u.display_name) = %[1]s THEN 0
+				WHEN LOWER(u.username) LIKE %[2]s OR LOWER(u.display_name) LIKE %[2]s THEN 1
+				WHEN LOWER(u.username) LIKE %[3]s OR LOWER(u.display_name) LIKE %[3]s THEN 2
+				ELSE 3
+			END`, exact, prefix, substring)
+		score = fmt.Sprintf("GREATEST(similarity(LOWER(u.username), %[1]s), similarity(LOWER(u.display_name), %[1]s))::float8", exact)
+		filters = append(filters, fmt.Sprintf(`(LOWER(u.username) LIKE %[1]s OR LOWER(u.display_name) LIKE %[1]s
+			OR LOWER(u.username) %% %[2]s OR LOWER(u.display_name) %% %[2]s)`, substring, exact))
+	}
+	if q.TeamID != 0 {
+		filters = append(filters, fmt.Sprintf(`u.id IN (SELECT ut.user_id FROM user_teams ut
+			JOIN teams t ON t.id = ut.team_id WHERE ut.team_id = %s AND t.deleted_at IS NULL)`, arg(q.TeamID)))
+	}
+	where := strings.Join(filters, " AND ")
+
+	page := "TRUE"
+	if after != nil {
+		// Orden: rank ASC, score DESC, username ASC, id ASC
+		page = fmt.Sprintf("(c.rank, -c.score, c.sort_name, c.id) > (%s, %s, %s, %s)",
+			arg(after.Rank), arg(-after.Score), arg(after.Username), arg(after.ID))
+	}
+
+	query := `
+		WITH c AS (
+			SELECT u.id, ` + rank + ` AS rank, ` + score + ` AS score, LOWER(u.username) AS sort_name
+			FROM users u
+			WHERE ` + where + `
+		)
+		SELECT ` + userColumns + `, ` + emailVisible + `, c.rank, c.score, c.sort_name
+		FROM c
+		JOIN users u ON u.id = c.id
+		WHERE ` + page + `
+		ORDER BY c.rank, c.score DESC, c.sort_name, c.id
+		LIMIT ` + arg(q.Limit+1)
+
+	rows, err := r.DB.Query(query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	var keys []directoryKey
+	for rows.Next() {
+		var key directoryKey
+		user, err := scanUser(rows, &key.Rank, &key.Score, &key.Username)
+		if err != nil {
+			return nil, nil, err
+		}
+		key.ID = user.ID
+		users = append(users, *user)
+		keys = append(keys, key)
+	}
+	return users, keys, rows.Err()
+}
+
+// IsTeamMember reports whether the user belongs to the team (deleted teams have no members).
+func (r *UserRepository) IsTeamMember(userID, teamID int) (bool, error) {
+	var member bool
+	err := r.DB.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM user_teams ut
+			JOIN teams t ON t.id = ut.team_id
+			WHERE ut.user_id = $1 AND ut.team_id = $2 AND t.deleted_at IS NULL
+		)`, userID, teamID).Scan(&member)
+	return member, err
+}
+
+// UpdateProfile applies the non-nil fields of the update and returns the user.
+func (r *UserRepository) UpdateProfile(id int, update ProfileUpdate) (*User, error) {
+	query := `
+		UPDATE users u SET
+			display_name = COALESCE($2, display_name),
+			avatar_url = COALESCE($3, avatar_url),
+			bio = COALESCE($4, bio),
+			pronouns = COALESCE($5, pronouns),
+			timezone = COALESCE($6, timezone),
+			locale = COALESCE($7, locale),
+			profile_updated_at = NOW()
+		WHERE u.id = $1
+		RETURNING ` + userColumns + `, TRUE`
+	return scanUser(r.DB.QueryRow(query, id, update.DisplayName, update.AvatarURL, update.Bio,
+		update.Pronouns, update.Timezone, update.Locale))
+}
+
+// SetStatus saves the custom status of the user; with ttl it expires after that many seconds.
+func (r *UserRepository) SetStatus(id int, emoji, text string, ttl *int64) (*User, error) {
+	query := `
+		UPDATE users u SET
+			status_emoji = $2,
+			status_text = $3,
+			status_expires_at = CASE WHEN $4::bigint IS NULL THEN NULL ELSE NOW() + make_interval(secs => $4::bigint) END
+		WHERE u.id = $1
+		RETURNING ` + userColumns + `, TRUE`
+	return scanUser(r.DB.QueryRow(query, id, emoji, text, ttl))
+}
+
+// ExpireStatuses clears the statuses past their expiry and returns the affected users.
+func (r *UserRepository) ExpireStatuses() ([]int, error) {
+	rows, err := r.DB.Query(`
+		UPDATE users SET status_emoji = '', status_text = '', status_expires_at = NULL
+		WHERE status_expires_at <= NOW()
+		RETURNING id`)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var users []User
+	var ids []int
 	for rows.Next() {
-		var user User
-		if err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt); err != nil {
+		var id int
+		if err := rows.Scan(&id); err != nil {
 			return nil, err
 		}
-		users = append(users, user)
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Audience returns the users who see the user's changes live: themselves,
+// teammates in private teams and friends.
+func (r *UserRepository) Audience(userID int) ([]int, error) {
+	rows, err := r.DB.Query(`SELECT $1::integer UNION `+RelatedIDs("$1"), userID)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	return users, nil
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
 }
 
-func (r *UserRepository) GetUserByID(id int) (*User, error) {
-	var user User
-	err := r.DB.QueryRow("SELECT id, username, email, created_at FROM users WHERE id = $1", id).Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt)
+// GetSettings returns the stored settings of the user ({} if they never changed any).
+func (r *UserRepository) GetSettings(userID int) ([]byte, error) {
+	var raw []byte
+	err := r.DB.QueryRow(`SELECT settings FROM user_settings WHERE user_id = $1`, userID).Scan(&raw)
+	if err == sql.ErrNoRows {
+		return []byte("{}"), nil
+	}
+	return raw, err
+}
+
+// UpdateSettings replaces the stored settings with the result of update, locking
+// the row so concurrent partial updates don't overwrite each other.
+func (r *UserRepository) UpdateSettings(userID int, update func(stored []byte) ([]byte, error)) ([]byte, error) {
+	tx, err := r.DB.Begin()
 	if err != nil {
 		return nil, err
 	}
-	return &user, nil
+	defer tx.Rollback()
+
+	if _, err = tx.Exec(`INSERT INTO user_settings (user_id) VALUES ($1) ON CONFLICT (user_id) DO NOTHING`, userID); err != nil {
+		return nil, err
+	}
+	var stored []byte
+	if err = tx.QueryRow(`SELECT settings FROM user_settings WHERE user_id = $1 FOR UPDATE`, userID).Scan(&stored); err != nil {
+		return nil, err
+	}
+
+	updated, err := update(stored)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = tx.Exec(`UPDATE user_settings SET settings = $2, updated_at = NOW() WHERE user_id = $1`, userID, updated); err != nil {
+		return nil, err
+	}
+	return updated, tx.Commit()
+}
+
+// escapeLike escapes the LIKE wildcards so user input is matched literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
 }
 
-func (r *UserRepository) SearchUsers(query string) ([]User, error) {
-	rows, err := r.DB.Query("SELECT id, username, email, created_at FROM users WHERE username ILIKE $1 OR email ILIKE $1", "%"+query+"%")
+// GetAccountSettings returns the private account state of the user.
+func (r *UserRepository) GetAccountSettings(userID int) (*AccountSettings, error) {
+	var settings AccountSettings
+	err := r.DB.QueryRow(`
+		SELECT u.email_verified, COALESCE(m.enabled, FALSE), u.deletion_scheduled_at
+		FROM users u
+		LEFT JOIN user_mfa m ON m.user_id = u.id
+		WHERE u.id = $1`, userID).Scan(&settings.EmailVerified, &settings.MFAEnabled, &settings.DeletionScheduledAt)
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// ListTeamMemberships returns the teams of the user with their role, by name.
+func (r *UserRepository) ListTeamMemberships(userID int) ([]TeamMembership, error) {
+	rows, err := r.DB.Query(`
+		SELECT t.id, t.name, COALESCE(ut.role, 'member')
+		FROM user_teams ut
+		JOIN teams t ON t.id = ut.team_id
+		WHERE ut.user_id = $1 AND t.deleted_at IS NULL
+		ORDER BY LOWER(t.name), t.id`, userID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var users []User
+	teams := []TeamMembership{}
 	for rows.Next() {
-		var user User
-		if err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt); err != nil {
+		var team TeamMembership
+		if err := rows.Scan(&team.TeamID, &team.Name, &team.Role); err != nil {
 			return nil, err
 		}
-		users = append(users, user)
+		teams = append(teams, team)
+	}
+	return teams, rows.Err()
+}
+
+// ListUnread counts, per channel of the user, the messages from others newer
+// than their last_read mark, including those without an author (user_id NULL).
+// Channels never read count every message.
+func (r *UserRepository) ListUnread(userID int) ([]ChannelUnread, error) {
+	rows, err := r.DB.Query(`
+		SELECT c.id, c.team_id, c.is_dm, COUNT(m.id)
+		FROM channel_users cu
+		JOIN channels c ON c.id = cu.channel_id
+		LEFT JOIN last_read lr ON lr.user_id = cu.user_id AND lr.channel_id = c.id
+		JOIN messages m ON m.channel_id = c.id
+			AND m.id > COALESCE(lr.message_id, 0)
+			AND m.user_id IS DISTINCT FROM cu.user_id
+		WHERE cu.user_id = $1
+		GROUP BY c.id, c.team_id, c.is_dm
+		ORDER BY c.id`, userID)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	return users, nil
+	unread := []ChannelUnread{}
+	for rows.Next() {
+		var u ChannelUnread
+		if err := rows.Scan(&u.ChannelID, &u.TeamID, &u.IsDM, &u.Count); err != nil {
+			return nil, err
+		}
+		unread = append(unread, u)
+	}
+	return unread, rows.Err()
+}
+
+// ListPendingFriendRequests returns the pending requests received by the user.
+func (r *UserRepository) ListPendingFriendRequests(userID int) ([]FriendRequest, error) {
+	rows, err := r.DB.Query(`
+		SELECT `+SummaryColumns("u")+`
+		FROM friends f
+		JOIN users u ON u.id = f.user_id
+		WHERE f.friend_id = $1 AND f.status = 'pending'
+		ORDER BY LOWER(u.username), u.id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []FriendRequest{}
+	for rows.Next() {
+		var req FriendRequest
+		if err := rows.Scan(req.From.ScanDest()...); err != nil {
+			return nil, err
+		}
+		requests = append(requests, req)
+	}
+	return requests, rows.Err()
 }
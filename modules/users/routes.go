@@ -1,21 +1,24 @@
 package users
 
 import (
-	"database/sql"
+	"net/http"
 
 	"toller-server/modules/auth"
 
 	"github.com/gorilla/mux"
 )
 
-func RegisterUserRoutes(router *mux.Router, db *sql.DB) {
-	h := NewUserHandler(db)
-
+func RegisterUserRoutes(router *mux.Router, h *UserHandler, authMiddleware func(http.Handler) http.Handler) {
 	s := router.PathPrefix("/api/v1/").Subrouter()
-	s.Use(auth.JWTMiddleware)
+	s.Use(authMiddleware)
 
-	s.HandleFunc("/users", h.GetAllUsersHandler).Methods("GET")
-	s.HandleFunc("/users/{id:[0-9]+}", h.GetUserByIDHandler).Methods("GET")
-	s.HandleFunc("/users/search", h.SearchUsersHandler).Methods("GET")
-	s.HandleFunc("/users/me/{id:[0-9]+}", h.GetUserMeHandler).Methods("GET")
+	s.HandleFunc("/users", auth.RequireScope(auth.ScopeUsersRead, h.DirectoryHandler)).Methods("GET")
+	s.HandleFunc("/users/{id:[0-9]+}", auth.RequireScope(auth.ScopeUsersRead, h.GetUserByIDHandler)).Methods("GET")
+	s.HandleFunc("/users/search", auth.RequireScope(auth.ScopeUsersRead, h.SearchUsersHandler)).Methods("GET")
+	s.HandleFunc("/users/me", auth.RequireScope(auth.ScopeUsersRead, h.GetUserMeHandler)).Methods("GET")
+	s.HandleFunc("/users/me", auth.RequireScope(auth.ScopeUsersWrite, h.UpdateMeHandler)).Methods("PATCH")
+	s.HandleFunc("/users/me/settings", auth.RequireScope(auth.ScopeUsersRead, h.GetSettingsHandler)).Methods("GET")
+	s.HandleFunc("/users/me/settings", auth.RequireScope(auth.ScopeUsersWrite, h.UpdateSettingsHandler)).Methods("PATCH")
+	s.HandleFunc("/users/me/status", auth.RequireScope(auth.ScopeUsersWrite, h.SetStatusHandler)).Methods("PUT")
+	s.HandleFunc("/users/me/status", auth.RequireScope(auth.ScopeUsersWrite, h.ClearStatusHandler)).Methods("DELETE")
 }
@@ -1,21 +1,325 @@
 package users
 
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	_ "time/tzdata" // validate timezones even on hosts without zoneinfo
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	ErrInvalidProfile = errors.New("invalid profile")
+	ErrInvalidCursor  = errors.New("invalid cursor")
+	ErrQueryTooLong   = errors.New("search query is too long")
+	ErrNotTeamMember  = errors.New("you are not a member of this team")
+	ErrInvalidStatus  = errors.New("invalid status")
+)
+
+const (
+	defaultDirectoryLimit = 20
+	maxDirectoryLimit     = 100
+	maxQueryLength        = 100
+
+	maxStatusEmojiLength = 64
+	maxStatusTextLength  = 100
+	maxStatusDuration    = 365 * 24 * time.Hour
+	statusSweepInterval  = 30 * time.Second
+)
+
+// BCP 47 tags such as "es", "pt-BR" or "zh-Hant-TW"
+var localePattern = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
 type UserService struct {
-	Repo *UserRepository
+	Repo      *UserRepository
+	Publisher StatusPublisher // optional
 }
 
 func NewUserService(repo *UserRepository) *UserService {
 	return &UserService{Repo: repo}
 }
 
-func (s *UserService) GetAllUsers() ([]User, error) {
-	return s.Repo.GetAllUsers()
+// GetUserByID returns the user as seen by viewerID (email only if they are related).
+func (s *UserService) GetUserByID(viewerID, id int) (*User, error) {
+	return s.Repo.GetUserByID(viewerID, id)
+}
+
+// GetMe returns the private bootstrap view of the authenticated user.
+func (s *UserService) GetMe(userID int) (*Me, error) {
+	user, err := s.Repo.GetUserByID(userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	me := &Me{User: *user}
+
+	account, err := s.Repo.GetAccountSettings(userID)
+	if err != nil {
+		return nil, err
+	}
+	me.Account = *account
+
+	settings, err := s.GetSettings(userID)
+	if err != nil {
+		return nil, err
+	}
+	me.Settings = *settings
+
+	if me.Teams, err = s.Repo.ListTeamMemberships(userID); err != nil {
+		return nil, err
+	}
+	if me.Unread, err = s.Repo.ListUnread(userID); err != nil {
+		return nil, err
+	}
+	if me.PendingFriendRequests, err = s.Repo.ListPendingFriendRequests(userID); err != nil {
+		return nil, err
+	}
+	return me, nil
+}
+
+// GetSettings returns the user's settings with the defaults filled in.
+func (s *UserService) GetSettings(userID int) (*Settings, error) {
+	stored, err := s.Repo.GetSettings(userID)
+	if err != nil {
+		return nil, err
+	}
+	return resolveSettings(stored)
+}
+
+// UpdateSettings applies a JSON merge patch: only the keys present change and
+// null resets a key to its default.
+func (s *UserService) UpdateSettings(userID int, patch map[string]interface{}) (*Settings, error) {
+	var settings *Settings
+	_, err := s.Repo.UpdateSettings(userID, func(stored []byte) ([]byte, error) {
+		var current map[string]interface{}
+		if err := json.Unmarshal(stored, &current); err != nil {
+			return nil, err
+		}
+		merged, err := json.Marshal(mergePatch(current, patch))
+		if err != nil {
+			return nil, err
+		}
+		// Validate before saving; an invalid patch leaves the settings untouched
+		if settings, err = resolveSettings(merged); err != nil {
+			return nil, err
+		}
+		return merged, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// Directory returns a page of users, ranked by relevance when there is a query.
+func (s *UserService) Directory(viewerID int, q DirectoryQuery) (*DirectoryPage, error) {
+	q.Query = strings.TrimSpace(q.Query)
+	if utf8.RuneCountInString(q.Query) > maxQueryLength {
+		return nil, ErrQueryTooLong
+	}
+	if q.Limit <= 0 {
+		q.Limit = defaultDirectoryLimit
+	}
+	if q.Limit > maxDirectoryLimit {
+		q.Limit = maxDirectoryLimit
+	}
+
+	var after *directoryKey
+	if q.Cursor != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		after = &directoryKey{}
+		if err := json.Unmarshal(raw, after); err != nil {
+			return nil, ErrInvalidCursor
+		}
+	}
+
+	if q.TeamID != 0 {
+		member, err := s.Repo.IsTeamMember(viewerID, q.TeamID)
+		if err != nil {
+			return nil, err
+		}
+		if !member {
+			return nil, ErrNotTeamMember
+		}
+	}
+
+	users, keys, err := s.Repo.Directory(viewerID, q, after)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &DirectoryPage{Users: users}
+	if len(users) > q.Limit {
+		page.Users = users[:q.Limit]
+		raw, _ := json.Marshal(keys[q.Limit-1])
+		page.NextCursor = base64.RawURLEncoding.EncodeToString(raw)
+	}
+	return page, nil
+}
+
+// UpdateProfile validates and saves the fields present in the update.
+func (s *UserService) UpdateProfile(userID int, update ProfileUpdate) (*User, error) {
+	checks := []struct {
+		field    string
+		value    *string
+		maxRunes int
+		validate func(string) error
+	}{
+		{"display_name", update.DisplayName, 80, nil},
+		{"avatar_url", update.AvatarURL, 500, validateAvatarURL},
+		{"bio", update.Bio, 500, nil},
+		{"pronouns", update.Pronouns, 40, nil},
+		{"timezone", update.Timezone, 64, validateTimezone},
+		{"locale", update.Locale, 16, validateLocale},
+	}
+	for _, c := range checks {
+		if c.value == nil {
+			continue
+		}
+		*c.value = strings.TrimSpace(*c.value)
+		if utf8.RuneCountInString(*c.value) > c.maxRunes {
+			return nil, fmt.Errorf("%w: %s must be at most %d characters", ErrInvalidProfile, c.field, c.maxRunes)
+		}
+		// The bio may span several lines; the other fields are single-line
+		if c.field != "bio" && strings.IndexFunc(*c.value, unicode.IsControl) >= 0 {
+			return nil, fmt.Errorf("%w: %s contains invalid characters", ErrInvalidProfile, c.field)
+		}
+		if *c.value != "" && c.validate != nil {
+			if err := c.validate(*c.value); err != nil {
+				return nil, fmt.Errorf("%w: %s %v", ErrInvalidProfile, c.field, err)
+			}
+		}
+	}
+
+	return s.Repo.UpdateProfile(userID, update)
+}
+
+func validateAvatarURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return errors.New("must be an https URL")
+	}
+	return nil
+}
+
+func validateTimezone(value string) error {
+	if value == "Local" {
+		return errors.New("must be an IANA timezone such as America/Argentina/Buenos_Aires")
+	}
+	if _, err := time.LoadLocation(value); err != nil {
+		return errors.New("must be an IANA timezone such as America/Argentina/Buenos_Aires")
+	}
+	return nil
+}
+
+func validateLocale(value string) error {
+	if !localePattern.MatchString(value) {
+		return errors.New("must be a language tag such as es or pt-BR")
+	}
+	return nil
+}
+
+// SetStatus validates and saves the custom status, then pushes it to the user's audience.
+func (s *UserService) SetStatus(userID int, update StatusUpdate) (*User, error) {
+	emoji, text := strings.TrimSpace(update.Emoji), strings.TrimSpace(update.Text)
+	if emoji == "" && text == "" {
+		return nil, fmt.Errorf("%w: emoji or text is required", ErrInvalidStatus)
+	}
+	if utf8.RuneCountInString(emoji) > maxStatusEmojiLength || strings.IndexFunc(emoji, unicode.IsSpace) >= 0 {
+		return nil, fmt.Errorf("%w: emoji must be a single emoji or :shortcode:", ErrInvalidStatus)
+	}
+	if utf8.RuneCountInString(text) > maxStatusTextLength {
+		return nil, fmt.Errorf("%w: text must be at most %d characters", ErrInvalidStatus, maxStatusTextLength)
+	}
+	if strings.IndexFunc(text, unicode.IsControl) >= 0 {
+		return nil, fmt.Errorf("%w: text contains invalid characters", ErrInvalidStatus)
+	}
+
+	// The expiry is sent as seconds from now so the database clock decides when it is due
+	var ttl *int64
+	var clearAfter time.Duration
+	switch {
+	case update.ClearAfter != "" && update.ExpiresAt != nil:
+		return nil, fmt.Errorf("%w: use either clear_after or expires_at", ErrInvalidStatus)
+	case update.ClearAfter != "":
+		d, err := time.ParseDuration(update.ClearAfter)
+		if err != nil {
+			return nil, fmt.Errorf("%w: clear_after must be a duration such as 30m or 4h", ErrInvalidStatus)
+		}
+		clearAfter = d
+	case update.ExpiresAt != nil:
+		clearAfter = time.Until(*update.ExpiresAt)
+	}
+	if update.ClearAfter != "" || update.ExpiresAt != nil {
+		if clearAfter < time.Minute || clearAfter > maxStatusDuration {
+			return nil, fmt.Errorf("%w: the status must last between a minute and a year", ErrInvalidStatus)
+		}
+		seconds := int64(clearAfter / time.Second)
+		ttl = &seconds
+	}
+
+	user, err := s.Repo.SetStatus(userID, emoji, text, ttl)
+	if err != nil {
+		return nil, err
+	}
+	s.publishStatus(userID, user.Status)
+	return user, nil
+}
+
+// ClearStatus removes the custom status and pushes the change.
+func (s *UserService) ClearStatus(userID int) (*User, error) {
+	user, err := s.Repo.SetStatus(userID, "", "", nil)
+	if err != nil {
+		return nil, err
+	}
+	s.publishStatus(userID, user.Status)
+	return user, nil
+}
+
+// RunStatusExpiry clears the expired statuses every 30 seconds until ctx is cancelled.
+func (s *UserService) RunStatusExpiry(ctx context.Context) {
+	ticker := time.NewTicker(statusSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.ExpireStatuses()
+		}
+	}
 }
 
-func (s *UserService) GetUserByID(id int) (*User, error) {
-	return s.Repo.GetUserByID(id)
+// ExpireStatuses clears the statuses past their expiry and pushes each change.
+func (s *UserService) ExpireStatuses() {
+	ids, err := s.Repo.ExpireStatuses()
+	if err != nil {
+		log.Println("could not expire custom statuses:", err)
+		return
+	}
+	for _, id := range ids {
+		s.publishStatus(id, CustomStatus{})
+	}
 }
 
-func (s *UserService) SearchUsers(query string) ([]User, error) {
-	return s.Repo.SearchUsers(query)
+func (s *UserService) publishStatus(userID int, status CustomStatus) {
+	if s.Publisher == nil {
+		return
+	}
+	audience, err := s.Repo.Audience(userID)
+	if err != nil {
+		log.Printf("could not load the audience of user %d: %v", userID, err)
+		return
+	}
+	s.Publisher.PublishCustomStatus(audience, userID, status)
 }
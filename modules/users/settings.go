@@ -0,0 +1,178 @@
+package users
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Notification levels, from most to least noisy.
+const (
+	NotifyAll      = "all"
+	NotifyMentions = "mentions"
+	NotifyNone     = "none"
+)
+
+// maxNotificationOverrides caps the per-team and per-channel overrides of a user.
+const maxNotificationOverrides = 500
+
+var ErrInvalidSettings = errors.New("invalid settings")
+
+// Settings are the per-user preferences. Only the keys the user changed are
+// stored; DefaultSettings fills in the rest.
+type Settings struct {
+	Theme          string               `json:"theme"`           // system, light or dark
+	MessageDisplay string               `json:"message_display"` // comfortable or compact
+	Notifications  NotificationSettings `json:"notifications"`
+	// While set and in the future, no notifications are sent
+	MuteUntil   *time.Time  `json:"mute_until"`
+	DNDSchedule DNDSchedule `json:"dnd_schedule"`
+}
+
+// NotificationSettings sets the level for everything, per team and per channel.
+// Overrides are keyed by id; a channel override wins over its team's.
+type NotificationSettings struct {
+	Default  string            `json:"default"`
+	Teams    map[string]string `json:"teams"`
+	Channels map[string]string `json:"channels"`
+}
+
+// DNDSchedule silences notifications every day between Start and End ("HH:MM"),
+// in the timezone of the user's profile. End before Start spans midnight.
+type DNDSchedule struct {
+	Enabled bool   `json:"enabled"`
+	Start   string `json:"start"`
+	End     string `json:"end"`
+}
+
+// DefaultSettings returns the settings of a user who never changed anything.
+func DefaultSettings() Settings {
+	return Settings{
+		Theme:          "system",
+		MessageDisplay: "comfortable",
+		Notifications: NotificationSettings{
+			Default:  NotifyAll,
+			Teams:    map[string]string{},
+			Channels: map[string]string{},
+		},
+		DNDSchedule: DNDSchedule{Start: "22:00", End: "08:00"},
+	}
+}
+
+// resolveSettings applies the stored keys on top of the defaults and rejects
+// unknown keys and invalid values.
+func resolveSettings(stored []byte) (*Settings, error) {
+	settings := DefaultSettings()
+	dec := json.NewDecoder(bytes.NewReader(stored))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&settings); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSettings, err)
+	}
+	if err := settings.validate(); err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+func (s *Settings) validate() error {
+	oneOf := func(field, value string, allowed ...string) error {
+		for _, a := range allowed {
+			if value == a {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: %s must be one of %v", ErrInvalidSettings, field, allowed)
+	}
+
+	if err := oneOf("theme", s.Theme, "system", "light", "dark"); err != nil {
+		return err
+	}
+	if err := oneOf("message_display", s.MessageDisplay, "comfortable", "compact"); err != nil {
+		return err
+	}
+	levels := []string{NotifyAll, NotifyMentions, NotifyNone}
+	if err := oneOf("notifications.default", s.Notifications.Default, levels...); err != nil {
+		return err
+	}
+	for field, overrides := range map[string]map[string]string{
+		"notifications.teams":    s.Notifications.Teams,
+		"notifications.channels": s.Notifications.Channels,
+	} {
+		if len(overrides) > maxNotificationOverrides {
+			return fmt.Errorf("%w: %s can have at most %d entries", ErrInvalidSettings, field, maxNotificationOverrides)
+		}
+		for id, level := range overrides {
+			if n, err := strconv.Atoi(id); err != nil || n <= 0 || strconv.Itoa(n) != id {
+				return fmt.Errorf("%w: %s keys must be ids, got %q", ErrInvalidSettings, field, id)
+			}
+			if err := oneOf(field+"."+id, level, levels...); err != nil {
+				return err
+			}
+		}
+	}
+	for field, value := range map[string]string{"dnd_schedule.start": s.DNDSchedule.Start, "dnd_schedule.end": s.DNDSchedule.End} {
+		if _, err := time.Parse("15:04", value); err != nil {
+			return fmt.Errorf("%w: %s must be a time such as 22:00", ErrInvalidSettings, field)
+		}
+	}
+	return nil
+}
+
+// NotificationLevel is the level that applies to a channel (teamID 0 for DMs):
+// the channel override, else the team override, else the default. Muting wins.
+func (s *Settings) NotificationLevel(teamID, channelID int, now time.Time) string {
+	if s.MuteUntil != nil && now.Before(*s.MuteUntil) {
+		return NotifyNone
+	}
+	if level, ok := s.Notifications.Channels[strconv.Itoa(channelID)]; ok {
+		return level
+	}
+	if level, ok := s.Notifications.Teams[strconv.Itoa(teamID)]; ok && teamID != 0 {
+		return level
+	}
+	return s.Notifications.Default
+}
+
+// InDND reports whether now falls in the DND schedule, read in loc.
+func (s *Settings) InDND(now time.Time, loc *time.Location) bool {
+	if !s.DNDSchedule.Enabled {
+		return false
+	}
+	start, err1 := time.Parse("15:04", s.DNDSchedule.Start)
+	end, err2 := time.Parse("15:04", s.DNDSchedule.End)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	local := now.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	from, to := start.Hour()*60+start.Minute(), end.Hour()*60+end.Minute()
+	if from <= to {
+		return minute >= from && minute < to
+	}
+	// Spans midnight, e.g. 22:00 to 08:00
+	return minute >= from || minute < to
+}
+
+// mergePatch applies an RFC 7386 JSON merge patch: objects are merged
+// recursively and null removes the key (so it falls back to the default).
+func mergePatch(target, patch map[string]interface{}) map[string]interface{} {
+	if target == nil {
+		target = map[string]interface{}{}
+	}
+	for key, value := range patch {
+		if value == nil {
+			delete(target, key)
+			continue
+		}
+		if patchObj, ok := value.(map[string]interface{}); ok {
+			targetObj, _ := target[key].(map[string]interface{})
+			target[key] = mergePatch(targetObj, patchObj)
+			continue
+		}
+		target[key] = value
+	}
+	return target
+}
@@ -0,0 +1,113 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"mime"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message es un email de texto plano.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer abstrae el envío de emails para que auth y otros módulos no dependan del transporte.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// FromEnv elige la implementación según MAIL_DRIVER:
+//   - "smtp": usa SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD y MAIL_FROM
+//   - cualquier otro valor (por defecto): outbox local en MAIL_OUTBOX_DIR, o solo log si no está definido
+func FromEnv() Mailer {
+	if os.Getenv("MAIL_DRIVER") == "smtp" {
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		return &SMTPMailer{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("MAIL_FROM"),
+		}
+	}
+	return &OutboxMailer{Dir: os.Getenv("MAIL_OUTBOX_DIR")}
+}
+
+// SMTPMailer envía los emails a través de un servidor SMTP con autenticación PLAIN.
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	return smtp.SendMail(m.Host+":"+m.Port, auth, m.From, []string{msg.To}, format(m.From, msg))
+}
+
+// OutboxMailer no envía nada: escribe cada email como archivo .eml en Dir
+// (útil en desarrollo y tests) o solo lo loguea si Dir está vacío.
+type OutboxMailer struct {
+	Dir string
+	mu  sync.Mutex
+	seq int
+}
+
+func (m *OutboxMailer) Send(msg Message) error {
+	if m.Dir == "" {
+		log.Printf("[MAILER] Para: %s | Asunto: %s\n%s", msg.To, msg.Subject, msg.Body)
+		return nil
+	}
+
+	m.mu.Lock()
+	m.seq++
+	name := fmt.Sprintf("%d_%03d_%s.eml", time.Now().UnixNano(), m.seq, sanitize(msg.To))
+	m.mu.Unlock()
+
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(m.Dir, name), format("outbox@localhost", msg), 0o644)
+}
+
+// format arma el mensaje. Los encabezados no admiten saltos de línea (así un valor
+// no puede agregar otros encabezados) y el asunto va codificado si no es ASCII.
+func format(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", headerValue(from))
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", headerValue(msg.Subject)))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(msg.Body)
+	return []byte(b.String())
+}
+
+func headerValue(v string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(v)
+}
+
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '@' || r == '.' || r == '-' || r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, s)
+}
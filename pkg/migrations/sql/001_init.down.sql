@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS last_read;
+DROP TABLE IF EXISTS friends;
+DROP TABLE IF EXISTS messages;
+DROP TABLE IF EXISTS channel_users;
+DROP TABLE IF EXISTS channels;
+DROP TABLE IF EXISTS user_teams;
+DROP TABLE IF EXISTS teams;
+DROP TABLE IF EXISTS users;
@@ -1,5 +1,8 @@
+-- Primera migración: esquema inicial.
+-- Usa IF NOT EXISTS para poder adoptar bases creadas a mano con el antiguo pkg/config/001_init.sql.
+
 -- Users
-CREATE TABLE users (
+CREATE TABLE IF NOT EXISTS users (
     id SERIAL PRIMARY KEY,
     username VARCHAR(50) UNIQUE NOT NULL,
     email VARCHAR(100) UNIQUE NOT NULL,
@@ -8,7 +11,7 @@ CREATE TABLE users (
 );
 
 -- Teams
-CREATE TABLE teams (
+CREATE TABLE IF NOT EXISTS teams (
     id SERIAL PRIMARY KEY,
     name VARCHAR(100) NOT NULL,
     description TEXT,
@@ -16,7 +19,7 @@ CREATE TABLE teams (
 );
 
 -- Relación usuarios ↔ teams (muchos a muchos)
-CREATE TABLE user_teams (
+CREATE TABLE IF NOT EXISTS user_teams (
     user_id INT REFERENCES users(id) ON DELETE CASCADE,
     team_id INT REFERENCES teams(id) ON DELETE CASCADE,
     role VARCHAR(20) DEFAULT 'member', -- admin / member
@@ -24,7 +27,7 @@ CREATE TABLE user_teams (
 );
 
 -- Channels
-CREATE TABLE channels (
+CREATE TABLE IF NOT EXISTS channels (
     id SERIAL PRIMARY KEY,
     name VARCHAR(100) NOT NULL,
     team_id INT REFERENCES teams(id) ON DELETE CASCADE, -- Nulable para DMs
@@ -33,7 +36,7 @@ CREATE TABLE channels (
 );
 
 -- Relación usuarios ↔ canales (muchos a muchos con rol)
-CREATE TABLE channel_users (
+CREATE TABLE IF NOT EXISTS channel_users (
     user_id INT REFERENCES users(id) ON DELETE CASCADE,
     channel_id INT REFERENCES channels(id) ON DELETE CASCADE,
     role VARCHAR(20) DEFAULT 'user', -- admin / user
@@ -41,7 +44,7 @@ CREATE TABLE channel_users (
 );
 
 -- Messages
-CREATE TABLE messages (
+CREATE TABLE IF NOT EXISTS messages (
     id SERIAL PRIMARY KEY,
     channel_id INT REFERENCES channels(id) ON DELETE CASCADE,
     user_id INT REFERENCES users(id) ON DELETE CASCADE,
@@ -50,7 +53,7 @@ CREATE TABLE messages (
 );
 
 -- Amistades entre usuarios
-CREATE TABLE friends (
+CREATE TABLE IF NOT EXISTS friends (
     user_id INT REFERENCES users(id) ON DELETE CASCADE,
     friend_id INT REFERENCES users(id) ON DELETE CASCADE,
     status VARCHAR(20) DEFAULT 'pending', -- pending, accepted, blocked
@@ -58,7 +61,7 @@ CREATE TABLE friends (
 );
 
 -- Last Read
-CREATE TABLE last_read (
+CREATE TABLE IF NOT EXISTS last_read (
     user_id INT REFERENCES users(id) ON DELETE CASCADE,
     channel_id INT REFERENCES channels(id) ON DELETE CASCADE,
     message_id INT REFERENCES messages(id) ON DELETE CASCADE,
@@ -0,0 +1,4 @@
+-- Datos del dispositivo de cada sesión para poder listarlas y revocarlas
+ALTER TABLE sessions ADD COLUMN user_agent TEXT;
+ALTER TABLE sessions ADD COLUMN ip_address VARCHAR(45);
+ALTER TABLE sessions ADD COLUMN last_seen_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
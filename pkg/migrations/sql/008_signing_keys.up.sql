@@ -0,0 +1,9 @@
+-- Claves asimétricas para firmar los JWT (key ring con rotación)
+CREATE TABLE signing_keys (
+    kid VARCHAR(64) PRIMARY KEY,
+    algorithm VARCHAR(10) NOT NULL, -- RS256 / EdDSA
+    private_key TEXT NOT NULL,      -- PKCS#8 en PEM
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    activates_at TIMESTAMP NOT NULL, -- desde cuándo firma; antes solo se publica en el JWKS
+    expires_at TIMESTAMP             -- hasta cuándo se aceptan tokens firmados con ella
+);
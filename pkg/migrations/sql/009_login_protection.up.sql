@@ -0,0 +1,27 @@
+-- Intentos de login, para limitar la fuerza bruta por cuenta y por IP
+CREATE TABLE login_attempts (
+    id SERIAL PRIMARY KEY,
+    email VARCHAR(100) NOT NULL, -- normalizado; se registra aunque la cuenta no exista
+    ip_address VARCHAR(45),
+    success BOOLEAN NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_login_attempts_email ON login_attempts(email, created_at);
+CREATE INDEX idx_login_attempts_ip ON login_attempts(ip_address, created_at);
+
+-- Bloqueos temporales; quedan como registro visible para los admins
+CREATE TABLE account_lockouts (
+    id SERIAL PRIMARY KEY,
+    scope VARCHAR(10) NOT NULL, -- account / ip
+    email VARCHAR(100),
+    user_id INT REFERENCES users(id) ON DELETE SET NULL,
+    ip_address VARCHAR(45),
+    failed_attempts INT NOT NULL,
+    locked_until TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_account_lockouts_email ON account_lockouts(email, locked_until);
+CREATE INDEX idx_account_lockouts_ip ON account_lockouts(ip_address, locked_until);
+CREATE INDEX idx_account_lockouts_user_id ON account_lockouts(user_id);
@@ -0,0 +1,24 @@
+-- Cuentas de bot: pertenecen a una persona o a un team
+ALTER TABLE users ADD COLUMN is_bot BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN bot_owner_id INT REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE users ADD COLUMN bot_team_id INT REFERENCES teams(id) ON DELETE CASCADE;
+
+CREATE INDEX idx_users_bot_owner_id ON users(bot_owner_id) WHERE is_bot;
+CREATE INDEX idx_users_bot_team_id ON users(bot_team_id) WHERE is_bot;
+
+-- Tokens personales de larga duración (para CI, bots, scripts)
+CREATE TABLE personal_access_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_by INT REFERENCES users(id) ON DELETE SET NULL, -- quien lo emitió (el dueño, si es de un bot)
+    name VARCHAR(100) NOT NULL,
+    token_prefix VARCHAR(16) NOT NULL, -- primeros caracteres, para reconocerlo en listados
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    scopes TEXT[] NOT NULL,
+    expires_at TIMESTAMP,
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_personal_access_tokens_user_id ON personal_access_tokens(user_id);
@@ -0,0 +1,8 @@
+-- Perfil público del usuario; vacío significa "sin completar"
+ALTER TABLE users ADD COLUMN display_name VARCHAR(80) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN avatar_url VARCHAR(500) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN bio VARCHAR(500) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN pronouns VARCHAR(40) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN timezone VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN locale VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN profile_updated_at TIMESTAMP;
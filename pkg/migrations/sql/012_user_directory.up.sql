@@ -0,0 +1,7 @@
+-- Búsqueda por similitud (trigramas) en el directorio de usuarios
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX idx_users_username_trgm ON users USING GIN (LOWER(username) gin_trgm_ops);
+CREATE INDEX idx_users_display_name_trgm ON users USING GIN (LOWER(display_name) gin_trgm_ops);
+-- Orden por defecto del directorio (paginación por cursor)
+CREATE INDEX idx_users_lower_username_id ON users (LOWER(username), id);
@@ -0,0 +1,3 @@
+-- Modo de presencia elegido por el usuario; la conexión en sí vive en memoria
+ALTER TABLE users ADD COLUMN presence_mode VARCHAR(20) NOT NULL DEFAULT 'auto'
+    CHECK (presence_mode IN ('auto', 'dnd', 'invisible'));
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_users_status_expires_at;
+ALTER TABLE users DROP COLUMN IF EXISTS status_expires_at;
+ALTER TABLE users DROP COLUMN IF EXISTS status_text;
+ALTER TABLE users DROP COLUMN IF EXISTS status_emoji;
@@ -0,0 +1,7 @@
+-- Estado personalizado (emoji + texto) con vencimiento opcional
+ALTER TABLE users ADD COLUMN status_emoji VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN status_text VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN status_expires_at TIMESTAMP;
+
+-- El barrido de vencidos solo mira los estados con vencimiento
+CREATE INDEX idx_users_status_expires_at ON users(status_expires_at) WHERE status_expires_at IS NOT NULL;
@@ -0,0 +1,7 @@
+-- Preferencias por usuario. Solo se guardan los valores que el usuario cambió;
+-- los defaults viven en el código (modules/users/settings.go)
+CREATE TABLE user_settings (
+    user_id INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    settings JSONB NOT NULL DEFAULT '{}',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,18 @@
+-- Invitaciones a teams: links compartibles (con límite de usos y vencimiento)
+-- o dirigidas a un email, que se reclaman al registrarse con esa dirección
+CREATE TABLE team_invites (
+    id SERIAL PRIMARY KEY,
+    team_id INT NOT NULL REFERENCES teams(id) ON DELETE CASCADE,
+    code VARCHAR(32) UNIQUE NOT NULL,
+    email VARCHAR(100), -- normalizado en minúsculas; NULL para los links
+    role VARCHAR(20) NOT NULL DEFAULT 'member',
+    max_uses INT NOT NULL DEFAULT 0, -- 0 = sin límite
+    uses INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP,
+    created_by INT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    revoked_at TIMESTAMP
+);
+
+CREATE INDEX idx_team_invites_team_id ON team_invites(team_id);
+CREATE INDEX idx_team_invites_email ON team_invites(email) WHERE email IS NOT NULL AND revoked_at IS NULL;
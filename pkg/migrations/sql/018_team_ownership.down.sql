@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_teams_purge_at;
+DROP INDEX IF EXISTS idx_teams_owner_id;
+ALTER TABLE teams DROP COLUMN IF EXISTS purge_at;
+ALTER TABLE teams DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE teams DROP COLUMN IF EXISTS owner_id;
@@ -0,0 +1,17 @@
+-- Dueño del team, distinto de los admins: solo él puede borrarlo o transferirlo
+ALTER TABLE teams ADD COLUMN owner_id INT REFERENCES users(id) ON DELETE SET NULL;
+
+-- Borrado con período de gracia: el team queda oculto y se puede restaurar hasta purge_at
+ALTER TABLE teams ADD COLUMN deleted_at TIMESTAMP;
+ALTER TABLE teams ADD COLUMN purge_at TIMESTAMP;
+
+-- Los teams existentes quedan a nombre de su primer admin
+UPDATE teams t SET owner_id = (
+    SELECT ut.user_id FROM user_teams ut
+    WHERE ut.team_id = t.id AND ut.role = 'admin'
+    ORDER BY ut.user_id
+    LIMIT 1
+);
+
+CREATE INDEX idx_teams_owner_id ON teams(owner_id);
+CREATE INDEX idx_teams_purge_at ON teams(purge_at) WHERE purge_at IS NOT NULL;
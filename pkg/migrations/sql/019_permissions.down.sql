@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS channel_permission_overrides;
+DROP TABLE IF EXISTS team_member_roles;
+DROP TABLE IF EXISTS team_roles;
@@ -0,0 +1,36 @@
+-- Roles personalizados por team: un conjunto de permisos con nombre que se suma
+-- al rol base del miembro (admin / member)
+CREATE TABLE team_roles (
+    id SERIAL PRIMARY KEY,
+    team_id INT NOT NULL REFERENCES teams(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    permissions TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_team_roles_team_name ON team_roles(team_id, LOWER(name));
+
+-- Roles asignados a cada miembro; se borran solos cuando el miembro sale del team
+CREATE TABLE team_member_roles (
+    user_id INT NOT NULL,
+    team_id INT NOT NULL,
+    role_id INT NOT NULL REFERENCES team_roles(id) ON DELETE CASCADE,
+    PRIMARY KEY (user_id, team_id, role_id),
+    FOREIGN KEY (user_id, team_id) REFERENCES user_teams(user_id, team_id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_team_member_roles_role_id ON team_member_roles(role_id);
+
+-- Overrides por canal: sin role_id ni user_id aplican a todos los miembros del team
+CREATE TABLE channel_permission_overrides (
+    id SERIAL PRIMARY KEY,
+    channel_id INT NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+    role_id INT REFERENCES team_roles(id) ON DELETE CASCADE,
+    user_id INT REFERENCES users(id) ON DELETE CASCADE,
+    allow TEXT[] NOT NULL DEFAULT '{}',
+    deny TEXT[] NOT NULL DEFAULT '{}',
+    CHECK (role_id IS NULL OR user_id IS NULL)
+);
+
+CREATE UNIQUE INDEX idx_channel_overrides_target
+    ON channel_permission_overrides(channel_id, COALESCE(role_id, 0), COALESCE(user_id, 0));
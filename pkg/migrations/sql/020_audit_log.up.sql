@@ -0,0 +1,30 @@
+-- Registro de auditoría de los teams: quién hizo qué, sobre qué, con qué cambios
+-- y desde dónde. Solo se agregan filas: un trigger rechaza UPDATE y DELETE
+CREATE TABLE audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    team_id INT NOT NULL, -- sin FK: el historial sobrevive a la purga del team
+    actor_id INT, -- NULL para las acciones del sistema
+    action VARCHAR(50) NOT NULL,
+    target_type VARCHAR(20) NOT NULL,
+    target_id INT,
+    changes JSONB NOT NULL DEFAULT '{}',
+    ip_address VARCHAR(45),
+    user_agent TEXT,
+    session_id INT,
+    token_id INT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_audit_log_team_id ON audit_log(team_id, id DESC);
+CREATE INDEX idx_audit_log_team_action ON audit_log(team_id, action, id DESC);
+CREATE INDEX idx_audit_log_team_actor ON audit_log(team_id, actor_id, id DESC);
+
+CREATE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log es append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE PROCEDURE audit_log_append_only();
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS team_join_requests;
+DROP INDEX IF EXISTS idx_teams_name_trgm;
+ALTER TABLE teams DROP COLUMN IF EXISTS visibility;
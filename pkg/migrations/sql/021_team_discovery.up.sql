@@ -0,0 +1,25 @@
+-- Visibilidad de los teams: private (solo por invitación), discoverable (aparece
+-- en el directorio y se pide unirse) u open (aparece y se entra directamente)
+ALTER TABLE teams ADD COLUMN visibility VARCHAR(20) NOT NULL DEFAULT 'private'
+    CHECK (visibility IN ('private', 'discoverable', 'open'));
+
+-- Búsqueda en el directorio de teams (pg_trgm viene de 012_user_directory)
+CREATE INDEX idx_teams_name_trgm ON teams USING GIN (LOWER(name) gin_trgm_ops)
+    WHERE visibility <> 'private' AND deleted_at IS NULL;
+
+-- Solicitudes para unirse a un team discoverable, que aprueba o rechaza quien
+-- gestiona los miembros
+CREATE TABLE team_join_requests (
+    id SERIAL PRIMARY KEY,
+    team_id INT NOT NULL REFERENCES teams(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    message TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected', 'cancelled')),
+    reviewed_by INT REFERENCES users(id) ON DELETE SET NULL,
+    reviewed_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Una sola solicitud pendiente por usuario y team
+CREATE UNIQUE INDEX idx_team_join_requests_pending ON team_join_requests(team_id, user_id) WHERE status = 'pending';
+CREATE INDEX idx_team_join_requests_user_id ON team_join_requests(user_id);
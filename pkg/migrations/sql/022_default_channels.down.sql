@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_channels_team_default;
+ALTER TABLE channels DROP COLUMN IF EXISTS is_default;
@@ -0,0 +1,5 @@
+-- Canales por defecto: todo miembro nuevo del team entra a ellos automáticamente
+-- (por ejemplo #general, que se crea junto con el team)
+ALTER TABLE channels ADD COLUMN is_default BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX idx_channels_team_default ON channels(team_id) WHERE is_default;
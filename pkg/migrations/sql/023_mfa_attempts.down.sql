@@ -0,0 +1,2 @@
+DELETE FROM account_lockouts WHERE scope = 'mfa';
+DROP TABLE IF EXISTS mfa_attempts;
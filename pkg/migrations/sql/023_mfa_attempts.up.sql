@@ -0,0 +1,11 @@
+-- Intentos de segundo factor (TOTP o código de recuperación), para limitar la
+-- fuerza bruta sobre el 2FA igual que sobre la contraseña. Los bloqueos van a
+-- account_lockouts con scope = 'mfa'.
+CREATE TABLE mfa_attempts (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    success BOOLEAN NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_mfa_attempts_user_id ON mfa_attempts(user_id, created_at);
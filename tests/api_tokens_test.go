@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPersonalTokensAndBots valida la emisión, los scopes y la revocación de
+// tokens personales, y que un bot de team pueda usar la API con su token.
+func TestPersonalTokensAndBots(t *testing.T) {
+	server, _ := setupTestServer(t)
+	_, sessionToken := registerAndLogin(t, server.URL, "pat_owner", "pat_owner@test.com", "password123")
+
+	type patResponse struct {
+		ID     int      `json:"id"`
+		Prefix string   `json:"prefix"`
+		Token  string   `json:"token"`
+		Scopes []string `json:"scopes"`
+	}
+	createToken := func(payload map[string]interface{}) patResponse {
+		resp := doJSON(t, server.URL, "POST", "/api/v1/auth/tokens", sessionToken, payload)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		var pat patResponse
+		json.NewDecoder(resp.Body).Decode(&pat)
+		return pat
+	}
+
+	// 1. Crear un token de solo lectura de teams: el valor se devuelve una única vez
+	pat := createToken(map[string]interface{}{"name": "CI", "scopes": []string{"teams:read"}, "expires_in_days": 30})
+	assert.True(t, strings.HasPrefix(pat.Token, "tpat_"))
+	assert.True(t, strings.HasPrefix(pat.Token, pat.Prefix))
+
+	resp := doJSON(t, server.URL, "GET", "/api/v1/auth/tokens", sessionToken, nil)
+	var listed []patResponse
+	json.NewDecoder(resp.Body).Decode(&listed)
+	resp.Body.Close()
+	if assert.Len(t, listed, 1) {
+		assert.Equal(t, pat.Prefix, listed[0].Prefix)
+		assert.Empty(t, listed[0].Token, "el listado no debe exponer el token")
+	}
+
+	// Scopes desconocidos se rechazan
+	assert.Equal(t, http.StatusBadRequest,
+		statusOf(t, server.URL, "POST", "/api/v1/auth/tokens", sessionToken, map[string]interface{}{"name": "x", "scopes": []string{"admin"}}))
+
+	// 2. El token vale en las rutas de su scope y no en las demás
+	assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "GET", "/api/v1/teams", pat.Token, nil))
+	assert.Equal(t, http.StatusForbidden, statusOf(t, server.URL, "POST", "/api/v1/teams", pat.Token, map[string]string{"name": "Nope"}))
+	assert.Equal(t, http.StatusForbidden, statusOf(t, server.URL, "GET", "/api/v1/friends", pat.Token, nil))
+
+	// Ni puede gestionar la cuenta ni emitir otros tokens
+	assert.Equal(t, http.StatusForbidden, statusOf(t, server.URL, "GET", "/api/v1/auth/sessions", pat.Token, nil))
+	assert.Equal(t, http.StatusForbidden,
+		statusOf(t, server.URL, "POST", "/api/v1/auth/tokens", pat.Token, map[string]interface{}{"name": "x", "scopes": []string{"teams:read"}}))
+
+	// El WebSocket exige messages:read
+	assert.Equal(t, http.StatusForbidden, statusOf(t, server.URL, "GET", "/ws/channel/1?token="+pat.Token, "", nil))
+
+	// 3. Revocado, deja de valer en la próxima request
+	assert.Equal(t, http.StatusNoContent, statusOf(t, server.URL, "DELETE", fmt.Sprintf("/api/v1/auth/tokens/%d", pat.ID), sessionToken, nil))
+	assert.Equal(t, http.StatusUnauthorized, statusOf(t, server.URL, "GET", "/api/v1/teams", pat.Token, nil))
+
+	// 4. Un bot del team, administrado por el admin, crea canales con su token
+	resp = doJSON(t, server.URL, "POST", "/api/v1/teams", sessionToken, map[string]string{"name": "Bots Team"})
+	var created struct {
+		Team struct {
+			ID int `json:"id"`
+		} `json:"team"`
+	}
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+
+	resp = doJSON(t, server.URL, "POST", "/api/v1/auth/bots", sessionToken, map[string]interface{}{"username": "deploy-bot", "team_id": created.Team.ID})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	var bot struct {
+		ID     int  `json:"id"`
+		TeamID *int `json:"team_id"`
+	}
+	json.NewDecoder(resp.Body).Decode(&bot)
+	resp.Body.Close()
+	if assert.NotNil(t, bot.TeamID) {
+		assert.Equal(t, created.Team.ID, *bot.TeamID)
+	}
+
+	// El bot necesita ser miembro del team para operar en él
+	assert.Equal(t, http.StatusOK,
+		statusOf(t, server.URL, "POST", fmt.Sprintf("/api/v1/teams/%d/members", created.Team.ID), sessionToken, map[string]int{"user_id": bot.ID}))
+
+	botToken := createToken(map[string]interface{}{
+		"name": "deploy", "bot_id": bot.ID, "scopes": []string{"channels:read", "channels:write"},
+	})
+	assert.Equal(t, http.StatusCreated,
+		statusOf(t, server.URL, "POST", fmt.Sprintf("/api/v1/teams/%d/channels", created.Team.ID), botToken.Token, map[string]string{"name": "deploys"}))
+
+	// Borrar el bot invalida sus tokens
+	assert.Equal(t, http.StatusNoContent, statusOf(t, server.URL, "DELETE", fmt.Sprintf("/api/v1/auth/bots/%d", bot.ID), sessionToken, nil))
+	assert.Equal(t, http.StatusUnauthorized,
+		statusOf(t, server.URL, "GET", fmt.Sprintf("/api/v1/teams/%d/channels", created.Team.ID), botToken.Token, nil))
+}
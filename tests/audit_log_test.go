@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"toller-server/modules/audit"
+	"toller-server/modules/permissions"
+	"toller-server/modules/teams"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestAuditLog valida que los cambios de un team queden registrados con su
+// autor y su diff, los filtros, la paginación y quién puede leer el registro.
+func TestAuditLog(t *testing.T) {
+	server, db := setupTestServer(t)
+
+	aliceID, aliceToken := registerAndLogin(t, server.URL, "alice_audit", "alice_audit@test.com", "password123")
+	bobID, bobToken := registerAndLogin(t, server.URL, "bob_audit", "bob_audit@test.com", "password123")
+
+	auditPage := func(query string) audit.Page {
+		resp := doJSON(t, server.URL, "GET", query, aliceToken, nil)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var page audit.Page
+		json.NewDecoder(resp.Body).Decode(&page)
+		return page
+	}
+	actions := func(entries []audit.Entry) []string {
+		list := []string{}
+		for _, e := range entries {
+			list = append(list, e.Action)
+		}
+		return list
+	}
+
+	resp := doJSON(t, server.URL, "POST", "/api/v1/teams", aliceToken, map[string]string{"name": "Audit Team"})
+	var created struct {
+		Team teams.Team `json:"team"`
+	}
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	base := fmt.Sprintf("/api/v1/teams/%d", created.Team.ID)
+
+	// 1. Cambios de miembros, del team, de canales y de roles
+	assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "POST", base+"/members", aliceToken, map[string]int{"user_id": bobID}))
+	// Con un User-Agent propio para verificar la metadata de la entrada, y un
+	// X-Forwarded-For falso y largo que no debe impedir el registro
+	req := jsonRequest(server.URL, "PUT", base, aliceToken, map[string]string{"name": "Audit Team 2"})
+	req.Header.Set("User-Agent", "audit-test")
+	req.Header.Set("X-Forwarded-For", strings.Repeat("spoofed-", 10))
+	resp = send(t, req)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, statusOf(t, server.URL, "POST", base+"/channels", aliceToken, map[string]string{"name": "random"}))
+	resp = doJSON(t, server.URL, "POST", base+"/roles", aliceToken, map[string]interface{}{"name": "Auditor", "permissions": []string{"view_audit_log"}})
+	var auditor permissions.Role
+	json.NewDecoder(resp.Body).Decode(&auditor)
+	resp.Body.Close()
+
+	page := auditPage(base + "/audit")
+	// El #general se crea junto con el team
+	assert.Equal(t, []string{"role.create", "channel.create", "team.update", "member.add", "channel.create", "team.create"},
+		actions(page.Entries))
+	if assert.Len(t, page.Entries, 6) {
+		update := page.Entries[2]
+		assert.Equal(t, aliceID, update.ActorID)
+		if assert.NotNil(t, update.Actor) {
+			assert.Equal(t, "alice_audit", update.Actor.Username)
+		}
+		assert.Equal(t, audit.Change{Before: "Audit Team", After: "Audit Team 2"}, update.Changes["name"])
+		assert.Equal(t, "audit-test", update.Meta.UserAgent)
+		assert.NotZero(t, update.Meta.SessionID)
+		assert.Equal(t, "127.0.0.1", update.Meta.IPAddress)
+
+		assert.Equal(t, "member", page.Entries[3].Changes["role"].After)
+		assert.Equal(t, bobID, page.Entries[3].TargetID)
+	}
+
+	// Actualizar sin cambios no deja entrada
+	statusOf(t, server.URL, "PUT", base, aliceToken, map[string]string{"name": "Audit Team 2"})
+	assert.Len(t, auditPage(base+"/audit").Entries, 6)
+
+	// 2. Filtros por acción, autor y objetivo
+	assert.Equal(t, []string{"team.update", "team.create"}, actions(auditPage(base+"/audit?action=team.create,team.update").Entries))
+	assert.Empty(t, auditPage(fmt.Sprintf("%s/audit?actor_id=%d", base, bobID)).Entries)
+	assert.Equal(t, []string{"member.add"}, actions(auditPage(fmt.Sprintf("%s/audit?target_type=user&target_id=%d", base, bobID)).Entries))
+	assert.Equal(t, http.StatusBadRequest, statusOf(t, server.URL, "GET", base+"/audit?since=ayer", aliceToken, nil))
+	assert.Equal(t, http.StatusBadRequest, statusOf(t, server.URL, "GET", base+"/audit?cursor=basura", aliceToken, nil))
+
+	// 3. Paginación con cursor
+	first := auditPage(base + "/audit?limit=2")
+	assert.Equal(t, []string{"role.create", "channel.create"}, actions(first.Entries))
+	assert.NotEmpty(t, first.NextCursor)
+	second := auditPage(base + "/audit?limit=2&cursor=" + first.NextCursor)
+	assert.Equal(t, []string{"team.update", "member.add"}, actions(second.Entries))
+	last := auditPage(base + "/audit?limit=2&cursor=" + second.NextCursor)
+	assert.Equal(t, []string{"channel.create", "team.create"}, actions(last.Entries))
+	assert.Empty(t, last.NextCursor)
+
+	// 4. Solo con view_audit_log se puede leer
+	assert.Equal(t, http.StatusForbidden, statusOf(t, server.URL, "GET", base+"/audit", bobToken, nil))
+	assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "PUT", fmt.Sprintf("%s/members/%d/roles", base, bobID), aliceToken,
+		map[string][]int{"role_ids": {auditor.ID}}))
+	assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "GET", base+"/audit", bobToken, nil))
+	assert.Equal(t, []string{"member.roles_update"}, actions(auditPage(base+"/audit?limit=1").Entries))
+
+	// Sacar a alguien que no es miembro falla y no queda registrado
+	carolID, _ := registerAndLogin(t, server.URL, "carol_audit", "carol_audit@test.com", "password123")
+	assert.Equal(t, http.StatusForbidden, statusOf(t, server.URL, "DELETE", fmt.Sprintf("%s/members/%d", base, carolID), aliceToken, nil))
+	assert.Equal(t, []string{"member.roles_update"}, actions(auditPage(base+"/audit?limit=1").Entries))
+
+	// 5. El registro es de solo agregado
+	_, err := db.Exec("UPDATE audit_log SET action = 'team.delete'")
+	assert.Error(t, err)
+	_, err = db.Exec("DELETE FROM audit_log")
+	assert.Error(t, err)
+}
@@ -98,12 +98,20 @@ func TestWebSocketBroadcast(t *testing.T) {
 	msgChan := make(chan []byte, 1)
 	go func() {
 		defer close(msgChan)
-		// El historial de mensajes está vacío, así que el primer mensaje debe ser el de broadcast
-		_, msg, err := mariaConn.ReadMessage()
-		if err != nil {
-			return // El test principal detectará el timeout
+		// El historial de mensajes está vacío, así que el primer mensaje (salteando
+		// los eventos de presencia) debe ser el de broadcast
+		for {
+			_, msg, err := mariaConn.ReadMessage()
+			if err != nil {
+				return // El test principal detectará el timeout
+			}
+			var out chat.OutgoingMessage
+			if json.Unmarshal(msg, &out) == nil && out.Type == "presence" {
+				continue
+			}
+			msgChan <- msg
+			return
 		}
-		msgChan <- msg
 	}()
 
 	// Conectar a Fran (remitente)
@@ -135,3 +143,52 @@ func TestWebSocketBroadcast(t *testing.T) {
 		t.Fatal("Timeout: Maria no recibió el mensaje de broadcast a tiempo.")
 	}
 }
+
+// TestWebSocketRejectsNonMembers valida que solo se conecten al canal sus
+// miembros, y que al resto se lo rechace antes del upgrade.
+func TestWebSocketRejectsNonMembers(t *testing.T) {
+	server, _ := setupTestServer(t)
+
+	_, aliceToken := registerAndLogin(t, server.URL, "alice_ws", "alice_ws@test.com", "password123")
+	bobID, bobToken := registerAndLogin(t, server.URL, "bob_ws", "bob_ws@test.com", "password123")
+
+	resp := doJSON(t, server.URL, "POST", "/api/v1/teams", aliceToken, map[string]string{"name": "WS Team"})
+	var created struct {
+		Team struct {
+			ID int `json:"id"`
+		} `json:"team"`
+	}
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+
+	resp = doJSON(t, server.URL, "POST", fmt.Sprintf("/api/v1/teams/%d/channels", created.Team.ID), aliceToken, map[string]string{"name": "privado"})
+	var channel struct {
+		ID int `json:"id"`
+	}
+	json.NewDecoder(resp.Body).Decode(&channel)
+	resp.Body.Close()
+
+	// dial devuelve el código de la respuesta al upgrade
+	dial := func(channelID int, token string) int {
+		conn, status := dialChannel(server.URL, channelID, token)
+		if conn != nil {
+			conn.Close()
+		}
+		return status
+	}
+
+	assert.Equal(t, http.StatusSwitchingProtocols, dial(channel.ID, aliceToken))
+	assert.Equal(t, http.StatusForbidden, dial(channel.ID, bobToken), "Bob no es del team")
+	assert.Equal(t, http.StatusForbidden, dial(channel.ID+1000, bobToken), "el canal no existe")
+
+	// Estar en el team no alcanza: hay que estar en el canal
+	assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "POST", fmt.Sprintf("/api/v1/teams/%d/members", created.Team.ID), aliceToken, map[string]int{"user_id": bobID}))
+	assert.Equal(t, http.StatusForbidden, dial(channel.ID, bobToken), "Bob no está en el canal")
+	assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "POST", fmt.Sprintf("/api/v1/channels/%d/members", channel.ID), aliceToken,
+		map[string]interface{}{"user_id": bobID, "role": "user"}))
+	assert.Equal(t, http.StatusSwitchingProtocols, dial(channel.ID, bobToken))
+
+	// Con el team borrado ya no se conecta nadie
+	assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "DELETE", fmt.Sprintf("/api/v1/teams/%d", created.Team.ID), aliceToken, nil))
+	assert.Equal(t, http.StatusForbidden, dial(channel.ID, aliceToken))
+}
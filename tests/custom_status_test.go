@@ -0,0 +1,106 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"toller-server/modules/chat"
+	"toller-server/modules/users"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestCustomStatus valida el alta, la limpieza y el vencimiento del estado
+// personalizado, y que cada cambio llegue por WebSocket a los compañeros de team.
+func TestCustomStatus(t *testing.T) {
+	server, db := setupTestServer(t)
+
+	_, aliceToken := registerAndLogin(t, server.URL, "alice_status", "alice_status@test.com", "password123")
+	bobID, bobToken := registerAndLogin(t, server.URL, "bob_status", "bob_status@test.com", "password123")
+
+	setStatus := func(payload map[string]string) (int, users.User) {
+		resp := doJSON(t, server.URL, "PUT", "/api/v1/users/me/status", bobToken, payload)
+		defer resp.Body.Close()
+		var user users.User
+		json.NewDecoder(resp.Body).Decode(&user)
+		return resp.StatusCode, user
+	}
+
+	resp := doJSON(t, server.URL, "POST", "/api/v1/teams", aliceToken, map[string]string{"name": "Status Team"})
+	var created struct {
+		Team struct {
+			ID int `json:"id"`
+		} `json:"team"`
+	}
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	doJSON(t, server.URL, "POST", fmt.Sprintf("/api/v1/teams/%d/members", created.Team.ID), aliceToken, map[string]int{"user_id": bobID}).Body.Close()
+
+	resp = doJSON(t, server.URL, "POST", fmt.Sprintf("/api/v1/teams/%d/channels", created.Team.ID), aliceToken, map[string]string{"name": "estado"})
+	var channel struct {
+		ID int `json:"id"`
+	}
+	json.NewDecoder(resp.Body).Decode(&channel)
+	resp.Body.Close()
+	aliceConn, status := dialChannel(server.URL, channel.ID, aliceToken)
+	if !assert.Equal(t, http.StatusSwitchingProtocols, status) {
+		return
+	}
+	defer aliceConn.Close()
+	time.Sleep(200 * time.Millisecond)
+
+	// waitStatus lee eventos hasta recibir el estado de Bob con ese texto
+	waitStatus := func(text string) users.CustomStatus {
+		msg := waitEvent(t, aliceConn, fmt.Sprintf("el estado %q", text), func(msg chat.OutgoingMessage) bool {
+			return msg.Type == "custom_status" && int(msg.UserID) == bobID && msg.CustomStatus != nil && msg.CustomStatus.Text == text
+		})
+		return *msg.CustomStatus
+	}
+
+	// 1. Valores inválidos
+	for _, payload := range []map[string]string{
+		{},
+		{"emoji": "no es un emoji", "text": "x"},
+		{"text": strings.Repeat("a", 101)},
+		{"text": "x", "clear_after": "mañana"},
+		{"text": "x", "clear_after": "10s"},
+	} {
+		status, _ := setStatus(payload)
+		assert.Equal(t, http.StatusBadRequest, status, "%v", payload)
+	}
+
+	// 2. Un estado con vencimiento se guarda en el perfil y llega a Alice
+	status, me := setStatus(map[string]string{"emoji": "🌴", "text": "De vacaciones", "clear_after": "4h"})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "🌴", me.Status.Emoji)
+	assert.NotNil(t, me.Status.ExpiresAt)
+	received := waitStatus("De vacaciones")
+	assert.Equal(t, "🌴", received.Emoji)
+
+	// 3. Al vencer lo limpia el barrido y Alice recibe el estado vacío
+	_, err := db.Exec(`UPDATE users SET status_expires_at = NOW() - INTERVAL '1 minute' WHERE id = $1`, bobID)
+	assert.NoError(t, err)
+	testUsersService.ExpireStatuses()
+	cleared := waitStatus("")
+	assert.Empty(t, cleared.Emoji)
+
+	resp = doJSON(t, server.URL, "GET", fmt.Sprintf("/api/v1/users/%d", bobID), aliceToken, nil)
+	var bob users.User
+	json.NewDecoder(resp.Body).Decode(&bob)
+	resp.Body.Close()
+	assert.Empty(t, bob.Status.Text)
+	assert.Nil(t, bob.Status.ExpiresAt)
+
+	// 4. Sin vencimiento queda hasta que se borra a mano
+	status, me = setStatus(map[string]string{"text": "En una reunión"})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Nil(t, me.Status.ExpiresAt)
+	waitStatus("En una reunión")
+
+	assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "DELETE", "/api/v1/users/me/status", bobToken, nil))
+	waitStatus("")
+}
@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"toller-server/modules/channels"
+	"toller-server/modules/teams"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestDefaultChannels valida que cada team arranque con #general, que los
+// miembros nuevos entren a los canales por defecto y el backfill al marcar uno.
+func TestDefaultChannels(t *testing.T) {
+	server, _ := setupTestServer(t)
+
+	_, aliceToken := registerAndLogin(t, server.URL, "alice_defch", "alice_defch@test.com", "password123")
+	bobID, bobToken := registerAndLogin(t, server.URL, "bob_defch", "bob_defch@test.com", "password123")
+	carolID, carolToken := registerAndLogin(t, server.URL, "carol_defch", "carol_defch@test.com", "password123")
+	_, daveToken := registerAndLogin(t, server.URL, "dave_defch", "dave_defch@test.com", "password123")
+
+	createChannel := func(base string, payload map[string]interface{}) channels.Channel {
+		resp := doJSON(t, server.URL, "POST", base+"/channels", aliceToken, payload)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		var channel channels.Channel
+		json.NewDecoder(resp.Body).Decode(&channel)
+		return channel
+	}
+
+	resp := doJSON(t, server.URL, "POST", "/api/v1/teams", aliceToken, map[string]string{"name": "Default Channels Team", "visibility": "open"})
+	var created struct {
+		Team teams.Team `json:"team"`
+	}
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	base := fmt.Sprintf("/api/v1/teams/%d", created.Team.ID)
+
+	channelNames := func(token string) []string {
+		resp := doJSON(t, server.URL, "GET", base+"/channels", token, nil)
+		defer resp.Body.Close()
+		var list []channels.ChannelWithRole
+		json.NewDecoder(resp.Body).Decode(&list)
+		names := []string{}
+		for _, ch := range list {
+			names = append(names, ch.Name)
+		}
+		return names
+	}
+
+	// 1. El team arranca con #general, con el creador como admin
+	resp = doJSON(t, server.URL, "GET", base+"/channels", aliceToken, nil)
+	var aliceChannels []channels.ChannelWithRole
+	json.NewDecoder(resp.Body).Decode(&aliceChannels)
+	resp.Body.Close()
+	if assert.Len(t, aliceChannels, 1) {
+		assert.Equal(t, "general", aliceChannels[0].Name)
+		assert.True(t, aliceChannels[0].IsDefault)
+		assert.Equal(t, "admin", aliceChannels[0].UserRole)
+	}
+
+	// 2. Los miembros nuevos entran a los canales por defecto, no a los demás
+	createChannel(base, map[string]interface{}{"name": "privado"})
+	assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "POST", base+"/members", aliceToken, map[string]int{"user_id": bobID}))
+	assert.Equal(t, []string{"general"}, channelNames(bobToken))
+
+	// Solo quien tiene manage_channels en el team crea canales por defecto
+	assert.Equal(t, http.StatusForbidden, statusOf(t, server.URL, "POST", base+"/channels", bobToken,
+		map[string]interface{}{"name": "anuncios", "is_default": true}))
+	announcements := createChannel(base, map[string]interface{}{"name": "anuncios", "is_default": true})
+	assert.True(t, announcements.IsDefault)
+	assert.Equal(t, []string{"general", "anuncios"}, channelNames(bobToken), "un canal por defecto nuevo suma a los miembros actuales")
+
+	// También al entrar por el directorio
+	assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "POST", base+"/join", daveToken, nil))
+	assert.Equal(t, []string{"general", "anuncios"}, channelNames(daveToken))
+
+	// 3. Marcar un canal como por defecto suma a todos los miembros (backfill)
+	random := createChannel(base, map[string]interface{}{"name": "random"})
+	randomPath := fmt.Sprintf("/api/v1/channels/%d", random.ID)
+	assert.Equal(t, http.StatusForbidden, statusOf(t, server.URL, "PUT", randomPath, bobToken, map[string]interface{}{"is_default": true}))
+	assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "PUT", randomPath, aliceToken, map[string]interface{}{"is_default": true}))
+	assert.Equal(t, []string{"general", "anuncios", "random"}, channelNames(bobToken))
+
+	// 4. Al desmarcarlo nadie sale, pero los nuevos ya no entran
+	assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "PUT", randomPath, aliceToken, map[string]interface{}{"is_default": false}))
+	assert.Contains(t, channelNames(bobToken), "random")
+	assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "POST", base+"/members", aliceToken, map[string]int{"user_id": carolID}))
+	assert.Equal(t, []string{"general", "anuncios"}, channelNames(carolToken))
+}
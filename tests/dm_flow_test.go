@@ -89,11 +89,19 @@ func TestDirectMessageFlow(t *testing.T) {
 	msgChan := make(chan []byte, 1)
 	go func() {
 		defer close(msgChan)
-		_, msg, err := userB_Conn.ReadMessage()
-		if err != nil {
+		// Los eventos de presencia no son mensajes: se saltean
+		for {
+			_, msg, err := userB_Conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var out chat.OutgoingMessage
+			if json.Unmarshal(msg, &out) == nil && out.Type == "presence" {
+				continue
+			}
+			msgChan <- msg
 			return
 		}
-		msgChan <- msg
 	}()
 
 	userA_ConnURL := fmt.Sprintf("%s/ws/channel/%d?token=%s", wsURL, channelID_AB, userA_Token)
@@ -0,0 +1,38 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestEmailVerificationFlow valida el email de verificación enviado al registrarse.
+func TestEmailVerificationFlow(t *testing.T) {
+	server, _ := setupTestServer(t)
+
+	registerAndLogin(t, server.URL, "verify_user", "verify_user@test.com", "password123")
+
+	// 1. Reenviar genera un token nuevo e invalida el anterior
+	firstToken := tokenFromEmail(t, lastEmailTo(t, "verify_user@test.com"))
+	assert.Equal(t, http.StatusAccepted, statusOf(t, server.URL, "POST", "/api/v1/auth/verify/resend", "", map[string]string{"email": "verify_user@test.com"}))
+	token := tokenFromEmail(t, lastEmailTo(t, "verify_user@test.com"))
+	assert.NotEqual(t, firstToken, token)
+
+	assert.Equal(t, http.StatusBadRequest, statusOf(t, server.URL, "GET", "/api/v1/auth/verify?token="+firstToken, "", nil), "El token anterior ya no debería servir")
+
+	// 2. Verificar con el token vigente
+	assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "POST", "/api/v1/auth/verify", "", map[string]string{"token": token}))
+
+	// 3. El login refleja el email verificado
+	resp := doJSON(t, server.URL, "POST", "/api/v1/auth/login", "", map[string]string{"email": "verify_user@test.com", "password": "password123"})
+	var loginResp struct {
+		User struct {
+			EmailVerified bool `json:"email_verified"`
+		} `json:"user"`
+	}
+	json.NewDecoder(resp.Body).Decode(&loginResp)
+	resp.Body.Close()
+	assert.True(t, loginResp.User.EmailVerified)
+}
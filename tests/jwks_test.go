@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+type testJWKS struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Alg string `json:"alg"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	} `json:"keys"`
+}
+
+func fetchJWKS(t *testing.T, serverURL string) testJWKS {
+	resp := doJSON(t, serverURL, "GET", "/.well-known/jwks.json", "", nil)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var set testJWKS
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&set))
+	return set
+}
+
+// TestJWKSValidatesAccessTokens valida que otro servicio pueda verificar nuestros tokens
+// solo con el JWKS público, y que la rotación publique la clave nueva sin invalidar la anterior.
+func TestJWKSValidatesAccessTokens(t *testing.T) {
+	server, _ := setupTestServer(t)
+	_, token := registerAndLogin(t, server.URL, "jwks_user", "jwks_user@test.com", "password123")
+
+	// Verificar como lo haría un servicio externo
+	verify := func(set testJWKS, tokenString string) (*jwt.Token, error) {
+		return jwt.Parse(tokenString, func(tk *jwt.Token) (interface{}, error) {
+			for _, k := range set.Keys {
+				if k.Kid != tk.Header["kid"] || k.Kty != "RSA" {
+					continue
+				}
+				n, _ := base64.RawURLEncoding.DecodeString(k.N)
+				e, _ := base64.RawURLEncoding.DecodeString(k.E)
+				return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+			}
+			return nil, jwt.ErrTokenUnverifiable
+		}, jwt.WithValidMethods([]string{"RS256"}))
+	}
+
+	set := fetchJWKS(t, server.URL)
+	assert.NotEmpty(t, set.Keys)
+	parsed, err := verify(set, token)
+	assert.NoError(t, err)
+	assert.True(t, parsed.Valid)
+	oldKid := parsed.Header["kid"]
+
+	// Rotar: la clave nueva se publica de inmediato pero todavía no firma
+	assert.NoError(t, testKeyRing.Rotate())
+	rotated := fetchJWKS(t, server.URL)
+	assert.Equal(t, len(set.Keys)+1, len(rotated.Keys))
+
+	_, err = verify(rotated, token)
+	assert.NoError(t, err, "los tokens firmados con la clave anterior siguen siendo válidos")
+
+	_, fresh := registerAndLogin(t, server.URL, "jwks_user2", "jwks_user2@test.com", "password123")
+	parsed, err = verify(rotated, fresh)
+	assert.NoError(t, err)
+	assert.Equal(t, oldKid, parsed.Header["kid"])
+
+	// Un token HS256 sin kid no se acepta si no hay secreto legado configurado
+	legacy, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": 1,
+		"sid":     1,
+		"exp":     time.Now().Add(time.Minute).Unix(),
+	}).SignedString([]byte("cualquier-secreto"))
+	assert.Equal(t, http.StatusUnauthorized, statusOf(t, server.URL, "GET", "/api/v1/auth/sessions", legacy, nil))
+}
@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"toller-server/modules/auth"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestLoginLockout valida los errores genéricos, el bloqueo tras varios fallos
+// y que los admins del team vean el bloqueo.
+func TestLoginLockout(t *testing.T) {
+	server, _ := setupTestServer(t)
+
+	_, adminToken := registerAndLogin(t, server.URL, "lock_admin", "lock_admin@test.com", "password123")
+	victimID, _ := registerAndLogin(t, server.URL, "lock_victim", "lock_victim@test.com", "password123")
+
+	login := func(email, password string) (int, string) {
+		resp := doJSON(t, server.URL, "POST", "/api/v1/auth/login", "", map[string]string{"email": email, "password": password})
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(msg)
+	}
+
+	// 1. Email inexistente y contraseña incorrecta responden exactamente igual
+	status1, msg1 := login("nadie@test.com", "password123")
+	status2, msg2 := login("lock_victim@test.com", "incorrecta")
+	assert.Equal(t, http.StatusUnauthorized, status1)
+	assert.Equal(t, status1, status2)
+	assert.Equal(t, msg1, msg2)
+
+	// 2. Al llegar al límite la cuenta queda bloqueada, incluso con la contraseña correcta
+	max := testAuthService.Throttle.MaxAccountFailures
+	for i := 1; i < max; i++ {
+		status, _ := login("lock_victim@test.com", "incorrecta")
+		assert.Equal(t, http.StatusUnauthorized, status)
+	}
+	status, _ := login("lock_victim@test.com", "password123")
+	assert.Equal(t, http.StatusTooManyRequests, status)
+
+	// Un email inexistente también se bloquea, así el bloqueo no revela qué cuentas existen
+	for i := 1; i < max; i++ {
+		login("nadie@test.com", "otra")
+	}
+	status, _ = login("nadie@test.com", "otra")
+	assert.Equal(t, http.StatusTooManyRequests, status)
+
+	// 3. Los admins del team del usuario ven el bloqueo
+	resp := doJSON(t, server.URL, "POST", "/api/v1/teams", adminToken, map[string]string{"name": "Lock Team"})
+	var created struct {
+		Team struct {
+			ID int `json:"id"`
+		} `json:"team"`
+	}
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "POST", fmt.Sprintf("/api/v1/teams/%d/members", created.Team.ID), adminToken, map[string]int{"user_id": victimID}))
+
+	resp = doJSON(t, server.URL, "GET", fmt.Sprintf("/api/v1/teams/%d/lockouts", created.Team.ID), adminToken, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var lockouts []struct {
+		UserID         int  `json:"user_id"`
+		FailedAttempts int  `json:"failed_attempts"`
+		Active         bool `json:"active"`
+	}
+	json.NewDecoder(resp.Body).Decode(&lockouts)
+	resp.Body.Close()
+	if assert.Len(t, lockouts, 1) {
+		assert.Equal(t, victimID, lockouts[0].UserID)
+		assert.Equal(t, max, lockouts[0].FailedAttempts)
+		assert.True(t, lockouts[0].Active)
+	}
+}
+
+// TestLoginLockoutIgnoresForwardedFor valida que un X-Forwarded-For inventado
+// no cambie la IP ni impida registrar los fallos.
+func TestLoginLockoutIgnoresForwardedFor(t *testing.T) {
+	server, _ := setupTestServer(t)
+
+	registerAndLogin(t, server.URL, "spoof_victim", "spoof_victim@test.com", "password123")
+
+	login := func(password, forwardedFor string) int {
+		req := jsonRequest(server.URL, "POST", "/api/v1/auth/login", "", map[string]string{"email": "spoof_victim@test.com", "password": password})
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		resp := send(t, req)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	max := testAuthService.Throttle.MaxAccountFailures
+	for i := 0; i < max; i++ {
+		assert.Equal(t, http.StatusUnauthorized, login("incorrecta", fmt.Sprintf("%d.%s", i, strings.Repeat("x", 60))))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, login("password123", "203.0.113.7"))
+}
+
+// TestTrustedProxiesClientInfo valida de dónde sale la IP del cliente con y sin proxies de confianza.
+func TestTrustedProxiesClientInfo(t *testing.T) {
+	request := func(remoteAddr string, forwardedFor ...string) *http.Request {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = remoteAddr
+		for _, v := range forwardedFor {
+			r.Header.Add("X-Forwarded-For", v)
+		}
+		return r
+	}
+
+	// Sin proxies configurados manda siempre la conexión
+	var none auth.TrustedProxies
+	assert.Equal(t, "198.51.100.4", none.ClientInfo(request("198.51.100.4:5000", "203.0.113.7")).IPAddress)
+
+	proxies, err := auth.ParseTrustedProxies("10.0.0.0/8, 192.0.2.1")
+	assert.NoError(t, err)
+
+	// Detrás del proxy cuenta el último salto que no es de confianza
+	assert.Equal(t, "203.0.113.7", proxies.ClientInfo(request("10.1.2.3:5000", "1.2.3.4, 203.0.113.7, 192.0.2.1")).IPAddress)
+	assert.Equal(t, "203.0.113.7", proxies.ClientInfo(request("10.1.2.3:5000", "1.2.3.4", "203.0.113.7")).IPAddress)
+	// Un valor que no es una IP no se usa
+	assert.Equal(t, "10.1.2.3", proxies.ClientInfo(request("10.1.2.3:5000", strings.Repeat("x", 60))).IPAddress)
+	// Desde fuera de los proxies el encabezado se ignora
+	assert.Equal(t, "198.51.100.4", proxies.ClientInfo(request("198.51.100.4:5000", "203.0.113.7")).IPAddress)
+
+	_, err = auth.ParseTrustedProxies("no-es-una-red")
+	assert.Error(t, err)
+}
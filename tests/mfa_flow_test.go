@@ -0,0 +1,139 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"toller-server/modules/auth"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestTOTPCode valida el cálculo contra los vectores de prueba de RFC 6238 (SHA1, 6 dígitos).
+func TestTOTPCode(t *testing.T) {
+	// base32 de "12345678901234567890"
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for ts, want := range vectors {
+		code, err := auth.TOTPCode(secret, time.Unix(ts, 0))
+		assert.NoError(t, err)
+		assert.Equal(t, want, code, "timestamp %d", ts)
+	}
+}
+
+// TestMFALoginFlow valida el alta de 2FA y el login en dos pasos.
+func TestMFALoginFlow(t *testing.T) {
+	server, _ := setupTestServer(t)
+
+	_, token := registerAndLogin(t, server.URL, "mfa_user", "mfa_user@test.com", "password123")
+
+	// 1. Alta: secreto + URI otpauth
+	resp := doJSON(t, server.URL, "POST", "/api/v1/auth/mfa/enroll", token, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var enrollment auth.MFAEnrollment
+	json.NewDecoder(resp.Body).Decode(&enrollment)
+	resp.Body.Close()
+	assert.Contains(t, enrollment.OTPAuthURI, "otpauth://totp/")
+
+	// 2. Confirmar con el código vigente devuelve los códigos de recuperación
+	code, _ := auth.TOTPCode(enrollment.Secret, time.Now())
+	resp = doJSON(t, server.URL, "POST", "/api/v1/auth/mfa/confirm", token, map[string]string{"code": code})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var confirm struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	json.NewDecoder(resp.Body).Decode(&confirm)
+	resp.Body.Close()
+	assert.Len(t, confirm.RecoveryCodes, 10)
+
+	// 3. El login con contraseña ahora devuelve un challenge
+	resp = doJSON(t, server.URL, "POST", "/api/v1/auth/login", "", map[string]string{"email": "mfa_user@test.com", "password": "password123"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var challenge struct {
+		MFARequired    bool   `json:"mfa_required"`
+		ChallengeToken string `json:"challenge_token"`
+		Token          string `json:"token"`
+	}
+	json.NewDecoder(resp.Body).Decode(&challenge)
+	resp.Body.Close()
+	assert.True(t, challenge.MFARequired)
+	assert.Empty(t, challenge.Token)
+
+	// 4. El challenge no sirve como access token
+	assert.Equal(t, http.StatusUnauthorized, statusOf(t, server.URL, "GET", "/api/v1/auth/sessions", challenge.ChallengeToken, nil))
+
+	// 5. Repetir el mismo código TOTP se rechaza
+	assert.Equal(t, http.StatusUnauthorized, statusOf(t, server.URL, "POST", "/api/v1/auth/login/mfa", "", map[string]string{"challenge_token": challenge.ChallengeToken, "code": code}))
+
+	// 6. Un código de recuperación completa el login, y solo una vez
+	recovery := map[string]string{"challenge_token": challenge.ChallengeToken, "recovery_code": confirm.RecoveryCodes[0]}
+	resp = doJSON(t, server.URL, "POST", "/api/v1/auth/login/mfa", "", recovery)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var loginResp struct {
+		Token string `json:"token"`
+	}
+	json.NewDecoder(resp.Body).Decode(&loginResp)
+	resp.Body.Close()
+	assert.NotEmpty(t, loginResp.Token)
+
+	assert.Equal(t, http.StatusUnauthorized, statusOf(t, server.URL, "POST", "/api/v1/auth/login/mfa", "", recovery))
+
+	// 7. Desactivar con otro código de recuperación
+	assert.Equal(t, http.StatusNoContent, statusOf(t, server.URL, "POST", "/api/v1/auth/mfa/disable", loginResp.Token, map[string]string{"recovery_code": confirm.RecoveryCodes[1]}))
+}
+
+// TestMFABruteForce valida que el challenge se invalide tras varios códigos
+// inválidos y que el segundo factor se bloquee igual que el login.
+func TestMFABruteForce(t *testing.T) {
+	server, _ := setupTestServer(t)
+
+	_, token := registerAndLogin(t, server.URL, "mfa_brute", "mfa_brute@test.com", "password123")
+
+	resp := doJSON(t, server.URL, "POST", "/api/v1/auth/mfa/enroll", token, nil)
+	var enrollment auth.MFAEnrollment
+	json.NewDecoder(resp.Body).Decode(&enrollment)
+	resp.Body.Close()
+	code, _ := auth.TOTPCode(enrollment.Secret, time.Now())
+	resp = doJSON(t, server.URL, "POST", "/api/v1/auth/mfa/confirm", token, map[string]string{"code": code})
+	var confirm struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	json.NewDecoder(resp.Body).Decode(&confirm)
+	resp.Body.Close()
+	if !assert.Len(t, confirm.RecoveryCodes, 10) {
+		return
+	}
+
+	resp = doJSON(t, server.URL, "POST", "/api/v1/auth/login", "", map[string]string{"email": "mfa_brute@test.com", "password": "password123"})
+	var challenge struct {
+		ChallengeToken string `json:"challenge_token"`
+	}
+	json.NewDecoder(resp.Body).Decode(&challenge)
+	resp.Body.Close()
+
+	// Un código de hace una hora nunca es válido
+	wrong, _ := auth.TOTPCode(enrollment.Secret, time.Now().Add(-time.Hour))
+	throttle := testAuthService.Throttle
+
+	// 1. Tras MaxChallengeTries códigos inválidos el challenge ya no sirve, ni con un código válido
+	for i := 0; i < throttle.MaxChallengeTries; i++ {
+		assert.Equal(t, http.StatusUnauthorized, statusOf(t, server.URL, "POST", "/api/v1/auth/login/mfa", "",
+			map[string]string{"challenge_token": challenge.ChallengeToken, "code": wrong}))
+	}
+	assert.Equal(t, http.StatusUnauthorized, statusOf(t, server.URL, "POST", "/api/v1/auth/login/mfa", "",
+		map[string]string{"challenge_token": challenge.ChallengeToken, "recovery_code": confirm.RecoveryCodes[0]}))
+
+	// 2. Los fallos siguen contando en los demás usos del 2FA hasta bloquearlo
+	for i := throttle.MaxChallengeTries; i < throttle.MaxMFAFailures; i++ {
+		assert.Equal(t, http.StatusBadRequest, statusOf(t, server.URL, "POST", "/api/v1/auth/mfa/disable", token, map[string]string{"code": wrong}))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, statusOf(t, server.URL, "POST", "/api/v1/auth/mfa/disable", token,
+		map[string]string{"recovery_code": confirm.RecoveryCodes[0]}))
+}
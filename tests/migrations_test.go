@@ -0,0 +1,23 @@
+package tests
+
+import (
+	"testing"
+
+	"toller-server/pkg/migrations"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestEmbeddedMigrations valida que las migraciones embebidas sean consecutivas y reversibles.
+func TestEmbeddedMigrations(t *testing.T) {
+	list, err := migrations.Load()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, list)
+
+	assert.Equal(t, "init", list[0].Name, "001_init debe ser la primera migración")
+	for i, mig := range list {
+		assert.Equal(t, i+1, mig.Version, "las versiones deben ser consecutivas")
+		assert.NotEmpty(t, mig.Up, "la migración %d no tiene script up", mig.Version)
+		assert.NotEmpty(t, mig.Down, "la migración %d no tiene script down", mig.Version)
+	}
+}
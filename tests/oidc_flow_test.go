@@ -0,0 +1,207 @@
+package tests
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"toller-server/modules/auth"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockIdP es un proveedor OpenID Connect mínimo: discovery, JWKS y token endpoint.
+type mockIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	// Lo que el test espera recibir y lo que el IdP responde en el id_token
+	challenge     string
+	nonce         string
+	subject       string
+	email         string
+	emailVerified bool
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	idp := &mockIdP{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "mock-key",
+				"use": "sig",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != "toller" || secret != "s3cret" || r.FormValue("code") != "valid-code" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		// PKCE: el verifier tiene que corresponder al challenge de la URL de autorización
+		sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(sum[:]) != idp.challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":            idp.server.URL,
+			"aud":            "toller",
+			"sub":            idp.subject,
+			"exp":            time.Now().Add(time.Minute).Unix(),
+			"iat":            time.Now().Unix(),
+			"nonce":          idp.nonce,
+			"email":          idp.email,
+			"email_verified": idp.emailVerified,
+		})
+		token.Header["kid"] = "mock-key"
+		signed, _ := token.SignedString(key)
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "opaque", "token_type": "Bearer", "id_token": signed})
+	})
+
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// TestOIDCLoginFlow valida el login con un IdP externo: alta automática, relogin,
+// state de un solo uso y conflicto con una cuenta existente no verificada por el IdP.
+func TestOIDCLoginFlow(t *testing.T) {
+	server, _ := setupTestServer(t)
+	idp := newMockIdP(t)
+	testAuthService.OIDCProviders["mock"] = auth.NewOIDCProvider(auth.OIDCConfig{
+		Name:         "mock",
+		Issuer:       idp.server.URL,
+		ClientID:     "toller",
+		ClientSecret: "s3cret",
+		RedirectURL:  server.URL + "/api/v1/auth/oidc/mock/callback",
+	})
+
+	// No seguir redirecciones para poder inspeccionar la URL del IdP
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	// startLogin devuelve el state y prepara el IdP con el nonce y challenge recibidos
+	startLogin := func() string {
+		resp, err := client.Get(server.URL + "/api/v1/auth/oidc/mock/login")
+		assert.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusFound, resp.StatusCode)
+
+		location, err := url.Parse(resp.Header.Get("Location"))
+		assert.NoError(t, err)
+		q := location.Query()
+		assert.Equal(t, idp.server.URL+"/authorize", location.Scheme+"://"+location.Host+location.Path)
+		assert.Equal(t, "S256", q.Get("code_challenge_method"))
+		assert.Equal(t, "code", q.Get("response_type"))
+
+		idp.challenge = q.Get("code_challenge")
+		idp.nonce = q.Get("nonce")
+		return q.Get("state")
+	}
+	callback := func(state, code string) *http.Response {
+		resp, err := client.Get(server.URL + "/api/v1/auth/oidc/mock/callback?state=" + url.QueryEscape(state) + "&code=" + code)
+		assert.NoError(t, err)
+		return resp
+	}
+
+	idp.subject, idp.email, idp.emailVerified = "idp-user-1", "oidc.person@test.com", true
+
+	// 1. Primer login: se crea la cuenta
+	state := startLogin()
+	resp := callback(state, "valid-code")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var login struct {
+		Token string `json:"token"`
+		User  struct {
+			ID            int    `json:"id"`
+			Username      string `json:"username"`
+			EmailVerified bool   `json:"email_verified"`
+		} `json:"user"`
+	}
+	json.NewDecoder(resp.Body).Decode(&login)
+	resp.Body.Close()
+	assert.NotEmpty(t, login.Token)
+	assert.Equal(t, "oidc.person", login.User.Username)
+	assert.True(t, login.User.EmailVerified)
+
+	// El access token funciona en rutas protegidas
+	assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "GET", "/api/v1/auth/sessions", login.Token, nil))
+
+	// 2. El state es de un solo uso
+	resp = callback(state, "valid-code")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// 3. Un segundo login con la misma identidad entra a la misma cuenta
+	resp = callback(startLogin(), "valid-code")
+	var again struct {
+		User struct {
+			ID int `json:"id"`
+		} `json:"user"`
+	}
+	json.NewDecoder(resp.Body).Decode(&again)
+	resp.Body.Close()
+	assert.Equal(t, login.User.ID, again.User.ID)
+
+	// 4. Un code que el IdP rechaza no loguea
+	resp = callback(startLogin(), "wrong-code")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// 5. Un nonce que no coincide invalida el id_token
+	state = startLogin()
+	idp.nonce = "otro-nonce"
+	resp = callback(state, "valid-code")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// 6. Un email ya registrado que el IdP no verificó no se vincula
+	registerAndLogin(t, server.URL, "local_user", "local@test.com", "password123")
+	idp.subject, idp.email, idp.emailVerified = "idp-user-2", "local@test.com", false
+	resp = callback(startLogin(), "valid-code")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	// 7. Si el IdP lo verificó, la identidad se vincula a la cuenta existente
+	idp.emailVerified = true
+	resp = callback(startLogin(), "valid-code")
+	var linked struct {
+		User struct {
+			Username string `json:"username"`
+		} `json:"user"`
+	}
+	json.NewDecoder(resp.Body).Decode(&linked)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "local_user", linked.User.Username)
+
+	// 8. Proveedor desconocido
+	assert.Equal(t, http.StatusNotFound, statusOf(t, server.URL, "GET", "/api/v1/auth/oidc/nope/login", "", nil))
+}
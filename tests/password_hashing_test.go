@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"toller-server/modules/auth"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// TestArgon2idHasher valida el formato PHC, la compatibilidad con bcrypt y cuándo hace falta rehashear.
+func TestArgon2idHasher(t *testing.T) {
+	weak := &auth.Argon2idHasher{Memory: 8 * 1024, Iterations: 1, Parallelism: 1}
+	strong := &auth.Argon2idHasher{Memory: 16 * 1024, Iterations: 2, Parallelism: 1}
+
+	hash, err := weak.Hash("clave-segura-123")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=8192,t=1,p=1$"))
+	assert.True(t, weak.Verify(hash, "clave-segura-123"))
+	assert.False(t, weak.Verify(hash, "otra-clave"))
+
+	// Los parámetros viajan en el hash: un hasher más fuerte lo sigue verificando y pide rehashear
+	assert.True(t, strong.Verify(hash, "clave-segura-123"))
+	assert.True(t, strong.NeedsRehash(hash))
+	assert.False(t, weak.NeedsRehash(hash))
+
+	legacy, _ := bcrypt.GenerateFromPassword([]byte("clave-vieja"), bcrypt.MinCost)
+	assert.True(t, weak.Verify(string(legacy), "clave-vieja"))
+	assert.True(t, weak.NeedsRehash(string(legacy)))
+
+	// Las cuentas sin contraseña local nunca coinciden
+	assert.False(t, weak.Verify("!oidc", "!oidc"))
+	assert.False(t, weak.NeedsRehash("!oidc"))
+}
+
+// TestPasswordPolicyAndRehash valida la política al registrarse y que los hashes
+// bcrypt se migren a argon2id en el primer login exitoso.
+func TestPasswordPolicyAndRehash(t *testing.T) {
+	server, db := setupTestServer(t)
+
+	blocklist := filepath.Join(t.TempDir(), "breached.txt")
+	os.WriteFile(blocklist, []byte("# top filtradas\nqwerty123\nPassword1!\n"), 0o600)
+	assert.NoError(t, testAuthService.PasswordPolicy.LoadBlocklist(blocklist))
+
+	register := func(password string) int {
+		return statusOf(t, server.URL, "POST", "/api/v1/auth/register", "",
+			map[string]string{"username": "policy_user", "email": "policy_user@test.com", "password": password})
+	}
+	assert.Equal(t, http.StatusBadRequest, register("corta"))
+	assert.Equal(t, http.StatusBadRequest, register("QWERTY123"), "la lista de filtradas no distingue mayúsculas")
+	assert.Equal(t, http.StatusCreated, register("una-clave-decente"))
+
+	// Un usuario con hash bcrypt (de antes del cambio) se migra al loguearse
+	userID, _ := registerAndLogin(t, server.URL, "legacy_user", "legacy_user@test.com", "password123")
+	legacy, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	_, err := db.Exec(`UPDATE users SET password = $1 WHERE id = $2`, string(legacy), userID)
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "POST", "/api/v1/auth/login", "",
+		map[string]string{"email": "legacy_user@test.com", "password": "password123"}))
+
+	var stored string
+	assert.NoError(t, db.QueryRow(`SELECT password FROM users WHERE id = $1`, userID).Scan(&stored))
+	assert.True(t, strings.HasPrefix(stored, "$argon2id$"), "el hash bcrypt debería haberse reemplazado")
+	assert.True(t, testAuthService.Passwords.Verify(stored, "password123"))
+}
@@ -0,0 +1,38 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPasswordResetFlow valida el pedido de recuperación, el cambio de contraseña y la revocación de sesiones.
+func TestPasswordResetFlow(t *testing.T) {
+	server, _ := setupTestServer(t)
+
+	_, oldToken := registerAndLogin(t, server.URL, "reset_user", "reset_user@test.com", "password123")
+
+	// 1. Un email inexistente recibe la misma respuesta
+	assert.Equal(t, http.StatusAccepted, statusOf(t, server.URL, "POST", "/api/v1/auth/password/forgot", "", map[string]string{"email": "nadie@test.com"}))
+
+	// 2. Pedir la recuperación y leer el token del outbox
+	assert.Equal(t, http.StatusAccepted, statusOf(t, server.URL, "POST", "/api/v1/auth/password/forgot", "", map[string]string{"email": "reset_user@test.com"}))
+	token := tokenFromEmail(t, lastEmailTo(t, "reset_user@test.com"))
+
+	// 3. Cambiar la contraseña
+	reset := map[string]string{"token": token, "password": "nuevaClave456"}
+	assert.Equal(t, http.StatusNoContent, statusOf(t, server.URL, "POST", "/api/v1/auth/password/reset", "", reset))
+
+	// 4. El token es de un solo uso
+	assert.Equal(t, http.StatusBadRequest, statusOf(t, server.URL, "POST", "/api/v1/auth/password/reset", "", reset))
+
+	// 5. Las sesiones anteriores quedaron revocadas
+	assert.Equal(t, http.StatusUnauthorized, statusOf(t, server.URL, "GET", "/api/v1/auth/sessions", oldToken, nil))
+
+	// 6. La contraseña vieja ya no sirve y la nueva sí
+	assert.Equal(t, http.StatusUnauthorized, statusOf(t, server.URL, "POST", "/api/v1/auth/login", "",
+		map[string]string{"email": "reset_user@test.com", "password": "password123"}))
+	assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "POST", "/api/v1/auth/login", "",
+		map[string]string{"email": "reset_user@test.com", "password": "nuevaClave456"}))
+}
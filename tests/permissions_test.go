@@ -0,0 +1,131 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"toller-server/modules/permissions"
+	"toller-server/modules/teams"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPermissions valida los roles personalizados de un team, que nadie pueda
+// dar permisos que no tiene y los overrides de permisos por canal.
+func TestPermissions(t *testing.T) {
+	server, _ := setupTestServer(t)
+
+	_, aliceToken := registerAndLogin(t, server.URL, "alice_perms", "alice_perms@test.com", "password123")
+	bobID, bobToken := registerAndLogin(t, server.URL, "bob_perms", "bob_perms@test.com", "password123")
+	carolID, carolToken := registerAndLogin(t, server.URL, "carol_perms", "carol_perms@test.com", "password123")
+
+	myPermissions := func(path, token string) []string {
+		resp := doJSON(t, server.URL, "GET", path, token, nil)
+		defer resp.Body.Close()
+		var body struct {
+			Permissions []string `json:"permissions"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		return body.Permissions
+	}
+
+	resp := doJSON(t, server.URL, "POST", "/api/v1/teams", aliceToken, map[string]string{"name": "Perms Team"})
+	var created struct {
+		Team teams.Team `json:"team"`
+	}
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	base := fmt.Sprintf("/api/v1/teams/%d", created.Team.ID)
+	statusOf(t, server.URL, "POST", base+"/members", aliceToken, map[string]int{"user_id": bobID})
+	statusOf(t, server.URL, "POST", base+"/members", aliceToken, map[string]int{"user_id": carolID})
+
+	// 1. Permisos efectivos: la dueña tiene todos, un miembro los de por defecto
+	assert.ElementsMatch(t, permissions.All, myPermissions(base+"/permissions", aliceToken))
+	assert.ElementsMatch(t, permissions.MemberDefaults, myPermissions(base+"/permissions", bobToken))
+	assert.Equal(t, http.StatusForbidden, statusOf(t, server.URL, "POST", base+"/invites", bobToken, map[string]string{}))
+
+	// 2. Roles personalizados: solo con manage_roles, con nombre válido y permisos conocidos
+	assert.Equal(t, http.StatusForbidden, statusOf(t, server.URL, "POST", base+"/roles", bobToken,
+		map[string]interface{}{"name": "Moderator", "permissions": []string{"invite_members"}}))
+	assert.Equal(t, http.StatusBadRequest, statusOf(t, server.URL, "POST", base+"/roles", aliceToken,
+		map[string]interface{}{"name": "Admin", "permissions": []string{}}))
+	assert.Equal(t, http.StatusBadRequest, statusOf(t, server.URL, "POST", base+"/roles", aliceToken,
+		map[string]interface{}{"name": "Moderator", "permissions": []string{"fly"}}))
+
+	resp = doJSON(t, server.URL, "POST", base+"/roles", aliceToken, map[string]interface{}{
+		"name": "Moderator", "permissions": []string{"manage_channels", "invite_members", "delete_messages"},
+	})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	var moderator permissions.Role
+	json.NewDecoder(resp.Body).Decode(&moderator)
+	resp.Body.Close()
+	assert.Equal(t, []string{"invite_members", "manage_channels", "delete_messages"}, moderator.Permissions)
+	assert.Equal(t, http.StatusConflict, statusOf(t, server.URL, "POST", base+"/roles", aliceToken,
+		map[string]interface{}{"name": "moderator", "permissions": []string{}}))
+
+	// 3. Con el rol, Bob puede invitar pero no como admin
+	bobRoles := fmt.Sprintf("%s/members/%d/roles", base, bobID)
+	assert.Equal(t, http.StatusForbidden, statusOf(t, server.URL, "PUT", bobRoles, bobToken, map[string][]int{"role_ids": {moderator.ID}}))
+	assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "PUT", bobRoles, aliceToken, map[string][]int{"role_ids": {moderator.ID}}))
+	assert.Contains(t, myPermissions(base+"/permissions", bobToken), "invite_members")
+	assert.Equal(t, http.StatusCreated, statusOf(t, server.URL, "POST", base+"/invites", bobToken, map[string]string{}))
+	assert.Equal(t, http.StatusForbidden, statusOf(t, server.URL, "POST", base+"/invites", bobToken, map[string]string{"role": "admin"}))
+	assert.Equal(t, http.StatusNotFound, statusOf(t, server.URL, "PUT", bobRoles, aliceToken, map[string][]int{"role_ids": {999999}}))
+
+	// 4. Nadie da permisos que no tiene
+	resp = doJSON(t, server.URL, "POST", base+"/roles", aliceToken, map[string]interface{}{"name": "Role Manager", "permissions": []string{"manage_roles"}})
+	var roleManager permissions.Role
+	json.NewDecoder(resp.Body).Decode(&roleManager)
+	resp.Body.Close()
+	statusOf(t, server.URL, "PUT", bobRoles, aliceToken, map[string][]int{"role_ids": {moderator.ID, roleManager.ID}})
+	assert.Equal(t, http.StatusForbidden, statusOf(t, server.URL, "POST", base+"/roles", bobToken,
+		map[string]interface{}{"name": "Team Manager", "permissions": []string{"manage_team"}}))
+	assert.Equal(t, http.StatusCreated, statusOf(t, server.URL, "POST", base+"/roles", bobToken,
+		map[string]interface{}{"name": "Cleaner", "permissions": []string{"delete_messages"}}))
+
+	// 5. Overrides por canal: un canal de anuncios donde solo Carol puede escribir
+	resp = doJSON(t, server.URL, "POST", base+"/channels", aliceToken, map[string]string{"name": "anuncios"})
+	var channel struct {
+		ID int `json:"id"`
+	}
+	json.NewDecoder(resp.Body).Decode(&channel)
+	resp.Body.Close()
+	channelBase := fmt.Sprintf("/api/v1/channels/%d", channel.ID)
+	statusOf(t, server.URL, "POST", channelBase+"/members", aliceToken, map[string]interface{}{"user_id": carolID, "role": "user"})
+
+	assert.Contains(t, myPermissions(channelBase+"/permissions", carolToken), "send_messages")
+	assert.Equal(t, http.StatusForbidden, statusOf(t, server.URL, "PUT", channelBase+"/overrides", carolToken,
+		map[string]interface{}{"target": "everyone", "deny": []string{"send_messages"}}))
+	assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "PUT", channelBase+"/overrides", aliceToken,
+		map[string]interface{}{"target": "everyone", "deny": []string{"send_messages"}}))
+	assert.NotContains(t, myPermissions(channelBase+"/permissions", carolToken), "send_messages")
+	assert.Contains(t, myPermissions(channelBase+"/permissions", aliceToken), "send_messages", "los admins no se ven afectados")
+
+	assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "PUT", channelBase+"/overrides", aliceToken,
+		map[string]interface{}{"target": "user", "user_id": carolID, "allow": []string{"send_messages"}}))
+	assert.Contains(t, myPermissions(channelBase+"/permissions", carolToken), "send_messages")
+
+	assert.Equal(t, http.StatusBadRequest, statusOf(t, server.URL, "PUT", channelBase+"/overrides", aliceToken,
+		map[string]interface{}{"target": "everyone", "allow": []string{"manage_team"}}))
+	assert.Equal(t, http.StatusBadRequest, statusOf(t, server.URL, "PUT", channelBase+"/overrides", aliceToken,
+		map[string]interface{}{"target": "everyone", "allow": []string{"pin_messages"}, "deny": []string{"pin_messages"}}))
+
+	resp = doJSON(t, server.URL, "GET", channelBase+"/overrides", carolToken, nil)
+	var overrides struct {
+		Overrides []permissions.Override `json:"overrides"`
+	}
+	json.NewDecoder(resp.Body).Decode(&overrides)
+	resp.Body.Close()
+	assert.Len(t, overrides.Overrides, 2)
+
+	// 6. manage_channels vale en todos los canales del team, sin ser admin del canal
+	assert.Equal(t, http.StatusForbidden, statusOf(t, server.URL, "PUT", channelBase, carolToken, map[string]string{"name": "novedades"}))
+	assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "PUT", channelBase, bobToken, map[string]string{"name": "novedades"}))
+
+	// 7. Al borrar el rol, Bob pierde sus permisos
+	assert.Equal(t, http.StatusNoContent, statusOf(t, server.URL, "DELETE", fmt.Sprintf("%s/roles/%d", base, moderator.ID), aliceToken, nil))
+	assert.NotContains(t, myPermissions(base+"/permissions", bobToken), "invite_members")
+	assert.Equal(t, http.StatusForbidden, statusOf(t, server.URL, "POST", base+"/invites", bobToken, map[string]string{}))
+}
@@ -0,0 +1,123 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"toller-server/modules/chat"
+	"toller-server/modules/presence"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPresence valida online/away/offline a partir de las conexiones, los modos
+// manuales y que los cambios lleguen por WebSocket a los compañeros de team.
+func TestPresence(t *testing.T) {
+	server, _ := setupTestServer(t)
+
+	_, aliceToken := registerAndLogin(t, server.URL, "alice_presence", "alice_presence@test.com", "password123")
+	bobID, bobToken := registerAndLogin(t, server.URL, "bob_presence", "bob_presence@test.com", "password123")
+	carolID, _ := registerAndLogin(t, server.URL, "carol_presence", "carol_presence@test.com", "password123")
+
+	lookup := func(token string, ids ...int) map[int]presence.Presence {
+		parts := make([]string, len(ids))
+		for i, id := range ids {
+			parts[i] = fmt.Sprint(id)
+		}
+		resp := doJSON(t, server.URL, "GET", "/api/v1/presence?user_ids="+strings.Join(parts, ","), token, nil)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var list []presence.Presence
+		json.NewDecoder(resp.Body).Decode(&list)
+		result := map[int]presence.Presence{}
+		for _, p := range list {
+			result[p.UserID] = p
+		}
+		return result
+	}
+	// waitPresence espera el evento con el estado indicado del usuario
+	waitPresence := func(conn *websocket.Conn, userID int, status string) {
+		waitEvent(t, conn, fmt.Sprintf("el evento %s de %d", status, userID), func(msg chat.OutgoingMessage) bool {
+			return msg.Type == "presence" && int(msg.UserID) == userID && msg.Status == status
+		})
+	}
+
+	// Alice y Bob comparten un team; Carol no tiene relación con ninguno
+	resp := doJSON(t, server.URL, "POST", "/api/v1/teams", aliceToken, map[string]string{"name": "Presence Team"})
+	var created struct {
+		Team struct {
+			ID int `json:"id"`
+		} `json:"team"`
+	}
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	doJSON(t, server.URL, "POST", fmt.Sprintf("/api/v1/teams/%d/members", created.Team.ID), aliceToken, map[string]int{"user_id": bobID}).Body.Close()
+
+	resp = doJSON(t, server.URL, "POST", fmt.Sprintf("/api/v1/teams/%d/channels", created.Team.ID), aliceToken, map[string]string{"name": "presencia"})
+	var channel struct {
+		ID int `json:"id"`
+	}
+	json.NewDecoder(resp.Body).Decode(&channel)
+	resp.Body.Close()
+	doJSON(t, server.URL, "POST", fmt.Sprintf("/api/v1/channels/%d/members", channel.ID), aliceToken, map[string]interface{}{"user_id": bobID, "role": "user"}).Body.Close()
+
+	// 1. Sin conexiones Bob está offline; a Carol no se la puede consultar
+	before := lookup(aliceToken, bobID, carolID)
+	assert.Equal(t, presence.StatusOffline, before[bobID].Status)
+	assert.NotContains(t, before, carolID)
+
+	aliceConn, status := dialChannel(server.URL, channel.ID, aliceToken)
+	if !assert.Equal(t, http.StatusSwitchingProtocols, status) {
+		return
+	}
+	defer aliceConn.Close()
+	bobConn, status := dialChannel(server.URL, channel.ID, bobToken)
+	if !assert.Equal(t, http.StatusSwitchingProtocols, status) {
+		return
+	}
+
+	// 2. Al conectarse Bob, Alice recibe el cambio
+	waitPresence(aliceConn, bobID, presence.StatusOnline)
+	assert.Equal(t, presence.StatusOnline, lookup(aliceToken, bobID)[bobID].Status)
+
+	// 3. Sin actividad pasa a away, y un heartbeat lo devuelve a online
+	waitPresence(aliceConn, bobID, presence.StatusAway)
+	assert.NoError(t, bobConn.WriteJSON(chat.IncomingMessage{Type: "heartbeat"}))
+	waitPresence(aliceConn, bobID, presence.StatusOnline)
+
+	// 4. Modos manuales: dnd se ve, invisible se ve como offline salvo para uno mismo
+	assert.Equal(t, http.StatusBadRequest, statusOf(t, server.URL, "PUT", "/api/v1/presence/me", bobToken, map[string]string{"mode": "busy"}))
+
+	assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "PUT", "/api/v1/presence/me", bobToken, map[string]string{"mode": presence.ModeDND}))
+	waitPresence(aliceConn, bobID, presence.StatusDND)
+
+	assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "PUT", "/api/v1/presence/me", bobToken, map[string]string{"mode": presence.ModeInvisible}))
+	waitPresence(aliceConn, bobID, presence.StatusOffline)
+	self := lookup(bobToken, bobID)[bobID]
+	assert.Equal(t, presence.StatusInvisible, self.Status)
+	assert.Equal(t, presence.ModeInvisible, self.Mode)
+
+	// 5. El modo se guarda: al reconectarse sigue invisible
+	bobConn.Close()
+	bobConn, status = dialChannel(server.URL, channel.ID, bobToken)
+	if !assert.Equal(t, http.StatusSwitchingProtocols, status) {
+		return
+	}
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, presence.StatusOffline, lookup(aliceToken, bobID)[bobID].Status)
+
+	assert.NoError(t, bobConn.WriteJSON(chat.IncomingMessage{Type: "heartbeat"}))
+	assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "PUT", "/api/v1/presence/me", bobToken, map[string]string{"mode": presence.ModeAuto}))
+	waitPresence(aliceConn, bobID, presence.StatusOnline)
+
+	// 6. Al cerrar la última conexión vuelve a offline
+	bobConn.Close()
+	waitPresence(aliceConn, bobID, presence.StatusOffline)
+
+	assert.Equal(t, http.StatusBadRequest, statusOf(t, server.URL, "GET", "/api/v1/presence", aliceToken, nil))
+}
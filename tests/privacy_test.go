@@ -0,0 +1,156 @@
+package tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"toller-server/modules/dms"
+	"toller-server/modules/privacy"
+	"toller-server/modules/users"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPrivacy valida la exportación de datos personales y la baja de cuenta:
+// confirmación con contraseña, cancelación y anonimización al vencer la gracia.
+func TestPrivacy(t *testing.T) {
+	server, db := setupTestServer(t)
+
+	aliceID, aliceToken := registerAndLogin(t, server.URL, "alice_privacy", "alice_privacy@test.com", "password123")
+	bobID, bobToken := registerAndLogin(t, server.URL, "bob_privacy", "bob_privacy@test.com", "password123")
+
+	// Alice y Bob tienen un DM con un par de mensajes
+	resp := doJSON(t, server.URL, "POST", "/api/v1/dms", aliceToken, map[string]int{"recipient_id": bobID})
+	var dm map[string]int
+	json.NewDecoder(resp.Body).Decode(&dm)
+	resp.Body.Close()
+	channelID := dm["channel_id"]
+	_, err := db.Exec(`INSERT INTO messages (channel_id, user_id, content) VALUES ($1, $2, 'hola bob'), ($1, $3, 'hola alice')`,
+		channelID, aliceID, bobID)
+	assert.NoError(t, err)
+
+	// 1. Exportación: queda pendiente, no se puede pedir otra ni descargar todavía
+	resp = doJSON(t, server.URL, "POST", "/api/v1/privacy/exports", aliceToken, nil)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	var export privacy.Export
+	json.NewDecoder(resp.Body).Decode(&export)
+	resp.Body.Close()
+	assert.Equal(t, privacy.ExportPending, export.Status)
+
+	resp = doJSON(t, server.URL, "POST", "/api/v1/privacy/exports", aliceToken, nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	download := fmt.Sprintf("/api/v1/privacy/exports/%d/download", export.ID)
+	resp = doJSON(t, server.URL, "GET", download, aliceToken, nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	testPrivacy.ProcessExports()
+
+	resp = doJSON(t, server.URL, "GET", fmt.Sprintf("/api/v1/privacy/exports/%d", export.ID), aliceToken, nil)
+	json.NewDecoder(resp.Body).Decode(&export)
+	resp.Body.Close()
+	assert.Equal(t, privacy.ExportReady, export.Status)
+	assert.NotNil(t, export.ExpiresAt)
+
+	// Bob no puede ver ni descargar el archivo de Alice
+	resp = doJSON(t, server.URL, "GET", download, bobToken, nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp = doJSON(t, server.URL, "GET", download, aliceToken, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/zip", resp.Header.Get("Content-Type"))
+	archive, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if !assert.NoError(t, err) {
+		return
+	}
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		assert.NoError(t, err)
+		files[f.Name], _ = io.ReadAll(rc)
+		rc.Close()
+	}
+	for _, name := range []string{"manifest.json", "profile.json", "settings.json", "teams.json", "friends.json", "messages.json"} {
+		assert.Contains(t, files, name)
+	}
+	var profile users.User
+	assert.NoError(t, json.Unmarshal(files["profile.json"], &profile))
+	assert.Equal(t, "alice_privacy@test.com", profile.Email)
+	var messages []privacy.ExportedMessage
+	assert.NoError(t, json.Unmarshal(files["messages.json"], &messages))
+	if assert.Len(t, messages, 1, "solo los mensajes propios") {
+		assert.Equal(t, "hola bob", messages[0].Content)
+		assert.True(t, messages[0].IsDM)
+	}
+
+	// 2. Baja: requiere la contraseña y se puede cancelar durante la gracia
+	resp = doJSON(t, server.URL, "POST", "/api/v1/privacy/deletion", aliceToken, map[string]string{"password": "incorrecta"})
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp = doJSON(t, server.URL, "POST", "/api/v1/privacy/deletion", aliceToken, map[string]string{"password": "password123"})
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	var deletion privacy.Deletion
+	json.NewDecoder(resp.Body).Decode(&deletion)
+	resp.Body.Close()
+	assert.NotNil(t, deletion.ScheduledAt)
+
+	resp = doJSON(t, server.URL, "DELETE", "/api/v1/privacy/deletion", aliceToken, nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp = doJSON(t, server.URL, "DELETE", "/api/v1/privacy/deletion", aliceToken, nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// Sin vencer la gracia, el barrido no toca la cuenta
+	resp = doJSON(t, server.URL, "POST", "/api/v1/privacy/deletion", aliceToken, map[string]string{"password": "password123"})
+	resp.Body.Close()
+	testPrivacy.ProcessDeletions()
+	resp = doJSON(t, server.URL, "GET", "/api/v1/users/me", aliceToken, nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// 3. Vencida la gracia, la cuenta se anonimiza
+	_, err = db.Exec(`UPDATE users SET deletion_scheduled_at = NOW() - INTERVAL '1 minute' WHERE id = $1`, aliceID)
+	assert.NoError(t, err)
+	testPrivacy.ProcessDeletions()
+
+	assert.Equal(t, http.StatusUnauthorized, statusOf(t, server.URL, "GET", "/api/v1/users/me", aliceToken, nil), "las sesiones se revocan")
+	assert.Equal(t, http.StatusUnauthorized, statusOf(t, server.URL, "POST", "/api/v1/auth/login", "",
+		map[string]string{"email": "alice_privacy@test.com", "password": "password123"}))
+
+	// Bob sigue viendo la conversación, con el autor anonimizado
+	resp = doJSON(t, server.URL, "GET", fmt.Sprintf("/api/v1/dms/%d/messages", channelID), bobToken, nil)
+	var history []dms.Message
+	json.NewDecoder(resp.Body).Decode(&history)
+	resp.Body.Close()
+	if assert.Len(t, history, 2) {
+		assert.Equal(t, "hola bob", history[0].Content)
+		assert.Equal(t, "Deleted user", history[0].Author.DisplayName)
+		assert.NotEqual(t, "alice_privacy", history[0].Author.Username)
+	}
+
+	// Y la cuenta ya no aparece en el directorio
+	resp = doJSON(t, server.URL, "GET", "/api/v1/users?"+url.Values{"q": {"Deleted user"}}.Encode(), bobToken, nil)
+	var page users.DirectoryPage
+	json.NewDecoder(resp.Body).Decode(&page)
+	resp.Body.Close()
+	for _, u := range page.Users {
+		assert.NotEqual(t, aliceID, u.ID)
+	}
+
+	// El email queda libre para una cuenta nueva
+	registerAndLogin(t, server.URL, "alice_privacy", "alice_privacy@test.com", "password123")
+}
@@ -0,0 +1,92 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"toller-server/modules/dms"
+	"toller-server/modules/teams"
+	"toller-server/modules/users"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestUserProfiles valida la edición del perfil con PATCH /users/me y que el
+// perfil venga embebido en miembros de teams y en la lista de DMs.
+func TestUserProfiles(t *testing.T) {
+	server, _ := setupTestServer(t)
+	_, aliceToken := registerAndLogin(t, server.URL, "alice_profile", "alice_profile@test.com", "password123")
+	bobID, bobToken := registerAndLogin(t, server.URL, "bob_profile", "bob_profile@test.com", "password123")
+
+	// 1. Valores inválidos se rechazan
+	invalid := []map[string]string{
+		{"timezone": "Mars/Olympus_Mons"},
+		{"locale": "español"},
+		{"avatar_url": "javascript:alert(1)"},
+		{"pronouns": "una descripción de pronombres demasiado larga para el campo"},
+	}
+	for _, payload := range invalid {
+		resp := doJSON(t, server.URL, "PATCH", "/api/v1/users/me", bobToken, payload)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "%v", payload)
+	}
+
+	// 2. Solo cambian los campos enviados
+	resp := doJSON(t, server.URL, "PATCH", "/api/v1/users/me", bobToken, map[string]string{
+		"display_name": "Bob Builder",
+		"timezone":     "America/Argentina/Buenos_Aires",
+		"locale":       "es-AR",
+		"avatar_url":   "https://cdn.example.com/bob.png",
+	})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = doJSON(t, server.URL, "PATCH", "/api/v1/users/me", bobToken, map[string]string{"bio": "Construyo cosas"})
+	var me users.User
+	json.NewDecoder(resp.Body).Decode(&me)
+	resp.Body.Close()
+	assert.Equal(t, "Bob Builder", me.DisplayName)
+	assert.Equal(t, "Construyo cosas", me.Bio)
+	assert.Equal(t, "es-AR", me.Locale)
+
+	// 3. El perfil viene embebido en los miembros del team
+	resp = doJSON(t, server.URL, "POST", "/api/v1/teams", aliceToken, map[string]string{"name": "Profiles Team"})
+	var created struct {
+		Team teams.Team `json:"team"`
+	}
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+
+	resp = doJSON(t, server.URL, "POST", fmt.Sprintf("/api/v1/teams/%d/members", created.Team.ID), aliceToken, map[string]int{"user_id": bobID})
+	resp.Body.Close()
+
+	resp = doJSON(t, server.URL, "GET", fmt.Sprintf("/api/v1/teams/%d/members", created.Team.ID), aliceToken, nil)
+	var members []teams.TeamMember
+	json.NewDecoder(resp.Body).Decode(&members)
+	resp.Body.Close()
+	found := false
+	for _, m := range members {
+		if m.UserID == bobID {
+			found = true
+			assert.Equal(t, "Bob Builder", m.DisplayName)
+			assert.Equal(t, "https://cdn.example.com/bob.png", m.AvatarURL)
+		}
+	}
+	assert.True(t, found, "Bob debería estar entre los miembros")
+
+	// 4. Y en la lista de DMs
+	resp = doJSON(t, server.URL, "POST", "/api/v1/dms", aliceToken, map[string]int{"recipient_id": bobID})
+	resp.Body.Close()
+
+	resp = doJSON(t, server.URL, "GET", "/api/v1/dms", aliceToken, nil)
+	var list []dms.DMChannelInfo
+	json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	if assert.Len(t, list, 1) {
+		assert.Equal(t, bobID, list[0].OtherUser.ID)
+		assert.Equal(t, "Bob Builder", list[0].OtherUser.DisplayName)
+		assert.Equal(t, "America/Argentina/Buenos_Aires", list[0].OtherUser.Timezone)
+	}
+}
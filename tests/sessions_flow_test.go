@@ -0,0 +1,85 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRefreshAndLogoutFlow valida la rotación del refresh token y la revocación de la sesión.
+func TestRefreshAndLogoutFlow(t *testing.T) {
+	server, _ := setupTestServer(t)
+
+	registerAndLogin(t, server.URL, "session_user", "session_user@test.com", "password123")
+
+	// 1. Login para obtener el par de tokens
+	resp := doJSON(t, server.URL, "POST", "/api/v1/auth/login", "", map[string]string{"email": "session_user@test.com", "password": "password123"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var loginResp struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	json.NewDecoder(resp.Body).Decode(&loginResp)
+	resp.Body.Close()
+	assert.NotEmpty(t, loginResp.RefreshToken)
+
+	// 2. Refresh rota el token
+	refreshBody := map[string]string{"refresh_token": loginResp.RefreshToken}
+	resp = doJSON(t, server.URL, "POST", "/api/v1/auth/refresh", "", refreshBody)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var refreshed struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	json.NewDecoder(resp.Body).Decode(&refreshed)
+	resp.Body.Close()
+	assert.NotEqual(t, loginResp.RefreshToken, refreshed.RefreshToken)
+
+	// 3. Reutilizar el refresh token viejo revoca la sesión
+	assert.Equal(t, http.StatusUnauthorized, statusOf(t, server.URL, "POST", "/api/v1/auth/refresh", "", refreshBody))
+	assert.Equal(t, http.StatusUnauthorized, statusOf(t, server.URL, "GET", "/api/v1/friends", refreshed.Token, nil), "La sesión debería estar revocada")
+
+	// 4. Logout revoca la sesión de otro login
+	_, token := registerAndLogin(t, server.URL, "session_user2", "session_user2@test.com", "password123")
+	assert.Equal(t, http.StatusNoContent, statusOf(t, server.URL, "POST", "/api/v1/auth/logout", token, nil))
+	assert.Equal(t, http.StatusUnauthorized, statusOf(t, server.URL, "GET", "/api/v1/friends", token, nil), "El token no debería servir después del logout")
+}
+
+// TestListAndRevokeDeviceSessions valida el listado de sesiones y "cerrar sesión en los demás dispositivos".
+func TestListAndRevokeDeviceSessions(t *testing.T) {
+	server, _ := setupTestServer(t)
+
+	// Dos logins del mismo usuario desde dispositivos distintos
+	_, laptopToken := registerAndLogin(t, server.URL, "devices_user", "devices_user@test.com", "password123")
+	req := jsonRequest(server.URL, "POST", "/api/v1/auth/login", "", map[string]string{"email": "devices_user@test.com", "password": "password123"})
+	req.Header.Set("User-Agent", "toller-mobile/1.0")
+	resp := send(t, req)
+	var phoneLogin map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&phoneLogin)
+	resp.Body.Close()
+	phoneToken := phoneLogin["token"].(string)
+
+	// 1. Listar sesiones desde la laptop
+	resp = doJSON(t, server.URL, "GET", "/api/v1/auth/sessions", laptopToken, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var sessions []map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&sessions)
+	resp.Body.Close()
+	assert.Len(t, sessions, 2)
+	currentCount := 0
+	for _, s := range sessions {
+		if s["current"] == true {
+			currentCount++
+		}
+	}
+	assert.Equal(t, 1, currentCount, "Solo una sesión debería ser la actual")
+
+	// 2. Cerrar sesión en los demás dispositivos
+	assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "POST", "/api/v1/auth/sessions/revoke-others", laptopToken, nil))
+
+	// 3. El token del teléfono ya no sirve, el de la laptop sí
+	assert.Equal(t, http.StatusUnauthorized, statusOf(t, server.URL, "GET", "/api/v1/auth/sessions", phoneToken, nil))
+	assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "GET", "/api/v1/auth/sessions", laptopToken, nil))
+}
@@ -0,0 +1,163 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"toller-server/modules/presence"
+	"toller-server/modules/teams"
+	"toller-server/modules/users"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestTeamDirectory valida la visibilidad de los teams, el directorio, la
+// entrada directa a los teams open y las solicitudes para los discoverable.
+func TestTeamDirectory(t *testing.T) {
+	server, _ := setupTestServer(t)
+
+	aliceID, aliceToken := registerAndLogin(t, server.URL, "alice_dir", "alice_dir@test.com", "password123")
+	bobID, bobToken := registerAndLogin(t, server.URL, "bob_dir", "bob_dir@test.com", "password123")
+	carolID, carolToken := registerAndLogin(t, server.URL, "carol_dir", "carol_dir@test.com", "password123")
+
+	createTeam := func(name, visibility string) teams.Team {
+		resp := doJSON(t, server.URL, "POST", "/api/v1/teams", aliceToken, map[string]string{"name": name, "visibility": visibility})
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		var created struct {
+			Team teams.Team `json:"team"`
+		}
+		json.NewDecoder(resp.Body).Decode(&created)
+		return created.Team
+	}
+	directory := func(token, query string) teams.DirectoryPage {
+		resp := doJSON(t, server.URL, "GET", "/api/v1/teams/directory"+query, token, nil)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var page teams.DirectoryPage
+		json.NewDecoder(resp.Body).Decode(&page)
+		return page
+	}
+	names := func(page teams.DirectoryPage) []string {
+		list := []string{}
+		for _, team := range page.Teams {
+			list = append(list, team.Name)
+		}
+		return list
+	}
+
+	// 1. Visibilidad: privado por defecto y validada
+	private := createTeam("Gophers Privados", "")
+	assert.Equal(t, "private", private.Visibility)
+	assert.Equal(t, http.StatusBadRequest, statusOf(t, server.URL, "POST", "/api/v1/teams", aliceToken,
+		map[string]string{"name": "Raro", "visibility": "secret"}))
+	open := createTeam("Gophers Abiertos", "open")
+	discoverable := createTeam("Gophers Club", "discoverable")
+	createTeam("Rustaceans", "open")
+
+	// 2. El directorio muestra solo los teams visibles, por relevancia
+	assert.Equal(t, []string{"Gophers Abiertos", "Gophers Club", "Rustaceans"}, names(directory(bobToken, "")))
+	if found := names(directory(bobToken, "?q=gophers%20club")); assert.NotEmpty(t, found) {
+		assert.Equal(t, "Gophers Club", found[0], "la coincidencia exacta va primero")
+	}
+	assert.Equal(t, []string{"Gophers Abiertos", "Gophers Club"}, names(directory(bobToken, "?q=goph")))
+	assert.Equal(t, []string{"Rustaceans"}, names(directory(bobToken, "?q=rustacean")))
+
+	first := directory(bobToken, "?limit=2")
+	assert.Len(t, first.Teams, 2)
+	assert.NotEmpty(t, first.NextCursor)
+	second := directory(bobToken, "?limit=2&cursor="+first.NextCursor)
+	assert.Equal(t, []string{"Rustaceans"}, names(second))
+	assert.Empty(t, second.NextCursor)
+	assert.Equal(t, http.StatusBadRequest, statusOf(t, server.URL, "GET", "/api/v1/teams/directory?cursor=basura", bobToken, nil))
+
+	// 3. En un team open se entra directamente; uno privado no admite unirse
+	assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "POST", fmt.Sprintf("/api/v1/teams/%d/join", open.ID), bobToken, nil))
+	assert.Equal(t, http.StatusConflict, statusOf(t, server.URL, "POST", fmt.Sprintf("/api/v1/teams/%d/join", open.ID), bobToken, nil))
+	assert.Equal(t, http.StatusNotFound, statusOf(t, server.URL, "POST", fmt.Sprintf("/api/v1/teams/%d/join", private.ID), bobToken, nil))
+	assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "GET", fmt.Sprintf("/api/v1/teams/%d", open.ID), bobToken, nil))
+	for _, team := range directory(bobToken, "?q=abiertos").Teams {
+		assert.True(t, team.IsMember)
+		assert.Equal(t, 2, team.MemberCount)
+	}
+	// Entrar a un team open no alcanza para ver el email ni la presencia de los miembros
+	resp := doJSON(t, server.URL, "GET", fmt.Sprintf("/api/v1/users/%d", aliceID), bobToken, nil)
+	var alice users.User
+	json.NewDecoder(resp.Body).Decode(&alice)
+	resp.Body.Close()
+	assert.Equal(t, "alice_dir", alice.Username)
+	assert.Empty(t, alice.Email)
+	resp = doJSON(t, server.URL, "GET", fmt.Sprintf("/api/v1/presence?user_ids=%d", aliceID), bobToken, nil)
+	var seen []presence.Presence
+	json.NewDecoder(resp.Body).Decode(&seen)
+	resp.Body.Close()
+	assert.Empty(t, seen)
+	// Tampoco en la lista de miembros; la admin del team sí ve el de Bob
+	emails := func(token string) map[int]string {
+		resp := doJSON(t, server.URL, "GET", fmt.Sprintf("/api/v1/teams/%d/members", open.ID), token, nil)
+		defer resp.Body.Close()
+		var members []teams.TeamMember
+		json.NewDecoder(resp.Body).Decode(&members)
+		list := map[int]string{}
+		for _, m := range members {
+			list[m.UserID] = m.Email
+		}
+		return list
+	}
+	seenByBob := emails(bobToken)
+	assert.Empty(t, seenByBob[aliceID])
+	assert.Equal(t, "bob_dir@test.com", seenByBob[bobID])
+	assert.Equal(t, "bob_dir@test.com", emails(aliceToken)[bobID])
+
+	// 4. En uno discoverable queda una solicitud pendiente
+	joinPath := fmt.Sprintf("/api/v1/teams/%d/join", discoverable.ID)
+	resp = doJSON(t, server.URL, "POST", joinPath, bobToken, map[string]string{"message": "Hola, quiero sumarme"})
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	var bobRequest struct {
+		Request teams.JoinRequest `json:"request"`
+	}
+	json.NewDecoder(resp.Body).Decode(&bobRequest)
+	resp.Body.Close()
+	assert.Equal(t, "pending", bobRequest.Request.Status)
+	assert.Equal(t, http.StatusConflict, statusOf(t, server.URL, "POST", joinPath, bobToken, nil))
+	assert.Equal(t, http.StatusForbidden, statusOf(t, server.URL, "GET", fmt.Sprintf("/api/v1/teams/%d", discoverable.ID), bobToken, nil))
+	if found := directory(bobToken, "?q=club").Teams; assert.NotEmpty(t, found) {
+		assert.True(t, found[0].RequestedJoin)
+	}
+
+	assert.Equal(t, http.StatusAccepted, statusOf(t, server.URL, "POST", joinPath, carolToken, nil))
+
+	// 5. Quien gestiona los miembros ve, aprueba y rechaza las solicitudes
+	requestsPath := fmt.Sprintf("/api/v1/teams/%d/join-requests", discoverable.ID)
+	assert.Equal(t, http.StatusForbidden, statusOf(t, server.URL, "GET", requestsPath, bobToken, nil))
+	resp = doJSON(t, server.URL, "GET", requestsPath, aliceToken, nil)
+	var pending []teams.JoinRequest
+	json.NewDecoder(resp.Body).Decode(&pending)
+	resp.Body.Close()
+	if assert.Len(t, pending, 2) {
+		assert.Equal(t, bobID, pending[0].UserID)
+		assert.Equal(t, "Hola, quiero sumarme", pending[0].Message)
+		assert.Equal(t, "bob_dir", pending[0].User.Username)
+		assert.Equal(t, carolID, pending[1].UserID)
+
+		assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "POST", fmt.Sprintf("%s/%d/approve", requestsPath, pending[0].ID), aliceToken, nil))
+		assert.Equal(t, http.StatusNotFound, statusOf(t, server.URL, "POST", fmt.Sprintf("%s/%d/approve", requestsPath, pending[0].ID), aliceToken, nil))
+		assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "POST", fmt.Sprintf("%s/%d/reject", requestsPath, pending[1].ID), aliceToken, nil))
+	}
+	assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "GET", fmt.Sprintf("/api/v1/teams/%d", discoverable.ID), bobToken, nil))
+	assert.Equal(t, http.StatusForbidden, statusOf(t, server.URL, "GET", fmt.Sprintf("/api/v1/teams/%d", discoverable.ID), carolToken, nil))
+
+	// 6. Una solicitud rechazada se puede repetir y cancelar
+	assert.Equal(t, http.StatusAccepted, statusOf(t, server.URL, "POST", joinPath, carolToken, nil))
+	assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "DELETE", joinPath, carolToken, nil))
+	assert.Equal(t, http.StatusNotFound, statusOf(t, server.URL, "DELETE", joinPath, carolToken, nil))
+
+	// 7. Al volverlo privado desaparece del directorio
+	assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "PUT", fmt.Sprintf("/api/v1/teams/%d", open.ID), aliceToken,
+		map[string]string{"name": "Gophers Abiertos", "visibility": "private"}))
+	assert.NotContains(t, names(directory(carolToken, "")), "Gophers Abiertos")
+	assert.Equal(t, http.StatusBadRequest, statusOf(t, server.URL, "PUT", fmt.Sprintf("/api/v1/teams/%d", open.ID), aliceToken,
+		map[string]string{"name": "Gophers Abiertos", "visibility": "secret"}))
+}
@@ -0,0 +1,177 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"toller-server/modules/teams"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestTeamInvites valida las invitaciones por link (usos y revocación) y por
+// email (solo para esa dirección verificada, reclamadas al verificarla).
+func TestTeamInvites(t *testing.T) {
+	server, _ := setupTestServer(t)
+
+	_, aliceToken := registerAndLogin(t, server.URL, "alice_inv", "alice_inv@test.com", "password123")
+	_, bobToken := registerAndLogin(t, server.URL, "bob_inv", "bob_inv@test.com", "password123")
+	_, carolToken := registerAndLogin(t, server.URL, "carol_inv", "carol_inv@test.com", "password123")
+
+	createInvite := func(teamID int, payload map[string]interface{}) (int, teams.TeamInvite) {
+		resp := doJSON(t, server.URL, "POST", fmt.Sprintf("/api/v1/teams/%d/invites", teamID), aliceToken, payload)
+		defer resp.Body.Close()
+		var invite teams.TeamInvite
+		json.NewDecoder(resp.Body).Decode(&invite)
+		return resp.StatusCode, invite
+	}
+	roleIn := func(token string, teamID int) string {
+		resp := doJSON(t, server.URL, "GET", "/api/v1/teams", token, nil)
+		defer resp.Body.Close()
+		var list []teams.TeamWithRole
+		json.NewDecoder(resp.Body).Decode(&list)
+		for _, team := range list {
+			if team.ID == teamID {
+				return team.UserRole
+			}
+		}
+		return ""
+	}
+
+	resp := doJSON(t, server.URL, "POST", "/api/v1/teams", aliceToken, map[string]string{"name": "Invites Team"})
+	var created struct {
+		Team teams.Team `json:"team"`
+	}
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	teamID := created.Team.ID
+
+	// 1. Validaciones y permisos. El nombre va en el asunto del email: sin saltos de línea
+	assert.Equal(t, http.StatusBadRequest, statusOf(t, server.URL, "POST", "/api/v1/teams", aliceToken,
+		map[string]string{"name": "Equipo\r\nBcc: victima@test.com"}))
+	assert.Equal(t, http.StatusBadRequest, statusOf(t, server.URL, "PUT", fmt.Sprintf("/api/v1/teams/%d", teamID), aliceToken,
+		map[string]string{"name": "Invites Team\nBcc: victima@test.com"}))
+	status, _ := createInvite(teamID, map[string]interface{}{"role": "owner"})
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = createInvite(teamID, map[string]interface{}{"expires_in_hours": 10000})
+	assert.Equal(t, http.StatusBadRequest, status)
+	resp = doJSON(t, server.URL, "POST", fmt.Sprintf("/api/v1/teams/%d/invites", teamID), bobToken, map[string]string{})
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode, "Bob no es admin del team")
+
+	// 2. Link de un solo uso: Bob entra, Carol llega tarde
+	status, link := createInvite(teamID, map[string]interface{}{"max_uses": 1})
+	assert.Equal(t, http.StatusCreated, status)
+	assert.NotEmpty(t, link.Code)
+	assert.Equal(t, "member", link.Role)
+	assert.NotNil(t, link.ExpiresAt)
+
+	resp = doJSON(t, server.URL, "GET", "/api/v1/invites/"+link.Code, bobToken, nil)
+	var preview teams.InvitePreview
+	json.NewDecoder(resp.Body).Decode(&preview)
+	resp.Body.Close()
+	assert.Equal(t, "Invites Team", preview.TeamName)
+	assert.False(t, preview.ForEmail)
+
+	resp = doJSON(t, server.URL, "POST", "/api/v1/invites/"+link.Code+"/accept", bobToken, nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "member", roleIn(bobToken, teamID))
+
+	resp = doJSON(t, server.URL, "POST", "/api/v1/invites/"+link.Code+"/accept", carolToken, nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusGone, resp.StatusCode)
+
+	// 3. Link sin límite revocado: ya no sirve
+	_, open := createInvite(teamID, map[string]interface{}{"role": "admin"})
+	resp = doJSON(t, server.URL, "GET", fmt.Sprintf("/api/v1/teams/%d/invites", teamID), aliceToken, nil)
+	var outstanding []teams.TeamInvite
+	json.NewDecoder(resp.Body).Decode(&outstanding)
+	resp.Body.Close()
+	if assert.Len(t, outstanding, 1, "el link agotado no es una invitación pendiente") {
+		assert.Equal(t, open.ID, outstanding[0].ID)
+	}
+
+	resp = doJSON(t, server.URL, "POST", "/api/v1/invites/"+open.Code+"/accept", bobToken, nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusConflict, resp.StatusCode, "Bob ya es miembro")
+
+	resp = doJSON(t, server.URL, "DELETE", fmt.Sprintf("/api/v1/teams/%d/invites/%d", teamID, open.ID), aliceToken, nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = doJSON(t, server.URL, "POST", "/api/v1/invites/"+open.Code+"/accept", carolToken, nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// 4. Invitación por email a una cuenta existente: solo la acepta esa cuenta
+	status, _ = createInvite(teamID, map[string]interface{}{"email": "bob_inv@test.com"})
+	assert.Equal(t, http.StatusConflict, status, "Bob ya es miembro")
+
+	status, carolInvite := createInvite(teamID, map[string]interface{}{"email": "Carol_Inv@test.com"})
+	assert.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, "carol_inv@test.com", carolInvite.Email)
+	assert.Equal(t, 1, carolInvite.MaxUses)
+	assert.Contains(t, lastEmailTo(t, "carol_inv@test.com"), "code="+carolInvite.Code)
+
+	status, _ = createInvite(teamID, map[string]interface{}{"email": "carol_inv@test.com"})
+	assert.Equal(t, http.StatusConflict, status, "ya hay una invitación pendiente")
+
+	_, daveToken := registerAndLogin(t, server.URL, "dave_inv", "dave_inv@test.com", "password123")
+	resp = doJSON(t, server.URL, "POST", "/api/v1/invites/"+carolInvite.Code+"/accept", daveToken, nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// Con el email sin verificar tampoco, aunque la política de verificación esté apagada
+	resp = doJSON(t, server.URL, "POST", "/api/v1/invites/"+carolInvite.Code+"/accept", carolToken, nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// Al verificarlo, la invitación pendiente se reclama sola
+	verifyEmail(t, server.URL, "carol_inv@test.com")
+	assert.Equal(t, "member", roleIn(carolToken, teamID))
+
+	// Una cuenta ya verificada la acepta con el código
+	verifyEmail(t, server.URL, "dave_inv@test.com")
+	_, daveInvite := createInvite(teamID, map[string]interface{}{"email": "dave_inv@test.com"})
+	resp = doJSON(t, server.URL, "POST", "/api/v1/invites/"+daveInvite.Code+"/accept", daveToken, nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "member", roleIn(daveToken, teamID))
+
+	// 5. Invitación por email a alguien sin cuenta: entra al verificar el email, con el rol invitado
+	status, _ = createInvite(teamID, map[string]interface{}{"email": "erin_inv@test.com", "role": "admin"})
+	assert.Equal(t, http.StatusCreated, status)
+	body := lastEmailTo(t, "erin_inv@test.com")
+	assert.True(t, strings.Contains(body, "Invites Team"))
+	assert.Contains(t, body, "en cuanto lo verifiques", "el mail avisa que hay que verificar el email")
+
+	_, erinToken := registerAndLogin(t, server.URL, "erin_inv", "erin_inv@test.com", "password123")
+	assert.Empty(t, roleIn(erinToken, teamID), "registrarse no alcanza para reclamar la invitación")
+	verifyEmail(t, server.URL, "erin_inv@test.com")
+	assert.Equal(t, "admin", roleIn(erinToken, teamID))
+
+	resp = doJSON(t, server.URL, "GET", fmt.Sprintf("/api/v1/teams/%d/invites", teamID), aliceToken, nil)
+	json.NewDecoder(resp.Body).Decode(&outstanding)
+	resp.Body.Close()
+	assert.Empty(t, outstanding)
+
+	// 6. Si entró al team por otro lado antes de verificar, la invitación queda sin usar
+	frankID, frankToken := registerAndLogin(t, server.URL, "frank_inv", "frank_inv@test.com", "password123")
+	_, frankInvite := createInvite(teamID, map[string]interface{}{"email": "frank_inv@test.com", "role": "admin"})
+	resp = doJSON(t, server.URL, "POST", fmt.Sprintf("/api/v1/teams/%d/members", teamID), aliceToken, map[string]int{"user_id": frankID})
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	verifyEmail(t, server.URL, "frank_inv@test.com")
+	assert.Equal(t, "member", roleIn(frankToken, teamID))
+
+	resp = doJSON(t, server.URL, "GET", fmt.Sprintf("/api/v1/teams/%d/invites", teamID), aliceToken, nil)
+	json.NewDecoder(resp.Body).Decode(&outstanding)
+	resp.Body.Close()
+	if assert.Len(t, outstanding, 1) {
+		assert.Equal(t, frankInvite.ID, outstanding[0].ID)
+		assert.Equal(t, 0, outstanding[0].Uses)
+	}
+}
@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"toller-server/modules/teams"
+	"toller-server/modules/users"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestTeamOwnership valida el dueño del team: transferencia, guardas para que
+// el team no quede sin dueño ni admins, y el borrado con período de gracia.
+func TestTeamOwnership(t *testing.T) {
+	server, db := setupTestServer(t)
+
+	aliceID, aliceToken := registerAndLogin(t, server.URL, "alice_owner", "alice_owner@test.com", "password123")
+	bobID, bobToken := registerAndLogin(t, server.URL, "bob_owner", "bob_owner@test.com", "password123")
+	carolID, carolToken := registerAndLogin(t, server.URL, "carol_owner", "carol_owner@test.com", "password123")
+
+	// El creador queda como dueño
+	resp := doJSON(t, server.URL, "POST", "/api/v1/teams", aliceToken, map[string]string{"name": "Owned Team"})
+	var created struct {
+		Team teams.Team `json:"team"`
+	}
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	teamID := created.Team.ID
+	if assert.NotNil(t, created.Team.OwnerID) {
+		assert.Equal(t, aliceID, *created.Team.OwnerID)
+	}
+	base := fmt.Sprintf("/api/v1/teams/%d", teamID)
+	statusOf(t, server.URL, "POST", base+"/members", aliceToken, map[string]int{"user_id": bobID})
+	statusOf(t, server.URL, "POST", base+"/members", aliceToken, map[string]int{"user_id": carolID})
+
+	// 1. El único admin (la dueña) no puede irse ni degradarse
+	assert.Equal(t, http.StatusConflict, statusOf(t, server.URL, "POST", base+"/leave", aliceToken, nil))
+	assert.Equal(t, http.StatusConflict, statusOf(t, server.URL, "PUT", fmt.Sprintf("%s/members/%d", base, aliceID), aliceToken, map[string]string{"role": "member"}))
+
+	// 2. Cambio de roles por la ruta nueva
+	assert.Equal(t, http.StatusForbidden, statusOf(t, server.URL, "PUT", fmt.Sprintf("%s/members/%d", base, carolID), bobToken, map[string]string{"role": "admin"}))
+	assert.Equal(t, http.StatusBadRequest, statusOf(t, server.URL, "PUT", fmt.Sprintf("%s/members/%d", base, bobID), aliceToken, map[string]string{"role": "owner"}))
+	assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "PUT", fmt.Sprintf("%s/members/%d", base, bobID), aliceToken, map[string]string{"role": "admin"}))
+
+	// 3. Solo la dueña transfiere, y solo a un miembro
+	assert.Equal(t, http.StatusForbidden, statusOf(t, server.URL, "POST", base+"/transfer", bobToken, map[string]int{"user_id": bobID}))
+	_, daveToken := registerAndLogin(t, server.URL, "dave_owner", "dave_owner@test.com", "password123")
+	assert.Equal(t, http.StatusNotFound, statusOf(t, server.URL, "POST", base+"/transfer", aliceToken, map[string]int{"user_id": 999999}))
+	assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "POST", base+"/transfer", aliceToken, map[string]int{"user_id": carolID}))
+
+	resp = doJSON(t, server.URL, "GET", base+"/members", aliceToken, nil)
+	var members []teams.TeamMember
+	json.NewDecoder(resp.Body).Decode(&members)
+	resp.Body.Close()
+	for _, m := range members {
+		switch m.UserID {
+		case carolID:
+			assert.True(t, m.IsOwner)
+			assert.Equal(t, "admin", m.Role, "el nuevo dueño queda como admin")
+		case aliceID:
+			assert.False(t, m.IsOwner)
+			assert.Equal(t, "admin", m.Role)
+		}
+	}
+
+	// Al dueño no lo saca nadie; la ex dueña ahora sí puede irse
+	assert.Equal(t, http.StatusForbidden, statusOf(t, server.URL, "DELETE", fmt.Sprintf("%s/members/%d", base, carolID), bobToken, nil))
+	assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "POST", base+"/leave", aliceToken, nil))
+
+	// 4. Borrado: solo el dueño, el team desaparece y se puede restaurar
+	assert.Equal(t, http.StatusForbidden, statusOf(t, server.URL, "DELETE", base, bobToken, nil))
+	assert.Equal(t, http.StatusForbidden, statusOf(t, server.URL, "DELETE", base, daveToken, nil))
+
+	resp = doJSON(t, server.URL, "DELETE", base, carolToken, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var deleted struct {
+		Team teams.Team `json:"team"`
+	}
+	json.NewDecoder(resp.Body).Decode(&deleted)
+	resp.Body.Close()
+	assert.NotNil(t, deleted.Team.PurgeAt)
+
+	assert.Equal(t, http.StatusForbidden, statusOf(t, server.URL, "GET", base, bobToken, nil), "un team borrado no se ve")
+	// Y ya no cuenta como team compartido: Bob deja de ver el email de Carol
+	resp = doJSON(t, server.URL, "GET", fmt.Sprintf("/api/v1/users/%d", carolID), bobToken, nil)
+	var carol users.User
+	json.NewDecoder(resp.Body).Decode(&carol)
+	resp.Body.Close()
+	assert.Equal(t, "carol_owner", carol.Username)
+	assert.Empty(t, carol.Email)
+	resp = doJSON(t, server.URL, "GET", "/api/v1/teams/deleted", carolToken, nil)
+	var pending []teams.Team
+	json.NewDecoder(resp.Body).Decode(&pending)
+	resp.Body.Close()
+	if assert.Len(t, pending, 1) {
+		assert.Equal(t, teamID, pending[0].ID)
+	}
+
+	assert.Equal(t, http.StatusNotFound, statusOf(t, server.URL, "POST", base+"/restore", bobToken, nil))
+	assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "POST", base+"/restore", carolToken, nil))
+	assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "GET", base, bobToken, nil))
+
+	// 5. Vencida la gracia, el team se purga y ya no se puede restaurar
+	assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "DELETE", base, carolToken, nil))
+	_, err := db.Exec(`UPDATE teams SET purge_at = NOW() - INTERVAL '1 minute' WHERE id = $1`, teamID)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, statusOf(t, server.URL, "POST", base+"/restore", carolToken, nil))
+
+	testTeamsService.PurgeDeletedTeams()
+	var exists bool
+	db.QueryRow(`SELECT EXISTS(SELECT 1 FROM teams WHERE id = $1)`, teamID).Scan(&exists)
+	assert.False(t, exists)
+}
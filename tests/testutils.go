@@ -2,29 +2,62 @@ package tests
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	_ "github.com/lib/pq"
 
+	"toller-server/modules/audit"
 	"toller-server/modules/auth"
 	"toller-server/modules/channels"
 	"toller-server/modules/chat"
 	"toller-server/modules/dms"
 	"toller-server/modules/friends"
+	"toller-server/modules/permissions"
+	"toller-server/modules/presence"
+	"toller-server/modules/privacy"
 	"toller-server/modules/teams"
 	"toller-server/modules/users"
+	"toller-server/pkg/mailer"
+	"toller-server/pkg/migrations"
 
 	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
 
 	"github.com/joho/godotenv"
 )
 
+// testOutbox guarda como archivos los emails que envía el servidor de pruebas
+var testOutbox *mailer.OutboxMailer
+
+// testAuthService permite a cada test ajustar la configuración de auth (p. ej. proveedores OIDC)
+var testAuthService *auth.AuthService
+
+// testPresence es el servicio de presencia del servidor de pruebas
+var testPresence *presence.PresenceService
+
+// testUsersService permite a los tests disparar el vencimiento de estados sin esperar al barrido
+var testUsersService *users.UserService
+
+// testTeamsService permite a los tests purgar los teams borrados sin esperar al barrido
+var testTeamsService *teams.TeamService
+
+// testPrivacy no corre en segundo plano: los tests procesan exportaciones y bajas a mano
+var testPrivacy *privacy.PrivacyService
+
+// testKeyRing es el key ring con el que el servidor de pruebas firma los tokens
+var testKeyRing *auth.KeyRing
+
 // setupTestServer inicializa el servidor y la base de datos para los tests
 func setupTestServer(t *testing.T) (*httptest.Server, *sql.DB) {
 	if err := godotenv.Load("../.env"); err != nil {
@@ -36,46 +69,114 @@ func setupTestServer(t *testing.T) (*httptest.Server, *sql.DB) {
 		log.Fatal("DB_URL no está configurada para el test.")
 	}
 
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		log.Fatal("JWT_SECRET no está configurada para el test.")
-	}
-
 	db, err := sql.Open("postgres", dbURL)
 	if err != nil {
 		log.Fatal("Error al conectar a la DB:", err)
 	}
 
+	migrator, err := migrations.New(db)
+	if err != nil {
+		t.Fatalf("Error al cargar migraciones: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("Error al aplicar migraciones: %v", err)
+	}
+
 	cleanupTables(t, db)
 
+	keyRing := &auth.KeyRing{Repo: &auth.SigningKeyRepository{DB: db}}
+	if err := keyRing.Init(); err != nil {
+		t.Fatalf("Error al inicializar las claves de firma: %v", err)
+	}
+	testKeyRing = keyRing
+
 	// Inicializar handlers
 	authRepo := &auth.UserRepository{DB: db}
-	authService := &auth.AuthService{Repo: authRepo}
+	sessionRepo := &auth.SessionRepository{DB: db}
+	tokenVerifier := &auth.TokenVerifier{
+		Keys:           keyRing,
+		Sessions:       sessionRepo,
+		PersonalTokens: &auth.PersonalTokenRepository{DB: db},
+	}
+	testOutbox = &mailer.OutboxMailer{Dir: t.TempDir()}
+	authService := &auth.AuthService{
+		Repo:           authRepo,
+		Tokens:         tokenVerifier,
+		Sessions:       sessionRepo,
+		Resets:         &auth.PasswordResetRepository{DB: db},
+		Verifications:  &auth.EmailVerificationRepository{DB: db},
+		MFA:            &auth.MFARepository{DB: db},
+		Mailer:         testOutbox,
+		AppURL:         "http://toller.test",
+		OIDCProviders:  map[string]*auth.OIDCProvider{},
+		OIDC:           &auth.OIDCRepository{DB: db},
+		Throttle:       auth.NewLoginThrottle(&auth.LoginAttemptRepository{DB: db}),
+		PersonalTokens: tokenVerifier.PersonalTokens,
+		Bots:           &auth.BotRepository{DB: db},
+		// Parámetros argon2 mínimos para no alargar los tests
+		Passwords:      &auth.Argon2idHasher{Memory: 8 * 1024, Iterations: 1, Parallelism: 1},
+		PasswordPolicy: auth.NewPasswordPolicy(),
+	}
+	// Sin demoras reales entre intentos fallidos para no alargar los tests
+	authService.Throttle.BaseDelay = time.Millisecond
+	testAuthService = authService
 	authHandler := &auth.AuthHandler{Service: authService}
+	jwtMiddleware := auth.NewJWTMiddleware(tokenVerifier, nil)
+
+	auditLog := &audit.AuditLog{Repo: &audit.AuditRepository{DB: db}}
+
+	permissionsRepo := &permissions.PermissionRepository{DB: db}
+	authorizer := &permissions.Authorizer{Repo: permissionsRepo}
+	permissionsHandler := &permissions.PermissionHandler{
+		Service: &permissions.PermissionService{Repo: permissionsRepo, Authz: authorizer, Audit: auditLog},
+	}
 
 	teamsRepo := &teams.TeamRepository{DB: db}
-	teamsService := &teams.TeamService{Repo: teamsRepo}
+	teamsService := &teams.TeamService{Repo: teamsRepo, Authz: authorizer, Audit: auditLog, Accounts: authService, Mailer: testOutbox, AppURL: "http://toller.test"}
+	authService.Invites = teamsService
+	testTeamsService = teamsService
 	teamsHandler := &teams.TeamHandler{Service: teamsService}
 
 	channelsRepo := &channels.ChannelRepository{DB: db}
-	channelsService := &channels.ChannelService{Repo: channelsRepo}
+	channelsService := &channels.ChannelService{Repo: channelsRepo, Authz: authorizer, Audit: auditLog}
 	channelsHandler := &channels.ChannelHandler{Service: channelsService}
+	teamsService.Channels = channelsService
 
 	hub := chat.NewHub()
-	chatHandler := chat.NewHandler(db, jwtSecret, hub)
+	chatHandler := chat.NewHandler(db, tokenVerifier, hub)
+	chatHandler.Authz = authorizer
+
+	// Away al segundo sin actividad para no alargar los tests
+	presenceService := &presence.PresenceService{
+		Repo:      &presence.PresenceRepository{DB: db},
+		Publisher: hub,
+		AwayAfter: time.Second,
+	}
+	presenceCtx, stopPresence := context.WithCancel(context.Background())
+	go presenceService.Run(presenceCtx)
+	chatHandler.Presence = presenceService
+	testPresence = presenceService
 
 	r := mux.NewRouter()
 	r.HandleFunc("/ws/channel/{channel_id}", chatHandler.ServeWS)
-	auth.RegisterRoutes(r, authHandler)
-	teams.RegisterRoutes(r, teamsHandler, auth.JWTMiddleware)
-	channels.RegisterRoutes(r, channelsHandler, auth.JWTMiddleware)
-	dms.RegisterDMSRoutes(r, db)
-	users.RegisterUserRoutes(r, db)
-	friends.RegisterFriendRoutes(r, db)
+	auth.RegisterRoutes(r, authHandler, jwtMiddleware)
+	teams.RegisterRoutes(r, teamsHandler, jwtMiddleware)
+	channels.RegisterRoutes(r, channelsHandler, jwtMiddleware)
+	permissions.RegisterRoutes(r, permissionsHandler, jwtMiddleware)
+	dms.RegisterDMSRoutes(r, db, jwtMiddleware)
+	usersHandler := users.NewUserHandler(db)
+	usersHandler.Service.Publisher = hub
+	testUsersService = usersHandler.Service
+	users.RegisterUserRoutes(r, usersHandler, jwtMiddleware)
+	friends.RegisterFriendRoutes(r, db, jwtMiddleware)
+	presence.RegisterRoutes(r, &presence.PresenceHandler{Service: presenceService}, jwtMiddleware)
+	testPrivacy = privacy.NewPrivacyService(db, usersHandler.Service, authService, t.TempDir())
+	privacy.RegisterRoutes(r, &privacy.PrivacyHandler{Service: testPrivacy}, jwtMiddleware)
 
 	server := httptest.NewServer(r)
 
 	t.Cleanup(func() {
+		stopPresence()
 		server.Close()
 		db.Close()
 	})
@@ -85,13 +186,33 @@ func setupTestServer(t *testing.T) (*httptest.Server, *sql.DB) {
 
 // cleanupTables limpia las tablas relevantes para los tests
 func cleanupTables(t *testing.T, db *sql.DB) {
+	// audit_log es append-only: el trigger rechaza DELETE pero no TRUNCATE
 	_, err := db.Exec(`
+		TRUNCATE audit_log;
+		DELETE FROM channel_permission_overrides;
+		DELETE FROM team_member_roles;
+		DELETE FROM team_roles;
+		DELETE FROM team_join_requests;
+		DELETE FROM team_invites;
+		DELETE FROM data_exports;
+		DELETE FROM user_settings;
 		DELETE FROM friends;
 		DELETE FROM messages;
 		DELETE FROM channel_users;
 		DELETE FROM channels;
 		DELETE FROM user_teams;
 		DELETE FROM teams;
+		DELETE FROM account_lockouts;
+		DELETE FROM login_attempts;
+		DELETE FROM mfa_attempts;
+		DELETE FROM oidc_login_states;
+		DELETE FROM user_identities;
+		DELETE FROM mfa_recovery_codes;
+		DELETE FROM user_mfa;
+		DELETE FROM email_verifications;
+		DELETE FROM password_resets;
+		DELETE FROM sessions;
+		DELETE FROM personal_access_tokens;
 		DELETE FROM users;
 	`)
 	if err != nil {
@@ -132,3 +253,117 @@ func registerAndLogin(t *testing.T, serverURL, username, email, password string)
 
 	return userID, token
 }
+
+// jsonRequest arma un request con el payload codificado en JSON; con token
+// vacío va sin Authorization. Sirve para agregar headers antes de mandarlo.
+func jsonRequest(serverURL, method, path, token string, payload interface{}) *http.Request {
+	body, _ := json.Marshal(payload)
+	req, _ := http.NewRequest(method, serverURL+path, bytes.NewBuffer(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+// doJSON hace un request con el payload codificado en JSON (autenticado si hay token)
+func doJSON(t *testing.T, serverURL, method, path, token string, payload interface{}) *http.Response {
+	return send(t, jsonRequest(serverURL, method, path, token, payload))
+}
+
+// send manda un request armado con jsonRequest
+func send(t *testing.T, req *http.Request) *http.Response {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Error en %s %s: %v", req.Method, req.URL.Path, err)
+	}
+	return resp
+}
+
+// statusOf hace el request con doJSON y devuelve solo el código de respuesta
+func statusOf(t *testing.T, serverURL, method, path, token string, payload interface{}) int {
+	resp := doJSON(t, serverURL, method, path, token, payload)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// dialChannel abre el WebSocket de un canal. Devuelve la conexión (nil si se
+// rechazó) y el código de la respuesta al upgrade.
+func dialChannel(serverURL string, channelID int, token string) (*websocket.Conn, int) {
+	wsURL := "ws" + strings.TrimPrefix(serverURL, "http")
+	conn, resp, err := websocket.DefaultDialer.Dial(fmt.Sprintf("%s/ws/channel/%d?token=%s", wsURL, channelID, token), nil)
+	if resp == nil {
+		return nil, 0
+	}
+	if err != nil {
+		return nil, resp.StatusCode
+	}
+	return conn, resp.StatusCode
+}
+
+// waitEvent lee eventos del WebSocket hasta que uno cumpla match, o falla a los 3 segundos
+func waitEvent(t *testing.T, conn *websocket.Conn, what string, match func(chat.OutgoingMessage) bool) chat.OutgoingMessage {
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	for {
+		var msg chat.OutgoingMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("no llegó %s: %v", what, err)
+		}
+		if match(msg) {
+			return msg
+		}
+	}
+}
+
+// lastEmailTo devuelve el cuerpo del último email enviado a la dirección indicada
+func lastEmailTo(t *testing.T, address string) string {
+	entries, err := os.ReadDir(testOutbox.Dir)
+	if err != nil {
+		t.Fatalf("Error leyendo outbox: %v", err)
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		content, err := os.ReadFile(filepath.Join(testOutbox.Dir, entries[i].Name()))
+		if err != nil {
+			t.Fatalf("Error leyendo email: %v", err)
+		}
+		if strings.Contains(string(content), "To: "+address+"\r\n") {
+			parts := strings.SplitN(string(content), "\r\n\r\n", 2)
+			return parts[len(parts)-1]
+		}
+	}
+	t.Fatalf("No se encontró email para %s", address)
+	return ""
+}
+
+// tokenFromEmail extrae el valor del query param token del primer enlace del email
+func tokenFromEmail(t *testing.T, body string) string {
+	idx := strings.Index(body, "token=")
+	if idx < 0 {
+		t.Fatalf("El email no contiene un token: %s", body)
+	}
+	token := body[idx+len("token="):]
+	if end := strings.IndexAny(token, " \r\n&"); end >= 0 {
+		token = token[:end]
+	}
+	return token
+}
+
+// verifyEmail pide un email de verificación nuevo para la dirección y la verifica con su token
+func verifyEmail(t *testing.T, serverURL, address string) {
+	body, _ := json.Marshal(map[string]string{"email": address})
+	resp, err := http.Post(serverURL+"/api/v1/auth/verify/resend", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("Error pidiendo la verificación: %v", err)
+	}
+	resp.Body.Close()
+
+	body, _ = json.Marshal(map[string]string{"token": tokenFromEmail(t, lastEmailTo(t, address))})
+	resp, err = http.Post(serverURL+"/api/v1/auth/verify", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("Error verificando el email: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Verificación falló: %v", resp.Status)
+	}
+}
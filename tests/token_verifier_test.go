@@ -0,0 +1,54 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"toller-server/modules/auth"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestTokenVerifierSharedByRESTAndWebSocket valida que el middleware REST y el
+// WebSocket acepten y rechacen exactamente los mismos tokens.
+func TestTokenVerifierSharedByRESTAndWebSocket(t *testing.T) {
+	server, _ := setupTestServer(t)
+	userID, token := registerAndLogin(t, server.URL, "verifier_user", "verifier_user@test.com", "password123")
+
+	valid, err := testAuthService.Tokens.Parse(token)
+	assert.NoError(t, err)
+	assert.Equal(t, userID, valid.UserID)
+	assert.Equal(t, "toller", valid.Issuer)
+
+	// Variantes firmadas con la clave correcta pero con claims que no corresponden
+	forge := func(mutate func(c *auth.Claims)) string {
+		claims := testAuthService.Tokens.NewClaims(userID, time.Minute)
+		claims.SessionID = valid.SessionID
+		mutate(&claims)
+		signed, err := testKeyRing.Sign(claims)
+		assert.NoError(t, err)
+		return signed
+	}
+	rejected := map[string]string{
+		"otra audiencia": forge(func(c *auth.Claims) { c.Audience = jwt.ClaimStrings{"otro-servicio"} }),
+		"otro issuer":    forge(func(c *auth.Claims) { c.Issuer = "otro" }),
+		"expirado":       forge(func(c *auth.Claims) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour)) }),
+		"todavía no vale": forge(func(c *auth.Claims) {
+			c.NotBefore = jwt.NewNumericDate(time.Now().Add(time.Hour))
+		}),
+		"challenge de 2FA": forge(func(c *auth.Claims) { c.Purpose = "mfa_challenge" }),
+		"sin sesión":       forge(func(c *auth.Claims) { c.SessionID = 0 }),
+	}
+
+	// Un token válido pasa la autenticación del WebSocket y se rechaza después (403),
+	// porque el usuario no está en el canal 1
+	assert.Equal(t, http.StatusOK, statusOf(t, server.URL, "GET", "/api/v1/auth/sessions", token, nil))
+	assert.Equal(t, http.StatusForbidden, statusOf(t, server.URL, "GET", "/ws/channel/1?token="+token, "", nil))
+
+	for name, tk := range rejected {
+		assert.Equal(t, http.StatusUnauthorized, statusOf(t, server.URL, "GET", "/api/v1/auth/sessions", tk, nil), "REST: %s", name)
+		assert.Equal(t, http.StatusUnauthorized, statusOf(t, server.URL, "GET", "/ws/channel/1?token="+tk, "", nil), "WebSocket: %s", name)
+	}
+}
@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"toller-server/modules/users"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestUserDirectory valida que el directorio oculte emails a desconocidos,
+// ordene por relevancia, pagine con cursor y se pueda acotar a un team.
+func TestUserDirectory(t *testing.T) {
+	server, _ := setupTestServer(t)
+
+	aliceID, aliceToken := registerAndLogin(t, server.URL, "alice_dir", "alice_dir@test.com", "password123")
+	bobID, _ := registerAndLogin(t, server.URL, "bob_dir", "bob_dir@test.com", "password123")
+	carolID, carolToken := registerAndLogin(t, server.URL, "carol_dir", "carol_dir@test.com", "password123")
+	daveID, daveToken := registerAndLogin(t, server.URL, "dave_dir", "dave_dir@test.com", "password123")
+
+	directory := func(token string, params url.Values) (int, users.DirectoryPage) {
+		resp := doJSON(t, server.URL, "GET", "/api/v1/users?"+params.Encode(), token, nil)
+		defer resp.Body.Close()
+		var page users.DirectoryPage
+		json.NewDecoder(resp.Body).Decode(&page)
+		return resp.StatusCode, page
+	}
+
+	// Alice comparte team con Bob y es amiga de Carol; Dave no tiene relación
+	resp := doJSON(t, server.URL, "POST", "/api/v1/teams", aliceToken, map[string]string{"name": "Directory Team"})
+	var created struct {
+		Team struct {
+			ID int `json:"id"`
+		} `json:"team"`
+	}
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	doJSON(t, server.URL, "POST", fmt.Sprintf("/api/v1/teams/%d/members", created.Team.ID), aliceToken, map[string]int{"user_id": bobID}).Body.Close()
+	doJSON(t, server.URL, "POST", "/api/v1/friends/requests", aliceToken, map[string]int{"friend_id": carolID}).Body.Close()
+	doJSON(t, server.URL, "PUT", "/api/v1/friends/requests/"+strconv.Itoa(aliceID), carolToken, map[string]string{"status": "accepted"}).Body.Close()
+
+	// 1. Emails visibles solo para uno mismo, compañeros de team y amigos
+	status, page := directory(aliceToken, url.Values{"q": {"_dir"}})
+	assert.Equal(t, http.StatusOK, status)
+	emails := map[int]string{}
+	for _, u := range page.Users {
+		emails[u.ID] = u.Email
+	}
+	assert.Equal(t, "alice_dir@test.com", emails[aliceID])
+	assert.Equal(t, "bob_dir@test.com", emails[bobID])
+	assert.Equal(t, "carol_dir@test.com", emails[carolID])
+	assert.Contains(t, emails, daveID)
+	assert.Empty(t, emails[daveID], "Dave no comparte nada con Alice")
+
+	// Tampoco se puede buscar a alguien por su email
+	_, page = directory(daveToken, url.Values{"q": {"alice_dir@test.com"}})
+	for _, u := range page.Users {
+		assert.Empty(t, u.Email)
+	}
+
+	// 2. Ranking: exacto > prefijo > substring > similitud, paginado de a 2
+	registerAndLogin(t, server.URL, "mariana", "mariana@test.com", "password123")
+	registerAndLogin(t, server.URL, "anna", "anna@test.com", "password123")
+	registerAndLogin(t, server.URL, "anabel", "anabel@test.com", "password123")
+	registerAndLogin(t, server.URL, "ana", "ana@test.com", "password123")
+
+	var ranked []string
+	params := url.Values{"q": {"ana"}, "limit": {"2"}}
+	for i := 0; i < 5; i++ {
+		status, page = directory(daveToken, params)
+		assert.Equal(t, http.StatusOK, status)
+		assert.LessOrEqual(t, len(page.Users), 2)
+		for _, u := range page.Users {
+			ranked = append(ranked, u.Username)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		params.Set("cursor", page.NextCursor)
+	}
+	assert.Equal(t, []string{"ana", "anabel", "mariana", "anna"}, ranked)
+
+	status, _ = directory(daveToken, url.Values{"cursor": {"no-es-un-cursor"}})
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	// 3. Acotado a un team: solo sus miembros, y solo para miembros
+	status, page = directory(aliceToken, url.Values{"team_id": {strconv.Itoa(created.Team.ID)}})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, page.Users, 2)
+
+	status, _ = directory(daveToken, url.Values{"team_id": {strconv.Itoa(created.Team.ID)}})
+	assert.Equal(t, http.StatusForbidden, status)
+}
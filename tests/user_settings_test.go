@@ -0,0 +1,99 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"toller-server/modules/users"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestUserSettings valida los defaults, las actualizaciones parciales (merge
+// patch) y el rechazo de claves o valores fuera del esquema.
+func TestUserSettings(t *testing.T) {
+	server, _ := setupTestServer(t)
+	_, token := registerAndLogin(t, server.URL, "settings_user", "settings_user@test.com", "password123")
+
+	do := func(method string, payload interface{}) (int, users.Settings) {
+		resp := doJSON(t, server.URL, method, "/api/v1/users/me/settings", token, payload)
+		defer resp.Body.Close()
+		var settings users.Settings
+		json.NewDecoder(resp.Body).Decode(&settings)
+		return resp.StatusCode, settings
+	}
+
+	// 1. Sin cambios devuelve los defaults
+	status, settings := do("GET", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, users.DefaultSettings(), settings)
+
+	// 2. Solo cambian las claves enviadas, también dentro de objetos anidados
+	status, settings = do("PATCH", map[string]interface{}{
+		"theme":         "dark",
+		"notifications": map[string]interface{}{"teams": map[string]string{"12": "mentions"}},
+	})
+	assert.Equal(t, http.StatusOK, status)
+	status, settings = do("PATCH", map[string]interface{}{
+		"notifications": map[string]interface{}{"channels": map[string]string{"40": "none"}},
+		"dnd_schedule":  map[string]interface{}{"enabled": true},
+	})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "dark", settings.Theme)
+	assert.Equal(t, "mentions", settings.Notifications.Teams["12"])
+	assert.Equal(t, "none", settings.Notifications.Channels["40"])
+	assert.True(t, settings.DNDSchedule.Enabled)
+	assert.Equal(t, "22:00", settings.DNDSchedule.Start)
+
+	// null vuelve al default
+	_, settings = do("PATCH", map[string]interface{}{"theme": nil, "notifications": map[string]interface{}{"teams": map[string]interface{}{"12": nil}}})
+	assert.Equal(t, "system", settings.Theme)
+	assert.NotContains(t, settings.Notifications.Teams, "12")
+	assert.Equal(t, "none", settings.Notifications.Channels["40"])
+
+	// 3. Claves desconocidas y valores inválidos se rechazan sin tocar lo guardado
+	for _, patch := range []map[string]interface{}{
+		{"font_size": 14},
+		{"theme": "neon"},
+		{"notifications": map[string]interface{}{"default": "sometimes"}},
+		{"notifications": map[string]interface{}{"teams": map[string]string{"general": "all"}}},
+		{"dnd_schedule": map[string]interface{}{"start": "25:00"}},
+		{"mute_until": "mañana"},
+	} {
+		status, _ := do("PATCH", patch)
+		assert.Equal(t, http.StatusBadRequest, status, "%v", patch)
+	}
+	_, settings = do("GET", nil)
+	assert.Equal(t, "none", settings.Notifications.Channels["40"])
+	assert.True(t, settings.DNDSchedule.Enabled)
+}
+
+// TestNotificationLevel valida la precedencia canal > team > default, el
+// silencio temporal y el horario de no molestar que cruza la medianoche.
+func TestNotificationLevel(t *testing.T) {
+	settings := users.DefaultSettings()
+	settings.Notifications.Default = users.NotifyMentions
+	settings.Notifications.Teams["1"] = users.NotifyNone
+	settings.Notifications.Channels["10"] = users.NotifyAll
+
+	now := time.Date(2025, 10, 1, 23, 30, 0, 0, time.UTC)
+	assert.Equal(t, users.NotifyAll, settings.NotificationLevel(1, 10, now))
+	assert.Equal(t, users.NotifyNone, settings.NotificationLevel(1, 11, now))
+	assert.Equal(t, users.NotifyMentions, settings.NotificationLevel(2, 20, now))
+
+	muteUntil := now.Add(time.Hour)
+	settings.MuteUntil = &muteUntil
+	assert.Equal(t, users.NotifyNone, settings.NotificationLevel(1, 10, now))
+	assert.Equal(t, users.NotifyAll, settings.NotificationLevel(1, 10, now.Add(2*time.Hour)))
+
+	settings.DNDSchedule.Enabled = true
+	assert.True(t, settings.InDND(now, time.UTC))
+	assert.True(t, settings.InDND(now.Add(8*time.Hour), time.UTC)) // 07:30
+	assert.False(t, settings.InDND(now.Add(9*time.Hour), time.UTC))
+	// 23:30 UTC son las 20:30 en Buenos Aires
+	buenosAires, err := time.LoadLocation("America/Argentina/Buenos_Aires")
+	assert.NoError(t, err)
+	assert.False(t, settings.InDND(now, buenosAires))
+}
@@ -20,14 +20,14 @@ func TestUsersFlow(t *testing.T) {
 	_, _ = registerAndLogin(t, server.URL, "userB_users", "userb_users@test.com", "password123")
 
 	// --- 2. Get all users ---
-	req, _ := http.NewRequest("GET", server.URL+"/api/v1/users/", nil)
+	req, _ := http.NewRequest("GET", server.URL+"/api/v1/users", nil)
 	req.Header.Set("Authorization", "Bearer "+userA_Token)
 	resp, err := client.Do(req)
 	assert.NoError(t, err)
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
-	var allUsers []users.User
+	var allUsers users.DirectoryPage
 	json.NewDecoder(resp.Body).Decode(&allUsers)
-	assert.GreaterOrEqual(t, len(allUsers), 2, "Should have at least 2 users")
+	assert.GreaterOrEqual(t, len(allUsers.Users), 2, "Should have at least 2 users")
 	resp.Body.Close()
 
 	// --- 3. Get user by ID ---
@@ -48,9 +48,11 @@ func TestUsersFlow(t *testing.T) {
 	resp, err = client.Do(req)
 	assert.NoError(t, err)
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
-	var searchResult []users.User
+	var searchResult users.DirectoryPage
 	json.NewDecoder(resp.Body).Decode(&searchResult)
-	assert.Len(t, searchResult, 1, "Should find 1 user")
-	assert.Equal(t, "userB_users", searchResult[0].Username)
+	// Fuzzy (trigram) matches such as userA_users may follow, but the prefix match ranks first
+	if assert.NotEmpty(t, searchResult.Users, "Should find userB") {
+		assert.Equal(t, "userB_users", searchResult.Users[0].Username)
+	}
 	resp.Body.Close()
 }
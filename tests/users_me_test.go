@@ -0,0 +1,89 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"toller-server/modules/users"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestUserMeBootstrap valida que /users/me salga del token y traiga teams con
+// rol, no leídos por canal y solicitudes de amistad pendientes.
+func TestUserMeBootstrap(t *testing.T) {
+	server, db := setupTestServer(t)
+	aliceID, aliceToken := registerAndLogin(t, server.URL, "alice_me", "alice_me@test.com", "password123")
+	bobID, bobToken := registerAndLogin(t, server.URL, "bob_me", "bob_me@test.com", "password123")
+
+	getMe := func(token string) users.Me {
+		resp := doJSON(t, server.URL, "GET", "/api/v1/users/me", token, nil)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var me users.Me
+		json.NewDecoder(resp.Body).Decode(&me)
+		return me
+	}
+
+	// Alice crea un team y suma a Bob; Bob le pide amistad y le escribe por DM
+	resp := doJSON(t, server.URL, "POST", "/api/v1/teams", aliceToken, map[string]string{"name": "Me Team"})
+	var created struct {
+		Team struct {
+			ID int `json:"id"`
+		} `json:"team"`
+	}
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	doJSON(t, server.URL, "POST", fmt.Sprintf("/api/v1/teams/%d/members", created.Team.ID), aliceToken, map[string]int{"user_id": bobID}).Body.Close()
+	doJSON(t, server.URL, "POST", "/api/v1/friends/requests", bobToken, map[string]int{"friend_id": aliceID}).Body.Close()
+
+	resp = doJSON(t, server.URL, "POST", "/api/v1/dms", bobToken, map[string]int{"recipient_id": aliceID})
+	var dm struct {
+		ID int `json:"channel_id"`
+	}
+	json.NewDecoder(resp.Body).Decode(&dm)
+	resp.Body.Close()
+	for _, content := range []string{"hola", "¿estás?"} {
+		_, err := db.Exec(`INSERT INTO messages (channel_id, user_id, content) VALUES ($1, $2, $3)`, dm.ID, bobID, content)
+		assert.NoError(t, err)
+	}
+
+	// 1. El payload es el de quien hace la request, con email y estado de la cuenta
+	me := getMe(aliceToken)
+	assert.Equal(t, aliceID, me.ID)
+	assert.Equal(t, "alice_me@test.com", me.Email)
+	assert.False(t, me.Account.MFAEnabled)
+	assert.Equal(t, users.DefaultSettings().Theme, me.Settings.Theme)
+	if assert.Len(t, me.Teams, 1) {
+		assert.Equal(t, created.Team.ID, me.Teams[0].TeamID)
+		assert.Equal(t, "admin", me.Teams[0].Role)
+	}
+	if assert.Len(t, me.PendingFriendRequests, 1) {
+		assert.Equal(t, bobID, me.PendingFriendRequests[0].From.ID)
+	}
+	if assert.Len(t, me.Unread, 1) {
+		assert.Equal(t, dm.ID, me.Unread[0].ChannelID)
+		assert.True(t, me.Unread[0].IsDM)
+		assert.Equal(t, 2, me.Unread[0].Count)
+	}
+
+	// Los mensajes propios no cuentan como no leídos
+	me = getMe(bobToken)
+	assert.Equal(t, bobID, me.ID)
+	assert.Empty(t, me.Unread)
+	assert.Empty(t, me.PendingFriendRequests)
+	if assert.Len(t, me.Teams, 1) {
+		assert.Equal(t, "member", me.Teams[0].Role)
+	}
+
+	// 2. Marcar como leído limpia el contador
+	doJSON(t, server.URL, "POST", fmt.Sprintf("/api/v1/dms/%d/read", dm.ID), aliceToken, nil).Body.Close()
+	assert.Empty(t, getMe(aliceToken).Unread)
+
+	// 3. La ruta vieja con el id en la URL ya no existe
+	resp = doJSON(t, server.URL, "GET", fmt.Sprintf("/api/v1/users/me/%d", bobID), aliceToken, nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}